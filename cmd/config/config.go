@@ -1,24 +1,375 @@
 package config
 
-import "os"
-
-// Global defines the global configuration values
-var Global = struct {
-	PostgresAddress  string
-	PostgresUsername string
-	PostgresPassword string
-	PostgresDatabase string
-}{
-	PostgresAddress:  getEnv("POSTGRES_ADDRESS", "localhost"),
-	PostgresUsername: "postgres",
-	PostgresPassword: "postgres",
-	PostgresDatabase: "risks",
-}
-
-func getEnv(key, defaultVal string) string {
-	value, exists := os.LookupEnv(key)
-	if !exists {
-		return defaultVal
-	}
-	return value
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"gopkg.in/yaml.v3"
+	"io"
+	"log/slog"
+	"net"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// redacted replaces the value of secrets when the configuration is printed
+const redacted = "******"
+
+// Storage backends
+const (
+	StoragePostgres = "postgres"
+	StorageMemory   = "memory"
+	StorageSQLite   = "sqlite"
+)
+
+type (
+	// Config is the configuration of the service, see Load for where it is read from
+	Config struct {
+		// Storage is the backend storing the risks, postgres, sqlite or memory. The memory storage loses the risks
+		// when the service stops, it is meant for demos and tests.
+		Storage  string   `yaml:"storage"`
+		Postgres Postgres `yaml:"postgres"`
+		SQLite   SQLite   `yaml:"sqlite"`
+		HTTP     HTTP     `yaml:"http"`
+		Risks    Risks    `yaml:"risks"`
+		// LogLevel is one of debug, info, warn or error
+		LogLevel string `yaml:"logLevel"`
+	}
+
+	Postgres struct {
+		Host     string `yaml:"host"`
+		Port     int    `yaml:"port"`
+		Username string `yaml:"username"`
+		Password string `yaml:"password"`
+		// PasswordFile is read into Password when set, e.g. a mounted kubernetes or docker secret
+		PasswordFile string `yaml:"passwordFile"`
+		Database     string `yaml:"database"`
+		// SSLMode is one of the libpq sslmode values: disable, allow, prefer, require, verify-ca or verify-full
+		SSLMode         string        `yaml:"sslMode"`
+		ConnectTimeout  time.Duration `yaml:"connectTimeout"`
+		MinConns        int           `yaml:"minConns"`
+		MaxConns        int           `yaml:"maxConns"`
+		MaxConnIdleTime time.Duration `yaml:"maxConnIdleTime"`
+		MaxConnLifetime time.Duration `yaml:"maxConnLifetime"`
+	}
+
+	SQLite struct {
+		// Path is the database file, it is created when it does not exist
+		Path string `yaml:"path"`
+	}
+
+	HTTP struct {
+		ListenAddress   string        `yaml:"listenAddress"`
+		ReadTimeout     time.Duration `yaml:"readTimeout"`
+		WriteTimeout    time.Duration `yaml:"writeTimeout"`
+		IdleTimeout     time.Duration `yaml:"idleTimeout"`
+		ShutdownTimeout time.Duration `yaml:"shutdownTimeout"`
+		// MaxRequestBodyBytes limits the size of request bodies
+		MaxRequestBodyBytes int64 `yaml:"maxRequestBodyBytes"`
+		// GatewaySecret is shared with the gateway in front of the service, the X-Actor header is only trusted on the
+		// requests carrying it in the X-Gateway-Secret header and ignored when it is empty
+		GatewaySecret string `yaml:"gatewaySecret"`
+	}
+
+	Risks struct {
+		// TitleMaxLength and DescriptionMaxLength are in characters
+		TitleMaxLength       int `yaml:"titleMaxLength"`
+		DescriptionMaxLength int `yaml:"descriptionMaxLength"`
+		// TrashRetention is how long deleted risks are kept before they are purged
+		TrashRetention time.Duration `yaml:"trashRetention"`
+		// IdempotencyKeyTTL is how long the risk created with an idempotency key is replayed to retries
+		IdempotencyKeyTTL time.Duration `yaml:"idempotencyKeyTTL"`
+		// BatchMaxOperations limits the number of operations of a batch request
+		BatchMaxOperations int `yaml:"batchMaxOperations"`
+		// ScoreScale is the highest likelihood and impact, they are rated from 1 to ScoreScale
+		ScoreScale int `yaml:"scoreScale"`
+		// SeverityScores are the lowest residual scores of the severities above low
+		SeverityScores SeverityScores `yaml:"severityScores"`
+	}
+
+	SeverityScores struct {
+		Medium   int `yaml:"medium"`
+		High     int `yaml:"high"`
+		Critical int `yaml:"critical"`
+	}
+
+	// setting is a configuration value that can be overridden by an environment variable and a command line flag
+	setting struct {
+		env    string
+		flag   string
+		usage  string
+		value  any
+		secret bool
+	}
+)
+
+// Global is the configuration of the service, it holds the defaults until it is replaced with the loaded configuration
+var Global = Defaults()
+
+// Defaults returns the configuration used when nothing else is configured
+func Defaults() Config {
+	return Config{
+		Storage: StoragePostgres,
+		Postgres: Postgres{
+			Host:            "localhost",
+			Port:            5432,
+			Username:        "postgres",
+			Password:        "postgres",
+			Database:        "risks",
+			SSLMode:         "disable",
+			ConnectTimeout:  5 * time.Second,
+			MinConns:        2,
+			MaxConns:        10,
+			MaxConnIdleTime: 30 * time.Minute,
+			MaxConnLifetime: time.Hour,
+		},
+		SQLite: SQLite{
+			Path: "risks.db",
+		},
+		HTTP: HTTP{
+			ListenAddress:       ":8080",
+			ReadTimeout:         10 * time.Second,
+			WriteTimeout:        30 * time.Second,
+			IdleTimeout:         2 * time.Minute,
+			ShutdownTimeout:     25 * time.Second,
+			MaxRequestBodyBytes: 1 << 20,
+		},
+		Risks: Risks{
+			TitleMaxLength:       255,
+			DescriptionMaxLength: 4096,
+			TrashRetention:       30 * 24 * time.Hour,
+			IdempotencyKeyTTL:    24 * time.Hour,
+			BatchMaxOperations:   1000,
+			ScoreScale:           5,
+			SeverityScores: SeverityScores{
+				Medium:   5,
+				High:     10,
+				Critical: 15,
+			},
+		},
+		LogLevel: "info",
+	}
+}
+
+func (c *Config) settings() []setting {
+	return []setting{
+		{env: "STORAGE", flag: "storage", usage: "storage backend, postgres, sqlite or memory", value: &c.Storage},
+		{env: "POSTGRES_ADDRESS", flag: "postgres-host", usage: "postgres host", value: &c.Postgres.Host},
+		{env: "POSTGRES_PORT", flag: "postgres-port", usage: "postgres port", value: &c.Postgres.Port},
+		{env: "POSTGRES_USERNAME", flag: "postgres-username", usage: "postgres username", value: &c.Postgres.Username},
+		{env: "POSTGRES_PASSWORD", flag: "postgres-password", usage: "postgres password", value: &c.Postgres.Password, secret: true},
+		{env: "POSTGRES_PASSWORD_FILE", flag: "postgres-password-file", usage: "file to read the postgres password from", value: &c.Postgres.PasswordFile},
+		{env: "POSTGRES_DATABASE", flag: "postgres-database", usage: "postgres database", value: &c.Postgres.Database},
+		{env: "POSTGRES_SSL_MODE", flag: "postgres-ssl-mode", usage: "postgres sslmode", value: &c.Postgres.SSLMode},
+		{env: "POSTGRES_CONNECT_TIMEOUT", flag: "postgres-connect-timeout", usage: "timeout of new postgres connections", value: &c.Postgres.ConnectTimeout},
+		{env: "POSTGRES_MIN_CONNS", flag: "postgres-min-conns", usage: "postgres connections kept open when idle", value: &c.Postgres.MinConns},
+		{env: "POSTGRES_MAX_CONNS", flag: "postgres-max-conns", usage: "maximum number of postgres connections", value: &c.Postgres.MaxConns},
+		{env: "POSTGRES_MAX_CONN_IDLE_TIME", flag: "postgres-max-conn-idle-time", usage: "idle time after which postgres connections are closed", value: &c.Postgres.MaxConnIdleTime},
+		{env: "POSTGRES_MAX_CONN_LIFETIME", flag: "postgres-max-conn-lifetime", usage: "age after which postgres connections are replaced", value: &c.Postgres.MaxConnLifetime},
+		{env: "SQLITE_PATH", flag: "sqlite-path", usage: "sqlite database file", value: &c.SQLite.Path},
+		{env: "LISTEN_ADDRESS", flag: "listen-address", usage: "address the HTTP server listens on", value: &c.HTTP.ListenAddress},
+		{env: "HTTP_READ_TIMEOUT", flag: "http-read-timeout", usage: "timeout for reading a request", value: &c.HTTP.ReadTimeout},
+		{env: "HTTP_WRITE_TIMEOUT", flag: "http-write-timeout", usage: "timeout for writing a response", value: &c.HTTP.WriteTimeout},
+		{env: "HTTP_IDLE_TIMEOUT", flag: "http-idle-timeout", usage: "timeout of idle keep-alive connections", value: &c.HTTP.IdleTimeout},
+		{env: "SHUTDOWN_TIMEOUT", flag: "shutdown-timeout", usage: "time given to in-flight requests on shutdown", value: &c.HTTP.ShutdownTimeout},
+		{env: "MAX_REQUEST_BODY_BYTES", flag: "max-request-body-bytes", usage: "maximum size of request bodies", value: &c.HTTP.MaxRequestBodyBytes},
+		{env: "GATEWAY_SECRET", flag: "gateway-secret", usage: "secret the gateway sends with the X-Actor header", value: &c.HTTP.GatewaySecret, secret: true},
+		{env: "RISK_TITLE_MAX_LENGTH", flag: "risk-title-max-length", usage: "maximum length of risk titles", value: &c.Risks.TitleMaxLength},
+		{env: "RISK_DESCRIPTION_MAX_LENGTH", flag: "risk-description-max-length", usage: "maximum length of risk descriptions", value: &c.Risks.DescriptionMaxLength},
+		{env: "TRASH_RETENTION", flag: "trash-retention", usage: "how long deleted risks are kept", value: &c.Risks.TrashRetention},
+		{env: "IDEMPOTENCY_KEY_TTL", flag: "idempotency-key-ttl", usage: "how long idempotency keys are kept", value: &c.Risks.IdempotencyKeyTTL},
+		{env: "BATCH_MAX_OPERATIONS", flag: "batch-max-operations", usage: "maximum number of operations of a batch request", value: &c.Risks.BatchMaxOperations},
+		{env: "RISK_SCORE_SCALE", flag: "risk-score-scale", usage: "highest likelihood and impact of a risk", value: &c.Risks.ScoreScale},
+		{env: "RISK_SEVERITY_MEDIUM_SCORE", flag: "risk-severity-medium-score", usage: "lowest residual score of medium severity risks", value: &c.Risks.SeverityScores.Medium},
+		{env: "RISK_SEVERITY_HIGH_SCORE", flag: "risk-severity-high-score", usage: "lowest residual score of high severity risks", value: &c.Risks.SeverityScores.High},
+		{env: "RISK_SEVERITY_CRITICAL_SCORE", flag: "risk-severity-critical-score", usage: "lowest residual score of critical severity risks", value: &c.Risks.SeverityScores.Critical},
+		{env: "LOG_LEVEL", flag: "log-level", usage: "debug, info, warn or error", value: &c.LogLevel},
+	}
+}
+
+// Load reads the configuration from the args, which are the command line arguments without the program name.
+// Every layer overrides the previous one: the defaults, the YAML file given by the -config flag or the CONFIG_FILE
+// environment variable, the environment variables and finally the flags. The arguments left after the flags are
+// returned, they are the subcommand to run if any.
+func Load(args []string) (Config, []string, error) {
+	cfg := Defaults()
+
+	// the flags are parsed first to find the config file, but they are applied last
+	flags := flag.NewFlagSet("risks", flag.ContinueOnError)
+	configFile := flags.String("config", os.Getenv("CONFIG_FILE"), "YAML config file (env CONFIG_FILE)")
+	flagValues := map[string]string{}
+	for _, s := range cfg.settings() {
+		name := s.flag
+		flags.Func(name, fmt.Sprintf("%s (env %s)", s.usage, s.env), func(value string) error {
+			flagValues[name] = value
+			return nil
+		})
+	}
+	if err := flags.Parse(args); err != nil {
+		return Config{}, nil, err
+	}
+
+	if *configFile != "" {
+		file, err := os.Open(*configFile)
+		if err != nil {
+			return Config{}, nil, fmt.Errorf("error reading config file: %w", err)
+		}
+		defer file.Close()
+		decoder := yaml.NewDecoder(file)
+		decoder.KnownFields(true)
+		if err = decoder.Decode(&cfg); err != nil && !errors.Is(err, io.EOF) {
+			return Config{}, nil, fmt.Errorf("error decoding config file %s: %w", *configFile, err)
+		}
+	}
+
+	var errs []error
+	for _, s := range cfg.settings() {
+		if value, ok := os.LookupEnv(s.env); ok {
+			if err := s.set(value); err != nil {
+				errs = append(errs, fmt.Errorf("invalid %s: %w", s.env, err))
+			}
+		}
+	}
+	for _, s := range cfg.settings() {
+		if value, ok := flagValues[s.flag]; ok {
+			if err := s.set(value); err != nil {
+				errs = append(errs, fmt.Errorf("invalid -%s: %w", s.flag, err))
+			}
+		}
+	}
+	if len(errs) > 0 {
+		return Config{}, nil, errors.Join(errs...)
+	}
+
+	if cfg.Postgres.PasswordFile != "" {
+		password, err := os.ReadFile(cfg.Postgres.PasswordFile)
+		if err != nil {
+			return Config{}, nil, fmt.Errorf("error reading the postgres password file: %w", err)
+		}
+		cfg.Postgres.Password = strings.TrimRight(string(password), "\r\n")
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return Config{}, nil, err
+	}
+	return cfg, flags.Args(), nil
+}
+
+func (s setting) set(value string) error {
+	switch v := s.value.(type) {
+	case *string:
+		*v = value
+	case *int:
+		i, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("%q is not an integer", value)
+		}
+		*v = i
+	case *int64:
+		i, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return fmt.Errorf("%q is not an integer", value)
+		}
+		*v = i
+	case *time.Duration:
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return fmt.Errorf("%q is not a duration like 30s or 1h", value)
+		}
+		*v = d
+	}
+	return nil
+}
+
+// Validate checks the configuration, returning every invalid value at once
+func (c Config) Validate() error {
+	var errs []error
+	check := func(ok bool, format string, args ...any) {
+		if !ok {
+			errs = append(errs, fmt.Errorf(format, args...))
+		}
+	}
+
+	switch c.Storage {
+	case StoragePostgres, StorageSQLite, StorageMemory:
+	default:
+		check(false, "storage must be one of %s, %s or %s but is %q", StoragePostgres, StorageSQLite, StorageMemory, c.Storage)
+	}
+	check(c.Postgres.Host != "", "postgres host is required")
+	check(c.Postgres.Port > 0 && c.Postgres.Port <= 65535, "postgres port must be between 1 and 65535 but is %d", c.Postgres.Port)
+	check(c.Postgres.Username != "", "postgres username is required")
+	check(c.Postgres.Database != "", "postgres database is required")
+	switch c.Postgres.SSLMode {
+	case "disable", "allow", "prefer", "require", "verify-ca", "verify-full":
+	default:
+		check(false, "postgres ssl mode must be one of disable, allow, prefer, require, verify-ca or verify-full but is %q", c.Postgres.SSLMode)
+	}
+	check(c.Postgres.ConnectTimeout >= time.Second, "postgres connect timeout must be at least 1s")
+	check(c.Postgres.MinConns >= 0, "postgres min conns must not be negative")
+	check(c.Postgres.MaxConns > 0, "postgres max conns must be positive")
+	check(c.Postgres.MinConns <= c.Postgres.MaxConns, "postgres min conns (%d) must not be larger than max conns (%d)", c.Postgres.MinConns, c.Postgres.MaxConns)
+	check(c.Postgres.MaxConnIdleTime > 0, "postgres max conn idle time must be positive")
+	check(c.Postgres.MaxConnLifetime > 0, "postgres max conn lifetime must be positive")
+
+	check(c.SQLite.Path != "", "sqlite path is required")
+
+	_, _, err := net.SplitHostPort(c.HTTP.ListenAddress)
+	check(err == nil, "listen address must be a host:port address like :8080 but is %q", c.HTTP.ListenAddress)
+	check(c.HTTP.ReadTimeout > 0, "http read timeout must be positive")
+	check(c.HTTP.WriteTimeout > 0, "http write timeout must be positive")
+	check(c.HTTP.IdleTimeout > 0, "http idle timeout must be positive")
+	check(c.HTTP.ShutdownTimeout > 0, "shutdown timeout must be positive")
+	check(c.HTTP.MaxRequestBodyBytes > 0, "max request body bytes must be positive")
+
+	check(c.Risks.TitleMaxLength > 0, "risk title max length must be positive")
+	check(c.Risks.DescriptionMaxLength > 0, "risk description max length must be positive")
+	check(c.Risks.TrashRetention > 0, "trash retention must be positive")
+	check(c.Risks.IdempotencyKeyTTL > 0, "idempotency key ttl must be positive")
+	check(c.Risks.BatchMaxOperations > 0, "batch max operations must be positive")
+	check(c.Risks.ScoreScale >= 2 && c.Risks.ScoreScale <= 10, "risk score scale must be between 2 and 10 but is %d", c.Risks.ScoreScale)
+	severities := c.Risks.SeverityScores
+	check(1 < severities.Medium && severities.Medium < severities.High && severities.High < severities.Critical && severities.Critical <= c.Risks.ScoreScale*c.Risks.ScoreScale,
+		"risk severity scores must increase from medium (%d) to high (%d) and critical (%d), between 2 and the highest score %d",
+		severities.Medium, severities.High, severities.Critical, c.Risks.ScoreScale*c.Risks.ScoreScale)
+
+	_, err = c.SlogLevel()
+	check(err == nil, "log level must be one of debug, info, warn or error but is %q", c.LogLevel)
+
+	return errors.Join(errs...)
+}
+
+// DSN returns the postgres connection string
+func (p Postgres) DSN() string {
+	dsn := url.URL{
+		Scheme: "postgres",
+		User:   url.UserPassword(p.Username, p.Password),
+		Host:   net.JoinHostPort(p.Host, strconv.Itoa(p.Port)),
+		Path:   "/" + p.Database,
+		RawQuery: url.Values{
+			"sslmode":         {p.SSLMode},
+			"connect_timeout": {strconv.Itoa(int(p.ConnectTimeout.Round(time.Second).Seconds()))},
+		}.Encode(),
+	}
+	return dsn.String()
+}
+
+// SlogLevel returns the log level as a slog level
+func (c Config) SlogLevel() (slog.Level, error) {
+	var level slog.Level
+	err := level.UnmarshalText([]byte(c.LogLevel))
+	return level, err
+}
+
+// Redacted returns the configuration in YAML with the secrets replaced, so that it can be printed or logged
+func (c Config) Redacted() (string, error) {
+	for _, s := range c.settings() {
+		if v, ok := s.value.(*string); ok && s.secret && *v != "" {
+			*v = redacted
+		}
+	}
+	out, err := yaml.Marshal(c)
+	return string(out), err
 }
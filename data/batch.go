@@ -0,0 +1,104 @@
+package data
+
+import (
+	"fmt"
+	"github.com/google/uuid"
+)
+
+// BatchAction is what an operation of a batch does to a risk
+type BatchAction string
+
+const (
+	BatchCreate BatchAction = "create"
+	BatchUpdate BatchAction = "update"
+	BatchDelete BatchAction = "delete"
+)
+
+// BatchMode tells how a batch is applied, atomic batches are all or nothing while best effort batches apply every
+// operation that succeeds
+type BatchMode string
+
+const (
+	BatchAtomic     BatchMode = "atomic"
+	BatchBestEffort BatchMode = "bestEffort"
+)
+
+type (
+	// BatchRequest is a list of operations applied to the risks in a single transaction, in order
+	BatchRequest struct {
+		Mode       BatchMode        `json:"mode"`
+		Operations []BatchOperation `json:"operations"`
+	}
+
+	// BatchOperation creates, updates or deletes a risk. An update replaces every field of the risk a write sets, like
+	// a PUT: the ratings it leaves out are rated like the ones of a new risk, and the external reference, owner,
+	// assignee or tags it leaves out are removed. Updates and deletes must send the version of the risk they change, like the
+	// If-Match header of a single write.
+	BatchOperation struct {
+		Action      BatchAction `json:"op"`
+		ID          uuid.UUID   `json:"id"`
+		Version     int64       `json:"version"`
+		Title       string      `json:"title"`
+		Description string      `json:"description"`
+		State       State       `json:"state"`
+		ExternalRef string      `json:"externalRef"`
+		// the ratings are scored like the ratings of a single write
+		Likelihood         int      `json:"likelihood"`
+		Impact             int      `json:"impact"`
+		ResidualLikelihood int      `json:"residualLikelihood"`
+		ResidualImpact     int      `json:"residualImpact"`
+		InherentScore      int      `json:"-"`
+		ResidualScore      int      `json:"-"`
+		Severity           Severity `json:"-"`
+		Owner              string   `json:"owner"`
+		Assignee           string   `json:"assignee"`
+		Tags               []string `json:"tags"`
+	}
+
+	// BatchResult is the outcome of an operation, the risk as the operation left it or the error that failed it
+	BatchResult struct {
+		Action BatchAction
+		Risk   Risk
+		Err    error
+	}
+
+	// BatchCheck is called by the storage with every risk an update or delete is about to change, as it is at that
+	// point of the batch. The operation fails with the returned error.
+	BatchCheck func(current Risk, operation BatchOperation) error
+
+	// BatchError fails an atomic batch when one of its operations fails, none of the operations are applied
+	BatchError struct {
+		Index int
+		Err   error
+	}
+)
+
+// NewBatchOperation returns an operation writing the risk
+func NewBatchOperation(action BatchAction, risk Risk) BatchOperation {
+	return BatchOperation{
+		Action: action, ID: risk.ID, Version: risk.Version,
+		Title: risk.Title, Description: risk.Description, State: risk.State, ExternalRef: risk.ExternalRef,
+		Likelihood: risk.Likelihood, Impact: risk.Impact, ResidualLikelihood: risk.ResidualLikelihood, ResidualImpact: risk.ResidualImpact,
+		InherentScore: risk.InherentScore, ResidualScore: risk.ResidualScore, Severity: risk.Severity,
+		Owner: risk.Owner, Assignee: risk.Assignee, Tags: risk.Tags,
+	}
+}
+
+// Risk returns the risk the operation writes
+func (o BatchOperation) Risk() Risk {
+	return Risk{
+		ID: o.ID, Version: o.Version,
+		Title: o.Title, Description: o.Description, State: o.State, ExternalRef: o.ExternalRef,
+		Likelihood: o.Likelihood, Impact: o.Impact, ResidualLikelihood: o.ResidualLikelihood, ResidualImpact: o.ResidualImpact,
+		InherentScore: o.InherentScore, ResidualScore: o.ResidualScore, Severity: o.Severity,
+		Owner: o.Owner, Assignee: o.Assignee, Tags: o.Tags,
+	}
+}
+
+func (e *BatchError) Error() string {
+	return fmt.Sprintf("operations[%d]: %s", e.Index, e.Err)
+}
+
+func (e *BatchError) Unwrap() error {
+	return e.Err
+}
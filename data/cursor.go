@@ -0,0 +1,197 @@
+package data
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"github.com/google/uuid"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// sortTimeFormat formats the times in UTC with a fixed width, so that their text sorts like the times they represent
+const sortTimeFormat = "2006-01-02T15:04:05.000000Z07:00"
+
+// Cursor marks a position in a sorted list of risks, it holds the sort values of the risk the next page starts after
+type Cursor struct {
+	// Sort is the complete sort order the cursor was created for, formatted like the sort query param
+	Sort   string   `json:"s"`
+	Values []string `json:"v"`
+	// Backward cursors page towards the start of the list
+	Backward bool `json:"b,omitempty"`
+}
+
+// cursorFields has the fields of a Cursor without its text encoding, it is what the encoded cursor is made of
+type cursorFields Cursor
+
+// CountMode defines how the total count of a list of risks is computed
+type CountMode string
+
+const (
+	CountExact    CountMode = "exact"
+	CountEstimate CountMode = "estimate"
+	CountNone     CountMode = "none"
+)
+
+// ParseCountMode parses the count query param, an empty value is an exact count
+func ParseCountMode(value string) (CountMode, error) {
+	switch mode := CountMode(value); mode {
+	case "":
+		return CountExact, nil
+	case CountExact, CountEstimate, CountNone:
+		return mode, nil
+	}
+	return "", &ValidationError{Fields: []FieldError{
+		{Field: "count", Message: fmt.Sprintf("must be one of %s, %s or %s but received %q", CountExact, CountEstimate, CountNone, value)},
+	}}
+}
+
+// NewCursor creates a cursor pointing at the risk for the given sort keys
+func NewCursor(risk Risk, keys []SortKey, backward bool) *Cursor {
+	values := make([]string, len(keys))
+	for i, key := range keys {
+		values[i] = risk.SortValue(key.Field)
+	}
+	return &Cursor{Sort: FormatSort(keys), Values: values, Backward: backward}
+}
+
+// ParseCursor decodes a cursor encoded with Cursor.String
+func ParseCursor(value string) (*Cursor, error) {
+	invalid := &ValidationError{Fields: []FieldError{{Field: "after", Message: "is not a valid cursor"}}}
+	decoded, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, invalid
+	}
+	var cursor cursorFields
+	if err = json.Unmarshal(decoded, &cursor); err != nil || cursor.Sort == "" {
+		return nil, invalid
+	}
+	return (*Cursor)(&cursor), nil
+}
+
+// String encodes the cursor into an opaque, URL safe value
+func (c *Cursor) String() string {
+	encoded, _ := json.Marshal((*cursorFields)(c))
+	return base64.RawURLEncoding.EncodeToString(encoded)
+}
+
+func (c *Cursor) MarshalText() ([]byte, error) {
+	return []byte(c.String()), nil
+}
+
+func (c *Cursor) UnmarshalText(text []byte) error {
+	cursor, err := ParseCursor(string(text))
+	if err != nil {
+		return err
+	}
+	*c = *cursor
+	return nil
+}
+
+// FormatSort formats sort keys in the format accepted by ParseSort
+func FormatSort(keys []SortKey) string {
+	formatted := make([]string, len(keys))
+	for i, key := range keys {
+		formatted[i] = key.String()
+	}
+	return strings.Join(formatted, ",")
+}
+
+// SortValue returns the value of a sortable field of the risk in its text form.
+// The ratings and scores are zero padded and the times have a fixed width, so that their text sorts like their value.
+func (r Risk) SortValue(field string) string {
+	switch field {
+	case "id":
+		return r.ID.String()
+	case "title":
+		return r.Title
+	case "description":
+		return r.Description
+	case "state":
+		return string(r.State)
+	case "createdBy":
+		return r.CreatedBy
+	case "updatedBy":
+		return r.UpdatedBy
+	}
+	if value, ok := r.timeValue(field); ok {
+		return value.UTC().Format(sortTimeFormat)
+	}
+	if value, ok := r.numericValue(field); ok {
+		return fmt.Sprintf("%03d", value)
+	}
+	return ""
+}
+
+// numericValue returns the value of a rating or score of the risk, it is false for the other fields
+func (r Risk) numericValue(field string) (int, bool) {
+	switch field {
+	case "likelihood":
+		return r.Likelihood, true
+	case "impact":
+		return r.Impact, true
+	case "residualLikelihood":
+		return r.ResidualLikelihood, true
+	case "residualImpact":
+		return r.ResidualImpact, true
+	case "inherentScore":
+		return r.InherentScore, true
+	case "residualScore":
+		return r.ResidualScore, true
+	}
+	return 0, false
+}
+
+// timeValue returns the value of a timestamp of the risk, it is false for the other fields
+func (r Risk) timeValue(field string) (time.Time, bool) {
+	switch field {
+	case "createdAt":
+		return r.CreatedAt, true
+	case "updatedAt":
+		return r.UpdatedAt, true
+	}
+	return time.Time{}, false
+}
+
+// CursorArg returns a value of the cursor as a query argument of the type of its sort field, numbers for the ratings
+// and scores, times for the timestamps and text for the other fields
+func CursorArg(field, value string) (any, error) {
+	invalid := &ValidationError{Fields: []FieldError{{Field: "after", Message: "is not a valid cursor"}}}
+	if _, ok := (Risk{}).timeValue(field); ok {
+		t, err := time.Parse(sortTimeFormat, value)
+		if err != nil {
+			return nil, invalid
+		}
+		return t, nil
+	}
+	if _, ok := (Risk{}).numericValue(field); !ok {
+		return value, nil
+	}
+	number, err := strconv.Atoi(value)
+	if err != nil {
+		return nil, invalid
+	}
+	return number, nil
+}
+
+// SearchSort is the order of the search results, the most relevant first, the cursors of the results are made for it
+const SearchSort = "-rank,id"
+
+// NewSearchCursor creates a cursor pointing at the search result with the given rank and ID. The rank is kept with
+// every digit, so that it compares equal to the rank it was read from.
+func NewSearchCursor(rank float64, ID uuid.UUID) *Cursor {
+	return &Cursor{Sort: SearchSort, Values: []string{strconv.FormatFloat(rank, 'g', -1, 64), ID.String()}}
+}
+
+// SearchCursorArgs returns the rank and the ID of the search result a search cursor points at
+func SearchCursorArgs(cursor *Cursor) (float64, string, error) {
+	if cursor.Sort != SearchSort || cursor.Backward || len(cursor.Values) != 2 {
+		return 0, "", &ValidationError{Fields: []FieldError{{Field: "after", Message: "is not a search cursor"}}}
+	}
+	rank, err := strconv.ParseFloat(cursor.Values[0], 64)
+	if err != nil {
+		return 0, "", &ValidationError{Fields: []FieldError{{Field: "after", Message: "is not a valid cursor"}}}
+	}
+	return rank, cursor.Values[1], nil
+}
@@ -0,0 +1,61 @@
+package data
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Error kinds, every error returned by the db and logic packages that callers may need to react to wraps one of these
+var (
+	ErrNotFound    = errors.New("not found")
+	ErrValidation  = errors.New("validation failed")
+	ErrConflict    = errors.New("conflict")
+	ErrUnavailable = errors.New("service unavailable")
+	// ErrPreconditionFailed is returned when a write expects another version of the risk than the stored one
+	ErrPreconditionFailed = errors.New("precondition failed")
+	// ErrIdempotencyKeyReused is returned when an idempotency key is sent again with another request
+	ErrIdempotencyKeyReused = errors.New("idempotency key reused")
+)
+
+// Error is an error classified with one of the error kinds
+type Error struct {
+	Kind error
+	Err  error
+}
+
+// Errorf formats an error of the given kind, the kind is not included in the message
+func Errorf(kind error, format string, args ...any) error {
+	return &Error{Kind: kind, Err: fmt.Errorf(format, args...)}
+}
+
+func (e *Error) Error() string {
+	return e.Err.Error()
+}
+
+func (e *Error) Unwrap() []error {
+	return []error{e.Kind, e.Err}
+}
+
+// FieldError describes why a single field of a request is invalid
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// ValidationError is a validation error listing every invalid field of a request
+type ValidationError struct {
+	Fields []FieldError
+}
+
+func (e *ValidationError) Error() string {
+	messages := make([]string, 0, len(e.Fields))
+	for _, f := range e.Fields {
+		messages = append(messages, fmt.Sprintf("%s: %s", f.Field, f.Message))
+	}
+	return strings.Join(messages, "; ")
+}
+
+func (e *ValidationError) Unwrap() error {
+	return ErrValidation
+}
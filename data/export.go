@@ -0,0 +1,182 @@
+package data
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ExportFormat is the file format risks are exported as
+type ExportFormat string
+
+const (
+	ExportCSV   ExportFormat = "csv"
+	ExportJSONL ExportFormat = "jsonl"
+	ExportXLSX  ExportFormat = "xlsx"
+)
+
+// exportContentTypes are the media types of the export formats
+var exportContentTypes = map[ExportFormat]string{
+	ExportCSV:   "text/csv; charset=utf-8",
+	ExportJSONL: "application/jsonl",
+	ExportXLSX:  "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet",
+}
+
+// exportColumns are the columns of the CSV and XLSX exports, named like the JSON fields of a risk
+var exportColumns = []struct {
+	name  string
+	value func(risk Risk) string
+}{
+	{"id", func(risk Risk) string { return risk.ID.String() }},
+	{"title", func(risk Risk) string { return risk.Title }},
+	{"description", func(risk Risk) string { return risk.Description }},
+	{"state", func(risk Risk) string { return string(risk.State) }},
+	{"externalRef", func(risk Risk) string { return risk.ExternalRef }},
+	{"likelihood", func(risk Risk) string { return strconv.Itoa(risk.Likelihood) }},
+	{"impact", func(risk Risk) string { return strconv.Itoa(risk.Impact) }},
+	{"residualLikelihood", func(risk Risk) string { return strconv.Itoa(risk.ResidualLikelihood) }},
+	{"residualImpact", func(risk Risk) string { return strconv.Itoa(risk.ResidualImpact) }},
+	{"inherentScore", func(risk Risk) string { return strconv.Itoa(risk.InherentScore) }},
+	{"residualScore", func(risk Risk) string { return strconv.Itoa(risk.ResidualScore) }},
+	{"severity", func(risk Risk) string { return string(risk.Severity) }},
+	{"owner", func(risk Risk) string { return risk.Owner }},
+	{"assignee", func(risk Risk) string { return risk.Assignee }},
+	{"tags", func(risk Risk) string { return strings.Join(risk.Tags, ",") }},
+	{"version", func(risk Risk) string { return strconv.FormatInt(risk.Version, 10) }},
+	{"createdAt", func(risk Risk) string { return risk.CreatedAt.UTC().Format(time.RFC3339Nano) }},
+	{"updatedAt", func(risk Risk) string { return risk.UpdatedAt.UTC().Format(time.RFC3339Nano) }},
+	{"createdBy", func(risk Risk) string { return risk.CreatedBy }},
+	{"updatedBy", func(risk Risk) string { return risk.UpdatedBy }},
+}
+
+// ParseExportFormat parses the format query param, an empty value is CSV
+func ParseExportFormat(value string) (ExportFormat, error) {
+	switch format := ExportFormat(value); format {
+	case "":
+		return ExportCSV, nil
+	case ExportCSV, ExportJSONL, ExportXLSX:
+		return format, nil
+	}
+	return "", &ValidationError{Fields: []FieldError{
+		{Field: "format", Message: fmt.Sprintf("must be one of %s, %s or %s but received %q", ExportCSV, ExportJSONL, ExportXLSX, value)},
+	}}
+}
+
+// ContentType returns the media type of the format
+func (f ExportFormat) ContentType() string {
+	return exportContentTypes[f]
+}
+
+// RiskWriter writes exported risks one at a time, so that an export never holds more than a risk in memory. Close
+// completes the file, it must be called even when no risk was written.
+type RiskWriter interface {
+	Write(risk Risk) error
+	Close() error
+}
+
+// NewRiskWriter returns a writer of risks in the format
+func NewRiskWriter(format ExportFormat, w io.Writer) RiskWriter {
+	switch format {
+	case ExportJSONL:
+		buffered := bufio.NewWriter(w)
+		return &jsonlWriter{buffered: buffered, encoder: json.NewEncoder(buffered)}
+	case ExportXLSX:
+		return newXLSXWriter(w)
+	default:
+		return &csvWriter{writer: csv.NewWriter(w)}
+	}
+}
+
+// exportRecord returns the values of the export columns of the risk
+func exportRecord(risk Risk) []string {
+	record := make([]string, len(exportColumns))
+	for i, column := range exportColumns {
+		record[i] = column.value(risk)
+	}
+	return record
+}
+
+// exportHeader returns the names of the export columns
+func exportHeader() []string {
+	header := make([]string, len(exportColumns))
+	for i, column := range exportColumns {
+		header[i] = column.name
+	}
+	return header
+}
+
+// csvWriter writes a header and a row per risk, the header is written even when there are no risks
+type csvWriter struct {
+	writer        *csv.Writer
+	headerWritten bool
+}
+
+func (c *csvWriter) Write(risk Risk) error {
+	if err := c.writeHeader(); err != nil {
+		return err
+	}
+	record := exportRecord(risk)
+	for i, value := range record {
+		record[i] = csvValue(value)
+	}
+	return c.writer.Write(record)
+}
+
+func (c *csvWriter) Close() error {
+	if err := c.writeHeader(); err != nil {
+		return err
+	}
+	c.writer.Flush()
+	return c.writer.Error()
+}
+
+func (c *csvWriter) writeHeader() error {
+	if c.headerWritten {
+		return nil
+	}
+	c.headerWritten = true
+	return c.writer.Write(exportHeader())
+}
+
+// csvValue quotes the values that spreadsheets would run as formulas with a leading ', so that opening an export cannot
+// run the text of a risk. The values already starting with quotes before a formula are quoted once more, so that
+// csvUnquote gives every value back. The XLSX export writes inline strings, which are never formulas.
+func csvValue(value string) string {
+	if isFormula(strings.TrimLeft(value, "'")) {
+		return "'" + value
+	}
+	return value
+}
+
+// csvUnquote removes the leading ' csvValue quoted a value with, so that an exported file is imported as it was
+// exported
+func csvUnquote(value string) string {
+	if strings.HasPrefix(value, "'") && isFormula(strings.TrimLeft(value, "'")) {
+		return value[1:]
+	}
+	return value
+}
+
+// isFormula reports whether spreadsheets would run the value as a formula
+func isFormula(value string) bool {
+	return value != "" && strings.ContainsRune("=+-@\t\r", rune(value[0]))
+}
+
+// jsonlWriter writes a risk per line, as it is returned by the API
+type jsonlWriter struct {
+	buffered *bufio.Writer
+	encoder  *json.Encoder
+}
+
+func (j *jsonlWriter) Write(risk Risk) error {
+	return j.encoder.Encode(risk)
+}
+
+func (j *jsonlWriter) Close() error {
+	return j.buffered.Flush()
+}
@@ -0,0 +1,144 @@
+package data
+
+import (
+	"fmt"
+	"github.com/google/uuid"
+	"io"
+	"slices"
+	"strings"
+)
+
+// Rating is which ratings of the risks a heat map places them by, before or after their mitigations
+type Rating string
+
+const (
+	RatingInherent Rating = "inherent"
+	RatingResidual Rating = "residual"
+)
+
+// ParseRating parses the rating query param, an empty value is residual
+func ParseRating(value string) (Rating, error) {
+	switch rating := Rating(value); rating {
+	case "":
+		return RatingResidual, nil
+	case RatingInherent, RatingResidual:
+		return rating, nil
+	}
+	return "", &ValidationError{Fields: []FieldError{
+		{Field: "rating", Message: fmt.Sprintf("must be one of %s or %s but received %q", RatingInherent, RatingResidual, value)},
+	}}
+}
+
+// HeatMapOptions selects the risks counted by a heat map
+type HeatMapOptions struct {
+	Filter Filter
+	Rating Rating
+	// WithIDs lists the IDs of the risks of every cell, not just their number
+	WithIDs bool
+}
+
+// HeatMapCell is the number of risks with a likelihood and an impact
+type HeatMapCell struct {
+	Likelihood int         `json:"likelihood"`
+	Impact     int         `json:"impact"`
+	Score      int         `json:"score"`
+	Severity   Severity    `json:"severity"`
+	Count      int         `json:"count"`
+	RiskIDs    []uuid.UUID `json:"riskIds,omitempty"`
+}
+
+// HeatMap is the likelihood by impact matrix of the risks, with a cell for every pair of ratings
+type HeatMap struct {
+	Rating Rating        `json:"rating"`
+	Scale  int           `json:"scale"`
+	Total  int           `json:"total"`
+	Cells  []HeatMapCell `json:"cells"`
+}
+
+// NewHeatMap lays out the counted cells, which only have their ratings, count and IDs, on the full matrix of the
+// scale, ordered by likelihood then impact. Risks rated before the scale was lowered widen the matrix to their ratings.
+func NewHeatMap(rating Rating, scoring Scoring, counted []HeatMapCell) HeatMap {
+	scale := scoring.Scale
+	for _, cell := range counted {
+		scale = max(scale, cell.Likelihood, cell.Impact)
+	}
+
+	heatMap := HeatMap{Rating: rating, Scale: scale, Cells: make([]HeatMapCell, 0, scale*scale)}
+	for likelihood := 1; likelihood <= scale; likelihood++ {
+		for impact := 1; impact <= scale; impact++ {
+			score := likelihood * impact
+			heatMap.Cells = append(heatMap.Cells, HeatMapCell{Likelihood: likelihood, Impact: impact, Score: score, Severity: scoring.Severity(score)})
+		}
+	}
+	for _, cell := range counted {
+		if cell.Likelihood < 1 || cell.Impact < 1 {
+			continue
+		}
+		c := &heatMap.Cells[(cell.Likelihood-1)*scale+cell.Impact-1]
+		c.Count += cell.Count
+		c.RiskIDs = append(c.RiskIDs, cell.RiskIDs...)
+		heatMap.Total += cell.Count
+	}
+	for i := range heatMap.Cells {
+		slices.SortFunc(heatMap.Cells[i].RiskIDs, func(a, b uuid.UUID) int {
+			return strings.Compare(a.String(), b.String())
+		})
+	}
+	return heatMap
+}
+
+// the layout of the SVG rendering, in pixels
+const (
+	svgCellSize = 64
+	svgMargin   = 56
+	svgTitle    = 32
+)
+
+// svgColors are the fills of the cells of every severity, traffic light colors
+var svgColors = map[Severity]string{
+	SeverityLow:      "#8bc34a",
+	SeverityMedium:   "#ffeb3b",
+	SeverityHigh:     "#ff9800",
+	SeverityCritical: "#f44336",
+}
+
+// WriteSVG renders the heat map as a standalone SVG image, the likelihood grows upwards and the impact to the right.
+// Every cell shows its number of risks, colored by its severity, with a tooltip.
+func (h HeatMap) WriteSVG(w io.Writer) error {
+	grid := h.Scale * svgCellSize
+	width := svgMargin + grid + svgMargin/2
+	height := svgTitle + grid + svgMargin
+
+	var svg strings.Builder
+	fmt.Fprintf(&svg, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d" font-family="sans-serif">`, width, height, width, height)
+	svg.WriteString("\n")
+	fmt.Fprintf(&svg, `<text x="%d" y="22" text-anchor="middle" font-size="16" font-weight="bold">Risk heat map, %s, %d risks</text>`, svgMargin+grid/2, h.Rating, h.Total)
+	svg.WriteString("\n")
+
+	for _, cell := range h.Cells {
+		x := svgMargin + (cell.Impact-1)*svgCellSize
+		y := svgTitle + (h.Scale-cell.Likelihood)*svgCellSize
+		noun := "risks"
+		if cell.Count == 1 {
+			noun = "risk"
+		}
+		fmt.Fprintf(&svg, `<g><title>Likelihood %d, impact %d, %s: %d %s</title>`, cell.Likelihood, cell.Impact, cell.Severity, cell.Count, noun)
+		fmt.Fprintf(&svg, `<rect x="%d" y="%d" width="%d" height="%d" fill="%s" stroke="#ffffff" stroke-width="2"/>`, x, y, svgCellSize, svgCellSize, svgColors[cell.Severity])
+		if cell.Count > 0 {
+			fmt.Fprintf(&svg, `<text x="%d" y="%d" text-anchor="middle" dominant-baseline="central" font-size="20">%d</text>`, x+svgCellSize/2, y+svgCellSize/2, cell.Count)
+		}
+		svg.WriteString("</g>\n")
+	}
+
+	for rating := 1; rating <= h.Scale; rating++ {
+		fmt.Fprintf(&svg, `<text x="%d" y="%d" text-anchor="end" dominant-baseline="central" font-size="12">%d</text>`, svgMargin-8, svgTitle+(h.Scale-rating)*svgCellSize+svgCellSize/2, rating)
+		fmt.Fprintf(&svg, `<text x="%d" y="%d" text-anchor="middle" font-size="12">%d</text>`, svgMargin+(rating-1)*svgCellSize+svgCellSize/2, svgTitle+grid+18, rating)
+		svg.WriteString("\n")
+	}
+	fmt.Fprintf(&svg, `<text x="%d" y="%d" text-anchor="middle" font-size="14">Impact</text>`, svgMargin+grid/2, svgTitle+grid+42)
+	fmt.Fprintf(&svg, `<text x="18" y="%d" text-anchor="middle" font-size="14" transform="rotate(-90 18 %d)">Likelihood</text>`, svgTitle+grid/2, svgTitle+grid/2)
+	svg.WriteString("\n</svg>\n")
+
+	_, err := io.WriteString(w, svg.String())
+	return err
+}
@@ -0,0 +1,124 @@
+package data
+
+import (
+	"context"
+	"github.com/google/uuid"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Actions recorded in the history of a risk
+const (
+	ActionCreated  Action = "created"
+	ActionUpdated  Action = "updated"
+	ActionDeleted  Action = "deleted"
+	ActionRestored Action = "restored"
+	ActionPurged   Action = "purged"
+)
+
+// auditKey is the context key of the Audit
+type auditKey struct{}
+
+type (
+	Action string
+
+	// Audit tells who makes a change and why, it is recorded in the history of every risk the change writes
+	Audit struct {
+		Actor     string
+		RequestID string
+		// Reason explains a state transition
+		Reason string
+	}
+
+	// HistoryEntry is a change of a risk, with the risk before and after the change.
+	// Before is nil when the risk was created and After is nil when it was purged.
+	HistoryEntry struct {
+		ID        int64         `json:"id"`
+		RiskID    uuid.UUID     `json:"riskId"`
+		Action    Action        `json:"action"`
+		Actor     string        `json:"actor"`
+		RequestID string        `json:"requestId,omitempty"`
+		Reason    string        `json:"reason,omitempty"`
+		ChangedAt time.Time     `json:"changedAt"`
+		Changes   []FieldChange `json:"changes"`
+		Before    *Risk         `json:"before,omitempty"`
+		After     *Risk         `json:"after,omitempty"`
+	}
+
+	// FieldChange is the change of a single field, From and To are nil when the field has no value
+	FieldChange struct {
+		Field string  `json:"field"`
+		From  *string `json:"from"`
+		To    *string `json:"to"`
+	}
+)
+
+// WithAudit returns a copy of the context carrying the audit
+func WithAudit(ctx context.Context, audit Audit) context.Context {
+	return context.WithValue(ctx, auditKey{}, audit)
+}
+
+// AuditFrom returns the audit carried by the context, it is empty when there is none
+func AuditFrom(ctx context.Context) Audit {
+	audit, _ := ctx.Value(auditKey{}).(Audit)
+	return audit
+}
+
+// Diff lists the fields that differ between two versions of a risk, a nil risk has no value for any field.
+// The timestamps maintained by the storage are left out, except for deletedAt which tells whether the risk is in the trash.
+func Diff(before, after *Risk) []FieldChange {
+	changes := []FieldChange{}
+	for _, field := range []string{"title", "description", "state", "externalRef", "likelihood", "impact", "residualLikelihood", "residualImpact", "severity", "owner", "assignee", "tags", "deletedAt"} {
+		from, to := before.historyValue(field), after.historyValue(field)
+		if from == nil && to == nil || from != nil && to != nil && *from == *to {
+			continue
+		}
+		changes = append(changes, FieldChange{Field: field, From: from, To: to})
+	}
+	return changes
+}
+
+// historyValue returns the value of a field shown in the history, nil when it has no value
+func (r *Risk) historyValue(field string) *string {
+	if r == nil {
+		return nil
+	}
+	// an unassigned risk has no owner or assignee rather than an empty one
+	if field == "owner" || field == "assignee" {
+		user := r.Owner
+		if field == "assignee" {
+			user = r.Assignee
+		}
+		if user == "" {
+			return nil
+		}
+		return &user
+	}
+	// the tags are shown like in an export, separated by commas
+	if field == "tags" {
+		if len(r.Tags) == 0 {
+			return nil
+		}
+		tags := strings.Join(r.Tags, ",")
+		return &tags
+	}
+	if field == "deletedAt" {
+		if r.DeletedAt == nil {
+			return nil
+		}
+		deletedAt := r.DeletedAt.UTC().Format(time.RFC3339Nano)
+		return &deletedAt
+	}
+	value := r.SortValue(field)
+	switch field {
+	case "externalRef":
+		value = r.ExternalRef
+	case "severity":
+		value = string(r.Severity)
+	}
+	if number, ok := r.numericValue(field); ok {
+		value = strconv.Itoa(number)
+	}
+	return &value
+}
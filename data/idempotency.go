@@ -0,0 +1,13 @@
+package data
+
+import "time"
+
+// IdempotencyKey makes the creation of a risk safe to retry: until the key expires, a retry with the same key and
+// request replays the risk created by the first request instead of creating another one
+type IdempotencyKey struct {
+	Key string
+	// RequestHash identifies the request the key was first used with, reusing the key with another request fails with
+	// ErrIdempotencyKeyReused
+	RequestHash string
+	ExpiresAt   time.Time
+}
@@ -0,0 +1,228 @@
+package data
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// ImportStatus is what an import did with a row, or would do with it in a dry run
+type ImportStatus string
+
+const (
+	ImportCreated   ImportStatus = "created"
+	ImportUpdated   ImportStatus = "updated"
+	ImportUnchanged ImportStatus = "unchanged"
+	ImportRejected  ImportStatus = "rejected"
+)
+
+// importColumns are the risk fields a CSV file can set, keyed by their normalized header name
+var importColumns = map[string]string{
+	"title":              "title",
+	"description":        "description",
+	"state":              "state",
+	"externalref":        "externalRef",
+	"likelihood":         "likelihood",
+	"impact":             "impact",
+	"residuallikelihood": "residualLikelihood",
+	"residualimpact":     "residualImpact",
+	"owner":              "owner",
+	"assignee":           "assignee",
+	"tags":               "tags",
+}
+
+// importIgnored are the columns of an export that are written by the service, an exported file is imported without
+// them
+var importIgnored = map[string]bool{
+	"id": true, "inherentscore": true, "residualscore": true, "severity": true, "version": true,
+	"createdat": true, "updatedat": true, "createdby": true, "updatedby": true,
+}
+
+// importRatings are the fields of the columns holding ratings, which must be whole numbers
+var importRatings = []string{"likelihood", "impact", "residualLikelihood", "residualImpact"}
+
+type (
+	// ImportRow is a row of an imported CSV file, with the values of the risk fields named by the header.
+	// Err is set when the row cannot be read.
+	ImportRow struct {
+		Line   int
+		Values map[string]string
+		Err    error
+	}
+
+	// ImportReport tells what an import did with every row of the file
+	ImportReport struct {
+		DryRun    bool              `json:"dryRun"`
+		Created   int               `json:"created"`
+		Updated   int               `json:"updated"`
+		Unchanged int               `json:"unchanged"`
+		Rejected  int               `json:"rejected"`
+		Rows      []ImportRowReport `json:"rows"`
+	}
+
+	// ImportRowReport is the outcome of a row, rejected rows have the reason they were rejected for
+	ImportRowReport struct {
+		Line        int          `json:"line"`
+		ExternalRef string       `json:"externalRef,omitempty"`
+		Status      ImportStatus `json:"status"`
+		RiskID      *uuid.UUID   `json:"riskId,omitempty"`
+		Reason      string       `json:"reason,omitempty"`
+		Errors      []FieldError `json:"errors,omitempty"`
+	}
+)
+
+// Apply sets the fields of the risk the row has a column for, the other fields are left as they are. An empty rating
+// is unrated, like a rating left out of a request, an empty owner or assignee unassigns the risk and the tags are
+// separated by commas.
+func (r ImportRow) Apply(risk Risk) Risk {
+	for field, value := range r.Values {
+		switch field {
+		case "title":
+			risk.Title = value
+		case "description":
+			risk.Description = value
+		case "state":
+			risk.State = State(value)
+		case "externalRef":
+			risk.ExternalRef = value
+		case "likelihood":
+			risk.Likelihood, _ = strconv.Atoi(value)
+		case "impact":
+			risk.Impact, _ = strconv.Atoi(value)
+		case "residualLikelihood":
+			risk.ResidualLikelihood, _ = strconv.Atoi(value)
+		case "residualImpact":
+			risk.ResidualImpact, _ = strconv.Atoi(value)
+		case "owner":
+			risk.Owner = value
+		case "assignee":
+			risk.Assignee = value
+		case "tags":
+			risk.Tags = nil
+			for _, tag := range strings.Split(value, ",") {
+				if tag = strings.TrimSpace(tag); tag != "" {
+					risk.Tags = append(risk.Tags, tag)
+				}
+			}
+		}
+	}
+	return risk
+}
+
+// Add adds the outcome of a row to the report
+func (r *ImportReport) Add(row ImportRowReport) {
+	switch row.Status {
+	case ImportCreated:
+		r.Created++
+	case ImportUpdated:
+		r.Updated++
+	case ImportUnchanged:
+		r.Unchanged++
+	case ImportRejected:
+		r.Rejected++
+	}
+	r.Rows = append(r.Rows, row)
+}
+
+// ReadRisksCSV reads a CSV file of risks. The header names the risk field of every column, the names are matched
+// ignoring case, spaces, dashes and underscores, e.g. "External Ref" is externalRef. The title column is required, the
+// columns of an export written by the service are ignored and the values quoted by the CSV export are unquoted.
+// Rows with the wrong number of fields are returned with an error, the file is rejected when it cannot be read.
+func ReadRisksCSV(r io.Reader) ([]ImportRow, error) {
+	reader := csv.NewReader(r)
+	header, err := reader.Read()
+	if errors.Is(err, io.EOF) {
+		return nil, Errorf(ErrValidation, "the CSV file is empty, it must start with a header")
+	}
+	if err != nil {
+		return nil, Errorf(ErrValidation, "error reading the CSV file: %s", err)
+	}
+
+	fields, err := headerFields(header)
+	if err != nil {
+		return nil, err
+	}
+
+	var rows []ImportRow
+	for {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		line, _ := reader.FieldPos(0)
+		var parseErr *csv.ParseError
+		if errors.As(err, &parseErr) && errors.Is(parseErr.Err, csv.ErrFieldCount) {
+			rows = append(rows, ImportRow{
+				Line: line,
+				Err:  Errorf(ErrValidation, "the row has %d fields but the header has %d", len(record), len(header)),
+			})
+			continue
+		}
+		if err != nil {
+			return nil, Errorf(ErrValidation, "error reading the CSV file: %s", err)
+		}
+
+		values := make(map[string]string, len(fields))
+		for i, field := range fields {
+			if field != "" {
+				values[field] = csvUnquote(strings.TrimSpace(record[i]))
+			}
+		}
+		rows = append(rows, ImportRow{Line: line, Values: values, Err: checkRatings(values)})
+	}
+	return rows, nil
+}
+
+// checkRatings fails when a rating of the row is not a whole number
+func checkRatings(values map[string]string) error {
+	var errs []FieldError
+	for _, field := range importRatings {
+		value, ok := values[field]
+		if !ok || value == "" {
+			continue
+		}
+		if _, err := strconv.Atoi(value); err != nil {
+			errs = append(errs, FieldError{Field: field, Message: fmt.Sprintf("must be a whole number but is %q", value)})
+		}
+	}
+	if len(errs) > 0 {
+		return &ValidationError{Fields: errs}
+	}
+	return nil
+}
+
+// headerFields maps the columns of the header to the risk fields they set, the ignored columns set none
+func headerFields(header []string) ([]string, error) {
+	var errs []FieldError
+	fields := make([]string, len(header))
+	seen := map[string]bool{}
+	for i, name := range header {
+		if i == 0 {
+			// spreadsheets save UTF-8 files with a byte order mark
+			name = strings.TrimPrefix(name, "\ufeff")
+		}
+		normalized := strings.NewReplacer(" ", "", "-", "", "_", "").Replace(strings.ToLower(strings.TrimSpace(name)))
+		field, ok := importColumns[normalized]
+		switch {
+		case importIgnored[normalized]:
+			continue
+		case !ok:
+			errs = append(errs, FieldError{Field: name, Message: "is not a known column, expected title, description, state, externalRef, likelihood, impact, residualLikelihood, residualImpact, owner, assignee or tags"})
+		case seen[field]:
+			errs = append(errs, FieldError{Field: name, Message: "is a duplicate column"})
+		}
+		seen[field] = true
+		fields[i] = field
+	}
+	if !seen["title"] {
+		errs = append(errs, FieldError{Field: "title", Message: "is a required column"})
+	}
+	if len(errs) > 0 {
+		return nil, &ValidationError{Fields: errs}
+	}
+	return fields, nil
+}
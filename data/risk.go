@@ -1,33 +1,134 @@
 package data
 
-import "github.com/google/uuid"
+import (
+	"fmt"
+	"github.com/google/uuid"
+	"slices"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// ExternalRefMaxLength is the maximum length, in characters, of the external reference of a risk
+const ExternalRefMaxLength = 255
+
+const (
+	// TagMaxLength is the maximum length, in characters, of a tag and MaxTags the maximum number of tags of a risk
+	TagMaxLength = 50
+	MaxTags      = 20
+)
 
 var validStates = map[string]bool{
-	"open":          true,
-	"closed":        true,
-	"accepted":      true,
-	"investigating": true,
+	string(StateOpen):          true,
+	string(StateClosed):        true,
+	string(StateAccepted):      true,
+	string(StateInvestigating): true,
 }
 
 type (
 	Risk struct {
-		ID          uuid.UUID `json:"id"`
-		State       State     `json:"state"`
-		Title       string    `json:"title"`
-		Description string    `json:"description"`
+		ID          uuid.UUID  `json:"id"`
+		State       State      `json:"state"`
+		Title       string     `json:"title"`
+		Description string     `json:"description"`
+		CreatedAt   time.Time  `json:"createdAt"`
+		UpdatedAt   time.Time  `json:"updatedAt"`
+		DeletedAt   *time.Time `json:"deletedAt,omitempty"`
+		// CreatedBy and UpdatedBy are the actors of the requests that created the risk and last updated it, they are
+		// written by the storage
+		CreatedBy string `json:"createdBy"`
+		UpdatedBy string `json:"updatedBy"`
+		// Version is incremented by every write of the risk, it starts at 1
+		Version int64 `json:"version"`
+		// ExternalRef is the optional reference of the risk in another system, unique among the risks
+		ExternalRef string `json:"externalRef,omitempty"`
+		// Likelihood and Impact rate the risk before its mitigations, the residual ones after them
+		Likelihood         int `json:"likelihood"`
+		Impact             int `json:"impact"`
+		ResidualLikelihood int `json:"residualLikelihood"`
+		ResidualImpact     int `json:"residualImpact"`
+		// InherentScore, ResidualScore and Severity are computed from the ratings, see Score
+		InherentScore int      `json:"inherentScore"`
+		ResidualScore int      `json:"residualScore"`
+		Severity      Severity `json:"severity"`
+		// Owner is accountable for the risk and Assignee works on it, both are IDs of active users when they are set
+		Owner    string `json:"owner,omitempty"`
+		Assignee string `json:"assignee,omitempty"`
+		// Tags label the risk, e.g. with the areas or the projects it concerns, in the order they were given
+		Tags []string `json:"tags,omitempty"`
 	}
 	State string
 
+	// Precondition is the versions a write expects the risk to have, the write fails with ErrPreconditionFailed when
+	// the risk has another version. Any version matches when Any is set.
+	Precondition struct {
+		Any      bool
+		Versions []int64
+	}
+
 	Options struct {
-		Offset    int
-		Limit     int
-		SortBy    string
-		SortOrder string
+		Offset int
+		Limit  int
+		Sort   []SortKey
+		Filter Filter
+		// After continues the list from a cursor returned with a previous page, the offset is ignored when set
+		After *Cursor
+		Count CountMode
+	}
+
+	// Filter narrows down a list of risks, only the risks matching every set field are listed
+	Filter struct {
+		States        []State
+		Title         string
+		Description   string
+		CreatedAfter  *time.Time
+		CreatedBefore *time.Time
+		UpdatedAfter  *time.Time
+		UpdatedBefore *time.Time
+		Severities    []Severity
+		// MinScore and MaxScore bound the residual score, zero is no bound
+		MinScore int
+		MaxScore int
+		Owner    string
+		Assignee string
+		// Involving lists the risks owned by or assigned to the user
+		Involving string
+		CreatedBy string
+		UpdatedBy string
+		// Tags lists the risks labelled with every one of the tags
+		Tags []string
+	}
+
+	// Limits are the maximum lengths, in characters, of the free text fields of a risk, and the highest rating
+	Limits struct {
+		TitleMaxLength       int
+		DescriptionMaxLength int
+		ScoreScale           int
 	}
 
 	PaginatedResponse struct {
-		TotalCount int    `json:"totalCount"`
-		Risks      []Risk `json:"risks"`
+		// TotalCount is left out when the count is skipped, and only approximate when it is estimated
+		TotalCount *int    `json:"totalCount,omitempty"`
+		Risks      []Risk  `json:"risks"`
+		NextCursor *Cursor `json:"nextCursor,omitempty"`
+		PrevCursor *Cursor `json:"prevCursor,omitempty"`
+	}
+
+	// SearchResult is a risk matching a search, the highlights are its title and description with the matching words
+	// wrapped in <mark> tags
+	SearchResult struct {
+		Risk
+		Rank                 float32 `json:"rank"`
+		TitleHighlight       string  `json:"titleHighlight"`
+		DescriptionHighlight string  `json:"descriptionHighlight"`
+	}
+
+	// SearchResponse is a page of search results, most relevant first, in the same envelope as PaginatedResponse. The
+	// search results are only paged forward, so there is no previous cursor.
+	SearchResponse struct {
+		TotalCount *int           `json:"totalCount,omitempty"`
+		Risks      []SearchResult `json:"risks"`
+		NextCursor *Cursor        `json:"nextCursor,omitempty"`
 	}
 )
 
@@ -38,3 +139,118 @@ func (s State) IsValid() bool {
 	}
 	return false
 }
+
+// Matches tells whether a risk with the given version meets the precondition
+func (p Precondition) Matches(version int64) bool {
+	return p.Any || slices.Contains(p.Versions, version)
+}
+
+// Validate checks the fields of a risk, returning a ValidationError listing every invalid field
+func (r Risk) Validate(limits Limits) error {
+	var fields []FieldError
+	if strings.TrimSpace(r.Title) == "" {
+		fields = append(fields, FieldError{Field: "title", Message: "is required"})
+	}
+	if n := utf8.RuneCountInString(r.Title); n > limits.TitleMaxLength {
+		fields = append(fields, FieldError{
+			Field:   "title",
+			Message: fmt.Sprintf("must be at most %d characters but has %d", limits.TitleMaxLength, n),
+		})
+	}
+	if n := utf8.RuneCountInString(r.Description); n > limits.DescriptionMaxLength {
+		fields = append(fields, FieldError{
+			Field:   "description",
+			Message: fmt.Sprintf("must be at most %d characters but has %d", limits.DescriptionMaxLength, n),
+		})
+	}
+	if n := utf8.RuneCountInString(r.ExternalRef); n > ExternalRefMaxLength {
+		fields = append(fields, FieldError{
+			Field:   "externalRef",
+			Message: fmt.Sprintf("must be at most %d characters but has %d", ExternalRefMaxLength, n),
+		})
+	}
+	fields = append(fields, tagErrors(r.Tags)...)
+	ratings := []struct {
+		field    string
+		value    int
+		inherent string
+		limit    int
+	}{
+		{"likelihood", r.Likelihood, "", 0},
+		{"impact", r.Impact, "", 0},
+		// mitigations lower a risk, they never raise it
+		{"residualLikelihood", r.ResidualLikelihood, "likelihood", r.Likelihood},
+		{"residualImpact", r.ResidualImpact, "impact", r.Impact},
+	}
+	for _, rating := range ratings {
+		switch {
+		case rating.value < 1 || rating.value > limits.ScoreScale:
+			fields = append(fields, FieldError{
+				Field:   rating.field,
+				Message: fmt.Sprintf("must be between 1 and %d but is %d", limits.ScoreScale, rating.value),
+			})
+		case rating.inherent != "" && rating.value > rating.limit:
+			fields = append(fields, FieldError{
+				Field:   rating.field,
+				Message: fmt.Sprintf("must not be higher than the %s %d but is %d", rating.inherent, rating.limit, rating.value),
+			})
+		}
+	}
+	if !r.State.IsValid() {
+		fields = append(fields, FieldError{
+			Field:   "state",
+			Message: fmt.Sprintf("must be one of %s, %s, %s or %s but received %q", StateOpen, StateInvestigating, StateAccepted, StateClosed, r.State),
+		})
+	}
+	if len(fields) > 0 {
+		return &ValidationError{Fields: fields}
+	}
+	return nil
+}
+
+// tagErrors lists the invalid tags. A tag is a non empty label without commas, which separate the tags of a filter
+// or of a CSV cell, and the tags of a risk are distinct.
+func tagErrors(tags []string) []FieldError {
+	var fields []FieldError
+	if len(tags) > MaxTags {
+		fields = append(fields, FieldError{Field: "tags", Message: fmt.Sprintf("must have at most %d tags but has %d", MaxTags, len(tags))})
+	}
+	for i, tag := range tags {
+		field := fmt.Sprintf("tags[%d]", i)
+		switch {
+		case strings.TrimSpace(tag) == "":
+			fields = append(fields, FieldError{Field: field, Message: "is required"})
+		case strings.TrimSpace(tag) != tag:
+			fields = append(fields, FieldError{Field: field, Message: fmt.Sprintf("must not start or end with spaces but received %q", tag)})
+		case strings.Contains(tag, ","):
+			fields = append(fields, FieldError{Field: field, Message: fmt.Sprintf("must not contain commas but received %q", tag)})
+		case utf8.RuneCountInString(tag) > TagMaxLength:
+			fields = append(fields, FieldError{Field: field, Message: fmt.Sprintf("must be at most %d characters but has %d", TagMaxLength, utf8.RuneCountInString(tag))})
+		case slices.Contains(tags[:i], tag):
+			fields = append(fields, FieldError{Field: field, Message: fmt.Sprintf("must not repeat the tag %q", tag)})
+		}
+	}
+	return fields
+}
+
+// ValidateNew validates a risk to be created like Validate, a new risk must also be in an initial state of the workflow
+func (r Risk) ValidateNew(limits Limits) error {
+	var fields []FieldError
+	if err := r.Validate(limits); err != nil {
+		fields = append(fields, err.(*ValidationError).Fields...)
+	}
+	if r.State.IsValid() && !r.State.IsInitial() {
+		initial := make([]string, len(initialStates))
+		for i, state := range initialStates {
+			initial[i] = string(state)
+		}
+		fields = append(fields, FieldError{
+			Field:   "state",
+			Message: fmt.Sprintf("must be %s when a risk is created but received %q, the other states are reached through transitions", strings.Join(initial, " or "), r.State),
+		})
+	}
+	if len(fields) > 0 {
+		return &ValidationError{Fields: fields}
+	}
+	return nil
+}
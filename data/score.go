@@ -0,0 +1,79 @@
+package data
+
+// Severity is the band the residual score of a risk falls in
+type Severity string
+
+const (
+	SeverityLow      Severity = "low"
+	SeverityMedium   Severity = "medium"
+	SeverityHigh     Severity = "high"
+	SeverityCritical Severity = "critical"
+)
+
+// Scoring is how risks are scored. Their likelihood and impact are rated from 1 to Scale, a score is the product of
+// a likelihood and an impact, and the severity of a risk is the band its residual score falls in.
+type Scoring struct {
+	Scale int
+	// MediumScore, HighScore and CriticalScore are the lowest scores of their severity, the lower scores are low
+	MediumScore   int
+	HighScore     int
+	CriticalScore int
+}
+
+func (s Severity) IsValid() bool {
+	switch s {
+	case SeverityLow, SeverityMedium, SeverityHigh, SeverityCritical:
+		return true
+	}
+	return false
+}
+
+// Severity returns the severity of a score
+func (s Scoring) Severity(score int) Severity {
+	switch {
+	case score >= s.CriticalScore:
+		return SeverityCritical
+	case score >= s.HighScore:
+		return SeverityHigh
+	case score >= s.MediumScore:
+		return SeverityMedium
+	}
+	return SeverityLow
+}
+
+// Score fills in the ratings the risk is missing and computes its scores and severity. A risk that was not rated is
+// rated in the middle of the scale, and its residual ratings, after its mitigations, default to its inherent ones.
+func (r Risk) Score(scoring Scoring) Risk {
+	middle := (scoring.Scale + 1) / 2
+	if r.Likelihood == 0 {
+		r.Likelihood = middle
+	}
+	if r.Impact == 0 {
+		r.Impact = middle
+	}
+	if r.ResidualLikelihood == 0 {
+		r.ResidualLikelihood = r.Likelihood
+	}
+	if r.ResidualImpact == 0 {
+		r.ResidualImpact = r.Impact
+	}
+	r.InherentScore = r.Likelihood * r.Impact
+	r.ResidualScore = r.ResidualLikelihood * r.ResidualImpact
+	r.Severity = scoring.Severity(r.ResidualScore)
+	return r
+}
+
+// Rescore scores a stored risk again, after the scoring changed. Its ratings are lowered to the top of the scale when
+// the scale shrank, its residual ratings are kept at most its inherent ones, and its scores and severity are computed.
+func (r Risk) Rescore(scoring Scoring) Risk {
+	r.Likelihood, r.Impact = min(r.Likelihood, scoring.Scale), min(r.Impact, scoring.Scale)
+	r.ResidualLikelihood, r.ResidualImpact = min(r.ResidualLikelihood, r.Likelihood), min(r.ResidualImpact, r.Impact)
+	return r.Score(scoring)
+}
+
+// Scored reports whether the ratings, scores and severity of the risk are the ones of the given rescored risk
+func (r Risk) Scored(rescored Risk) bool {
+	return r.Likelihood == rescored.Likelihood && r.Impact == rescored.Impact &&
+		r.ResidualLikelihood == rescored.ResidualLikelihood && r.ResidualImpact == rescored.ResidualImpact &&
+		r.InherentScore == rescored.InherentScore && r.ResidualScore == rescored.ResidualScore && r.Severity == rescored.Severity
+}
@@ -0,0 +1,73 @@
+package data
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// SortableFields are the risk fields that risks can be sorted by
+var SortableFields = []string{
+	"id", "title", "description", "state", "likelihood", "impact", "inherentScore", "residualScore",
+	"createdAt", "updatedAt", "createdBy", "updatedBy",
+}
+
+// SortKey is a single field of a sort order
+type SortKey struct {
+	Field      string
+	Descending bool
+}
+
+// ParseSort parses a comma separated list of sortable fields, each optionally prefixed with - for a descending order,
+// e.g. state,-title
+func ParseSort(value string) ([]SortKey, error) {
+	var keys []SortKey
+	var fields []FieldError
+	for _, part := range strings.Split(value, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		key := SortKey{Field: strings.TrimPrefix(part, "-"), Descending: strings.HasPrefix(part, "-")}
+		if !IsSortable(key.Field) {
+			fields = append(fields, FieldError{
+				Field:   "sort",
+				Message: fmt.Sprintf("cannot sort by %q, allowed fields are: %s", key.Field, strings.Join(SortableFields, ", ")),
+			})
+			continue
+		}
+		keys = append(keys, key)
+	}
+	if len(fields) > 0 {
+		return nil, &ValidationError{Fields: fields}
+	}
+	return keys, nil
+}
+
+// WithTieBreaker ends the sort keys with the id, so that every risk has a distinct position in the order.
+// The keys after the id are dropped as they cannot change the order.
+func WithTieBreaker(keys []SortKey) []SortKey {
+	for i, key := range keys {
+		if key.Field == "id" {
+			return keys[:i+1]
+		}
+	}
+	return append(slices.Clip(keys), SortKey{Field: "id"})
+}
+
+func IsSortable(field string) bool {
+	for _, f := range SortableFields {
+		if f == field {
+			return true
+		}
+	}
+	return false
+}
+
+// String formats the sort keys in the same format accepted by ParseSort
+func (k SortKey) String() string {
+	if k.Descending {
+		return "-" + k.Field
+	}
+	return k.Field
+}
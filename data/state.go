@@ -0,0 +1,82 @@
+package data
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+const (
+	StateOpen          State = "open"
+	StateInvestigating State = "investigating"
+	StateAccepted      State = "accepted"
+	StateClosed        State = "closed"
+)
+
+var (
+	// ErrInvalidTransition is returned when a risk cannot move from its current state to the requested one
+	ErrInvalidTransition = Errorf(ErrConflict, "invalid state transition")
+	// ErrReasonRequired is returned when a transition requires a reason and none was given
+	ErrReasonRequired = Errorf(ErrValidation, "a reason is required for this state transition")
+)
+
+// initialStates are the states a risk can be created in, the other states are only reached through transitions
+var initialStates = []State{StateOpen}
+
+// transitions defines the risk workflow, keyed by the state a risk is moving from
+var transitions = map[State][]Transition{
+	StateOpen: {
+		{To: StateInvestigating},
+		{To: StateClosed},
+	},
+	StateInvestigating: {
+		{To: StateAccepted},
+		{To: StateClosed},
+	},
+	StateAccepted: {
+		{To: StateClosed},
+		{To: StateOpen, RequiresReason: true},
+	},
+	StateClosed: {
+		{To: StateOpen, RequiresReason: true},
+	},
+}
+
+type (
+	// Transition describes a state a risk can move to
+	Transition struct {
+		To             State `json:"to"`
+		RequiresReason bool  `json:"requiresReason"`
+	}
+
+	TransitionRequest struct {
+		To     State  `json:"to"`
+		Reason string `json:"reason"`
+	}
+)
+
+// Transitions returns the transitions available from the state
+func (s State) Transitions() []Transition {
+	available := make([]Transition, len(transitions[s]))
+	copy(available, transitions[s])
+	return available
+}
+
+// IsInitial reports whether a risk can be created in the state
+func (s State) IsInitial() bool {
+	return slices.Contains(initialStates, s)
+}
+
+// ValidateTransition checks that a risk in the state is allowed to move to the given state
+func (s State) ValidateTransition(to State, reason string) error {
+	for _, t := range transitions[s] {
+		if t.To != to {
+			continue
+		}
+		if t.RequiresReason && strings.TrimSpace(reason) == "" {
+			return fmt.Errorf("%w: moving a risk from %s to %s", ErrReasonRequired, s, to)
+		}
+		return nil
+	}
+	return fmt.Errorf("%w: a risk cannot move from %s to %s", ErrInvalidTransition, s, to)
+}
@@ -0,0 +1,16 @@
+package data
+
+// PoolStats is a snapshot of the database connection pool usage
+type PoolStats struct {
+	TotalConns        int32 `json:"totalConns"`
+	AcquiredConns     int32 `json:"acquiredConns"`
+	IdleConns         int32 `json:"idleConns"`
+	ConstructingConns int32 `json:"constructingConns"`
+	MaxConns          int32 `json:"maxConns"`
+	// AcquireCount is the number of connections acquired since the pool was created, and AcquireDuration the total
+	// time spent waiting for them
+	AcquireCount         int64  `json:"acquireCount"`
+	AcquireDuration      string `json:"acquireDuration"`
+	EmptyAcquireCount    int64  `json:"emptyAcquireCount"`
+	CanceledAcquireCount int64  `json:"canceledAcquireCount"`
+}
@@ -0,0 +1,67 @@
+package data
+
+import (
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// UserFieldMaxLength is the maximum length, in characters, of the ID, name and email of a user
+const UserFieldMaxLength = 255
+
+type (
+	// User is someone who can own or be assigned risks. The ID is the identity the gateway sends as the actor of the
+	// requests of the user once they are authenticated.
+	User struct {
+		ID    string `json:"id"`
+		Name  string `json:"name"`
+		Email string `json:"email,omitempty"`
+		// Active users can be made owners and assignees, inactive ones keep the risks they already have
+		Active    bool      `json:"active"`
+		CreatedAt time.Time `json:"createdAt"`
+		UpdatedAt time.Time `json:"updatedAt"`
+	}
+
+	// UserFilter narrows down a list of users, only the users matching every set field are listed
+	UserFilter struct {
+		IDs    []string
+		Active *bool
+	}
+
+	// AssignmentRequest changes the owner or the assignee of a risk, the fields left out are not changed and an empty
+	// user unassigns the risk
+	AssignmentRequest struct {
+		Owner    *string `json:"owner"`
+		Assignee *string `json:"assignee"`
+		Reason   string  `json:"reason"`
+	}
+)
+
+// Validate checks the fields of a user, returning a ValidationError listing every invalid field
+func (u User) Validate() error {
+	var fields []FieldError
+	if u.ID == "" {
+		fields = append(fields, FieldError{Field: "id", Message: "is required"})
+	} else if strings.TrimSpace(u.ID) != u.ID {
+		fields = append(fields, FieldError{Field: "id", Message: "must not start or end with spaces"})
+	}
+	if strings.TrimSpace(u.Name) == "" {
+		fields = append(fields, FieldError{Field: "name", Message: "is required"})
+	}
+	if u.Email != "" && !strings.Contains(u.Email, "@") {
+		fields = append(fields, FieldError{Field: "email", Message: fmt.Sprintf("must be an email address but received %q", u.Email)})
+	}
+	for _, field := range []struct{ name, value string }{{"id", u.ID}, {"name", u.Name}, {"email", u.Email}} {
+		if n := utf8.RuneCountInString(field.value); n > UserFieldMaxLength {
+			fields = append(fields, FieldError{
+				Field:   field.name,
+				Message: fmt.Sprintf("must be at most %d characters but has %d", UserFieldMaxLength, n),
+			})
+		}
+	}
+	if len(fields) > 0 {
+		return &ValidationError{Fields: fields}
+	}
+	return nil
+}
@@ -0,0 +1,112 @@
+package data
+
+import (
+	"archive/zip"
+	"encoding/xml"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// the parts of a workbook with a single worksheet, the worksheet itself is streamed row by row
+const (
+	xlsxContentTypes = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">
+<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>
+<Default Extension="xml" ContentType="application/xml"/>
+<Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/>
+<Override PartName="/xl/worksheets/sheet1.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>
+</Types>`
+	xlsxRels = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">
+<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/>
+</Relationships>`
+	xlsxWorkbook = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">
+<sheets><sheet name="Risks" sheetId="1" r:id="rId1"/></sheets>
+</workbook>`
+	xlsxWorkbookRels = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">
+<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet1.xml"/>
+</Relationships>`
+	xlsxSheetStart = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>`
+	xlsxSheetEnd = `</sheetData></worksheet>`
+)
+
+// xlsxWriter writes a workbook with a header row and a row per risk. The cells are inline strings, which spreadsheets
+// never evaluate as formulas, and the worksheet is the last part of the archive so that it can be streamed.
+type xlsxWriter struct {
+	archive *zip.Writer
+	sheet   io.Writer
+	rows    int
+}
+
+func newXLSXWriter(w io.Writer) *xlsxWriter {
+	return &xlsxWriter{archive: zip.NewWriter(w)}
+}
+
+func (x *xlsxWriter) Write(risk Risk) error {
+	if err := x.start(); err != nil {
+		return err
+	}
+	return x.writeRow(exportRecord(risk))
+}
+
+func (x *xlsxWriter) Close() error {
+	if err := x.start(); err != nil {
+		return err
+	}
+	if _, err := io.WriteString(x.sheet, xlsxSheetEnd); err != nil {
+		return err
+	}
+	return x.archive.Close()
+}
+
+// start writes the parts before the worksheet and the header row, once
+func (x *xlsxWriter) start() error {
+	if x.sheet != nil {
+		return nil
+	}
+	parts := []struct{ name, content string }{
+		{"[Content_Types].xml", xlsxContentTypes},
+		{"_rels/.rels", xlsxRels},
+		{"xl/workbook.xml", xlsxWorkbook},
+		{"xl/_rels/workbook.xml.rels", xlsxWorkbookRels},
+	}
+	for _, part := range parts {
+		w, err := x.archive.Create(part.name)
+		if err != nil {
+			return err
+		}
+		if _, err = io.WriteString(w, part.content); err != nil {
+			return err
+		}
+	}
+
+	sheet, err := x.archive.Create("xl/worksheets/sheet1.xml")
+	if err != nil {
+		return err
+	}
+	if _, err = io.WriteString(sheet, xlsxSheetStart); err != nil {
+		return err
+	}
+	x.sheet = sheet
+	return x.writeRow(exportHeader())
+}
+
+func (x *xlsxWriter) writeRow(values []string) error {
+	x.rows++
+	var row strings.Builder
+	row.WriteString(`<row r="` + strconv.Itoa(x.rows) + `">`)
+	for _, value := range values {
+		row.WriteString(`<c t="inlineStr"><is><t xml:space="preserve">`)
+		if err := xml.EscapeText(&row, []byte(value)); err != nil {
+			return err
+		}
+		row.WriteString(`</t></is></c>`)
+	}
+	row.WriteString(`</row>`)
+	_, err := io.WriteString(x.sheet, row.String())
+	return err
+}
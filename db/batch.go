@@ -0,0 +1,241 @@
+package db
+
+import (
+	"context"
+	_ "embed"
+	"encoding/json"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v4"
+	"stan-project/data"
+	"time"
+)
+
+//go:embed sql/lock_risks.sql
+var lockRisks string
+
+// historyColumns are the columns of risk_history copied for the changes of a batch
+var historyColumns = []string{"risk_id", "action", "actor", "request_id", "reason", "before", "after"}
+
+// Batch applies the operations in a single transaction, in four round trips whatever their number: the risks
+// changed by the batch are locked at once, the risks holding the external references it writes are read, the writes
+// are sent as a pgx batch and the history is copied with COPY.
+// The operations are checked against the locked risks before anything is written, as every risk will be when the
+// turn of the operation comes, so that a best effort batch only sends the writes that succeed. A concurrent write of
+// one of the external references can still fail the whole batch with ErrConflict.
+func (rdb *risksDB) Batch(ctx context.Context, operations []data.BatchOperation, mode data.BatchMode, check data.BatchCheck) ([]data.BatchResult, error) {
+	var results []data.BatchResult
+	err := rdb.db.withTx(ctx, func(tx pgx.Tx) error {
+		locked, err := lockBatchRisks(ctx, tx, operations)
+		if err != nil {
+			return err
+		}
+		refs, err := batchExternalRefs(ctx, tx, operations)
+		if err != nil {
+			return err
+		}
+
+		results = make([]data.BatchResult, len(operations))
+		actor := data.AuditFrom(ctx).Actor
+		batch := &pgx.Batch{}
+		var queued []int
+		planned := map[uuid.UUID]data.Risk{}
+		for ID, risk := range locked {
+			planned[ID] = risk
+		}
+		for i, operation := range operations {
+			results[i].Action = operation.Action
+			if err = planOperation(planned, refs, operation, check); err != nil {
+				if mode == data.BatchAtomic {
+					return &data.BatchError{Index: i, Err: err}
+				}
+				results[i].Err = err
+				continue
+			}
+			switch operation.Action {
+			case data.BatchCreate:
+				batch.Queue(insertRisk, riskValues(operation.Risk(), actor)...)
+			case data.BatchUpdate:
+				batch.Queue(updateRisk, riskValues(operation.Risk(), actor)...)
+			case data.BatchDelete:
+				batch.Queue(softDeleteRiskByID, operation.ID)
+			}
+			queued = append(queued, i)
+		}
+		if len(queued) == 0 {
+			return nil
+		}
+
+		history, err := sendBatch(ctx, tx, batch, operations, queued, results, locked)
+		if err != nil {
+			return err
+		}
+		_, err = tx.CopyFrom(ctx, pgx.Identifier{"risk_history"}, historyColumns, pgx.CopyFromRows(history))
+		return classifyError(err)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+// lockBatchRisks locks the risks updated or deleted by a batch, in the order of their IDs so that concurrent batches
+// do not deadlock
+func lockBatchRisks(ctx context.Context, tx pgx.Tx, operations []data.BatchOperation) (map[uuid.UUID]data.Risk, error) {
+	var IDs []string
+	for _, operation := range operations {
+		if operation.Action != data.BatchCreate {
+			IDs = append(IDs, operation.ID.String())
+		}
+	}
+	locked := map[uuid.UUID]data.Risk{}
+	if len(IDs) == 0 {
+		return locked, nil
+	}
+
+	rows, err := tx.Query(ctx, lockRisks, IDs)
+	if err != nil {
+		return nil, classifyError(err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var risk data.Risk
+		if err = rows.Scan(append(riskFields(&risk), &risk.DeletedAt)...); err != nil {
+			return nil, classifyError(err)
+		}
+		locked[risk.ID] = risk
+	}
+	return locked, classifyError(rows.Err())
+}
+
+// batchExternalRefs returns the IDs of the risks, deleted or not, holding the external references written by a batch
+func batchExternalRefs(ctx context.Context, tx pgx.Tx, operations []data.BatchOperation) (map[string]uuid.UUID, error) {
+	var written []string
+	for _, operation := range operations {
+		if operation.Action != data.BatchDelete && operation.ExternalRef != "" {
+			written = append(written, operation.ExternalRef)
+		}
+	}
+	refs := map[string]uuid.UUID{}
+	if len(written) == 0 {
+		return refs, nil
+	}
+
+	rows, err := tx.Query(ctx, getRisksByExternalRefs, written)
+	if err != nil {
+		return nil, classifyError(err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var risk data.Risk
+		if err = rows.Scan(append(riskFields(&risk), &risk.DeletedAt)...); err != nil {
+			return nil, classifyError(err)
+		}
+		refs[risk.ExternalRef] = risk.ID
+	}
+	return refs, classifyError(rows.Err())
+}
+
+// planOperation checks an operation against the planned risks and external references, which are then changed like
+// the operation changes the stored risks
+func planOperation(planned map[uuid.UUID]data.Risk, refs map[string]uuid.UUID, operation data.BatchOperation, check data.BatchCheck) error {
+	if operation.Action == data.BatchCreate {
+		if err := checkExternalRef(refs, operation.Risk()); err != nil {
+			return err
+		}
+		if operation.ExternalRef != "" {
+			refs[operation.ExternalRef] = operation.ID
+		}
+		return nil
+	}
+
+	current, ok := planned[operation.ID]
+	if !ok || current.DeletedAt != nil {
+		return data.Errorf(data.ErrNotFound, "risk with ID: %s not found", operation.ID)
+	}
+	if err := checkVersion(current, operation.Version); err != nil {
+		return err
+	}
+	if err := check(current, operation); err != nil {
+		return err
+	}
+	if operation.Action == data.BatchUpdate {
+		if err := checkExternalRef(refs, operation.Risk()); err != nil {
+			return err
+		}
+	}
+
+	current.Version++
+	if operation.Action == data.BatchDelete {
+		deletedAt := time.Now()
+		current.DeletedAt = &deletedAt
+	} else {
+		if current.ExternalRef != "" {
+			delete(refs, current.ExternalRef)
+		}
+		if operation.ExternalRef != "" {
+			refs[operation.ExternalRef] = operation.ID
+		}
+		current.Title, current.Description, current.State = operation.Title, operation.Description, operation.State
+		current.ExternalRef, current.Owner, current.Assignee = operation.ExternalRef, operation.Owner, operation.Assignee
+	}
+	planned[operation.ID] = current
+	return nil
+}
+
+// checkExternalRef fails with ErrConflict when another risk holds the external reference of the risk, like the unique
+// index of the risks table would fail the write
+func checkExternalRef(refs map[string]uuid.UUID, risk data.Risk) error {
+	if other, ok := refs[risk.ExternalRef]; ok && risk.ExternalRef != "" && other != risk.ID {
+		return data.Errorf(data.ErrConflict, "risk with ID: %s already has the external reference %q", other, risk.ExternalRef)
+	}
+	return nil
+}
+
+// sendBatch sends the queued writes and reads their results in order, it returns the rows of the history of the
+// changes. The risk before a change is the locked risk, or the result of the previous change of the same risk.
+func sendBatch(ctx context.Context, tx pgx.Tx, batch *pgx.Batch, operations []data.BatchOperation, queued []int, results []data.BatchResult, latest map[uuid.UUID]data.Risk) ([][]any, error) {
+	batchResults := tx.SendBatch(ctx, batch)
+	defer batchResults.Close()
+
+	audit := data.AuditFrom(ctx)
+	history := make([][]any, 0, len(queued))
+	for _, i := range queued {
+		var (
+			changed data.Risk
+			action  data.Action
+			before  *data.Risk
+		)
+		fields := riskFields(&changed)
+		switch operations[i].Action {
+		case data.BatchCreate:
+			action = data.ActionCreated
+		case data.BatchUpdate:
+			action = data.ActionUpdated
+		case data.BatchDelete:
+			action = data.ActionDeleted
+			fields = append(fields, &changed.DeletedAt)
+		}
+		if err := batchResults.QueryRow().Scan(fields...); err != nil {
+			return nil, classifyError(err)
+		}
+		if previous, ok := latest[changed.ID]; ok {
+			before = &previous
+		}
+		latest[changed.ID] = changed
+		results[i].Risk = changed
+
+		// COPY sends strings as they are in its binary format, the snapshots are bytes so that they are encoded as jsonb
+		row := []any{changed.ID, string(action), audit.Actor, audit.RequestID, audit.Reason, nil, nil}
+		var err error
+		if before != nil {
+			if row[5], err = json.Marshal(before); err != nil {
+				return nil, err
+			}
+		}
+		if row[6], err = json.Marshal(changed); err != nil {
+			return nil, err
+		}
+		history = append(history, row)
+	}
+	return history, classifyError(batchResults.Close())
+}
@@ -0,0 +1,40 @@
+package db
+
+import (
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"stan-project/data"
+	"testing"
+)
+
+func TestPlanOperation(t *testing.T) {
+	t.Run("successfully reject the external references held by another risk", func(t *testing.T) {
+		a := data.Risk{ID: uuid.New(), Version: 1, State: "open", ExternalRef: "EXT-1"}
+		b := data.Risk{ID: uuid.New(), Version: 1, State: "open"}
+		planned := map[uuid.UUID]data.Risk{a.ID: a, b.ID: b}
+		refs := map[string]uuid.UUID{"EXT-1": a.ID}
+		accept := func(current data.Risk, operation data.BatchOperation) error { return nil }
+
+		for _, test := range []struct {
+			operation data.BatchOperation
+			conflict  bool
+		}{
+			{data.BatchOperation{Action: data.BatchCreate, ID: uuid.New(), State: "open", ExternalRef: "EXT-1"}, true},
+			{data.BatchOperation{Action: data.BatchCreate, ID: uuid.New(), State: "open", ExternalRef: "EXT-2"}, false},
+			{data.BatchOperation{Action: data.BatchCreate, ID: uuid.New(), State: "open", ExternalRef: "EXT-2"}, true},
+			{data.BatchOperation{Action: data.BatchUpdate, ID: b.ID, Version: 1, State: "open", ExternalRef: "EXT-2"}, true},
+			{data.BatchOperation{Action: data.BatchUpdate, ID: a.ID, Version: 1, State: "open", ExternalRef: "EXT-3"}, false},
+			{data.BatchOperation{Action: data.BatchCreate, ID: uuid.New(), State: "open", ExternalRef: "EXT-1"}, false},
+			{data.BatchOperation{Action: data.BatchUpdate, ID: a.ID, Version: 2, State: "open", ExternalRef: "EXT-3"}, false},
+		} {
+			err := planOperation(planned, refs, test.operation, accept)
+			if test.conflict {
+				assert.ErrorIs(t, err, data.ErrConflict)
+			} else {
+				assert.Nil(t, err)
+			}
+		}
+		assert.Equal(t, "EXT-3", planned[a.ID].ExternalRef)
+		assert.Equal(t, int64(1), planned[b.ID].Version)
+	})
+}
@@ -0,0 +1,986 @@
+// Package dbtest is a conformance suite run by the tests of every risks storage, so that they all behave the same
+package dbtest
+
+import (
+	"context"
+	"errors"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"math/rand"
+	"slices"
+	"stan-project/data"
+	"stan-project/logic"
+	"strings"
+	"testing"
+	"time"
+)
+
+// RiskDB is a risks storage under test, DeleteByID cleans up the risks added by the scenarios
+type RiskDB interface {
+	logic.RiskDB
+	DeleteByID(ctx context.Context, ID uuid.UUID) error
+}
+
+// Run runs every scenario against the storage.
+// The storage may hold other risks, e.g. a shared postgres database, so every scenario tags the titles of the risks it
+// adds with a random word and only looks at the risks with that tag.
+func Run(t *testing.T, rDB RiskDB) {
+	t.Run("add and get a risk", func(t *testing.T) { testAddAndGet(t, rDB) })
+	t.Run("update a risk", func(t *testing.T) { testUpdate(t, rDB) })
+	t.Run("missing risks are not found", func(t *testing.T) { testNotFound(t, rDB) })
+	t.Run("sort, filter and count risks", func(t *testing.T) { testSortFilterCount(t, rDB) })
+	t.Run("page through risks", func(t *testing.T) { testPagination(t, rDB) })
+	t.Run("search risks", func(t *testing.T) { testSearch(t, rDB) })
+	t.Run("delete, restore and purge a risk", func(t *testing.T) { testTrash(t, rDB) })
+	t.Run("record the history of a risk", func(t *testing.T) { testHistory(t, rDB) })
+	t.Run("version every write of a risk", func(t *testing.T) { testVersion(t, rDB) })
+	t.Run("add a risk once per idempotency key", func(t *testing.T) { testIdempotency(t, rDB) })
+	t.Run("create, update and delete risks in a batch", func(t *testing.T) { testBatch(t, rDB) })
+	t.Run("find risks by their unique external reference", func(t *testing.T) { testExternalRef(t, rDB) })
+	t.Run("reject the duplicate external references of a batch", func(t *testing.T) { testBatchExternalRef(t, rDB) })
+	t.Run("export every risk matching a filter", func(t *testing.T) { testExport(t, rDB) })
+	t.Run("sort and filter risks by score and severity", func(t *testing.T) { testScores(t, rDB) })
+	t.Run("count risks by likelihood and impact", func(t *testing.T) { testCountByRatings(t, rDB) })
+	t.Run("add, list and update users", func(t *testing.T) { testUsers(t, rDB) })
+	t.Run("assign risks to users", func(t *testing.T) { testAssignment(t, rDB) })
+	t.Run("record who created and updated a risk", func(t *testing.T) { testActors(t, rDB) })
+	t.Run("tag risks and filter them by tags", func(t *testing.T) { testTags(t, rDB) })
+}
+
+// newTag returns a random word of consonants, which no stemmer changes
+func newTag() string {
+	const letters = "bcdfghjkmnpqrtvwxz"
+	tag := make([]byte, 12)
+	for i := range tag {
+		tag[i] = letters[rand.Intn(len(letters))]
+	}
+	return string(tag)
+}
+
+// add adds a risk with a new ID and deletes it when the test ends
+func add(t *testing.T, rDB RiskDB, risk data.Risk) data.Risk {
+	t.Helper()
+	ctx := context.Background()
+	risk.ID = uuid.New()
+	added, err := rDB.Add(ctx, risk)
+	if err != nil {
+		t.Fatalf("error adding test data: %s", err)
+	}
+	t.Cleanup(func() {
+		if err := rDB.DeleteByID(ctx, added.ID); err != nil {
+			t.Logf("error cleaning up test data: %s", err)
+		}
+	})
+	return added
+}
+
+func titles(risks []data.Risk) []string {
+	titles := make([]string, len(risks))
+	for i, risk := range risks {
+		titles[i] = risk.Title
+	}
+	return titles
+}
+
+func testAddAndGet(t *testing.T, rDB RiskDB) {
+	ctx := context.Background()
+	tag := newTag()
+	before := time.Now().Add(-time.Minute)
+
+	added := add(t, rDB, data.Risk{Title: tag + " threat", Description: "a threat", State: "open"})
+	assert.Equal(t, tag+" threat", added.Title)
+	assert.Equal(t, "a threat", added.Description)
+	assert.Equal(t, data.State("open"), added.State)
+	assert.True(t, added.CreatedAt.After(before), "created at %s", added.CreatedAt)
+	assert.True(t, added.UpdatedAt.Equal(added.CreatedAt))
+	assert.Nil(t, added.DeletedAt)
+
+	risk, err := rDB.GetByID(ctx, added.ID)
+	assert.Nil(t, err)
+	assert.Equal(t, added.ID, risk.ID)
+	assert.Equal(t, added.Title, risk.Title)
+	assert.True(t, risk.CreatedAt.Equal(added.CreatedAt))
+
+	_, err = rDB.Add(ctx, data.Risk{ID: added.ID, Title: tag + " duplicate", State: "open"})
+	assert.ErrorIs(t, err, data.ErrConflict)
+}
+
+func testUpdate(t *testing.T, rDB RiskDB) {
+	ctx := context.Background()
+	tag := newTag()
+
+	added := add(t, rDB, data.Risk{Title: tag + " threat", State: "open"})
+	updated, err := rDB.Update(ctx, data.Risk{ID: added.ID, Title: tag + " updated", Description: "updated", State: "accepted"})
+	assert.Nil(t, err)
+	assert.Equal(t, tag+" updated", updated.Title)
+	assert.Equal(t, "updated", updated.Description)
+	assert.Equal(t, data.State("accepted"), updated.State)
+	assert.True(t, updated.CreatedAt.Equal(added.CreatedAt))
+	assert.False(t, updated.UpdatedAt.Before(added.UpdatedAt))
+
+	risk, err := rDB.GetByID(ctx, added.ID)
+	assert.Nil(t, err)
+	assert.Equal(t, updated.Title, risk.Title)
+}
+
+func testNotFound(t *testing.T, rDB RiskDB) {
+	ctx := context.Background()
+	ID := uuid.New()
+
+	_, err := rDB.GetByID(ctx, ID)
+	assert.ErrorIs(t, err, data.ErrNotFound)
+	_, err = rDB.Update(ctx, data.Risk{ID: ID, Title: "threat", State: "open"})
+	assert.ErrorIs(t, err, data.ErrNotFound)
+	assert.ErrorIs(t, rDB.SoftDeleteByID(ctx, ID, 0), data.ErrNotFound)
+	assert.ErrorIs(t, rDB.RestoreByID(ctx, ID), data.ErrNotFound)
+}
+
+func testSortFilterCount(t *testing.T, rDB RiskDB) {
+	ctx := context.Background()
+	tag := newTag()
+	before := time.Now().Add(-time.Minute)
+
+	add(t, rDB, data.Risk{Title: tag + " b", State: "open"})
+	add(t, rDB, data.Risk{Title: tag + " a", State: "closed"})
+	add(t, rDB, data.Risk{Title: tag + " c", State: "open"})
+	filter := data.Filter{Title: tag}
+
+	resp, err := rDB.GetAll(ctx, data.Options{Limit: 10, Sort: []data.SortKey{{Field: "title", Descending: true}}, Filter: filter, Count: data.CountExact})
+	assert.Nil(t, err)
+	assert.Equal(t, 3, *resp.TotalCount)
+	assert.Equal(t, []string{tag + " c", tag + " b", tag + " a"}, titles(resp.Risks))
+
+	resp, err = rDB.GetAll(ctx, data.Options{Limit: 10, Sort: []data.SortKey{{Field: "state"}, {Field: "title", Descending: true}}, Filter: filter, Count: data.CountNone})
+	assert.Nil(t, err)
+	assert.Nil(t, resp.TotalCount)
+	assert.Equal(t, []string{tag + " a", tag + " c", tag + " b"}, titles(resp.Risks))
+
+	resp, err = rDB.GetAll(ctx, data.Options{Limit: 10, Sort: []data.SortKey{{Field: "title"}}, Filter: data.Filter{Title: tag, States: []data.State{"open"}}, Count: data.CountEstimate})
+	assert.Nil(t, err)
+	assert.NotNil(t, resp.TotalCount)
+	assert.Equal(t, []string{tag + " b", tag + " c"}, titles(resp.Risks))
+
+	after := time.Now().Add(time.Minute)
+	upperCase := data.Filter{Title: tag + " A", CreatedAfter: &before, CreatedBefore: &after, UpdatedAfter: &before, UpdatedBefore: &after}
+	resp, err = rDB.GetAll(ctx, data.Options{Limit: 10, Sort: []data.SortKey{{Field: "title"}}, Filter: upperCase, Count: data.CountExact})
+	assert.Nil(t, err)
+	assert.Equal(t, 1, *resp.TotalCount)
+	assert.Equal(t, []string{tag + " a"}, titles(resp.Risks))
+
+	resp, err = rDB.GetAll(ctx, data.Options{Limit: 10, Sort: []data.SortKey{{Field: "title"}}, Filter: data.Filter{Title: tag, CreatedAfter: &after}, Count: data.CountExact})
+	assert.Nil(t, err)
+	assert.Equal(t, 0, *resp.TotalCount)
+	assert.Empty(t, resp.Risks)
+}
+
+func testPagination(t *testing.T, rDB RiskDB) {
+	ctx := context.Background()
+	tag := newTag()
+
+	for _, title := range []string{"a", "b", "c", "d", "e"} {
+		add(t, rDB, data.Risk{Title: tag + " " + title, State: "open"})
+	}
+	options := data.Options{Limit: 2, Sort: []data.SortKey{{Field: "title"}}, Filter: data.Filter{Title: tag}, Count: data.CountExact}
+
+	first, err := rDB.GetAll(ctx, options)
+	assert.Nil(t, err)
+	assert.Equal(t, 5, *first.TotalCount)
+	assert.Equal(t, []string{tag + " a", tag + " b"}, titles(first.Risks))
+	assert.Nil(t, first.PrevCursor)
+
+	options.After = first.NextCursor
+	second, err := rDB.GetAll(ctx, options)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{tag + " c", tag + " d"}, titles(second.Risks))
+	assert.NotNil(t, second.PrevCursor)
+
+	options.After = second.NextCursor
+	last, err := rDB.GetAll(ctx, options)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{tag + " e"}, titles(last.Risks))
+	assert.Nil(t, last.NextCursor)
+
+	options.After = second.PrevCursor
+	previous, err := rDB.GetAll(ctx, options)
+	assert.Nil(t, err)
+	assert.Equal(t, titles(first.Risks), titles(previous.Risks))
+	assert.Nil(t, previous.PrevCursor)
+
+	options.After = nil
+	options.Offset = 3
+	offset, err := rDB.GetAll(ctx, options)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{tag + " d", tag + " e"}, titles(offset.Risks))
+	assert.NotNil(t, offset.PrevCursor)
+	assert.Nil(t, offset.NextCursor)
+
+	options.Offset = 0
+	options.After = first.NextCursor
+	options.Sort = []data.SortKey{{Field: "state"}}
+	_, err = rDB.GetAll(ctx, options)
+	assert.ErrorIs(t, err, data.ErrValidation)
+}
+
+func testSearch(t *testing.T, rDB RiskDB) {
+	ctx := context.Background()
+	tag := newTag()
+
+	inTitle := add(t, rDB, data.Risk{Title: tag + " ddos attack", Description: "requests flooding the API", State: "open"})
+	inDescription := add(t, rDB, data.Risk{Title: tag + " outage", Description: "a ddos on the login page", State: "open"})
+	add(t, rDB, data.Risk{Title: tag + " leak", Description: "leaked credentials", State: "closed"})
+
+	resp, err := rDB.Search(ctx, tag+" ddo", data.Options{Limit: 10, Count: data.CountExact})
+	assert.Nil(t, err)
+	assert.Equal(t, 2, *resp.TotalCount)
+	if assert.Len(t, resp.Risks, 2) {
+		assert.Equal(t, inTitle.ID, resp.Risks[0].ID)
+		assert.Equal(t, inDescription.ID, resp.Risks[1].ID)
+		assert.Greater(t, resp.Risks[0].Rank, resp.Risks[1].Rank)
+		assert.Contains(t, resp.Risks[0].TitleHighlight, "<mark>ddos</mark>")
+		assert.Contains(t, resp.Risks[1].DescriptionHighlight, "<mark>ddos</mark>")
+	}
+
+	resp, err = rDB.Search(ctx, tag, data.Options{Limit: 10, Filter: data.Filter{States: []data.State{"closed"}}, Count: data.CountExact})
+	assert.Nil(t, err)
+	assert.Equal(t, 1, *resp.TotalCount)
+
+	resp, err = rDB.Search(ctx, tag, data.Options{Limit: 1, Offset: 1, Count: data.CountNone})
+	assert.Nil(t, err)
+	assert.Nil(t, resp.TotalCount)
+	assert.Len(t, resp.Risks, 1)
+
+	// the pages of the cursors add up to every result, in order
+	all, err := rDB.Search(ctx, tag, data.Options{Limit: 10, Count: data.CountExact})
+	assert.Nil(t, err)
+	assert.Nil(t, all.NextCursor)
+	options := data.Options{Limit: 2, Count: data.CountExact}
+	var paged []uuid.UUID
+	for page := 0; page < 3; page++ {
+		resp, err = rDB.Search(ctx, tag, options)
+		assert.Nil(t, err)
+		assert.Equal(t, 3, *resp.TotalCount)
+		for _, result := range resp.Risks {
+			paged = append(paged, result.ID)
+		}
+		if options.After = resp.NextCursor; options.After == nil {
+			break
+		}
+	}
+	if assert.Len(t, all.Risks, 3) {
+		assert.Equal(t, []uuid.UUID{all.Risks[0].ID, all.Risks[1].ID, all.Risks[2].ID}, paged)
+	}
+	_, err = rDB.Search(ctx, tag, data.Options{Limit: 2, After: &data.Cursor{Sort: "title,id", Values: []string{"a", "b"}}})
+	assert.ErrorIs(t, err, data.ErrValidation, "list cursors do not page the search")
+
+	script := add(t, rDB, data.Risk{Title: tag + ` <script>alert("xss")</script>`, Description: `a "script" & <b>more</b>`, State: "open"})
+	resp, err = rDB.Search(ctx, tag+" script", data.Options{Limit: 10, Count: data.CountExact})
+	assert.Nil(t, err)
+	if assert.Len(t, resp.Risks, 1) {
+		assert.Equal(t, script.ID, resp.Risks[0].ID)
+		assert.NotContains(t, resp.Risks[0].TitleHighlight, "<script>", "the highlights are HTML escaped")
+		assert.Contains(t, resp.Risks[0].TitleHighlight, "&lt;<mark>script</mark>&gt;")
+		assert.Contains(t, resp.Risks[0].DescriptionHighlight, "&#34;<mark>script</mark>&#34; &amp; &lt;b&gt;more&lt;/b&gt;")
+	}
+
+	resp, err = rDB.Search(ctx, "&|!:*", data.Options{Limit: 10, Count: data.CountExact})
+	assert.Nil(t, err)
+	assert.Equal(t, 0, *resp.TotalCount)
+	assert.Empty(t, resp.Risks)
+}
+
+func testTrash(t *testing.T, rDB RiskDB) {
+	ctx := context.Background()
+	tag := newTag()
+
+	added := add(t, rDB, data.Risk{Title: tag + " threat", State: "open"})
+	assert.Nil(t, rDB.SoftDeleteByID(ctx, added.ID, 0))
+	assert.ErrorIs(t, rDB.SoftDeleteByID(ctx, added.ID, 0), data.ErrNotFound)
+	_, err := rDB.GetByID(ctx, added.ID)
+	assert.ErrorIs(t, err, data.ErrNotFound)
+
+	resp, err := rDB.GetAll(ctx, data.Options{Limit: 10, Sort: []data.SortKey{{Field: "title"}}, Filter: data.Filter{Title: tag}, Count: data.CountExact})
+	assert.Nil(t, err)
+	assert.Equal(t, 0, *resp.TotalCount)
+
+	trash, err := rDB.GetDeleted(ctx, data.Options{Limit: 100})
+	assert.Nil(t, err)
+	assert.GreaterOrEqual(t, *trash.TotalCount, 1)
+	var deleted *data.Risk
+	for i := range trash.Risks {
+		if trash.Risks[i].ID == added.ID {
+			deleted = &trash.Risks[i]
+		}
+	}
+	if assert.NotNil(t, deleted, "the deleted risk is in the trash") {
+		assert.NotNil(t, deleted.DeletedAt)
+	}
+
+	assert.Nil(t, rDB.RestoreByID(ctx, added.ID))
+	assert.ErrorIs(t, rDB.RestoreByID(ctx, added.ID), data.ErrNotFound)
+	_, err = rDB.GetByID(ctx, added.ID)
+	assert.Nil(t, err)
+
+	assert.Nil(t, rDB.SoftDeleteByID(ctx, added.ID, 0))
+	purged, err := rDB.PurgeDeletedBefore(ctx, time.Now().Add(time.Minute))
+	assert.Nil(t, err)
+	assert.GreaterOrEqual(t, purged, int64(1))
+	assert.ErrorIs(t, rDB.RestoreByID(ctx, added.ID), data.ErrNotFound)
+}
+
+func testHistory(t *testing.T, rDB RiskDB) {
+	ctx := data.WithAudit(context.Background(), data.Audit{Actor: "alice", RequestID: "request-1"})
+	tag := newTag()
+
+	risk := data.Risk{ID: uuid.New(), Title: tag + " threat", State: "open"}
+	added, err := rDB.Add(ctx, risk)
+	if err != nil {
+		t.Fatalf("error adding test data: %s", err)
+	}
+	risk.Title = tag + " updated"
+	_, err = rDB.Update(data.WithAudit(ctx, data.Audit{Actor: "bob", Reason: "renamed"}), risk)
+	assert.Nil(t, err)
+	assert.Nil(t, rDB.SoftDeleteByID(ctx, risk.ID, 0))
+	assert.Nil(t, rDB.RestoreByID(ctx, risk.ID))
+	assert.Nil(t, rDB.DeleteByID(ctx, risk.ID))
+
+	history, err := rDB.GetHistory(ctx, risk.ID)
+	assert.Nil(t, err)
+	if !assert.Len(t, history, 5) {
+		return
+	}
+	var actions []data.Action
+	for _, entry := range history {
+		actions = append(actions, entry.Action)
+		assert.Equal(t, risk.ID, entry.RiskID)
+		assert.False(t, entry.ChangedAt.IsZero())
+	}
+	assert.Equal(t, []data.Action{data.ActionCreated, data.ActionUpdated, data.ActionDeleted, data.ActionRestored, data.ActionPurged}, actions)
+
+	created := history[0]
+	assert.Equal(t, "alice", created.Actor)
+	assert.Equal(t, "request-1", created.RequestID)
+	assert.Nil(t, created.Before)
+	if assert.NotNil(t, created.After) {
+		assert.Equal(t, added.Title, created.After.Title)
+		assert.True(t, added.CreatedAt.Equal(created.After.CreatedAt))
+	}
+
+	updated := history[1]
+	assert.Equal(t, "bob", updated.Actor)
+	assert.Equal(t, "renamed", updated.Reason)
+	assert.Equal(t, tag+" threat", updated.Before.Title)
+	assert.Equal(t, tag+" updated", updated.After.Title)
+
+	assert.Nil(t, history[2].Before.DeletedAt)
+	assert.NotNil(t, history[2].After.DeletedAt)
+	assert.NotNil(t, history[3].Before.DeletedAt)
+	assert.Nil(t, history[3].After.DeletedAt)
+	assert.NotNil(t, history[4].Before)
+	assert.Nil(t, history[4].After)
+
+	history, err = rDB.GetHistory(ctx, uuid.New())
+	assert.Nil(t, err)
+	assert.Empty(t, history)
+}
+
+func testVersion(t *testing.T, rDB RiskDB) {
+	ctx := context.Background()
+	tag := newTag()
+
+	added := add(t, rDB, data.Risk{Title: tag + " threat", State: "open"})
+	assert.Equal(t, int64(1), added.Version)
+
+	risk := added
+	risk.Title = tag + " updated"
+	updated, err := rDB.Update(ctx, risk)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(2), updated.Version)
+
+	_, err = rDB.Update(ctx, risk)
+	assert.ErrorIs(t, err, data.ErrPreconditionFailed)
+	assert.ErrorIs(t, rDB.SoftDeleteByID(ctx, added.ID, 1), data.ErrPreconditionFailed)
+
+	risk.Version = 0
+	updated, err = rDB.Update(ctx, risk)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(3), updated.Version)
+
+	assert.Nil(t, rDB.SoftDeleteByID(ctx, added.ID, 3))
+	assert.Nil(t, rDB.RestoreByID(ctx, added.ID))
+	restored, err := rDB.GetByID(ctx, added.ID)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(5), restored.Version)
+}
+
+func testIdempotency(t *testing.T, rDB RiskDB) {
+	ctx := context.Background()
+	tag := newTag()
+	addIdempotent := func(title string, key data.IdempotencyKey) (data.Risk, bool, error) {
+		added, replayed, err := rDB.AddIdempotent(ctx, data.Risk{ID: uuid.New(), Title: title, State: "open"}, key)
+		if err == nil && !replayed {
+			t.Cleanup(func() {
+				if err := rDB.DeleteByID(ctx, added.ID); err != nil {
+					t.Logf("error cleaning up test data: %s", err)
+				}
+			})
+		}
+		return added, replayed, err
+	}
+	key := data.IdempotencyKey{Key: tag + "-1", RequestHash: "hash 1", ExpiresAt: time.Now().Add(time.Hour)}
+
+	added, replayed, err := addIdempotent(tag+" threat", key)
+	assert.Nil(t, err)
+	assert.False(t, replayed)
+
+	risk := added
+	risk.Title = tag + " updated"
+	_, err = rDB.Update(ctx, risk)
+	assert.Nil(t, err)
+
+	retried, replayed, err := addIdempotent(tag+" threat", key)
+	assert.Nil(t, err)
+	assert.True(t, replayed)
+	assert.Equal(t, added.ID, retried.ID)
+	assert.Equal(t, tag+" threat", retried.Title)
+	assert.Equal(t, int64(1), retried.Version)
+	assert.True(t, added.CreatedAt.Equal(retried.CreatedAt))
+
+	_, _, err = addIdempotent(tag+" other", data.IdempotencyKey{Key: key.Key, RequestHash: "hash 2", ExpiresAt: key.ExpiresAt})
+	assert.ErrorIs(t, err, data.ErrIdempotencyKeyReused)
+
+	expired := data.IdempotencyKey{Key: tag + "-2", RequestHash: "hash 1", ExpiresAt: time.Now().Add(-time.Minute)}
+	first, _, err := addIdempotent(tag+" threat", expired)
+	assert.Nil(t, err)
+	second, replayed, err := addIdempotent(tag+" threat", expired)
+	assert.Nil(t, err)
+	assert.False(t, replayed)
+	assert.NotEqual(t, first.ID, second.ID)
+
+	purged, err := rDB.PurgeExpiredIdempotencyKeys(ctx, time.Now())
+	assert.Nil(t, err)
+	assert.GreaterOrEqual(t, purged, int64(1))
+	_, replayed, err = addIdempotent(tag+" threat", key)
+	assert.Nil(t, err)
+	assert.True(t, replayed)
+}
+
+func testBatch(t *testing.T, rDB RiskDB) {
+	ctx := context.Background()
+	tag := newTag()
+	a := add(t, rDB, data.Risk{Title: tag + " a", State: "open"})
+	b := add(t, rDB, data.Risk{Title: tag + " b", State: "open"})
+	errRejected := data.Errorf(data.ErrConflict, "rejected")
+	check := func(current data.Risk, operation data.BatchOperation) error {
+		if operation.Title == tag+" rejected" {
+			return errRejected
+		}
+		return nil
+	}
+	batch := func(mode data.BatchMode, operations ...data.BatchOperation) ([]data.BatchResult, error) {
+		results, err := rDB.Batch(ctx, operations, mode, check)
+		for _, result := range results {
+			if result.Action == data.BatchCreate && result.Err == nil {
+				ID := result.Risk.ID
+				t.Cleanup(func() {
+					if err := rDB.DeleteByID(ctx, ID); err != nil {
+						t.Logf("error cleaning up test data: %s", err)
+					}
+				})
+			}
+		}
+		return results, err
+	}
+	listed := func() []string {
+		response, err := rDB.GetAll(ctx, data.Options{Limit: 10, Sort: []data.SortKey{{Field: "title"}}, Filter: data.Filter{Title: tag}})
+		assert.Nil(t, err)
+		return titles(response.Risks)
+	}
+
+	_, err := batch(data.BatchAtomic,
+		data.BatchOperation{Action: data.BatchCreate, ID: uuid.New(), Title: tag + " c", State: "open"},
+		data.BatchOperation{Action: data.BatchUpdate, ID: a.ID, Version: 1, Title: tag + " a2", State: "open"},
+		data.BatchOperation{Action: data.BatchDelete, ID: b.ID, Version: 9},
+	)
+	var batchErr *data.BatchError
+	if assert.ErrorAs(t, err, &batchErr) {
+		assert.Equal(t, 2, batchErr.Index)
+	}
+	assert.ErrorIs(t, err, data.ErrPreconditionFailed)
+	assert.Equal(t, []string{tag + " a", tag + " b"}, listed())
+	history, err := rDB.GetHistory(ctx, a.ID)
+	assert.Nil(t, err)
+	assert.Len(t, history, 1)
+
+	results, err := batch(data.BatchAtomic,
+		data.BatchOperation{Action: data.BatchCreate, ID: uuid.New(), Title: tag + " c", State: "open"},
+		data.BatchOperation{Action: data.BatchUpdate, ID: a.ID, Version: 1, Title: tag + " a2", State: "open"},
+		data.BatchOperation{Action: data.BatchUpdate, ID: a.ID, Version: 2, Title: tag + " a3", State: "investigating"},
+		data.BatchOperation{Action: data.BatchDelete, ID: b.ID, Version: 1},
+	)
+	assert.Nil(t, err)
+	if !assert.Len(t, results, 4) {
+		return
+	}
+	assert.Equal(t, int64(1), results[0].Risk.Version)
+	assert.False(t, results[0].Risk.CreatedAt.IsZero())
+	assert.Equal(t, int64(2), results[1].Risk.Version)
+	assert.Equal(t, int64(3), results[2].Risk.Version)
+	assert.Equal(t, data.State("investigating"), results[2].Risk.State)
+	assert.Equal(t, int64(2), results[3].Risk.Version)
+	assert.NotNil(t, results[3].Risk.DeletedAt)
+	assert.Equal(t, []string{tag + " a3", tag + " c"}, listed())
+
+	history, err = rDB.GetHistory(ctx, a.ID)
+	assert.Nil(t, err)
+	if assert.Len(t, history, 3) {
+		assert.Equal(t, data.ActionUpdated, history[2].Action)
+		assert.Equal(t, tag+" a2", history[2].Before.Title)
+		assert.Equal(t, tag+" a3", history[2].After.Title)
+	}
+	history, err = rDB.GetHistory(ctx, b.ID)
+	assert.Nil(t, err)
+	if assert.Len(t, history, 2) {
+		assert.Equal(t, data.ActionDeleted, history[1].Action)
+	}
+
+	results, err = batch(data.BatchBestEffort,
+		data.BatchOperation{Action: data.BatchUpdate, ID: b.ID, Version: 2, Title: tag + " b2", State: "open"},
+		data.BatchOperation{Action: data.BatchUpdate, ID: a.ID, Version: 3, Title: tag + " rejected", State: "investigating"},
+		data.BatchOperation{Action: data.BatchCreate, ID: uuid.New(), Title: tag + " d", State: "open"},
+	)
+	assert.Nil(t, err)
+	if !assert.Len(t, results, 3) {
+		return
+	}
+	assert.ErrorIs(t, results[0].Err, data.ErrNotFound)
+	assert.ErrorIs(t, results[1].Err, errRejected)
+	assert.Nil(t, results[2].Err)
+	assert.Equal(t, []string{tag + " a3", tag + " c", tag + " d"}, listed())
+}
+
+func testExternalRef(t *testing.T, rDB RiskDB) {
+	ctx := context.Background()
+	tag := newTag()
+	a := add(t, rDB, data.Risk{Title: tag + " a", State: "open", ExternalRef: tag + "-1"})
+	b := add(t, rDB, data.Risk{Title: tag + " b", State: "open", ExternalRef: tag + "-2"})
+	add(t, rDB, data.Risk{Title: tag + " c", State: "open"})
+	add(t, rDB, data.Risk{Title: tag + " d", State: "open"})
+	assert.Equal(t, tag+"-1", a.ExternalRef)
+
+	_, err := rDB.Add(ctx, data.Risk{ID: uuid.New(), Title: tag + " e", State: "open", ExternalRef: tag + "-1"})
+	assert.ErrorIs(t, err, data.ErrConflict)
+	b.ExternalRef = tag + "-1"
+	_, err = rDB.Update(ctx, b)
+	assert.ErrorIs(t, err, data.ErrConflict)
+
+	assert.Nil(t, rDB.SoftDeleteByID(ctx, b.ID, 0))
+	risks, err := rDB.GetByExternalRefs(ctx, []string{tag + "-1", tag + "-2", tag + "-3"})
+	assert.Nil(t, err)
+	if !assert.Len(t, risks, 2) {
+		return
+	}
+	byRef := map[string]data.Risk{}
+	for _, risk := range risks {
+		byRef[risk.ExternalRef] = risk
+	}
+	assert.Equal(t, a.ID, byRef[tag+"-1"].ID)
+	assert.Nil(t, byRef[tag+"-1"].DeletedAt)
+	assert.Equal(t, b.ID, byRef[tag+"-2"].ID)
+	assert.NotNil(t, byRef[tag+"-2"].DeletedAt, "deleted risks keep their external reference")
+}
+
+func testBatchExternalRef(t *testing.T, rDB RiskDB) {
+	ctx := context.Background()
+	tag := newTag()
+	a := add(t, rDB, data.Risk{Title: tag + " a", State: "open", ExternalRef: tag + "-1"})
+	b := add(t, rDB, data.Risk{Title: tag + " b", State: "open"})
+	accept := func(current data.Risk, operation data.BatchOperation) error { return nil }
+	batch := func(mode data.BatchMode, operations ...data.BatchOperation) ([]data.BatchResult, error) {
+		results, err := rDB.Batch(ctx, operations, mode, accept)
+		for _, result := range results {
+			if result.Action == data.BatchCreate && result.Err == nil {
+				ID := result.Risk.ID
+				t.Cleanup(func() {
+					if err := rDB.DeleteByID(ctx, ID); err != nil {
+						t.Logf("error cleaning up test data: %s", err)
+					}
+				})
+			}
+		}
+		return results, err
+	}
+	listed := func() []string {
+		response, err := rDB.GetAll(ctx, data.Options{Limit: 10, Sort: []data.SortKey{{Field: "title"}}, Filter: data.Filter{Title: tag}})
+		assert.Nil(t, err)
+		return titles(response.Risks)
+	}
+
+	_, err := batch(data.BatchAtomic,
+		data.BatchOperation{Action: data.BatchCreate, ID: uuid.New(), Title: tag + " c", State: "open", ExternalRef: tag + "-2"},
+		data.BatchOperation{Action: data.BatchCreate, ID: uuid.New(), Title: tag + " d", State: "open", ExternalRef: tag + "-1"},
+	)
+	var batchErr *data.BatchError
+	if assert.ErrorAs(t, err, &batchErr) {
+		assert.Equal(t, 1, batchErr.Index)
+	}
+	assert.ErrorIs(t, err, data.ErrConflict)
+	assert.Equal(t, []string{tag + " a", tag + " b"}, listed())
+
+	results, err := batch(data.BatchBestEffort,
+		// held by a stored risk
+		data.BatchOperation{Action: data.BatchCreate, ID: uuid.New(), Title: tag + " c", State: "open", ExternalRef: tag + "-1"},
+		data.BatchOperation{Action: data.BatchCreate, ID: uuid.New(), Title: tag + " d", State: "open", ExternalRef: tag + "-2"},
+		// held by an earlier operation of the batch
+		data.BatchOperation{Action: data.BatchCreate, ID: uuid.New(), Title: tag + " e", State: "open", ExternalRef: tag + "-2"},
+		data.BatchOperation{Action: data.BatchUpdate, ID: b.ID, Version: 1, Title: tag + " b2", State: "open", ExternalRef: tag + "-2"},
+		// released by an earlier operation of the batch
+		data.BatchOperation{Action: data.BatchUpdate, ID: a.ID, Version: 1, Title: tag + " a2", State: "open", ExternalRef: tag + "-3"},
+		data.BatchOperation{Action: data.BatchCreate, ID: uuid.New(), Title: tag + " f", State: "open", ExternalRef: tag + "-1"},
+	)
+	assert.Nil(t, err)
+	if !assert.Len(t, results, 6) {
+		return
+	}
+	for i, conflict := range []bool{true, false, true, true, false, false} {
+		if conflict {
+			assert.ErrorIs(t, results[i].Err, data.ErrConflict, "operations[%d]", i)
+		} else {
+			assert.Nil(t, results[i].Err, "operations[%d]", i)
+		}
+	}
+	assert.Equal(t, []string{tag + " a2", tag + " b", tag + " d", tag + " f"}, listed())
+}
+
+func testExport(t *testing.T, rDB RiskDB) {
+	ctx := context.Background()
+	tag := newTag()
+	for _, title := range []string{"b", "d", "a", "c"} {
+		add(t, rDB, data.Risk{Title: tag + " " + title, State: "open"})
+	}
+	add(t, rDB, data.Risk{Title: tag + " e", State: "closed"})
+	deleted := add(t, rDB, data.Risk{Title: tag + " f", State: "open"})
+	assert.Nil(t, rDB.SoftDeleteByID(ctx, deleted.ID, 0))
+
+	var exported []data.Risk
+	err := rDB.Export(ctx, data.Options{Sort: []data.SortKey{{Field: "title", Descending: true}}, Filter: data.Filter{Title: tag, States: []data.State{"open"}}}, func(risk data.Risk) error {
+		exported = append(exported, risk)
+		return nil
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{tag + " d", tag + " c", tag + " b", tag + " a"}, titles(exported))
+
+	errStop := errors.New("stop")
+	calls := 0
+	err = rDB.Export(ctx, data.Options{Filter: data.Filter{Title: tag}}, func(risk data.Risk) error {
+		calls++
+		return errStop
+	})
+	assert.ErrorIs(t, err, errStop)
+	assert.Equal(t, 1, calls)
+}
+
+func testScores(t *testing.T, rDB RiskDB) {
+	ctx := context.Background()
+	tag := newTag()
+	scoring := data.Scoring{Scale: 5, MediumScore: 5, HighScore: 10, CriticalScore: 15}
+	for _, risk := range []data.Risk{
+		{Title: tag + " a", State: "open", Likelihood: 2, Impact: 2},
+		{Title: tag + " b", State: "open", Likelihood: 4, Impact: 5, ResidualLikelihood: 3, ResidualImpact: 4},
+		{Title: tag + " c", State: "open", Likelihood: 3, Impact: 3},
+		{Title: tag + " d", State: "closed", Likelihood: 5, Impact: 2},
+	} {
+		add(t, rDB, risk.Score(scoring))
+	}
+
+	risk, err := rDB.GetAll(ctx, data.Options{Limit: 1, Filter: data.Filter{Title: tag + " b"}, Count: data.CountNone})
+	assert.Nil(t, err)
+	if assert.Len(t, risk.Risks, 1) {
+		b := risk.Risks[0]
+		assert.Equal(t, []int{4, 5, 3, 4, 20, 12}, []int{b.Likelihood, b.Impact, b.ResidualLikelihood, b.ResidualImpact, b.InherentScore, b.ResidualScore})
+		assert.Equal(t, data.SeverityHigh, b.Severity)
+	}
+
+	options := data.Options{Limit: 2, Sort: []data.SortKey{{Field: "residualScore"}}, Filter: data.Filter{Title: tag}, Count: data.CountNone}
+	first, err := rDB.GetAll(ctx, options)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{tag + " a", tag + " c"}, titles(first.Risks))
+	options.After = first.NextCursor
+	second, err := rDB.GetAll(ctx, options)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{tag + " d", tag + " b"}, titles(second.Risks), "scores sort as numbers")
+
+	resp, err := rDB.GetAll(ctx, data.Options{Limit: 10, Sort: []data.SortKey{{Field: "inherentScore", Descending: true}}, Filter: data.Filter{Title: tag, Severities: []data.Severity{data.SeverityHigh}}, Count: data.CountExact})
+	assert.Nil(t, err)
+	assert.Equal(t, 2, *resp.TotalCount)
+	assert.Equal(t, []string{tag + " b", tag + " d"}, titles(resp.Risks))
+
+	resp, err = rDB.GetAll(ctx, data.Options{Limit: 10, Sort: []data.SortKey{{Field: "title"}}, Filter: data.Filter{Title: tag, MinScore: 9, MaxScore: 10}, Count: data.CountExact})
+	assert.Nil(t, err)
+	assert.Equal(t, 2, *resp.TotalCount)
+	assert.Equal(t, []string{tag + " c", tag + " d"}, titles(resp.Risks))
+}
+
+func testCountByRatings(t *testing.T, rDB RiskDB) {
+	ctx := context.Background()
+	tag := newTag()
+	scoring := data.Scoring{Scale: 5, MediumScore: 5, HighScore: 10, CriticalScore: 15}
+	a := add(t, rDB, data.Risk{Title: tag + " a", State: "open", Likelihood: 4, Impact: 5, ResidualLikelihood: 2}.Score(scoring))
+	b := add(t, rDB, data.Risk{Title: tag + " b", State: "open", Likelihood: 4, Impact: 5}.Score(scoring))
+	c := add(t, rDB, data.Risk{Title: tag + " c", State: "open", Likelihood: 2, Impact: 5}.Score(scoring))
+	add(t, rDB, data.Risk{Title: tag + " d", State: "closed", Likelihood: 4, Impact: 5}.Score(scoring))
+	deleted := add(t, rDB, data.Risk{Title: tag + " e", State: "open", Likelihood: 4, Impact: 5}.Score(scoring))
+	assert.Nil(t, rDB.SoftDeleteByID(ctx, deleted.ID, 0))
+
+	byRatings := func(cells []data.HeatMapCell) map[[2]int]data.HeatMapCell {
+		m := map[[2]int]data.HeatMapCell{}
+		for _, cell := range cells {
+			slices.SortFunc(cell.RiskIDs, func(a, b uuid.UUID) int { return strings.Compare(a.String(), b.String()) })
+			m[[2]int{cell.Likelihood, cell.Impact}] = cell
+		}
+		return m
+	}
+	sorted := func(IDs ...uuid.UUID) []uuid.UUID {
+		slices.SortFunc(IDs, func(a, b uuid.UUID) int { return strings.Compare(a.String(), b.String()) })
+		return IDs
+	}
+	open := data.Filter{Title: tag, States: []data.State{"open"}}
+
+	cells, err := rDB.CountByRatings(ctx, data.HeatMapOptions{Filter: open, Rating: data.RatingResidual, WithIDs: true})
+	assert.Nil(t, err)
+	assert.Equal(t, map[[2]int]data.HeatMapCell{
+		{2, 5}: {Likelihood: 2, Impact: 5, Count: 2, RiskIDs: sorted(a.ID, c.ID)},
+		{4, 5}: {Likelihood: 4, Impact: 5, Count: 1, RiskIDs: []uuid.UUID{b.ID}},
+	}, byRatings(cells))
+
+	cells, err = rDB.CountByRatings(ctx, data.HeatMapOptions{Filter: data.Filter{Title: tag}, Rating: data.RatingInherent})
+	assert.Nil(t, err)
+	assert.Equal(t, map[[2]int]data.HeatMapCell{
+		{2, 5}: {Likelihood: 2, Impact: 5, Count: 1},
+		{4, 5}: {Likelihood: 4, Impact: 5, Count: 3},
+	}, byRatings(cells))
+}
+
+// addUser adds a user with a tagged ID, the users are not deleted since nothing but the scenarios look at them
+func addUser(t *testing.T, rDB RiskDB, user data.User) data.User {
+	t.Helper()
+	added, err := rDB.AddUser(context.Background(), user)
+	if err != nil {
+		t.Fatalf("error adding test data: %s", err)
+	}
+	return added
+}
+
+func testUsers(t *testing.T, rDB RiskDB) {
+	ctx := context.Background()
+	tag := newTag()
+	alice := addUser(t, rDB, data.User{ID: tag + "-alice", Name: "Alice", Email: "alice@example.com", Active: true})
+	bob := addUser(t, rDB, data.User{ID: tag + "-bob", Name: "Bob"})
+	assert.False(t, alice.CreatedAt.IsZero())
+	assert.Equal(t, alice.CreatedAt, alice.UpdatedAt)
+
+	_, err := rDB.AddUser(ctx, data.User{ID: alice.ID, Name: "Alice again", Active: true})
+	assert.ErrorIs(t, err, data.ErrConflict)
+	_, err = rDB.GetUser(ctx, tag+"-carol")
+	assert.ErrorIs(t, err, data.ErrNotFound)
+
+	user, err := rDB.GetUser(ctx, alice.ID)
+	assert.Nil(t, err)
+	assert.Equal(t, alice.ID, user.ID)
+	assert.Equal(t, "alice@example.com", user.Email)
+	assert.True(t, user.Active)
+
+	users, err := rDB.GetUsers(ctx, data.UserFilter{IDs: []string{bob.ID, alice.ID, tag + "-carol"}})
+	assert.Nil(t, err)
+	if assert.Len(t, users, 2) {
+		assert.Equal(t, []string{alice.ID, bob.ID}, []string{users[0].ID, users[1].ID})
+	}
+	inactive := false
+	users, err = rDB.GetUsers(ctx, data.UserFilter{IDs: []string{alice.ID, bob.ID}, Active: &inactive})
+	assert.Nil(t, err)
+	if assert.Len(t, users, 1) {
+		assert.Equal(t, bob.ID, users[0].ID)
+	}
+
+	alice.Name, alice.Active = "Alice Liddell", false
+	updated, err := rDB.UpdateUser(ctx, alice)
+	assert.Nil(t, err)
+	assert.Equal(t, "Alice Liddell", updated.Name)
+	assert.False(t, updated.Active)
+	assert.True(t, updated.CreatedAt.Equal(alice.CreatedAt))
+	assert.False(t, updated.UpdatedAt.Before(alice.UpdatedAt))
+	_, err = rDB.UpdateUser(ctx, data.User{ID: tag + "-carol", Name: "Carol"})
+	assert.ErrorIs(t, err, data.ErrNotFound)
+}
+
+func testAssignment(t *testing.T, rDB RiskDB) {
+	ctx := context.Background()
+	tag := newTag()
+	alice := addUser(t, rDB, data.User{ID: tag + "-alice", Name: "Alice", Active: true})
+	bob := addUser(t, rDB, data.User{ID: tag + "-bob", Name: "Bob", Active: true})
+
+	a := add(t, rDB, data.Risk{Title: tag + " a", State: "open", Owner: alice.ID, Assignee: bob.ID})
+	b := add(t, rDB, data.Risk{Title: tag + " b", State: "open", Owner: bob.ID})
+	add(t, rDB, data.Risk{Title: tag + " c", State: "open"})
+	assert.Equal(t, []string{alice.ID, bob.ID}, []string{a.Owner, a.Assignee})
+
+	_, err := rDB.Add(ctx, data.Risk{ID: uuid.New(), Title: tag + " d", State: "open", Assignee: tag + "-carol"})
+	assert.ErrorIs(t, err, data.ErrValidation, "the assignee must be a user")
+
+	b.Assignee = alice.ID
+	b, err = rDB.Update(ctx, b)
+	assert.Nil(t, err)
+	assert.Equal(t, alice.ID, b.Assignee)
+	a.Assignee = ""
+	a, err = rDB.Update(ctx, a)
+	assert.Nil(t, err)
+	got, err := rDB.GetByID(ctx, a.ID)
+	assert.Nil(t, err)
+	assert.Equal(t, alice.ID, got.Owner)
+	assert.Equal(t, "", got.Assignee, "an empty assignee unassigns the risk")
+
+	for _, tt := range []struct {
+		filter   data.Filter
+		expected []string
+	}{
+		{data.Filter{Title: tag, Owner: alice.ID}, []string{tag + " a"}},
+		{data.Filter{Title: tag, Assignee: alice.ID}, []string{tag + " b"}},
+		{data.Filter{Title: tag, Involving: alice.ID}, []string{tag + " a", tag + " b"}},
+		{data.Filter{Title: tag, Involving: bob.ID}, []string{tag + " b"}},
+	} {
+		resp, err := rDB.GetAll(ctx, data.Options{Limit: 10, Sort: []data.SortKey{{Field: "title"}}, Filter: tt.filter, Count: data.CountExact})
+		assert.Nil(t, err)
+		assert.Equal(t, tt.expected, titles(resp.Risks), "filter %+v", tt.filter)
+		assert.Equal(t, len(tt.expected), *resp.TotalCount)
+	}
+
+	_, err = rDB.Batch(ctx, []data.BatchOperation{
+		data.NewBatchOperation(data.BatchCreate, data.Risk{ID: uuid.New(), Title: tag + " e", State: "open", Owner: tag + "-carol"}),
+	}, data.BatchAtomic, nil)
+	assert.ErrorIs(t, err, data.ErrValidation, "the owner must be a user")
+	resp, err := rDB.GetAll(ctx, data.Options{Limit: 10, Filter: data.Filter{Title: tag + " e"}, Count: data.CountExact})
+	assert.Nil(t, err)
+	assert.Equal(t, 0, *resp.TotalCount)
+}
+
+func testActors(t *testing.T, rDB RiskDB) {
+	tag := newTag()
+	alice := data.WithAudit(context.Background(), data.Audit{Actor: tag + "-alice"})
+	bob := data.WithAudit(context.Background(), data.Audit{Actor: tag + "-bob"})
+	addAs := func(ctx context.Context, title string) data.Risk {
+		t.Helper()
+		added, err := rDB.Add(ctx, data.Risk{ID: uuid.New(), Title: tag + " " + title, State: "open"})
+		if err != nil {
+			t.Fatalf("error adding test data: %s", err)
+		}
+		t.Cleanup(func() {
+			if err := rDB.DeleteByID(context.Background(), added.ID); err != nil {
+				t.Logf("error cleaning up test data: %s", err)
+			}
+		})
+		return added
+	}
+
+	a := addAs(alice, "a")
+	addAs(alice, "b")
+	addAs(bob, "c")
+	assert.Equal(t, []string{tag + "-alice", tag + "-alice"}, []string{a.CreatedBy, a.UpdatedBy})
+
+	a.Description = "updated by bob"
+	a.CreatedBy = tag + "-mallory"
+	a, err := rDB.Update(bob, a)
+	assert.Nil(t, err)
+	got, err := rDB.GetByID(context.Background(), a.ID)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{tag + "-alice", tag + "-bob"}, []string{got.CreatedBy, got.UpdatedBy}, "the creator is kept")
+	assert.False(t, got.UpdatedAt.Before(got.CreatedAt))
+
+	for _, tt := range []struct {
+		filter   data.Filter
+		expected []string
+	}{
+		{data.Filter{Title: tag, CreatedBy: tag + "-alice"}, []string{tag + " a", tag + " b"}},
+		{data.Filter{Title: tag, UpdatedBy: tag + "-bob"}, []string{tag + " a", tag + " c"}},
+	} {
+		resp, err := rDB.GetAll(context.Background(), data.Options{Limit: 10, Sort: []data.SortKey{{Field: "title"}}, Filter: tt.filter, Count: data.CountExact})
+		assert.Nil(t, err)
+		assert.Equal(t, tt.expected, titles(resp.Risks), "filter %+v", tt.filter)
+		assert.Equal(t, len(tt.expected), *resp.TotalCount)
+	}
+
+	options := data.Options{Limit: 2, Sort: []data.SortKey{{Field: "updatedBy", Descending: true}, {Field: "title"}}, Filter: data.Filter{Title: tag}, Count: data.CountNone}
+	first, err := rDB.GetAll(context.Background(), options)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{tag + " a", tag + " c"}, titles(first.Risks))
+	options.After = first.NextCursor
+	second, err := rDB.GetAll(context.Background(), options)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{tag + " b"}, titles(second.Risks))
+
+	// the risks can be added within the same instant, so only the order of their times is checked
+	options = data.Options{Limit: 2, Sort: []data.SortKey{{Field: "updatedAt"}}, Filter: data.Filter{Title: tag}, Count: data.CountNone}
+	var risks []data.Risk
+	for page := 0; page < 3; page++ {
+		resp, err := rDB.GetAll(context.Background(), options)
+		assert.Nil(t, err)
+		risks = append(risks, resp.Risks...)
+		if options.After = resp.NextCursor; options.After == nil {
+			break
+		}
+	}
+	assert.ElementsMatch(t, []string{tag + " a", tag + " b", tag + " c"}, titles(risks))
+	for i := 1; i < len(risks); i++ {
+		assert.False(t, risks[i].UpdatedAt.Before(risks[i-1].UpdatedAt), "times sort chronologically")
+	}
+}
+
+func testTags(t *testing.T, rDB RiskDB) {
+	ctx := context.Background()
+	tag := newTag()
+	cloud, vendor := tag+"-cloud", tag+"-vendor"
+	scoring := data.Scoring{Scale: 5, MediumScore: 5, HighScore: 10, CriticalScore: 15}
+	a := add(t, rDB, data.Risk{Title: tag + " a", State: "open", Tags: []string{vendor, cloud}}.Score(scoring))
+	b := add(t, rDB, data.Risk{Title: tag + " b", State: "open", Tags: []string{cloud}}.Score(scoring))
+	c := add(t, rDB, data.Risk{Title: tag + " c", State: "open"}.Score(scoring))
+	deleted := add(t, rDB, data.Risk{Title: tag + " d", State: "open", Tags: []string{cloud}}.Score(scoring))
+	assert.Nil(t, rDB.SoftDeleteByID(ctx, deleted.ID, 0))
+	assert.Equal(t, []string{vendor, cloud}, a.Tags, "the tags keep their order")
+	assert.Nil(t, c.Tags)
+
+	got, err := rDB.GetByID(ctx, a.ID)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{vendor, cloud}, got.Tags)
+
+	for _, tt := range []struct {
+		filter   data.Filter
+		expected []string
+	}{
+		{data.Filter{Title: tag, Tags: []string{cloud}}, []string{tag + " a", tag + " b"}},
+		{data.Filter{Title: tag, Tags: []string{cloud, vendor}}, []string{tag + " a"}},
+		{data.Filter{Title: tag, Tags: []string{vendor, tag + "-missing"}}, []string{}},
+	} {
+		resp, err := rDB.GetAll(ctx, data.Options{Limit: 10, Sort: []data.SortKey{{Field: "title"}}, Filter: tt.filter, Count: data.CountExact})
+		assert.Nil(t, err)
+		assert.Equal(t, tt.expected, titles(resp.Risks), "filter %+v", tt.filter)
+		assert.Equal(t, len(tt.expected), *resp.TotalCount)
+	}
+
+	cells, err := rDB.CountByRatings(ctx, data.HeatMapOptions{Filter: data.Filter{Title: tag, Tags: []string{cloud}}, Rating: data.RatingResidual})
+	assert.Nil(t, err)
+	assert.Equal(t, []data.HeatMapCell{{Likelihood: 3, Impact: 3, Count: 2}}, cells)
+
+	b.Tags = nil
+	b, err = rDB.Update(ctx, b)
+	assert.Nil(t, err)
+	assert.Nil(t, b.Tags, "the tags left out of an update are removed")
+	c.Tags = []string{vendor}
+	accept := func(current data.Risk, operation data.BatchOperation) error { return nil }
+	results, err := rDB.Batch(ctx, []data.BatchOperation{data.NewBatchOperation(data.BatchUpdate, c)}, data.BatchAtomic, accept)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{vendor}, results[0].Risk.Tags)
+
+	history, err := rDB.GetHistory(ctx, b.ID)
+	assert.Nil(t, err)
+	if assert.Len(t, history, 2) {
+		assert.Equal(t, []data.FieldChange{{Field: "tags", From: &cloud}}, data.Diff(history[1].Before, history[1].After))
+	}
+}
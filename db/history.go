@@ -0,0 +1,87 @@
+package db
+
+import (
+	"context"
+	_ "embed"
+	"encoding/json"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v4"
+	"stan-project/data"
+)
+
+//go:embed sql/insert_risk_history.sql
+var insertRiskHistory string
+
+// insertHistory records a change of a risk in its history, with the audit carried by the context.
+// It runs in the transaction of the change so that no change is left out of the history.
+func insertHistory(ctx context.Context, tx pgx.Tx, action data.Action, before, after *data.Risk) error {
+	risk := after
+	if risk == nil {
+		risk = before
+	}
+	beforeJSON, err := snapshot(before)
+	if err != nil {
+		return err
+	}
+	afterJSON, err := snapshot(after)
+	if err != nil {
+		return err
+	}
+
+	audit := data.AuditFrom(ctx)
+	_, err = tx.Exec(ctx, insertRiskHistory, risk.ID, action, audit.Actor, audit.RequestID, audit.Reason, beforeJSON, afterJSON)
+	return classifyError(err)
+}
+
+// snapshot encodes a version of a risk for the history, a nil risk is stored as NULL
+func snapshot(risk *data.Risk) (any, error) {
+	if risk == nil {
+		return nil, nil
+	}
+	encoded, err := json.Marshal(risk)
+	return string(encoded), err
+}
+
+//go:embed sql/get_risk_history.sql
+var getRiskHistory string
+
+// GetHistory lists the changes of a risk, oldest first. The history of a purged risk is kept.
+func (rdb *risksDB) GetHistory(ctx context.Context, ID uuid.UUID) ([]data.HistoryEntry, error) {
+	rows, err := rdb.db.client.Query(ctx, getRiskHistory, ID)
+	if err != nil {
+		return nil, classifyError(err)
+	}
+	defer rows.Close()
+
+	var history []data.HistoryEntry
+
+	for rows.Next() {
+		var entry data.HistoryEntry
+		var before, after []byte
+		err = rows.Scan(&entry.ID, &entry.RiskID, &entry.Action, &entry.Actor, &entry.RequestID, &entry.Reason, &entry.ChangedAt, &before, &after)
+		if err != nil {
+			return nil, classifyError(err)
+		}
+		if entry.Before, err = unmarshalSnapshot(before); err != nil {
+			return nil, err
+		}
+		if entry.After, err = unmarshalSnapshot(after); err != nil {
+			return nil, err
+		}
+		history = append(history, entry)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, classifyError(err)
+	}
+
+	return history, nil
+}
+
+func unmarshalSnapshot(encoded []byte) (*data.Risk, error) {
+	if encoded == nil {
+		return nil, nil
+	}
+	var risk data.Risk
+	err := json.Unmarshal(encoded, &risk)
+	return &risk, err
+}
@@ -0,0 +1,70 @@
+package memory
+
+import (
+	"context"
+	"github.com/google/uuid"
+	"stan-project/data"
+)
+
+// Batch applies the operations one after the other while holding the write lock. An atomic batch that fails is
+// rolled back by restoring the risks it changed and dropping the history it recorded.
+func (rdb *risksDB) Batch(ctx context.Context, operations []data.BatchOperation, mode data.BatchMode, check data.BatchCheck) ([]data.BatchResult, error) {
+	rdb.mu.Lock()
+	defer rdb.mu.Unlock()
+
+	// the risks as they were before the batch, a missing risk was created by the batch
+	original := map[uuid.UUID]*data.Risk{}
+	historyLength := len(rdb.history)
+	rollback := func() {
+		for ID, risk := range original {
+			if risk == nil {
+				delete(rdb.risks, ID)
+			} else {
+				rdb.risks[ID] = *risk
+			}
+		}
+		rdb.history = rdb.history[:historyLength]
+	}
+
+	results := make([]data.BatchResult, len(operations))
+	for i, operation := range operations {
+		results[i].Action = operation.Action
+		changed, err := rdb.applyOperation(ctx, operation, check, original)
+		if err != nil && mode == data.BatchAtomic {
+			rollback()
+			return nil, &data.BatchError{Index: i, Err: err}
+		}
+		results[i].Risk, results[i].Err = changed, err
+	}
+	return results, nil
+}
+
+// applyOperation checks and applies an operation of a batch, recording the risk it changes in original the first
+// time the risk is changed. The write lock must be held.
+func (rdb *risksDB) applyOperation(ctx context.Context, operation data.BatchOperation, check data.BatchCheck, original map[uuid.UUID]*data.Risk) (data.Risk, error) {
+	if operation.Action != data.BatchCreate {
+		current, err := rdb.current(operation.ID, operation.Version)
+		if err == nil {
+			err = check(current, operation)
+		}
+		if err != nil {
+			return data.Risk{}, err
+		}
+	}
+	if _, ok := original[operation.ID]; !ok {
+		var risk *data.Risk
+		if stored, exists := rdb.risks[operation.ID]; exists {
+			risk = &stored
+		}
+		original[operation.ID] = risk
+	}
+
+	switch operation.Action {
+	case data.BatchCreate:
+		return rdb.add(ctx, operation.Risk())
+	case data.BatchUpdate:
+		return rdb.update(ctx, operation.Risk())
+	default:
+		return rdb.softDelete(ctx, operation.ID, operation.Version)
+	}
+}
@@ -0,0 +1,49 @@
+package memory
+
+import (
+	"context"
+	"stan-project/data"
+	"time"
+)
+
+// idempotentAdd is the risk added with an idempotency key, as it was when it was added
+type idempotentAdd struct {
+	key  data.IdempotencyKey
+	risk data.Risk
+}
+
+// AddIdempotent adds a risk unless the idempotency key was already used, in which case the risk added by the first
+// request is returned as it was then, with replayed set
+func (rdb *risksDB) AddIdempotent(ctx context.Context, risk data.Risk, key data.IdempotencyKey) (data.Risk, bool, error) {
+	rdb.mu.Lock()
+	defer rdb.mu.Unlock()
+
+	if used, ok := rdb.idempotencyKeys[key.Key]; ok && used.key.ExpiresAt.After(rdb.now()) {
+		if used.key.RequestHash != key.RequestHash {
+			return data.Risk{}, false, data.Errorf(data.ErrIdempotencyKeyReused, "idempotency key %q was used with another request", key.Key)
+		}
+		return used.risk, true, nil
+	}
+
+	added, err := rdb.add(ctx, risk)
+	if err != nil {
+		return data.Risk{}, false, err
+	}
+	rdb.idempotencyKeys[key.Key] = idempotentAdd{key: key, risk: added}
+	return added, false, nil
+}
+
+// PurgeExpiredIdempotencyKeys deletes the idempotency keys that expired before the given time
+func (rdb *risksDB) PurgeExpiredIdempotencyKeys(ctx context.Context, before time.Time) (int64, error) {
+	rdb.mu.Lock()
+	defer rdb.mu.Unlock()
+
+	var purged int64
+	for key, used := range rdb.idempotencyKeys {
+		if !used.key.ExpiresAt.After(before) {
+			delete(rdb.idempotencyKeys, key)
+			purged++
+		}
+	}
+	return purged, nil
+}
@@ -0,0 +1,601 @@
+// Package memory stores the risks in memory, for local demos and tests without a database.
+// The risks are lost when the service stops.
+package memory
+
+import (
+	"context"
+	"github.com/google/uuid"
+	"html"
+	"slices"
+	"stan-project/data"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+)
+
+// Search ranks a query word matching the title higher than one matching the description, like the weights of the
+// postgres search column
+const (
+	titleWeight       = 1.0
+	descriptionWeight = 0.4
+)
+
+// risksDB has the same semantics as the postgres risks DB, except that strings are sorted byte-wise like with the C
+// collation and that search matches word prefixes without stemming
+type risksDB struct {
+	mu    sync.RWMutex
+	risks map[uuid.UUID]data.Risk
+	// history holds the changes of every risk, oldest first
+	history []data.HistoryEntry
+	// idempotencyKeys holds the risk added with every idempotency key
+	idempotencyKeys map[string]idempotentAdd
+	users           map[string]data.User
+	// now returns the time recorded on the risks, with the microsecond precision of postgres
+	now func() time.Time
+}
+
+func NewRisksDB() *risksDB {
+	return &risksDB{
+		risks:           map[uuid.UUID]data.Risk{},
+		idempotencyKeys: map[string]idempotentAdd{},
+		users:           map[string]data.User{},
+		now:             func() time.Time { return time.Now().UTC().Truncate(time.Microsecond) },
+	}
+}
+
+func (rdb *risksDB) Add(ctx context.Context, risk data.Risk) (data.Risk, error) {
+	rdb.mu.Lock()
+	defer rdb.mu.Unlock()
+
+	return rdb.add(ctx, risk)
+}
+
+// add adds a risk, the write lock must be held
+func (rdb *risksDB) add(ctx context.Context, risk data.Risk) (data.Risk, error) {
+	if _, exists := rdb.risks[risk.ID]; exists {
+		return data.Risk{}, data.Errorf(data.ErrConflict, "risk with ID: %s already exists", risk.ID)
+	}
+	if err := rdb.checkExternalRef(risk); err != nil {
+		return data.Risk{}, err
+	}
+	if err := rdb.checkUsers(risk); err != nil {
+		return data.Risk{}, err
+	}
+	now, actor := rdb.now(), data.AuditFrom(ctx).Actor
+	added := written(data.Risk{ID: risk.ID, CreatedAt: now, UpdatedAt: now, CreatedBy: actor, UpdatedBy: actor, Version: 1}, risk)
+	rdb.risks[risk.ID] = added
+	rdb.addHistory(ctx, now, data.ActionCreated, nil, &added)
+	return added, nil
+}
+
+func (rdb *risksDB) GetByID(ctx context.Context, ID uuid.UUID) (data.Risk, error) {
+	rdb.mu.RLock()
+	defer rdb.mu.RUnlock()
+
+	risk, ok := rdb.risks[ID]
+	if !ok || risk.DeletedAt != nil {
+		return data.Risk{}, data.Errorf(data.ErrNotFound, "risk with ID: %s not found", ID)
+	}
+	return risk, nil
+}
+
+// GetByExternalRefs lists the risks, deleted or not, with the given external references
+func (rdb *risksDB) GetByExternalRefs(ctx context.Context, refs []string) ([]data.Risk, error) {
+	rdb.mu.RLock()
+	defer rdb.mu.RUnlock()
+
+	var risks []data.Risk
+	for _, risk := range rdb.risks {
+		if risk.ExternalRef != "" && slices.Contains(refs, risk.ExternalRef) {
+			risks = append(risks, risk)
+		}
+	}
+	return risks, nil
+}
+
+// Update updates a risk, expecting it to have the version of the given risk unless that version is 0
+func (rdb *risksDB) Update(ctx context.Context, risk data.Risk) (data.Risk, error) {
+	rdb.mu.Lock()
+	defer rdb.mu.Unlock()
+
+	return rdb.update(ctx, risk)
+}
+
+// update updates a risk, the write lock must be held
+func (rdb *risksDB) update(ctx context.Context, risk data.Risk) (data.Risk, error) {
+	current, err := rdb.current(risk.ID, risk.Version)
+	if err == nil {
+		err = rdb.checkExternalRef(risk)
+	}
+	if err == nil {
+		err = rdb.checkUsers(risk)
+	}
+	if err != nil {
+		return data.Risk{}, err
+	}
+	updated := written(current, risk)
+	updated.UpdatedAt, updated.UpdatedBy = rdb.now(), data.AuditFrom(ctx).Actor
+	updated.Version++
+	rdb.risks[risk.ID] = updated
+	rdb.addHistory(ctx, updated.UpdatedAt, data.ActionUpdated, &current, &updated)
+	return updated, nil
+}
+
+// written returns the stored risk with the fields written by the given risk, the fields managed by the storage are kept
+func written(stored, risk data.Risk) data.Risk {
+	stored.Title, stored.Description, stored.State, stored.ExternalRef = risk.Title, risk.Description, risk.State, risk.ExternalRef
+	stored.Likelihood, stored.Impact, stored.ResidualLikelihood, stored.ResidualImpact = risk.Likelihood, risk.Impact, risk.ResidualLikelihood, risk.ResidualImpact
+	stored.InherentScore, stored.ResidualScore, stored.Severity = risk.InherentScore, risk.ResidualScore, risk.Severity
+	stored.Owner, stored.Assignee = risk.Owner, risk.Assignee
+	// the tags are copied so that the caller cannot change the stored risk through them, no tags are stored as nil
+	// like the other storages read them
+	stored.Tags = nil
+	if len(risk.Tags) > 0 {
+		stored.Tags = slices.Clone(risk.Tags)
+	}
+	return stored
+}
+
+// current returns a risk that is not deleted, expecting it to have the given version unless the version is 0.
+// The lock must be held.
+func (rdb *risksDB) current(ID uuid.UUID, version int64) (data.Risk, error) {
+	current, ok := rdb.risks[ID]
+	if !ok || current.DeletedAt != nil {
+		return data.Risk{}, data.Errorf(data.ErrNotFound, "risk with ID: %s not found", ID)
+	}
+	return current, checkVersion(current, version)
+}
+
+// checkExternalRef fails with ErrConflict when another risk, deleted or not, has the external reference of the risk,
+// like the unique index of the postgres risks table. The lock must be held.
+func (rdb *risksDB) checkExternalRef(risk data.Risk) error {
+	if risk.ExternalRef == "" {
+		return nil
+	}
+	for _, other := range rdb.risks {
+		if other.ExternalRef == risk.ExternalRef && other.ID != risk.ID {
+			return data.Errorf(data.ErrConflict, "risk with ID: %s already has the external reference %q", other.ID, risk.ExternalRef)
+		}
+	}
+	return nil
+}
+
+// checkUsers fails with ErrValidation when the owner or the assignee of the risk is not a user, like the foreign keys
+// of the postgres risks table. The lock must be held.
+func (rdb *risksDB) checkUsers(risk data.Risk) error {
+	for _, ID := range []string{risk.Owner, risk.Assignee} {
+		if _, ok := rdb.users[ID]; ID != "" && !ok {
+			return data.Errorf(data.ErrValidation, "user with ID: %s not found", ID)
+		}
+	}
+	return nil
+}
+
+// checkVersion fails with ErrPreconditionFailed when the risk does not have the expected version, 0 expects any version
+func checkVersion(risk data.Risk, version int64) error {
+	if version != 0 && risk.Version != version {
+		return data.Errorf(data.ErrPreconditionFailed, "risk with ID: %s has version %d, not %d", risk.ID, risk.Version, version)
+	}
+	return nil
+}
+
+// Export calls write with every risk matching the filter, in the sort order
+func (rdb *risksDB) Export(ctx context.Context, options data.Options, write func(risk data.Risk) error) error {
+	keys := data.WithTieBreaker(options.Sort)
+	rdb.mu.RLock()
+	risks := rdb.filter(options.Filter)
+	rdb.mu.RUnlock()
+
+	slices.SortFunc(risks, func(a, b data.Risk) int {
+		return compare(keys, a.SortValue, b.SortValue)
+	})
+	for _, risk := range risks {
+		if err := write(risk); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// CountByRatings counts the risks matching the filter by likelihood and impact
+func (rdb *risksDB) CountByRatings(ctx context.Context, options data.HeatMapOptions) ([]data.HeatMapCell, error) {
+	rdb.mu.RLock()
+	risks := rdb.filter(options.Filter)
+	rdb.mu.RUnlock()
+
+	type ratings struct{ likelihood, impact int }
+	var cells []data.HeatMapCell
+	index := map[ratings]int{}
+	for _, risk := range risks {
+		key := ratings{risk.ResidualLikelihood, risk.ResidualImpact}
+		if options.Rating == data.RatingInherent {
+			key = ratings{risk.Likelihood, risk.Impact}
+		}
+		i, ok := index[key]
+		if !ok {
+			i = len(cells)
+			index[key] = i
+			cells = append(cells, data.HeatMapCell{Likelihood: key.likelihood, Impact: key.impact})
+		}
+		cells[i].Count++
+		if options.WithIDs {
+			cells[i].RiskIDs = append(cells[i].RiskIDs, risk.ID)
+		}
+	}
+	return cells, nil
+}
+
+func (rdb *risksDB) GetAll(ctx context.Context, options data.Options) (data.PaginatedResponse, error) {
+	keys := data.WithTieBreaker(options.Sort)
+	if options.After != nil && options.After.Sort != data.FormatSort(keys) {
+		return data.PaginatedResponse{}, data.Errorf(data.ErrValidation, "the cursor was created for the sort order %q but the risks are sorted by %q", options.After.Sort, data.FormatSort(keys))
+	}
+	if options.After != nil && len(options.After.Values) != len(keys) {
+		return data.PaginatedResponse{}, data.Errorf(data.ErrValidation, "the cursor does not match the sort order %q", data.FormatSort(keys))
+	}
+
+	rdb.mu.RLock()
+	risks := rdb.filter(options.Filter)
+	rdb.mu.RUnlock()
+
+	count := countOf(options.Count, len(risks))
+	slices.SortFunc(risks, func(a, b data.Risk) int {
+		return compare(keys, a.SortValue, b.SortValue)
+	})
+
+	backward := options.After != nil && options.After.Backward
+	offset := options.Offset
+	if options.After != nil {
+		cursorValues := map[string]string{}
+		for i, key := range keys {
+			cursorValues[key.Field] = options.After.Values[i]
+		}
+		after := func(field string) string { return cursorValues[field] }
+		risks = slices.DeleteFunc(risks, func(risk data.Risk) bool {
+			c := compare(keys, risk.SortValue, after)
+			return c == 0 || (c < 0) != backward
+		})
+		// the risks before a backward cursor are read from the closest one
+		if backward {
+			slices.Reverse(risks)
+		}
+		offset = 0
+	}
+	risks = risks[min(offset, len(risks)):]
+
+	// one more risk than requested is kept to know whether there is another page
+	hasMore := len(risks) > options.Limit
+	risks = slices.Clip(risks[:min(options.Limit, len(risks))])
+	if backward {
+		slices.Reverse(risks)
+	}
+
+	response := data.PaginatedResponse{TotalCount: count}
+	if len(risks) == 0 {
+		return response, nil
+	}
+	response.Risks = risks
+	if (backward && hasMore) || (!backward && (options.After != nil || offset > 0)) {
+		response.PrevCursor = data.NewCursor(risks[0], keys, true)
+	}
+	if backward || hasMore {
+		response.NextCursor = data.NewCursor(risks[len(risks)-1], keys, false)
+	}
+	return response, nil
+}
+
+// Search lists the risks whose title or description have a word starting with every word of the query, most relevant first
+func (rdb *risksDB) Search(ctx context.Context, query string, options data.Options) (data.SearchResponse, error) {
+	queryWords := words(query)
+	if len(queryWords) == 0 {
+		zero := 0
+		return data.SearchResponse{TotalCount: &zero}, nil
+	}
+
+	rdb.mu.RLock()
+	risks := rdb.filter(options.Filter)
+	rdb.mu.RUnlock()
+
+	var results []data.SearchResult
+	for _, risk := range risks {
+		rank, ok := searchRank(queryWords, risk)
+		if !ok {
+			continue
+		}
+		results = append(results, data.SearchResult{
+			Risk:                 risk,
+			Rank:                 rank,
+			TitleHighlight:       highlight(risk.Title, queryWords),
+			DescriptionHighlight: highlight(risk.Description, queryWords),
+		})
+	}
+
+	count := countOf(options.Count, len(results))
+	slices.SortFunc(results, func(a, b data.SearchResult) int {
+		if a.Rank != b.Rank {
+			if a.Rank > b.Rank {
+				return -1
+			}
+			return 1
+		}
+		return strings.Compare(a.ID.String(), b.ID.String())
+	})
+	offset := options.Offset
+	if options.After != nil {
+		rank, ID, err := data.SearchCursorArgs(options.After)
+		if err != nil {
+			return data.SearchResponse{}, err
+		}
+		results = slices.DeleteFunc(results, func(result data.SearchResult) bool {
+			resultRank := float64(result.Rank)
+			return resultRank > rank || (resultRank == rank && result.ID.String() <= ID)
+		})
+		offset = 0
+	}
+	results = results[min(offset, len(results)):]
+
+	response := data.SearchResponse{TotalCount: count}
+	if len(results) > options.Limit {
+		last := results[options.Limit-1]
+		response.NextCursor = data.NewSearchCursor(float64(last.Rank), last.ID)
+	}
+	response.Risks = results[:min(options.Limit, len(results))]
+	if len(response.Risks) == 0 {
+		response.Risks = nil
+	}
+	return response, nil
+}
+
+// DeleteByID hard deletes a risk, deleted or not, it does nothing when the risk does not exist
+func (rdb *risksDB) DeleteByID(ctx context.Context, ID uuid.UUID) error {
+	rdb.mu.Lock()
+	defer rdb.mu.Unlock()
+
+	if risk, ok := rdb.risks[ID]; ok {
+		delete(rdb.risks, ID)
+		rdb.addHistory(ctx, rdb.now(), data.ActionPurged, &risk, nil)
+	}
+	return nil
+}
+
+// SoftDeleteByID moves a risk to the trash, expecting it to have the given version unless the version is 0
+func (rdb *risksDB) SoftDeleteByID(ctx context.Context, ID uuid.UUID, version int64) error {
+	rdb.mu.Lock()
+	defer rdb.mu.Unlock()
+
+	_, err := rdb.softDelete(ctx, ID, version)
+	return err
+}
+
+// softDelete moves a risk to the trash and returns it, the write lock must be held
+func (rdb *risksDB) softDelete(ctx context.Context, ID uuid.UUID, version int64) (data.Risk, error) {
+	current, err := rdb.current(ID, version)
+	if err != nil {
+		return data.Risk{}, err
+	}
+	deleted := current
+	deleted.Version++
+	deletedAt := rdb.now()
+	deleted.DeletedAt = &deletedAt
+	rdb.risks[ID] = deleted
+	rdb.addHistory(ctx, deletedAt, data.ActionDeleted, &current, &deleted)
+	return deleted, nil
+}
+
+func (rdb *risksDB) GetDeleted(ctx context.Context, options data.Options) (data.PaginatedResponse, error) {
+	rdb.mu.RLock()
+	var risks []data.Risk
+	for _, risk := range rdb.risks {
+		if risk.DeletedAt != nil {
+			risks = append(risks, risk)
+		}
+	}
+	rdb.mu.RUnlock()
+
+	count := len(risks)
+	slices.SortFunc(risks, func(a, b data.Risk) int {
+		if c := b.DeletedAt.Compare(*a.DeletedAt); c != 0 {
+			return c
+		}
+		return strings.Compare(a.ID.String(), b.ID.String())
+	})
+	risks = risks[min(options.Offset, len(risks)):]
+	risks = risks[:min(options.Limit, len(risks))]
+	if len(risks) == 0 {
+		risks = nil
+	}
+	return data.PaginatedResponse{TotalCount: &count, Risks: risks}, nil
+}
+
+func (rdb *risksDB) RestoreByID(ctx context.Context, ID uuid.UUID) error {
+	rdb.mu.Lock()
+	defer rdb.mu.Unlock()
+
+	current, ok := rdb.risks[ID]
+	if !ok || current.DeletedAt == nil {
+		return data.Errorf(data.ErrNotFound, "no deleted risk with ID: %s", ID)
+	}
+	restored := current
+	restored.DeletedAt = nil
+	restored.Version++
+	rdb.risks[ID] = restored
+	rdb.addHistory(ctx, rdb.now(), data.ActionRestored, &current, &restored)
+	return nil
+}
+
+// PurgeDeletedBefore hard deletes every risk that was soft deleted before the given time
+func (rdb *risksDB) PurgeDeletedBefore(ctx context.Context, before time.Time) (int64, error) {
+	rdb.mu.Lock()
+	defer rdb.mu.Unlock()
+
+	var purged int64
+	now := rdb.now()
+	for ID, risk := range rdb.risks {
+		if risk.DeletedAt != nil && risk.DeletedAt.Before(before) {
+			delete(rdb.risks, ID)
+			rdb.addHistory(ctx, now, data.ActionPurged, &risk, nil)
+			purged++
+		}
+	}
+	return purged, nil
+}
+
+// GetHistory lists the changes of a risk, oldest first. The history of a purged risk is kept.
+func (rdb *risksDB) GetHistory(ctx context.Context, ID uuid.UUID) ([]data.HistoryEntry, error) {
+	rdb.mu.RLock()
+	defer rdb.mu.RUnlock()
+
+	var history []data.HistoryEntry
+	for _, entry := range rdb.history {
+		if entry.RiskID == ID {
+			history = append(history, entry)
+		}
+	}
+	return history, nil
+}
+
+// addHistory records a change of a risk with the audit carried by the context, the write lock must be held.
+// The versions of the risk are copied so that the history does not share them with the caller.
+func (rdb *risksDB) addHistory(ctx context.Context, changedAt time.Time, action data.Action, before, after *data.Risk) {
+	audit := data.AuditFrom(ctx)
+	entry := data.HistoryEntry{
+		ID:        int64(len(rdb.history) + 1),
+		Action:    action,
+		Actor:     audit.Actor,
+		RequestID: audit.RequestID,
+		Reason:    audit.Reason,
+		ChangedAt: changedAt,
+	}
+	if before != nil {
+		risk := *before
+		entry.RiskID, entry.Before = risk.ID, &risk
+	}
+	if after != nil {
+		risk := *after
+		entry.RiskID, entry.After = risk.ID, &risk
+	}
+	rdb.history = append(rdb.history, entry)
+}
+
+// filter returns the risks that are not deleted and match the filter, in no particular order.
+// The read lock must be held.
+func (rdb *risksDB) filter(filter data.Filter) []data.Risk {
+	var risks []data.Risk
+	for _, risk := range rdb.risks {
+		if risk.DeletedAt == nil && matches(risk, filter) {
+			risks = append(risks, risk)
+		}
+	}
+	return risks
+}
+
+// matches reports whether the risk matches the filter, titles and descriptions are matched like with ILIKE
+func matches(risk data.Risk, filter data.Filter) bool {
+	switch {
+	case len(filter.States) > 0 && !slices.Contains(filter.States, risk.State),
+		filter.Title != "" && !containsFold(risk.Title, filter.Title),
+		filter.Description != "" && !containsFold(risk.Description, filter.Description),
+		filter.CreatedAfter != nil && risk.CreatedAt.Before(*filter.CreatedAfter),
+		filter.CreatedBefore != nil && !risk.CreatedAt.Before(*filter.CreatedBefore),
+		filter.UpdatedAfter != nil && risk.UpdatedAt.Before(*filter.UpdatedAfter),
+		filter.UpdatedBefore != nil && !risk.UpdatedAt.Before(*filter.UpdatedBefore),
+		len(filter.Severities) > 0 && !slices.Contains(filter.Severities, risk.Severity),
+		filter.MinScore > 0 && risk.ResidualScore < filter.MinScore,
+		filter.MaxScore > 0 && risk.ResidualScore > filter.MaxScore,
+		filter.Owner != "" && risk.Owner != filter.Owner,
+		filter.Assignee != "" && risk.Assignee != filter.Assignee,
+		filter.Involving != "" && risk.Owner != filter.Involving && risk.Assignee != filter.Involving,
+		filter.CreatedBy != "" && risk.CreatedBy != filter.CreatedBy,
+		filter.UpdatedBy != "" && risk.UpdatedBy != filter.UpdatedBy,
+		slices.ContainsFunc(filter.Tags, func(tag string) bool { return !slices.Contains(risk.Tags, tag) }):
+		return false
+	}
+	return true
+}
+
+func containsFold(s, substr string) bool {
+	return strings.Contains(strings.ToLower(s), strings.ToLower(substr))
+}
+
+// compare compares the sort values of two risks key by key
+func compare(keys []data.SortKey, a, b func(field string) string) int {
+	for _, key := range keys {
+		c := strings.Compare(a(key.Field), b(key.Field))
+		if key.Descending {
+			c = -c
+		}
+		if c != 0 {
+			return c
+		}
+	}
+	return 0
+}
+
+// countOf returns the count for the count mode, an estimate is the exact count as counting is cheap
+func countOf(mode data.CountMode, count int) *int {
+	if mode == data.CountNone {
+		return nil
+	}
+	return &count
+}
+
+// words splits the text into lower case words, anything but letters and digits separates words
+func words(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// searchRank ranks the risk for the query words, it does not match unless every query word matches
+func searchRank(queryWords []string, risk data.Risk) (float32, bool) {
+	titleWords, descriptionWords := words(risk.Title), words(risk.Description)
+	var rank float32
+	for _, word := range queryWords {
+		switch {
+		case hasPrefixed(titleWords, word):
+			rank += titleWeight
+		case hasPrefixed(descriptionWords, word):
+			rank += descriptionWeight
+		default:
+			return 0, false
+		}
+	}
+	return rank, true
+}
+
+func hasPrefixed(words []string, prefix string) bool {
+	return slices.ContainsFunc(words, func(word string) bool { return strings.HasPrefix(word, prefix) })
+}
+
+// highlight wraps the words of the text starting with a query word in <mark> tags, like the postgres headlines. The
+// text is HTML escaped, so that the marks are the only markup.
+func highlight(text string, queryWords []string) string {
+	var highlighted strings.Builder
+	for len(text) > 0 {
+		start := strings.IndexFunc(text, isWordRune)
+		if start < 0 {
+			highlighted.WriteString(html.EscapeString(text))
+			break
+		}
+		end := strings.IndexFunc(text[start:], func(r rune) bool { return !isWordRune(r) })
+		if end < 0 {
+			end = len(text)
+		} else {
+			end += start
+		}
+		word := text[start:end]
+		highlighted.WriteString(html.EscapeString(text[:start]))
+		if slices.ContainsFunc(queryWords, func(q string) bool { return strings.HasPrefix(strings.ToLower(word), q) }) {
+			highlighted.WriteString("<mark>" + html.EscapeString(word) + "</mark>")
+		} else {
+			highlighted.WriteString(html.EscapeString(word))
+		}
+		text = text[end:]
+	}
+	return highlighted.String()
+}
+
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r)
+}
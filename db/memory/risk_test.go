@@ -0,0 +1,248 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"stan-project/data"
+	"stan-project/db/dbtest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestRisksDB_Conformance(t *testing.T) {
+	dbtest.Run(t, NewRisksDB())
+}
+
+func TestRisksDB_Add(t *testing.T) {
+	t.Run("successfully add a new risk", func(t *testing.T) {
+		ctx := context.Background()
+		rDB := NewRisksDB()
+		now := time.Date(2024, 6, 1, 10, 0, 0, 0, time.UTC)
+		rDB.now = func() time.Time { return now }
+
+		riskID := uuid.MustParse("c7041e22-15c1-4293-9b43-c54c8dd4b909")
+		added, err := rDB.Add(ctx, data.Risk{ID: riskID, Title: "threat 1", Description: "a threat", State: "open"})
+		assert.Nil(t, err)
+		assert.Equal(t, data.Risk{ID: riskID, Title: "threat 1", Description: "a threat", State: "open", CreatedAt: now, UpdatedAt: now, Version: 1}, added)
+
+		risk, err := rDB.GetByID(ctx, riskID)
+		assert.Nil(t, err)
+		assert.Equal(t, added, risk)
+	})
+
+	t.Run("failed to add a risk with an existing ID", func(t *testing.T) {
+		ctx := context.Background()
+		rDB := NewRisksDB()
+
+		risk := data.Risk{ID: uuid.New(), Title: "threat 1", State: "open"}
+		_, err := rDB.Add(ctx, risk)
+		assert.Nil(t, err)
+
+		_, err = rDB.Add(ctx, risk)
+		assert.ErrorIs(t, err, data.ErrConflict)
+	})
+}
+
+func TestRisksDB_Update(t *testing.T) {
+	t.Run("successfully update a risk", func(t *testing.T) {
+		ctx := context.Background()
+		rDB := NewRisksDB()
+		created := time.Date(2024, 6, 1, 10, 0, 0, 0, time.UTC)
+		rDB.now = func() time.Time { return created }
+
+		added, err := rDB.Add(ctx, data.Risk{ID: uuid.New(), Title: "threat 1", State: "open"})
+		assert.Nil(t, err)
+
+		updatedAt := created.Add(time.Hour)
+		rDB.now = func() time.Time { return updatedAt }
+		updated, err := rDB.Update(ctx, data.Risk{ID: added.ID, Title: "threat 2", Description: "updated", State: "accepted", CreatedAt: updatedAt})
+		assert.Nil(t, err)
+		assert.Equal(t, data.Risk{ID: added.ID, Title: "threat 2", Description: "updated", State: "accepted", CreatedAt: created, UpdatedAt: updatedAt, Version: 2}, updated)
+	})
+
+	t.Run("failed to update a risk that does not exist", func(t *testing.T) {
+		_, err := NewRisksDB().Update(context.Background(), data.Risk{ID: uuid.New(), Title: "threat 1", State: "open"})
+		assert.ErrorIs(t, err, data.ErrNotFound)
+	})
+}
+
+func TestRisksDB_GetAll(t *testing.T) {
+	ctx := context.Background()
+	rDB := NewRisksDB()
+	created := time.Date(2024, 6, 1, 10, 0, 0, 0, time.UTC)
+	var ids []uuid.UUID
+	for i, state := range []data.State{"open", "closed", "open"} {
+		rDB.now = func() time.Time { return created.Add(time.Duration(i) * time.Hour) }
+		added, err := rDB.Add(ctx, data.Risk{ID: uuid.New(), Title: fmt.Sprintf("Threat %d", i+1), State: state})
+		if err != nil {
+			t.Fatalf("error adding test data: %s", err)
+		}
+		ids = append(ids, added.ID)
+	}
+	deleted, err := rDB.Add(ctx, data.Risk{ID: uuid.New(), Title: "Threat 0", State: "open"})
+	if err != nil {
+		t.Fatalf("error adding test data: %s", err)
+	}
+	if err = rDB.SoftDeleteByID(ctx, deleted.ID, 0); err != nil {
+		t.Fatalf("error deleting test data: %s", err)
+	}
+
+	titles := func(response data.PaginatedResponse) []string {
+		var titles []string
+		for _, risk := range response.Risks {
+			titles = append(titles, risk.Title)
+		}
+		return titles
+	}
+
+	t.Run("successfully sort and page the risks with an offset", func(t *testing.T) {
+		resp, err := rDB.GetAll(ctx, data.Options{Offset: 1, Limit: 1, Sort: []data.SortKey{{Field: "title", Descending: true}}, Count: data.CountExact})
+		assert.Nil(t, err)
+		assert.Equal(t, 3, *resp.TotalCount)
+		assert.Equal(t, []string{"Threat 2"}, titles(resp))
+		assert.NotNil(t, resp.PrevCursor)
+		assert.NotNil(t, resp.NextCursor)
+	})
+
+	t.Run("successfully sort by several fields", func(t *testing.T) {
+		resp, err := rDB.GetAll(ctx, data.Options{Limit: 10, Sort: []data.SortKey{{Field: "state", Descending: true}, {Field: "title"}}})
+		assert.Nil(t, err)
+		assert.Equal(t, []string{"Threat 1", "Threat 3", "Threat 2"}, titles(resp))
+		assert.Nil(t, resp.PrevCursor)
+		assert.Nil(t, resp.NextCursor)
+	})
+
+	t.Run("successfully filter the risks", func(t *testing.T) {
+		createdBefore := created.Add(2 * time.Hour)
+		resp, err := rDB.GetAll(ctx, data.Options{
+			Limit:  10,
+			Sort:   []data.SortKey{{Field: "title"}},
+			Filter: data.Filter{States: []data.State{"open"}, Title: "THREAT", CreatedAfter: &created, CreatedBefore: &createdBefore},
+			Count:  data.CountEstimate,
+		})
+		assert.Nil(t, err)
+		assert.Equal(t, 1, *resp.TotalCount)
+		assert.Equal(t, []string{"Threat 1"}, titles(resp))
+	})
+
+	t.Run("successfully page through risks with cursors", func(t *testing.T) {
+		options := data.Options{Limit: 2, Sort: []data.SortKey{{Field: "title"}}, Count: data.CountNone}
+
+		first, err := rDB.GetAll(ctx, options)
+		assert.Nil(t, err)
+		assert.Nil(t, first.TotalCount)
+		assert.Nil(t, first.PrevCursor)
+		assert.Equal(t, ids[:2], []uuid.UUID{first.Risks[0].ID, first.Risks[1].ID})
+
+		options.After = first.NextCursor
+		second, err := rDB.GetAll(ctx, options)
+		assert.Nil(t, err)
+		assert.Nil(t, second.NextCursor)
+		assert.Equal(t, []string{"Threat 3"}, titles(second))
+
+		options.After = second.PrevCursor
+		previous, err := rDB.GetAll(ctx, options)
+		assert.Nil(t, err)
+		assert.Equal(t, first.Risks, previous.Risks)
+		assert.Nil(t, previous.PrevCursor)
+
+		options.After = first.NextCursor
+		options.Sort = []data.SortKey{{Field: "state"}}
+		_, err = rDB.GetAll(ctx, options)
+		assert.ErrorIs(t, err, data.ErrValidation)
+	})
+}
+
+func TestRisksDB_Search(t *testing.T) {
+	t.Run("successfully search risks", func(t *testing.T) {
+		ctx := context.Background()
+		rDB := NewRisksDB()
+		inTitle, err := rDB.Add(ctx, data.Risk{ID: uuid.New(), Title: "DDoS attack", Description: "Attackers flooding the API", State: "open"})
+		assert.Nil(t, err)
+		inDescription, err := rDB.Add(ctx, data.Risk{ID: uuid.New(), Title: "threat 2", Description: "A ddos on the login page", State: "open"})
+		assert.Nil(t, err)
+		_, err = rDB.Add(ctx, data.Risk{ID: uuid.New(), Title: "threat 3", Description: "Leaked credentials", State: "open"})
+		assert.Nil(t, err)
+
+		resp, err := rDB.Search(ctx, "ddo", data.Options{Limit: 10, Count: data.CountExact})
+		assert.Nil(t, err)
+		assert.Equal(t, 2, *resp.TotalCount)
+		assert.Equal(t, inTitle.ID, resp.Risks[0].ID)
+		assert.Equal(t, "<mark>DDoS</mark> attack", resp.Risks[0].TitleHighlight)
+		assert.Equal(t, inDescription.ID, resp.Risks[1].ID)
+		assert.Equal(t, "A <mark>ddos</mark> on the login page", resp.Risks[1].DescriptionHighlight)
+		assert.Greater(t, resp.Risks[0].Rank, resp.Risks[1].Rank)
+
+		resp, err = rDB.Search(ctx, "ddos login", data.Options{Limit: 10})
+		assert.Nil(t, err)
+		assert.Len(t, resp.Risks, 1)
+		assert.Equal(t, inDescription.ID, resp.Risks[0].ID)
+
+		resp, err = rDB.Search(ctx, "&|!", data.Options{Limit: 10})
+		assert.Nil(t, err)
+		assert.Equal(t, 0, *resp.TotalCount)
+		assert.Empty(t, resp.Risks)
+	})
+}
+
+func TestRisksDB_Trash(t *testing.T) {
+	t.Run("successfully delete, restore and purge a risk", func(t *testing.T) {
+		ctx := context.Background()
+		rDB := NewRisksDB()
+		deletedAt := time.Date(2024, 6, 1, 10, 0, 0, 0, time.UTC)
+		rDB.now = func() time.Time { return deletedAt }
+
+		added, err := rDB.Add(ctx, data.Risk{ID: uuid.New(), Title: "threat 1", State: "open"})
+		assert.Nil(t, err)
+
+		assert.Nil(t, rDB.SoftDeleteByID(ctx, added.ID, 0))
+		assert.ErrorIs(t, rDB.SoftDeleteByID(ctx, added.ID, 0), data.ErrNotFound)
+		_, err = rDB.GetByID(ctx, added.ID)
+		assert.ErrorIs(t, err, data.ErrNotFound)
+
+		trash, err := rDB.GetDeleted(ctx, data.Options{Limit: 10})
+		assert.Nil(t, err)
+		assert.Equal(t, 1, *trash.TotalCount)
+		assert.Equal(t, &deletedAt, trash.Risks[0].DeletedAt)
+
+		assert.Nil(t, rDB.RestoreByID(ctx, added.ID))
+		assert.ErrorIs(t, rDB.RestoreByID(ctx, added.ID), data.ErrNotFound)
+		_, err = rDB.GetByID(ctx, added.ID)
+		assert.Nil(t, err)
+
+		assert.Nil(t, rDB.SoftDeleteByID(ctx, added.ID, 0))
+		purged, err := rDB.PurgeDeletedBefore(ctx, deletedAt)
+		assert.Nil(t, err)
+		assert.Equal(t, int64(0), purged)
+		purged, err = rDB.PurgeDeletedBefore(ctx, deletedAt.Add(time.Second))
+		assert.Nil(t, err)
+		assert.Equal(t, int64(1), purged)
+	})
+}
+
+func TestRisksDB_Concurrent(t *testing.T) {
+	t.Run("successfully add and list risks concurrently", func(t *testing.T) {
+		ctx := context.Background()
+		rDB := NewRisksDB()
+
+		var wg sync.WaitGroup
+		for i := 0; i < 50; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				_, err := rDB.Add(ctx, data.Risk{ID: uuid.New(), Title: fmt.Sprintf("threat %d", i), State: "open"})
+				assert.Nil(t, err)
+				_, err = rDB.GetAll(ctx, data.Options{Limit: 10, Count: data.CountExact})
+				assert.Nil(t, err)
+			}(i)
+		}
+		wg.Wait()
+
+		resp, err := rDB.GetAll(ctx, data.Options{Limit: 10, Count: data.CountExact})
+		assert.Nil(t, err)
+		assert.Equal(t, 50, *resp.TotalCount)
+	})
+}
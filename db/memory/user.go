@@ -0,0 +1,64 @@
+package memory
+
+import (
+	"context"
+	"slices"
+	"stan-project/data"
+	"strings"
+)
+
+// AddUser adds a user, it fails with data.ErrConflict when a user with the same ID exists
+func (rdb *risksDB) AddUser(ctx context.Context, user data.User) (data.User, error) {
+	rdb.mu.Lock()
+	defer rdb.mu.Unlock()
+
+	if _, exists := rdb.users[user.ID]; exists {
+		return data.User{}, data.Errorf(data.ErrConflict, "user with ID: %s already exists", user.ID)
+	}
+	user.CreatedAt = rdb.now()
+	user.UpdatedAt = user.CreatedAt
+	rdb.users[user.ID] = user
+	return user, nil
+}
+
+func (rdb *risksDB) GetUser(ctx context.Context, ID string) (data.User, error) {
+	rdb.mu.RLock()
+	defer rdb.mu.RUnlock()
+
+	user, ok := rdb.users[ID]
+	if !ok {
+		return data.User{}, data.Errorf(data.ErrNotFound, "user with ID: %s not found", ID)
+	}
+	return user, nil
+}
+
+// GetUsers lists the users matching the filter, ordered by ID
+func (rdb *risksDB) GetUsers(ctx context.Context, filter data.UserFilter) ([]data.User, error) {
+	rdb.mu.RLock()
+	defer rdb.mu.RUnlock()
+
+	users := []data.User{}
+	for _, user := range rdb.users {
+		if filter.IDs != nil && !slices.Contains(filter.IDs, user.ID) || filter.Active != nil && *filter.Active != user.Active {
+			continue
+		}
+		users = append(users, user)
+	}
+	slices.SortFunc(users, func(a, b data.User) int { return strings.Compare(a.ID, b.ID) })
+	return users, nil
+}
+
+// UpdateUser updates the name, email and activity of a user
+func (rdb *risksDB) UpdateUser(ctx context.Context, user data.User) (data.User, error) {
+	rdb.mu.Lock()
+	defer rdb.mu.Unlock()
+
+	stored, ok := rdb.users[user.ID]
+	if !ok {
+		return data.User{}, data.Errorf(data.ErrNotFound, "user with ID: %s not found", user.ID)
+	}
+	stored.Name, stored.Email, stored.Active = user.Name, user.Email, user.Active
+	stored.UpdatedAt = rdb.now()
+	rdb.users[user.ID] = stored
+	return stored, nil
+}
@@ -0,0 +1,279 @@
+package db
+
+import (
+	"context"
+	"crypto/sha256"
+	"embed"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/jackc/pgx/v4"
+	"io/fs"
+	"log/slog"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// migrationsLock is the key of the advisory lock held while migrating, so that replicas starting together take turns
+const migrationsLock = 7_041_522_815
+
+// Migration states reported by MigrationStatus
+const (
+	MigrationApplied  = "applied"
+	MigrationPending  = "pending"
+	MigrationModified = "modified"
+	MigrationUnknown  = "unknown"
+)
+
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+//go:embed sql/create_schema_migrations_table.sql
+var createSchemaMigrationsTable string
+
+type (
+	// migration is a versioned schema change, read from the files <version>_<name>.up.sql and <version>_<name>.down.sql
+	migration struct {
+		version  int
+		name     string
+		up       string
+		down     string
+		checksum string
+	}
+
+	// appliedMigration is a row of the schema_migrations table
+	appliedMigration struct {
+		name      string
+		checksum  string
+		appliedAt time.Time
+	}
+
+	// MigrationStatus describes a migration known to the binary or applied to the database
+	MigrationStatus struct {
+		Version   int
+		Name      string
+		State     string
+		AppliedAt *time.Time
+	}
+)
+
+// loadMigrations reads the migrations from the files, ordered by version
+func loadMigrations(files fs.FS) ([]migration, error) {
+	paths, err := fs.Glob(files, "migrations/*.sql")
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := map[int]*migration{}
+	for _, p := range paths {
+		base := path.Base(p)
+		name, direction, ok := strings.Cut(strings.TrimSuffix(base, ".sql"), ".")
+		versionText, _, _ := strings.Cut(name, "_")
+		version, err := strconv.Atoi(versionText)
+		if !ok || err != nil || (direction != "up" && direction != "down") {
+			return nil, fmt.Errorf("invalid migration file name %s, expected <version>_<name>.up.sql or <version>_<name>.down.sql", base)
+		}
+
+		script, err := fs.ReadFile(files, p)
+		if err != nil {
+			return nil, err
+		}
+
+		m, exists := byVersion[version]
+		if !exists {
+			m = &migration{version: version, name: name}
+			byVersion[version] = m
+		}
+		if m.name != name {
+			return nil, fmt.Errorf("migrations %s and %s have the same version", m.name, name)
+		}
+		if direction == "up" {
+			m.up = string(script)
+			sum := sha256.Sum256(script)
+			m.checksum = hex.EncodeToString(sum[:])
+		} else {
+			m.down = string(script)
+		}
+	}
+
+	migrations := make([]migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.up == "" {
+			return nil, fmt.Errorf("migration %s has no up script", m.name)
+		}
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].version < migrations[j].version })
+	return migrations, nil
+}
+
+// RunMigrations applies every pending migration, see MigrateUp
+func (db *db) RunMigrations(ctx context.Context) error {
+	_, err := db.MigrateUp(ctx)
+	return err
+}
+
+// MigrateUp applies the pending migrations in order and returns how many were applied.
+// Every migration is applied in the same transaction, so either all of them are applied or none is.
+// The checksums of the migrations already applied are verified first, a migration must never change once applied.
+func (db *db) MigrateUp(ctx context.Context) (int, error) {
+	migrations, err := loadMigrations(migrationFiles)
+	if err != nil {
+		return 0, err
+	}
+
+	count := 0
+	err = db.withMigrationsLock(ctx, func(tx pgx.Tx, applied map[int]appliedMigration) error {
+		for _, m := range migrations {
+			if a, ok := applied[m.version]; ok {
+				if a.checksum != m.checksum {
+					return fmt.Errorf("migration %s was changed after it was applied, its checksum is %s but %s was applied", m.name, m.checksum, a.checksum)
+				}
+				continue
+			}
+
+			slog.Info("applying migration", "name", m.name)
+			if _, err := tx.Exec(ctx, m.up); err != nil {
+				return fmt.Errorf("error applying migration %s: %w", m.name, err)
+			}
+			if _, err := tx.Exec(ctx, insertSchemaMigration, m.version, m.name, m.checksum); err != nil {
+				return err
+			}
+			count++
+		}
+		return nil
+	})
+	return count, err
+}
+
+// MigrateDown reverts up to the given number of applied migrations, the latest first, and returns how many were reverted
+func (db *db) MigrateDown(ctx context.Context, steps int) (int, error) {
+	migrations, err := loadMigrations(migrationFiles)
+	if err != nil {
+		return 0, err
+	}
+
+	count := 0
+	err = db.withMigrationsLock(ctx, func(tx pgx.Tx, applied map[int]appliedMigration) error {
+		for i := len(migrations) - 1; i >= 0 && count < steps; i-- {
+			m := migrations[i]
+			if _, ok := applied[m.version]; !ok {
+				continue
+			}
+			if m.down == "" {
+				return fmt.Errorf("migration %s has no down script and cannot be reverted", m.name)
+			}
+
+			slog.Info("reverting migration", "name", m.name)
+			if _, err := tx.Exec(ctx, m.down); err != nil {
+				return fmt.Errorf("error reverting migration %s: %w", m.name, err)
+			}
+			if _, err := tx.Exec(ctx, deleteSchemaMigration, m.version); err != nil {
+				return err
+			}
+			count++
+		}
+		return nil
+	})
+	return count, err
+}
+
+// MigrationStatus lists the migrations known to the binary and the ones applied to the database, ordered by version
+func (db *db) MigrationStatus(ctx context.Context) ([]MigrationStatus, error) {
+	migrations, err := loadMigrations(migrationFiles)
+	if err != nil {
+		return nil, err
+	}
+
+	var statuses []MigrationStatus
+	err = db.withMigrationsLock(ctx, func(tx pgx.Tx, applied map[int]appliedMigration) error {
+		statuses = migrationStatuses(migrations, applied)
+		return nil
+	})
+	return statuses, err
+}
+
+func migrationStatuses(migrations []migration, applied map[int]appliedMigration) []MigrationStatus {
+	statuses := make([]MigrationStatus, 0, len(migrations))
+	known := map[int]bool{}
+	for _, m := range migrations {
+		known[m.version] = true
+		status := MigrationStatus{Version: m.version, Name: m.name, State: MigrationPending}
+		if a, ok := applied[m.version]; ok {
+			status.State = MigrationApplied
+			if a.checksum != m.checksum {
+				status.State = MigrationModified
+			}
+			status.AppliedAt = &a.appliedAt
+		}
+		statuses = append(statuses, status)
+	}
+	// migrations applied by a newer version of the service
+	for version, a := range applied {
+		if !known[version] {
+			statuses = append(statuses, MigrationStatus{Version: version, Name: a.name, State: MigrationUnknown, AppliedAt: &a.appliedAt})
+		}
+	}
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].Version < statuses[j].Version })
+	return statuses
+}
+
+//go:embed sql/get_schema_migrations.sql
+var getSchemaMigrations string
+
+//go:embed sql/insert_schema_migration.sql
+var insertSchemaMigration string
+
+//go:embed sql/delete_schema_migration.sql
+var deleteSchemaMigration string
+
+//go:embed sql/lock_schema_migrations.sql
+var lockSchemaMigrations string
+
+// withMigrationsLock runs f in a transaction holding the migrations advisory lock, with the applied migrations
+func (db *db) withMigrationsLock(ctx context.Context, f func(tx pgx.Tx, applied map[int]appliedMigration) error) error {
+	tx, err := db.client.Begin(ctx)
+	if err != nil {
+		return classifyError(err)
+	}
+	defer func() {
+		if rollbackErr := tx.Rollback(ctx); rollbackErr != nil && !errors.Is(rollbackErr, pgx.ErrTxClosed) {
+			slog.Error("error rolling back the migrations transaction", "err", rollbackErr)
+		}
+	}()
+
+	// the lock is released when the transaction ends
+	if _, err = tx.Exec(ctx, lockSchemaMigrations, migrationsLock); err != nil {
+		return classifyError(err)
+	}
+	if _, err = tx.Exec(ctx, createSchemaMigrationsTable); err != nil {
+		return classifyError(err)
+	}
+
+	rows, err := tx.Query(ctx, getSchemaMigrations)
+	if err != nil {
+		return classifyError(err)
+	}
+	applied := map[int]appliedMigration{}
+	for rows.Next() {
+		var version int
+		var a appliedMigration
+		if err = rows.Scan(&version, &a.name, &a.checksum, &a.appliedAt); err != nil {
+			rows.Close()
+			return classifyError(err)
+		}
+		applied[version] = a
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return classifyError(err)
+	}
+
+	if err = f(tx, applied); err != nil {
+		return err
+	}
+	return classifyError(tx.Commit(ctx))
+}
@@ -0,0 +1,98 @@
+package db
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+func TestLoadMigrations(t *testing.T) {
+	t.Run("successfully load the embedded migrations", func(t *testing.T) {
+		migrations, err := loadMigrations(migrationFiles)
+		assert.Nil(t, err)
+		for i, m := range migrations {
+			assert.Equal(t, i+1, m.version, "migration versions must have no gaps")
+			assert.NotEmpty(t, m.down, "migration %s has no down script", m.name)
+		}
+	})
+
+	t.Run("successfully load migrations ordered by version", func(t *testing.T) {
+		migrations, err := loadMigrations(fstest.MapFS{
+			"migrations/0010_add_index.up.sql":      {Data: []byte("CREATE INDEX i ON t (c);")},
+			"migrations/0002_create_table.up.sql":   {Data: []byte("CREATE TABLE t (c INT);")},
+			"migrations/0002_create_table.down.sql": {Data: []byte("DROP TABLE t;")},
+		})
+		assert.Nil(t, err)
+		assert.Len(t, migrations, 2)
+		assert.Equal(t, 2, migrations[0].version)
+		assert.Equal(t, "0002_create_table", migrations[0].name)
+		assert.Equal(t, "CREATE TABLE t (c INT);", migrations[0].up)
+		assert.Equal(t, "DROP TABLE t;", migrations[0].down)
+		assert.Equal(t, 10, migrations[1].version)
+		assert.Empty(t, migrations[1].down)
+		assert.Len(t, migrations[0].checksum, 64)
+	})
+
+	tests := map[string]fstest.MapFS{
+		"invalid file name": {"migrations/create_table.up.sql": {Data: []byte("SELECT 1;")}},
+		"invalid direction": {"migrations/0001_create_table.sideways.sql": {Data: []byte("SELECT 1;")}},
+		"missing up script": {"migrations/0001_create_table.down.sql": {Data: []byte("SELECT 1;")}},
+		"duplicate version": {
+			"migrations/0001_create_table.up.sql": {Data: []byte("SELECT 1;")},
+			"migrations/0001_add_column.up.sql":   {Data: []byte("SELECT 1;")},
+		},
+	}
+	for name, files := range tests {
+		t.Run("failed to load migrations, "+name, func(t *testing.T) {
+			_, err := loadMigrations(files)
+			assert.NotNil(t, err)
+		})
+	}
+}
+
+func TestMigrationStatuses(t *testing.T) {
+	appliedAt := time.Date(2024, 6, 1, 10, 0, 0, 0, time.UTC)
+	migrations := []migration{
+		{version: 1, name: "0001_create_table", checksum: "a"},
+		{version: 2, name: "0002_add_column", checksum: "b"},
+		{version: 3, name: "0003_add_index", checksum: "c"},
+	}
+	applied := map[int]appliedMigration{
+		1: {name: "0001_create_table", checksum: "a", appliedAt: appliedAt},
+		2: {name: "0002_add_column", checksum: "changed", appliedAt: appliedAt},
+		4: {name: "0004_from_the_future", checksum: "d", appliedAt: appliedAt},
+	}
+
+	assert.Equal(t, []MigrationStatus{
+		{Version: 1, Name: "0001_create_table", State: MigrationApplied, AppliedAt: &appliedAt},
+		{Version: 2, Name: "0002_add_column", State: MigrationModified, AppliedAt: &appliedAt},
+		{Version: 3, Name: "0003_add_index", State: MigrationPending},
+		{Version: 4, Name: "0004_from_the_future", State: MigrationUnknown, AppliedAt: &appliedAt},
+	}, migrationStatuses(migrations, applied))
+}
+
+func TestDB_MigrateUp(t *testing.T) {
+	t.Run("successfully apply the migrations once", func(t *testing.T) {
+		ctx := context.Background()
+		pDB, err := InitDB(ctx)
+		if err != nil {
+			t.Fatalf("error initializing DB for test: %s", err)
+		}
+		defer pDB.Close(ctx)
+
+		err = pDB.RunMigrations(ctx)
+		assert.Nil(t, err)
+
+		applied, err := pDB.MigrateUp(ctx)
+		assert.Nil(t, err)
+		assert.Equal(t, 0, applied)
+
+		statuses, err := pDB.MigrationStatus(ctx)
+		assert.Nil(t, err)
+		for _, s := range statuses {
+			assert.Equal(t, MigrationApplied, s.State, "migration %s", s.Name)
+		}
+	})
+}
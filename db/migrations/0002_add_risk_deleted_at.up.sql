@@ -0,0 +1 @@
+ALTER TABLE risks ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMPTZ
\ No newline at end of file
@@ -0,0 +1,2 @@
+ALTER TABLE risks DROP COLUMN IF EXISTS updated_at;
+ALTER TABLE risks DROP COLUMN IF EXISTS created_at;
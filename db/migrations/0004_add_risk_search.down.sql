@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS risks_search_idx;
+ALTER TABLE risks DROP COLUMN IF EXISTS search;
@@ -0,0 +1,4 @@
+ALTER TABLE risks ADD COLUMN IF NOT EXISTS search TSVECTOR GENERATED ALWAYS AS (
+    setweight(to_tsvector('english', title), 'A') || setweight(to_tsvector('english', description), 'B')
+) STORED;
+CREATE INDEX IF NOT EXISTS risks_search_idx ON risks USING GIN (search);
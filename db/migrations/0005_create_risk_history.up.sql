@@ -0,0 +1,13 @@
+CREATE TABLE IF NOT EXISTS risk_history (
+    history_id BIGSERIAL PRIMARY KEY,
+    -- not a foreign key, the history of a risk is kept after the risk is purged
+    risk_id    UUID NOT NULL,
+    action     TEXT NOT NULL,
+    actor      TEXT NOT NULL DEFAULT '',
+    request_id TEXT NOT NULL DEFAULT '',
+    reason     TEXT NOT NULL DEFAULT '',
+    changed_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    before     JSONB,
+    after      JSONB
+);
+CREATE INDEX IF NOT EXISTS risk_history_risk_id_idx ON risk_history (risk_id, history_id);
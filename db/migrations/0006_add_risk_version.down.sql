@@ -0,0 +1 @@
+ALTER TABLE risks DROP COLUMN IF EXISTS version;
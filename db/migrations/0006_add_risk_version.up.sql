@@ -0,0 +1,2 @@
+-- the version is incremented by every write of a risk, it is the ETag clients send back in If-Match
+ALTER TABLE risks ADD COLUMN IF NOT EXISTS version BIGINT NOT NULL DEFAULT 1;
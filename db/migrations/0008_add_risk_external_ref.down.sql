@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS risks_external_ref_idx;
+ALTER TABLE risks DROP COLUMN IF EXISTS external_ref;
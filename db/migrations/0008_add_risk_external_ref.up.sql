@@ -0,0 +1,3 @@
+-- the reference of a risk in another system, e.g. the row of a spreadsheet register, used to upsert imported risks
+ALTER TABLE risks ADD COLUMN IF NOT EXISTS external_ref TEXT NOT NULL DEFAULT '';
+CREATE UNIQUE INDEX IF NOT EXISTS risks_external_ref_idx ON risks (external_ref) WHERE external_ref <> '';
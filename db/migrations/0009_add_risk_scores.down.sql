@@ -0,0 +1,10 @@
+DROP INDEX IF EXISTS risks_inherent_score_idx;
+DROP INDEX IF EXISTS risks_residual_score_idx;
+ALTER TABLE risks
+    DROP COLUMN IF EXISTS severity,
+    DROP COLUMN IF EXISTS residual_score,
+    DROP COLUMN IF EXISTS inherent_score,
+    DROP COLUMN IF EXISTS residual_impact,
+    DROP COLUMN IF EXISTS residual_likelihood,
+    DROP COLUMN IF EXISTS impact,
+    DROP COLUMN IF EXISTS likelihood;
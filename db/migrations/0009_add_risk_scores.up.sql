@@ -0,0 +1,27 @@
+-- likelihood and impact are rated before and after the mitigations of a risk, the scores and severity are computed
+-- by the service from the ratings and its configured severity bands
+ALTER TABLE risks
+    ADD COLUMN IF NOT EXISTS likelihood          SMALLINT,
+    ADD COLUMN IF NOT EXISTS impact              SMALLINT,
+    ADD COLUMN IF NOT EXISTS residual_likelihood SMALLINT,
+    ADD COLUMN IF NOT EXISTS residual_impact     SMALLINT,
+    ADD COLUMN IF NOT EXISTS inherent_score      SMALLINT,
+    ADD COLUMN IF NOT EXISTS residual_score      SMALLINT,
+    ADD COLUMN IF NOT EXISTS severity            TEXT;
+
+-- the risks created before scoring are rated in the middle of the default 1 to 5 scale, like unrated new risks
+UPDATE risks
+SET likelihood = 3, impact = 3, residual_likelihood = 3, residual_impact = 3, inherent_score = 9, residual_score = 9, severity = 'medium'
+WHERE likelihood IS NULL;
+
+ALTER TABLE risks
+    ALTER COLUMN likelihood SET NOT NULL,
+    ALTER COLUMN impact SET NOT NULL,
+    ALTER COLUMN residual_likelihood SET NOT NULL,
+    ALTER COLUMN residual_impact SET NOT NULL,
+    ALTER COLUMN inherent_score SET NOT NULL,
+    ALTER COLUMN residual_score SET NOT NULL,
+    ALTER COLUMN severity SET NOT NULL;
+
+CREATE INDEX IF NOT EXISTS risks_residual_score_idx ON risks (residual_score, risk_id) WHERE deleted_at IS NULL;
+CREATE INDEX IF NOT EXISTS risks_inherent_score_idx ON risks (inherent_score, risk_id) WHERE deleted_at IS NULL;
@@ -0,0 +1,6 @@
+DROP INDEX IF EXISTS risks_assignee_id_idx;
+DROP INDEX IF EXISTS risks_owner_id_idx;
+ALTER TABLE risks
+    DROP COLUMN IF EXISTS assignee_id,
+    DROP COLUMN IF EXISTS owner_id;
+DROP TABLE IF EXISTS users;
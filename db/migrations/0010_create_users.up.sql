@@ -0,0 +1,15 @@
+-- the users who own risks or are assigned to them, identified by the actor the gateway sends with their requests.
+-- Users are deactivated rather than deleted, so that the risks they own keep referencing them.
+CREATE TABLE IF NOT EXISTS users (
+    user_id    TEXT PRIMARY KEY,
+    name       TEXT NOT NULL,
+    email      TEXT NOT NULL DEFAULT '',
+    active     BOOLEAN NOT NULL DEFAULT TRUE,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+ALTER TABLE risks
+    ADD COLUMN IF NOT EXISTS owner_id TEXT REFERENCES users (user_id),
+    ADD COLUMN IF NOT EXISTS assignee_id TEXT REFERENCES users (user_id);
+CREATE INDEX IF NOT EXISTS risks_owner_id_idx ON risks (owner_id) WHERE deleted_at IS NULL;
+CREATE INDEX IF NOT EXISTS risks_assignee_id_idx ON risks (assignee_id) WHERE deleted_at IS NULL;
@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS risks_updated_at_idx;
+DROP INDEX IF EXISTS risks_created_at_idx;
+ALTER TABLE risks
+    DROP COLUMN IF EXISTS updated_by,
+    DROP COLUMN IF EXISTS created_by;
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS risks_tags_idx;
+ALTER TABLE risks DROP COLUMN IF EXISTS tags;
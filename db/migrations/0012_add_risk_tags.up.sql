@@ -0,0 +1,4 @@
+-- the tags label a risk, e.g. with the areas or the projects it concerns, the index serves the tag filter
+ALTER TABLE risks ADD COLUMN IF NOT EXISTS tags TEXT[] NOT NULL DEFAULT '{}';
+
+CREATE INDEX IF NOT EXISTS risks_tags_idx ON risks USING GIN (tags) WHERE deleted_at IS NULL;
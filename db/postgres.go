@@ -3,18 +3,32 @@ package db
 import (
 	"context"
 	_ "embed"
-	"fmt"
+	"errors"
 	"github.com/jackc/pgconn"
 	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+	"io"
+	"log/slog"
+	"net"
 	"stan-project/cmd/config"
+	"stan-project/data"
+	"strings"
+)
+
+const (
+	uniqueViolation     = "23505"
+	foreignKeyViolation = "23503"
 )
 
 type (
+	// pgConn is safe for concurrent use, every call runs on a connection of the pool
 	pgConn interface {
 		Exec(ctx context.Context, sql string, arguments ...interface{}) (pgconn.CommandTag, error)
 		Query(ctx context.Context, sql string, args ...interface{}) (pgx.Rows, error)
 		QueryRow(ctx context.Context, sql string, args ...interface{}) pgx.Row
-		Close(ctx context.Context) error
+		Begin(ctx context.Context) (pgx.Tx, error)
+		Stat() *pgxpool.Stat
+		Close()
 	}
 	db struct {
 		client pgConn
@@ -22,25 +36,87 @@ type (
 )
 
 func InitDB(ctx context.Context) (*db, error) {
-	connConfig := fmt.Sprintf("postgres://%s:%s@%s:5432/%s", config.Global.PostgresUsername, config.Global.PostgresPassword, config.Global.PostgresAddress, config.Global.PostgresDatabase)
-	conn, err := pgx.Connect(ctx, connConfig)
+	poolConfig, err := pgxpool.ParseConfig(config.Global.Postgres.DSN())
+	if err != nil {
+		return nil, err
+	}
+	poolConfig.MinConns = int32(config.Global.Postgres.MinConns)
+	poolConfig.MaxConns = int32(config.Global.Postgres.MaxConns)
+	poolConfig.MaxConnIdleTime = config.Global.Postgres.MaxConnIdleTime
+	poolConfig.MaxConnLifetime = config.Global.Postgres.MaxConnLifetime
+
+	pool, err := pgxpool.ConnectConfig(ctx, poolConfig)
 	if err != nil {
 		return nil, err
 	}
-	return &db{client: conn}, nil
+	return &db{client: pool}, nil
 }
 
+// Close closes every connection of the pool, waiting for the acquired ones to be released
 func (db *db) Close(ctx context.Context) error {
-	return db.client.Close(ctx)
+	db.client.Close()
+	return nil
 }
 
-//go:embed sql/create_risk_table.sql
-var createRisksTable string
+// Stats returns a snapshot of the connection pool usage
+func (db *db) Stats() data.PoolStats {
+	stat := db.client.Stat()
+	return data.PoolStats{
+		TotalConns:           stat.TotalConns(),
+		AcquiredConns:        stat.AcquiredConns(),
+		IdleConns:            stat.IdleConns(),
+		ConstructingConns:    stat.ConstructingConns(),
+		MaxConns:             stat.MaxConns(),
+		AcquireCount:         stat.AcquireCount(),
+		AcquireDuration:      stat.AcquireDuration().String(),
+		EmptyAcquireCount:    stat.EmptyAcquireCount(),
+		CanceledAcquireCount: stat.CanceledAcquireCount(),
+	}
+}
 
-func (db *db) RunMigrations(ctx context.Context) error {
-	_, err := db.client.Exec(ctx, createRisksTable)
+// withTx runs f in a transaction, which is committed when f succeeds and rolled back otherwise
+func (db *db) withTx(ctx context.Context, f func(tx pgx.Tx) error) error {
+	tx, err := db.client.Begin(ctx)
 	if err != nil {
+		return classifyError(err)
+	}
+	defer func() {
+		if rollbackErr := tx.Rollback(ctx); rollbackErr != nil && !errors.Is(rollbackErr, pgx.ErrTxClosed) {
+			slog.Error("error rolling back transaction", "err", rollbackErr)
+		}
+	}()
+
+	if err = f(tx); err != nil {
 		return err
 	}
-	return nil
+	return classifyError(tx.Commit(ctx))
+}
+
+// classifyError wraps postgres errors with the matching data error kind so that callers do not need to know about pgx
+func classifyError(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		switch {
+		case pgErr.Code == uniqueViolation:
+			return data.Errorf(data.ErrConflict, "%w", err)
+		// a risk referencing a user who does not exist
+		case pgErr.Code == foreignKeyViolation:
+			return data.Errorf(data.ErrValidation, "%w", err)
+		// connection exception, insufficient resources and operator intervention classes
+		case strings.HasPrefix(pgErr.Code, "08"), strings.HasPrefix(pgErr.Code, "53"), strings.HasPrefix(pgErr.Code, "57"):
+			return data.Errorf(data.ErrUnavailable, "database unavailable: %w", err)
+		}
+		return err
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) || pgconn.Timeout(err) || errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return data.Errorf(data.ErrUnavailable, "database unavailable: %w", err)
+	}
+
+	return err
 }
@@ -0,0 +1,82 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"github.com/jackc/pgconn"
+	"github.com/stretchr/testify/assert"
+	"net"
+	"stan-project/cmd/config"
+	"stan-project/data"
+	"testing"
+)
+
+func TestClassifyError(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		kind error
+	}{
+		{
+			name: "unique violation is a conflict",
+			err:  &pgconn.PgError{Code: "23505"},
+			kind: data.ErrConflict,
+		},
+		{
+			name: "foreign key violation is invalid",
+			err:  &pgconn.PgError{Code: "23503"},
+			kind: data.ErrValidation,
+		},
+		{
+			name: "connection exception is unavailable",
+			err:  &pgconn.PgError{Code: "08006"},
+			kind: data.ErrUnavailable,
+		},
+		{
+			name: "admin shutdown is unavailable",
+			err:  &pgconn.PgError{Code: "57P01"},
+			kind: data.ErrUnavailable,
+		},
+		{
+			name: "network error is unavailable",
+			err:  &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")},
+			kind: data.ErrUnavailable,
+		},
+		{
+			name: "deadline exceeded is unavailable",
+			err:  context.DeadlineExceeded,
+			kind: data.ErrUnavailable,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			actual := classifyError(tt.err)
+			assert.ErrorIs(t, actual, tt.kind)
+			assert.ErrorIs(t, actual, tt.err)
+		})
+	}
+
+	t.Run("other errors are returned as is", func(t *testing.T) {
+		err := &pgconn.PgError{Code: "42703"}
+		assert.Equal(t, err, classifyError(err))
+		assert.Nil(t, classifyError(nil))
+	})
+}
+
+func TestDB_Stats(t *testing.T) {
+	t.Run("successfully report the pool stats", func(t *testing.T) {
+		ctx := context.Background()
+		pDB, err := InitDB(ctx)
+		if err != nil {
+			t.Fatalf("error initializing DB for test: %s", err)
+		}
+		defer pDB.Close(ctx)
+
+		stats := pDB.Stats()
+
+		assert.Equal(t, int32(config.Global.Postgres.MaxConns), stats.MaxConns)
+		assert.GreaterOrEqual(t, stats.TotalConns, int32(1))
+		assert.Equal(t, int32(0), stats.AcquiredConns)
+	})
+}
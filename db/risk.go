@@ -3,9 +3,16 @@ package db
 import (
 	"context"
 	_ "embed"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/google/uuid"
+	"github.com/jackc/pgx/v4"
+	"slices"
 	"stan-project/data"
+	"strings"
+	"time"
+	"unicode"
 )
 
 type risksDB struct {
@@ -19,32 +26,129 @@ func NewRisksDB(db *db) *risksDB {
 //go:embed sql/insert_risk.sql
 var insertRisk string
 
-func (rdb *risksDB) Add(ctx context.Context, risk data.Risk) error {
-	var err error
-	_, err = rdb.db.client.Exec(ctx, insertRisk, risk.ID, risk.Title, risk.Description, risk.State)
-	return err
+func (rdb *risksDB) Add(ctx context.Context, risk data.Risk) (data.Risk, error) {
+	var added data.Risk
+	err := rdb.db.withTx(ctx, func(tx pgx.Tx) error {
+		err := tx.QueryRow(ctx, insertRisk, riskValues(risk, data.AuditFrom(ctx).Actor)...).Scan(riskFields(&added)...)
+		if err != nil {
+			return classifyError(err)
+		}
+		return insertHistory(ctx, tx, data.ActionCreated, nil, &added)
+	})
+	if err != nil {
+		return data.Risk{}, err
+	}
+	return added, nil
+}
+
+// riskFields returns the scan targets for the risk columns selected by every query, in order
+func riskFields(risk *data.Risk) []any {
+	return []any{&risk.ID, &risk.Title, &risk.Description, &risk.State, &risk.CreatedAt, &risk.UpdatedAt, &risk.Version, &risk.ExternalRef,
+		&risk.Likelihood, &risk.Impact, &risk.ResidualLikelihood, &risk.ResidualImpact, &risk.InherentScore, &risk.ResidualScore, &risk.Severity,
+		&risk.Owner, &risk.Assignee, &risk.CreatedBy, &risk.UpdatedBy, &risk.Tags}
+}
+
+// riskValues returns the values of the columns written by insert_risk.sql and update_risk.sql, in order. The actor is
+// recorded as the creator of an inserted risk and as the last updater of the risk.
+func riskValues(risk data.Risk, actor string) []any {
+	return []any{risk.ID, risk.Title, risk.Description, risk.State, risk.ExternalRef,
+		risk.Likelihood, risk.Impact, risk.ResidualLikelihood, risk.ResidualImpact, risk.InherentScore, risk.ResidualScore, risk.Severity,
+		risk.Owner, risk.Assignee, risk.Tags, actor}
+}
+
+//go:embed sql/get_risk_for_update.sql
+var getRiskForUpdate string
+
+// lockRisk reads a risk, deleted or not, and locks it until the end of the transaction so that the change recorded in
+// its history starts from the risk as it is
+func lockRisk(ctx context.Context, tx pgx.Tx, ID uuid.UUID) (data.Risk, error) {
+	var risk data.Risk
+	err := tx.QueryRow(ctx, getRiskForUpdate, ID).Scan(append(riskFields(&risk), &risk.DeletedAt)...)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return data.Risk{}, data.Errorf(data.ErrNotFound, "risk with ID: %s not found", ID)
+	}
+	return risk, classifyError(err)
+}
+
+// checkVersion fails with ErrPreconditionFailed when the risk does not have the expected version, 0 expects any version
+func checkVersion(risk data.Risk, version int64) error {
+	if version != 0 && risk.Version != version {
+		return data.Errorf(data.ErrPreconditionFailed, "risk with ID: %s has version %d, not %d", risk.ID, risk.Version, version)
+	}
+	return nil
 }
 
 //go:embed sql/get_risk_by_id.sql
 var getRiskByID string
 
 func (rdb *risksDB) GetByID(ctx context.Context, ID uuid.UUID) (data.Risk, error) {
-	rows, err := rdb.db.client.Query(ctx, getRiskByID, ID)
+	var risk data.Risk
+	err := rdb.db.client.QueryRow(ctx, getRiskByID, ID).Scan(riskFields(&risk)...)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return data.Risk{}, data.Errorf(data.ErrNotFound, "risk with ID: %s not found", ID)
+	}
 	if err != nil {
-		return data.Risk{}, err
+		return data.Risk{}, classifyError(err)
+	}
+
+	return risk, nil
+}
+
+//go:embed sql/get_risks_by_external_refs.sql
+var getRisksByExternalRefs string
+
+// GetByExternalRefs lists the risks, deleted or not, with the given external references
+func (rdb *risksDB) GetByExternalRefs(ctx context.Context, refs []string) ([]data.Risk, error) {
+	rows, err := rdb.db.client.Query(ctx, getRisksByExternalRefs, refs)
+	if err != nil {
+		return nil, classifyError(err)
 	}
 	defer rows.Close()
 
-	var risk data.Risk
+	var risks []data.Risk
 
 	for rows.Next() {
-		err = rows.Scan(&risk.ID, &risk.Title, &risk.Description, &risk.State)
-		if err != nil {
-			return data.Risk{}, err
+		var risk data.Risk
+		if err = rows.Scan(append(riskFields(&risk), &risk.DeletedAt)...); err != nil {
+			return nil, classifyError(err)
 		}
+		risks = append(risks, risk)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, classifyError(err)
 	}
 
-	return risk, nil
+	return risks, nil
+}
+
+//go:embed sql/update_risk.sql
+var updateRisk string
+
+// Update updates a risk, expecting it to have the version of the given risk unless that version is 0
+func (rdb *risksDB) Update(ctx context.Context, risk data.Risk) (data.Risk, error) {
+	var updated data.Risk
+	err := rdb.db.withTx(ctx, func(tx pgx.Tx) error {
+		current, err := lockRisk(ctx, tx, risk.ID)
+		if err != nil {
+			return err
+		}
+		if current.DeletedAt != nil {
+			return data.Errorf(data.ErrNotFound, "risk with ID: %s not found", risk.ID)
+		}
+		if err = checkVersion(current, risk.Version); err != nil {
+			return err
+		}
+
+		err = tx.QueryRow(ctx, updateRisk, riskValues(risk, data.AuditFrom(ctx).Actor)...).Scan(riskFields(&updated)...)
+		if err != nil {
+			return classifyError(err)
+		}
+		return insertHistory(ctx, tx, data.ActionUpdated, &current, &updated)
+	})
+	if err != nil {
+		return data.Risk{}, err
+	}
+	return updated, nil
 }
 
 //go:embed sql/get_all_risks.sql
@@ -53,41 +157,576 @@ var getAllRisks string
 //go:embed sql/count_all_risks.sql
 var countAllRisks string
 
+//go:embed sql/estimate_risks.sql
+var estimateRisks string
+
 func (rdb *risksDB) GetAll(ctx context.Context, options data.Options) (data.PaginatedResponse, error) {
 
-	var count int
-	err := rdb.db.client.QueryRow(ctx, countAllRisks).Scan(&count)
+	keys := data.WithTieBreaker(options.Sort)
+	if options.After != nil && options.After.Sort != data.FormatSort(keys) {
+		return data.PaginatedResponse{}, data.Errorf(data.ErrValidation, "the cursor was created for the sort order %q but the risks are sorted by %q", options.After.Sort, data.FormatSort(keys))
+	}
+
+	where, args := whereFilter(options.Filter, 1)
+	count, err := rdb.count(ctx, options.Count, where, args)
 	if err != nil {
 		return data.PaginatedResponse{}, err
 	}
 
-	formattedQuery := fmt.Sprintf(getAllRisks, options.SortBy, options.SortOrder)
-
-	rows, err := rdb.db.client.Query(ctx, formattedQuery, options.Limit, options.Offset)
+	backward := options.After != nil && options.After.Backward
+	order, err := orderBy(keys)
+	if backward {
+		order, err = orderBy(reversed(keys))
+	}
 	if err != nil {
 		return data.PaginatedResponse{}, err
 	}
+
+	// the limit and offset are the first two arguments of the query
+	where, args = whereFilter(options.Filter, 3)
+	offset := options.Offset
+	if options.After != nil {
+		after, afterArgs, err := keysetCondition(keys, options.After, 3+len(args))
+		if err != nil {
+			return data.PaginatedResponse{}, err
+		}
+		where += after
+		args = append(args, afterArgs...)
+		offset = 0
+	}
+	formattedQuery := fmt.Sprintf(getAllRisks, where, order)
+
+	// one more risk than requested is fetched to know whether there is another page
+	rows, err := rdb.db.client.Query(ctx, formattedQuery, append([]any{options.Limit + 1, offset}, args...)...)
+	if err != nil {
+		return data.PaginatedResponse{}, classifyError(err)
+	}
 	defer rows.Close()
 
 	var risks []data.Risk
 
 	for rows.Next() {
 		var risk data.Risk
-		err = rows.Scan(&risk.ID, &risk.Title, &risk.Description, &risk.State)
+		err = rows.Scan(riskFields(&risk)...)
 		if err != nil {
-			return data.PaginatedResponse{}, err
+			return data.PaginatedResponse{}, classifyError(err)
 		}
 		risks = append(risks, risk)
 	}
+	if err = rows.Err(); err != nil {
+		return data.PaginatedResponse{}, classifyError(err)
+	}
+
+	hasMore := len(risks) > options.Limit
+	if hasMore {
+		risks = risks[:options.Limit]
+	}
+	if backward {
+		slices.Reverse(risks)
+	}
 
-	return data.PaginatedResponse{TotalCount: count, Risks: risks}, nil
+	response := data.PaginatedResponse{TotalCount: count, Risks: risks}
+	if len(risks) == 0 {
+		return response, nil
+	}
+	if (backward && hasMore) || (!backward && (options.After != nil || offset > 0)) {
+		response.PrevCursor = data.NewCursor(risks[0], keys, true)
+	}
+	if backward || hasMore {
+		response.NextCursor = data.NewCursor(risks[len(risks)-1], keys, false)
+	}
+	return response, nil
+}
+
+//go:embed sql/export_risks.sql
+var exportRisks string
+
+//go:embed sql/fetch_exported_risks.sql
+var fetchExportedRisks string
+
+// exportFetchSize is the number of risks fetched from the export cursor at a time, it must match fetch_exported_risks.sql
+const exportFetchSize = 500
+
+// Export calls write with every risk matching the filter, in the sort order. The risks are read through a server side
+// cursor a few hundred at a time, so that the memory used does not depend on the number of risks.
+func (rdb *risksDB) Export(ctx context.Context, options data.Options, write func(risk data.Risk) error) error {
+	order, err := orderBy(options.Sort)
+	if err != nil {
+		return err
+	}
+	where, args := whereFilter(options.Filter, 1)
+
+	return rdb.db.withTx(ctx, func(tx pgx.Tx) error {
+		if _, err := tx.Exec(ctx, fmt.Sprintf(exportRisks, where, order), args...); err != nil {
+			return classifyError(err)
+		}
+		for {
+			fetched, err := fetchExported(ctx, tx, write)
+			if err != nil || fetched < exportFetchSize {
+				return err
+			}
+		}
+	})
+}
+
+// fetchExported writes the next risks of the export cursor and returns how many it fetched
+func fetchExported(ctx context.Context, tx pgx.Tx, write func(risk data.Risk) error) (int, error) {
+	rows, err := tx.Query(ctx, fetchExportedRisks)
+	if err != nil {
+		return 0, classifyError(err)
+	}
+	defer rows.Close()
+
+	fetched := 0
+	for rows.Next() {
+		var risk data.Risk
+		if err = rows.Scan(riskFields(&risk)...); err != nil {
+			return fetched, classifyError(err)
+		}
+		fetched++
+		if err = write(risk); err != nil {
+			return fetched, err
+		}
+	}
+	return fetched, classifyError(rows.Err())
+}
+
+//go:embed sql/count_risks_by_ratings.sql
+var countRisksByRatings string
+
+// ratingColumns are the likelihood and impact columns of the ratings
+func ratingColumns(rating data.Rating) (string, string) {
+	if rating == data.RatingInherent {
+		return "likelihood", "impact"
+	}
+	return "residual_likelihood", "residual_impact"
+}
+
+// CountByRatings counts the risks matching the filter by likelihood and impact. The IDs are aggregated by the
+// database only when they are asked for.
+func (rdb *risksDB) CountByRatings(ctx context.Context, options data.HeatMapOptions) ([]data.HeatMapCell, error) {
+	likelihood, impact := ratingColumns(options.Rating)
+	ids := "'{}'::text[]"
+	if options.WithIDs {
+		ids = "array_agg(risk_id::text)"
+	}
+	where, args := whereFilter(options.Filter, 1)
+
+	rows, err := rdb.db.client.Query(ctx, fmt.Sprintf(countRisksByRatings, likelihood, impact, ids, where), args...)
+	if err != nil {
+		return nil, classifyError(err)
+	}
+	defer rows.Close()
+
+	var cells []data.HeatMapCell
+	for rows.Next() {
+		var cell data.HeatMapCell
+		var riskIDs []string
+		if err = rows.Scan(&cell.Likelihood, &cell.Impact, &cell.Count, &riskIDs); err != nil {
+			return nil, classifyError(err)
+		}
+		for _, ID := range riskIDs {
+			cell.RiskIDs = append(cell.RiskIDs, uuid.MustParse(ID))
+		}
+		cells = append(cells, cell)
+	}
+	return cells, classifyError(rows.Err())
+}
+
+//go:embed sql/search_risks.sql
+var searchRisks string
+
+// Search lists the risks whose title or description match every word of the query, most relevant first.
+// The words are matched as prefixes, so that results can be shown while a user is typing.
+func (rdb *risksDB) Search(ctx context.Context, query string, options data.Options) (data.SearchResponse, error) {
+	tsQuery := prefixQuery(query)
+	if tsQuery == "" {
+		zero := 0
+		return data.SearchResponse{TotalCount: &zero}, nil
+	}
+
+	where, args := whereFilter(options.Filter, 2)
+	count, err := rdb.count(ctx, options.Count, " AND search @@ to_tsquery('english', $1)"+where, append([]any{tsQuery}, args...))
+	if err != nil {
+		return data.SearchResponse{}, err
+	}
+
+	// the limit, offset and search query are the first three arguments of the query
+	where, args = whereFilter(options.Filter, 4)
+	offset := options.Offset
+	if options.After != nil {
+		rank, ID, err := data.SearchCursorArgs(options.After)
+		if err != nil {
+			return data.SearchResponse{}, err
+		}
+		where += fmt.Sprintf(" AND (ts_rank(search, query) < $%[1]d OR (ts_rank(search, query) = $%[1]d AND risk_id > $%[2]d))", 4+len(args), 5+len(args))
+		args = append(args, rank, ID)
+		offset = 0
+	}
+
+	// one more result than requested is fetched to know whether there is another page
+	rows, err := rdb.db.client.Query(ctx, fmt.Sprintf(searchRisks, where), append([]any{options.Limit + 1, offset, tsQuery}, args...)...)
+	if err != nil {
+		return data.SearchResponse{}, classifyError(err)
+	}
+	defer rows.Close()
+
+	var results []data.SearchResult
+
+	for rows.Next() {
+		var result data.SearchResult
+		err = rows.Scan(append(riskFields(&result.Risk), &result.Rank, &result.TitleHighlight, &result.DescriptionHighlight)...)
+		if err != nil {
+			return data.SearchResponse{}, classifyError(err)
+		}
+		results = append(results, result)
+	}
+	if err = rows.Err(); err != nil {
+		return data.SearchResponse{}, classifyError(err)
+	}
+
+	response := data.SearchResponse{TotalCount: count, Risks: results}
+	if len(results) > options.Limit {
+		response.Risks = results[:options.Limit]
+		last := response.Risks[options.Limit-1]
+		response.NextCursor = data.NewSearchCursor(float64(last.Rank), last.ID)
+	}
+	return response, nil
+}
+
+// prefixQuery converts free text into a tsquery matching every word as a prefix.
+// Anything but letters and digits is dropped so that the text cannot break the tsquery syntax.
+func prefixQuery(text string) string {
+	words := strings.FieldsFunc(text, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	for i, word := range words {
+		words[i] = word + ":*"
+	}
+	return strings.Join(words, " & ")
+}
+
+// count counts the risks matching the conditions of the WHERE clause, the count is nil when it is skipped
+func (rdb *risksDB) count(ctx context.Context, mode data.CountMode, where string, args []any) (*int, error) {
+	switch mode {
+	case data.CountNone:
+		return nil, nil
+	case data.CountEstimate:
+		// the planner estimate is read from the query plan instead of scanning the matching rows
+		var plan []byte
+		err := rdb.db.client.QueryRow(ctx, fmt.Sprintf(estimateRisks, where), args...).Scan(&plan)
+		if err != nil {
+			return nil, classifyError(err)
+		}
+		var explained []struct {
+			Plan struct {
+				Rows float64 `json:"Plan Rows"`
+			}
+		}
+		if err = json.Unmarshal(plan, &explained); err != nil || len(explained) == 0 {
+			return nil, fmt.Errorf("error reading the estimated count of risks from the query plan: %s", plan)
+		}
+		estimate := int(explained[0].Plan.Rows)
+		return &estimate, nil
+	}
+
+	var count int
+	err := rdb.db.client.QueryRow(ctx, fmt.Sprintf(countAllRisks, where), args...).Scan(&count)
+	if err != nil {
+		return nil, classifyError(err)
+	}
+	return &count, nil
+}
+
+// keysetCondition builds the condition selecting the risks after the cursor, to be appended to a WHERE clause.
+// The keys are compared one after the other, so that mixed sort directions are supported:
+// (k1 > v1) OR (k1 = v1 AND k2 > v2) OR ...
+func keysetCondition(keys []data.SortKey, cursor *data.Cursor, firstArg int) (string, []any, error) {
+	if len(cursor.Values) != len(keys) {
+		return "", nil, data.Errorf(data.ErrValidation, "the cursor does not match the sort order %q", data.FormatSort(keys))
+	}
+
+	args := make([]any, len(keys))
+	disjunction := make([]string, len(keys))
+	for i, key := range keys {
+		arg, err := data.CursorArg(key.Field, cursor.Values[i])
+		if err != nil {
+			return "", nil, err
+		}
+		args[i] = arg
+		op := ">"
+		if key.Descending != cursor.Backward {
+			op = "<"
+		}
+
+		conjunction := make([]string, 0, i+1)
+		for j := 0; j < i; j++ {
+			conjunction = append(conjunction, fmt.Sprintf("%s = $%d", sortColumns[keys[j].Field], firstArg+j))
+		}
+		conjunction = append(conjunction, fmt.Sprintf("%s %s $%d", sortColumns[key.Field], op, firstArg+i))
+		disjunction[i] = "(" + strings.Join(conjunction, " AND ") + ")"
+	}
+	return " AND (" + strings.Join(disjunction, " OR ") + ")", args, nil
+}
+
+// whereFilter builds the conditions for the given filter, to be appended to a WHERE clause, along with their arguments.
+// The placeholders are numbered starting from firstArg.
+func whereFilter(filter data.Filter, firstArg int) (string, []any) {
+	var conditions []string
+	var args []any
+	add := func(condition string, arg any) {
+		args = append(args, arg)
+		conditions = append(conditions, fmt.Sprintf(condition, firstArg+len(args)-1))
+	}
+
+	if len(filter.States) > 0 {
+		states := make([]string, len(filter.States))
+		for i, state := range filter.States {
+			states[i] = string(state)
+		}
+		add("state = ANY($%d)", states)
+	}
+	if filter.Title != "" {
+		add("title ILIKE $%d", "%"+escapeLike(filter.Title)+"%")
+	}
+	if filter.Description != "" {
+		add("description ILIKE $%d", "%"+escapeLike(filter.Description)+"%")
+	}
+	if filter.CreatedAfter != nil {
+		add("created_at >= $%d", *filter.CreatedAfter)
+	}
+	if filter.CreatedBefore != nil {
+		add("created_at < $%d", *filter.CreatedBefore)
+	}
+	if filter.UpdatedAfter != nil {
+		add("updated_at >= $%d", *filter.UpdatedAfter)
+	}
+	if filter.UpdatedBefore != nil {
+		add("updated_at < $%d", *filter.UpdatedBefore)
+	}
+	if len(filter.Severities) > 0 {
+		severities := make([]string, len(filter.Severities))
+		for i, severity := range filter.Severities {
+			severities[i] = string(severity)
+		}
+		add("severity = ANY($%d)", severities)
+	}
+	if filter.MinScore > 0 {
+		add("residual_score >= $%d", filter.MinScore)
+	}
+	if filter.MaxScore > 0 {
+		add("residual_score <= $%d", filter.MaxScore)
+	}
+	if filter.Owner != "" {
+		add("owner_id = $%d", filter.Owner)
+	}
+	if filter.Assignee != "" {
+		add("assignee_id = $%d", filter.Assignee)
+	}
+	if filter.Involving != "" {
+		add("(owner_id = $%[1]d OR assignee_id = $%[1]d)", filter.Involving)
+	}
+	if filter.CreatedBy != "" {
+		add("created_by = $%d", filter.CreatedBy)
+	}
+	if filter.UpdatedBy != "" {
+		add("updated_by = $%d", filter.UpdatedBy)
+	}
+	if len(filter.Tags) > 0 {
+		add("tags @> $%d", filter.Tags)
+	}
+
+	if len(conditions) == 0 {
+		return "", nil
+	}
+	return " AND " + strings.Join(conditions, " AND "), args
+}
+
+// escapeLike escapes the LIKE wildcards so that the value is matched literally
+func escapeLike(value string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(value)
+}
+
+// sortColumns maps the sortable risk fields to their columns
+var sortColumns = map[string]string{
+	"id":            "risk_id",
+	"title":         "title",
+	"description":   "description",
+	"state":         "state",
+	"likelihood":    "likelihood",
+	"impact":        "impact",
+	"inherentScore": "inherent_score",
+	"residualScore": "residual_score",
+	"createdAt":     "created_at",
+	"updatedAt":     "updated_at",
+	"createdBy":     "created_by",
+	"updatedBy":     "updated_by",
+}
+
+// orderBy builds an ORDER BY clause from whitelisted columns only, ending with risk_id so that the order is deterministic
+func orderBy(keys []data.SortKey) (string, error) {
+	keys = data.WithTieBreaker(keys)
+	clauses := make([]string, 0, len(keys))
+	for _, key := range keys {
+		column, ok := sortColumns[key.Field]
+		if !ok {
+			return "", data.Errorf(data.ErrValidation, "cannot sort by %q", key.Field)
+		}
+		direction := "ASC"
+		if key.Descending {
+			direction = "DESC"
+		}
+		clauses = append(clauses, column+" "+direction)
+	}
+	return strings.Join(clauses, ", "), nil
+}
+
+// reversed returns the sort keys with every direction flipped
+func reversed(keys []data.SortKey) []data.SortKey {
+	flipped := make([]data.SortKey, len(keys))
+	for i, key := range keys {
+		flipped[i] = data.SortKey{Field: key.Field, Descending: !key.Descending}
+	}
+	return flipped
 }
 
 //go:embed sql/delete_risk_by_id.sql
 var deleteRiskByID string
 
+// DeleteByID hard deletes a risk, deleted or not, it does nothing when the risk does not exist
 func (rdb *risksDB) DeleteByID(ctx context.Context, ID uuid.UUID) error {
-	var err error
-	_, err = rdb.db.client.Exec(ctx, deleteRiskByID, ID)
-	return err
+	return rdb.db.withTx(ctx, func(tx pgx.Tx) error {
+		current, err := lockRisk(ctx, tx, ID)
+		if errors.Is(err, data.ErrNotFound) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		if _, err = tx.Exec(ctx, deleteRiskByID, ID); err != nil {
+			return classifyError(err)
+		}
+		return insertHistory(ctx, tx, data.ActionPurged, &current, nil)
+	})
+}
+
+//go:embed sql/soft_delete_risk_by_id.sql
+var softDeleteRiskByID string
+
+// SoftDeleteByID moves a risk to the trash, expecting it to have the given version unless the version is 0
+func (rdb *risksDB) SoftDeleteByID(ctx context.Context, ID uuid.UUID, version int64) error {
+	return rdb.db.withTx(ctx, func(tx pgx.Tx) error {
+		current, err := lockRisk(ctx, tx, ID)
+		if err == nil && current.DeletedAt != nil {
+			err = data.Errorf(data.ErrNotFound, "risk with ID: %s not found", ID)
+		}
+		if err == nil {
+			err = checkVersion(current, version)
+		}
+		if err != nil {
+			return err
+		}
+
+		var deleted data.Risk
+		err = tx.QueryRow(ctx, softDeleteRiskByID, ID).Scan(append(riskFields(&deleted), &deleted.DeletedAt)...)
+		if err != nil {
+			return classifyError(err)
+		}
+		return insertHistory(ctx, tx, data.ActionDeleted, &current, &deleted)
+	})
+}
+
+//go:embed sql/get_deleted_risks.sql
+var getDeletedRisks string
+
+//go:embed sql/count_deleted_risks.sql
+var countDeletedRisks string
+
+func (rdb *risksDB) GetDeleted(ctx context.Context, options data.Options) (data.PaginatedResponse, error) {
+	var count int
+	err := rdb.db.client.QueryRow(ctx, countDeletedRisks).Scan(&count)
+	if err != nil {
+		return data.PaginatedResponse{}, classifyError(err)
+	}
+
+	rows, err := rdb.db.client.Query(ctx, getDeletedRisks, options.Limit, options.Offset)
+	if err != nil {
+		return data.PaginatedResponse{}, classifyError(err)
+	}
+	defer rows.Close()
+
+	var risks []data.Risk
+
+	for rows.Next() {
+		var risk data.Risk
+		err = rows.Scan(append(riskFields(&risk), &risk.DeletedAt)...)
+		if err != nil {
+			return data.PaginatedResponse{}, classifyError(err)
+		}
+		risks = append(risks, risk)
+	}
+	if err = rows.Err(); err != nil {
+		return data.PaginatedResponse{}, classifyError(err)
+	}
+
+	return data.PaginatedResponse{TotalCount: &count, Risks: risks}, nil
+}
+
+//go:embed sql/restore_risk_by_id.sql
+var restoreRiskByID string
+
+func (rdb *risksDB) RestoreByID(ctx context.Context, ID uuid.UUID) error {
+	return rdb.db.withTx(ctx, func(tx pgx.Tx) error {
+		current, err := lockRisk(ctx, tx, ID)
+		if err == nil && current.DeletedAt == nil || errors.Is(err, data.ErrNotFound) {
+			return data.Errorf(data.ErrNotFound, "no deleted risk with ID: %s", ID)
+		}
+		if err != nil {
+			return err
+		}
+
+		var restored data.Risk
+		err = tx.QueryRow(ctx, restoreRiskByID, ID).Scan(append(riskFields(&restored), &restored.DeletedAt)...)
+		if err != nil {
+			return classifyError(err)
+		}
+		return insertHistory(ctx, tx, data.ActionRestored, &current, &restored)
+	})
+}
+
+//go:embed sql/purge_deleted_risks.sql
+var purgeDeletedRisks string
+
+// PurgeDeletedBefore hard deletes every risk that was soft deleted before the given time
+func (rdb *risksDB) PurgeDeletedBefore(ctx context.Context, before time.Time) (int64, error) {
+	var purged int64
+	err := rdb.db.withTx(ctx, func(tx pgx.Tx) error {
+		rows, err := tx.Query(ctx, purgeDeletedRisks, before)
+		if err != nil {
+			return classifyError(err)
+		}
+		var risks []data.Risk
+		for rows.Next() {
+			var risk data.Risk
+			if err = rows.Scan(append(riskFields(&risk), &risk.DeletedAt)...); err != nil {
+				rows.Close()
+				return classifyError(err)
+			}
+			risks = append(risks, risk)
+		}
+		rows.Close()
+		if err = rows.Err(); err != nil {
+			return classifyError(err)
+		}
+
+		for i := range risks {
+			if err = insertHistory(ctx, tx, data.ActionPurged, &risks[i], nil); err != nil {
+				return err
+			}
+		}
+		purged = int64(len(risks))
+		return nil
+	})
+	return purged, err
 }
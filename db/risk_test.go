@@ -2,10 +2,14 @@ package db
 
 import (
 	"context"
+	"fmt"
 	"github.com/google/uuid"
 	"github.com/stretchr/testify/assert"
 	"stan-project/data"
+	"stan-project/db/dbtest"
+	"sync"
 	"testing"
+	"time"
 )
 
 func TestNewRisksDB(t *testing.T) {
@@ -15,7 +19,7 @@ func TestNewRisksDB(t *testing.T) {
 		if err != nil {
 			t.Fatalf("error initializing DB for test: %s", err)
 		}
-		defer pDB.client.Close(ctx)
+		defer pDB.Close(ctx)
 
 		rDB := NewRisksDB(pDB)
 
@@ -23,6 +27,17 @@ func TestNewRisksDB(t *testing.T) {
 	})
 }
 
+func TestRisksDB_Conformance(t *testing.T) {
+	ctx := context.Background()
+	pDB, err := InitDB(ctx)
+	if err != nil {
+		t.Fatalf("error initializing DB for test: %s", err)
+	}
+	defer pDB.Close(ctx)
+
+	dbtest.Run(t, NewRisksDB(pDB))
+}
+
 func TestRisksDB_Add(t *testing.T) {
 	t.Run("successfully add a new risk", func(t *testing.T) {
 		ctx := context.Background()
@@ -30,12 +45,12 @@ func TestRisksDB_Add(t *testing.T) {
 		if err != nil {
 			t.Fatalf("error initializing DB for test: %s", err)
 		}
-		defer pDB.client.Close(ctx)
+		defer pDB.Close(ctx)
 
 		rDB := NewRisksDB(pDB)
 
 		riskID := uuid.MustParse("c7041e22-15c1-4293-9b43-c54c8dd4b909")
-		err = rDB.Add(ctx, data.Risk{
+		_, err = rDB.Add(ctx, data.Risk{
 			ID:          riskID,
 			Title:       "threat 1",
 			Description: "DDOS threat",
@@ -62,13 +77,13 @@ func TestRisksDB_GetByID(t *testing.T) {
 		if err != nil {
 			t.Fatalf("error initializing DB for test: %s", err)
 		}
-		defer pDB.client.Close(ctx)
+		defer pDB.Close(ctx)
 
 		rDB := NewRisksDB(pDB)
 
 		//Add test data
 		riskID := uuid.MustParse("c7041e22-15c1-4293-9b43-c54c8dd4b909")
-		addErr := rDB.Add(ctx, data.Risk{
+		added, addErr := rDB.Add(ctx, data.Risk{
 			ID:          riskID,
 			Title:       "threat 1",
 			Description: "DDOS threat",
@@ -87,35 +102,228 @@ func TestRisksDB_GetByID(t *testing.T) {
 			}
 		}()
 
-		expected := data.Risk{
+		actual, err := rDB.GetByID(ctx, riskID)
+
+		assert.Nil(t, err)
+		assert.Equal(t, added, actual)
+		assert.False(t, actual.CreatedAt.IsZero())
+	})
+}
+
+func TestRisksDB_GetAll(t *testing.T) {
+	t.Run("successfully get all risks", func(t *testing.T) {
+
+		ctx := context.Background()
+		pDB, err := InitDB(ctx)
+		if err != nil {
+			t.Fatalf("error initializing DB for test: %s", err)
+		}
+		defer pDB.Close(ctx)
+
+		rDB := NewRisksDB(pDB)
+
+		//Add test data
+		riskID := uuid.MustParse("c7041e22-15c1-4293-9b43-c54c8dd4b909")
+		added, addErr := rDB.Add(ctx, data.Risk{
 			ID:          riskID,
 			Title:       "threat 1",
 			Description: "DDOS threat",
 			State:       "open",
+		})
+
+		if addErr != nil {
+			t.Fatalf("error adding test data: %s", err)
 		}
 
-		actual, err := rDB.GetByID(ctx, riskID)
+		defer func() {
+			//clean up
+			deleteEr := rDB.DeleteByID(ctx, riskID)
+			if deleteEr != nil {
+				t.Logf("error cleaning up test data: %s", err)
+			}
+		}()
+
+		expected := data.PaginatedResponse{
+			TotalCount: intPtr(1),
+			Risks:      []data.Risk{added},
+		}
+
+		actual, err := rDB.GetAll(ctx, data.Options{Offset: 0, Limit: 3, Sort: []data.SortKey{{Field: "title"}}})
 
 		assert.Nil(t, err)
 		assert.Equal(t, expected, actual)
 	})
 }
 
-func TestRisksDB_GetAll(t *testing.T) {
-	t.Run("successfully get all risks", func(t *testing.T) {
+func TestRisksDB_GetAll_Cursor(t *testing.T) {
+	t.Run("successfully page through risks with cursors", func(t *testing.T) {
 
 		ctx := context.Background()
 		pDB, err := InitDB(ctx)
 		if err != nil {
 			t.Fatalf("error initializing DB for test: %s", err)
 		}
-		defer pDB.client.Close(ctx)
+		defer pDB.Close(ctx)
+
+		rDB := NewRisksDB(pDB)
+
+		//Add test data
+		var ids []uuid.UUID
+		for _, title := range []string{"threat 1", "threat 2", "threat 3"} {
+			added, addErr := rDB.Add(ctx, data.Risk{ID: uuid.New(), Title: title, State: "open"})
+			if addErr != nil {
+				t.Fatalf("error adding test data: %s", addErr)
+			}
+			ids = append(ids, added.ID)
+		}
+
+		defer func() {
+			//clean up
+			for _, id := range ids {
+				deleteEr := rDB.DeleteByID(ctx, id)
+				if deleteEr != nil {
+					t.Logf("error cleaning up test data: %s", deleteEr)
+				}
+			}
+		}()
+
+		options := data.Options{Limit: 2, Sort: []data.SortKey{{Field: "title"}}, Count: data.CountNone}
+
+		first, err := rDB.GetAll(ctx, options)
+		assert.Nil(t, err)
+		assert.Nil(t, first.TotalCount)
+		assert.Nil(t, first.PrevCursor)
+		assert.Equal(t, ids[:2], []uuid.UUID{first.Risks[0].ID, first.Risks[1].ID})
+
+		options.After = first.NextCursor
+		second, err := rDB.GetAll(ctx, options)
+		assert.Nil(t, err)
+		assert.Nil(t, second.NextCursor)
+		assert.Equal(t, ids[2], second.Risks[0].ID)
+
+		options.After = second.PrevCursor
+		previous, err := rDB.GetAll(ctx, options)
+		assert.Nil(t, err)
+		assert.Equal(t, first.Risks, previous.Risks)
+		assert.Nil(t, previous.PrevCursor)
+
+		options.After = first.NextCursor
+		options.Sort = []data.SortKey{{Field: "state"}}
+		_, err = rDB.GetAll(ctx, options)
+		assert.ErrorIs(t, err, data.ErrValidation)
+	})
+}
+
+func TestRisksDB_Search(t *testing.T) {
+	t.Run("successfully search risks", func(t *testing.T) {
+
+		ctx := context.Background()
+		pDB, err := InitDB(ctx)
+		if err != nil {
+			t.Fatalf("error initializing DB for test: %s", err)
+		}
+		defer pDB.Close(ctx)
 
 		rDB := NewRisksDB(pDB)
 
 		//Add test data
 		riskID := uuid.MustParse("c7041e22-15c1-4293-9b43-c54c8dd4b909")
-		addErr := rDB.Add(ctx, data.Risk{
+		_, addErr := rDB.Add(ctx, data.Risk{
+			ID:          riskID,
+			Title:       "threat 1",
+			Description: "Attackers flooding the API with requests",
+			State:       "open",
+		})
+
+		if addErr != nil {
+			t.Fatalf("error adding test data: %s", addErr)
+		}
+
+		defer func() {
+			//clean up
+			deleteEr := rDB.DeleteByID(ctx, riskID)
+			if deleteEr != nil {
+				t.Logf("error cleaning up test data: %s", deleteEr)
+			}
+		}()
+
+		actual, err := rDB.Search(ctx, "flood attack", data.Options{Limit: 3, Count: data.CountExact})
+
+		assert.Nil(t, err)
+		assert.Equal(t, 1, *actual.TotalCount)
+		assert.Equal(t, riskID, actual.Risks[0].ID)
+		assert.Contains(t, actual.Risks[0].DescriptionHighlight, "<mark>flooding</mark>")
+	})
+}
+
+func TestRisksDB_Concurrent(t *testing.T) {
+	t.Run("successfully add and list risks from many goroutines", func(t *testing.T) {
+
+		ctx := context.Background()
+		pDB, err := InitDB(ctx)
+		if err != nil {
+			t.Fatalf("error initializing DB for test: %s", err)
+		}
+		defer pDB.Close(ctx)
+
+		rDB := NewRisksDB(pDB)
+
+		// more goroutines than pooled connections, so that requests have to wait for a connection
+		workers := 4 * int(pDB.Stats().MaxConns)
+		ids := make([]uuid.UUID, workers)
+		errs := make(chan error, 2*workers)
+
+		var wg sync.WaitGroup
+		for i := 0; i < workers; i++ {
+			ids[i] = uuid.New()
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				_, addErr := rDB.Add(ctx, data.Risk{ID: ids[i], Title: fmt.Sprintf("threat %d", i), State: "open"})
+				errs <- addErr
+				_, getErr := rDB.GetAll(ctx, data.Options{Limit: 10, Sort: []data.SortKey{{Field: "title"}}, Count: data.CountExact})
+				errs <- getErr
+			}(i)
+		}
+		wg.Wait()
+		close(errs)
+
+		defer func() {
+			//clean up
+			for _, id := range ids {
+				deleteEr := rDB.DeleteByID(ctx, id)
+				if deleteEr != nil {
+					t.Logf("error cleaning up test data: %s", deleteEr)
+				}
+			}
+		}()
+
+		for err := range errs {
+			assert.Nil(t, err)
+		}
+
+		all, err := rDB.GetAll(ctx, data.Options{Limit: 1, Sort: []data.SortKey{{Field: "title"}}, Count: data.CountExact})
+		assert.Nil(t, err)
+		assert.Equal(t, workers, *all.TotalCount)
+		assert.Equal(t, int32(0), pDB.Stats().AcquiredConns)
+	})
+}
+
+func TestRisksDB_Update(t *testing.T) {
+	t.Run("successfully update a risk", func(t *testing.T) {
+
+		ctx := context.Background()
+		pDB, err := InitDB(ctx)
+		if err != nil {
+			t.Fatalf("error initializing DB for test: %s", err)
+		}
+		defer pDB.Close(ctx)
+
+		rDB := NewRisksDB(pDB)
+
+		//Add test data
+		riskID := uuid.MustParse("c7041e22-15c1-4293-9b43-c54c8dd4b909")
+		added, addErr := rDB.Add(ctx, data.Risk{
 			ID:          riskID,
 			Title:       "threat 1",
 			Description: "DDOS threat",
@@ -134,21 +342,295 @@ func TestRisksDB_GetAll(t *testing.T) {
 			}
 		}()
 
-		expected := data.PaginatedResponse{
-			TotalCount: 1,
-			Risks: []data.Risk{
-				{
-					ID:          riskID,
-					Title:       "threat 1",
-					Description: "DDOS threat",
-					State:       "open",
-				},
-			},
+		updated, err := rDB.Update(ctx, data.Risk{
+			ID:          riskID,
+			Title:       "threat 1",
+			Description: "DDOS threat, mitigated by rate limiting",
+			State:       "investigating",
+		})
+		assert.Nil(t, err)
+		assert.Equal(t, "DDOS threat, mitigated by rate limiting", updated.Description)
+		assert.Equal(t, added.CreatedAt, updated.CreatedAt)
+		assert.False(t, updated.UpdatedAt.Before(added.UpdatedAt))
+
+		actual, err := rDB.GetByID(ctx, riskID)
+
+		assert.Nil(t, err)
+		assert.Equal(t, updated, actual)
+	})
+
+	t.Run("failed to update a risk, risk not found", func(t *testing.T) {
+
+		ctx := context.Background()
+		pDB, err := InitDB(ctx)
+		if err != nil {
+			t.Fatalf("error initializing DB for test: %s", err)
+		}
+		defer pDB.Close(ctx)
+
+		rDB := NewRisksDB(pDB)
+
+		_, err = rDB.Update(ctx, data.Risk{
+			ID:          uuid.MustParse("1b1e4a4e-6d1f-4a51-9a5c-3c2f8a1e4b7d"),
+			Title:       "threat 1",
+			Description: "DDOS threat",
+			State:       "open",
+		})
+
+		assert.ErrorIs(t, err, data.ErrNotFound)
+	})
+}
+
+func TestRisksDB_SoftDeleteByID(t *testing.T) {
+	t.Run("successfully soft delete and restore a risk", func(t *testing.T) {
+
+		ctx := context.Background()
+		pDB, err := InitDB(ctx)
+		if err != nil {
+			t.Fatalf("error initializing DB for test: %s", err)
 		}
+		defer pDB.Close(ctx)
+
+		rDB := NewRisksDB(pDB)
+
+		//Add test data
+		riskID := uuid.MustParse("c7041e22-15c1-4293-9b43-c54c8dd4b909")
+		_, addErr := rDB.Add(ctx, data.Risk{
+			ID:          riskID,
+			Title:       "threat 1",
+			Description: "DDOS threat",
+			State:       "open",
+		})
 
-		actual, err := rDB.GetAll(ctx, data.Options{Offset: 0, Limit: 3, SortBy: "title", SortOrder: "asc"})
+		if addErr != nil {
+			t.Fatalf("error adding test data: %s", err)
+		}
 
+		defer func() {
+			//clean up
+			deleteEr := rDB.DeleteByID(ctx, riskID)
+			if deleteEr != nil {
+				t.Logf("error cleaning up test data: %s", err)
+			}
+		}()
+
+		err = rDB.SoftDeleteByID(ctx, riskID, 0)
+		assert.Nil(t, err)
+
+		_, err = rDB.GetByID(ctx, riskID)
+		assert.ErrorIs(t, err, data.ErrNotFound)
+
+		deleted, err := rDB.GetDeleted(ctx, data.Options{Offset: 0, Limit: 3})
+		assert.Nil(t, err)
+		assert.Equal(t, 1, *deleted.TotalCount)
+		assert.Equal(t, riskID, deleted.Risks[0].ID)
+		assert.NotNil(t, deleted.Risks[0].DeletedAt)
+
+		err = rDB.SoftDeleteByID(ctx, riskID, 0)
+		assert.ErrorIs(t, err, data.ErrNotFound)
+
+		err = rDB.RestoreByID(ctx, riskID)
+		assert.Nil(t, err)
+
+		_, err = rDB.GetByID(ctx, riskID)
 		assert.Nil(t, err)
-		assert.Equal(t, expected, actual)
 	})
 }
+
+func TestRisksDB_PurgeDeletedBefore(t *testing.T) {
+	t.Run("successfully purge deleted risks", func(t *testing.T) {
+
+		ctx := context.Background()
+		pDB, err := InitDB(ctx)
+		if err != nil {
+			t.Fatalf("error initializing DB for test: %s", err)
+		}
+		defer pDB.Close(ctx)
+
+		rDB := NewRisksDB(pDB)
+
+		//Add test data
+		riskID := uuid.MustParse("c7041e22-15c1-4293-9b43-c54c8dd4b909")
+		_, addErr := rDB.Add(ctx, data.Risk{
+			ID:          riskID,
+			Title:       "threat 1",
+			Description: "DDOS threat",
+			State:       "open",
+		})
+
+		if addErr != nil {
+			t.Fatalf("error adding test data: %s", err)
+		}
+
+		err = rDB.SoftDeleteByID(ctx, riskID, 0)
+		if err != nil {
+			t.Fatalf("error deleting test data: %s", err)
+		}
+
+		purged, err := rDB.PurgeDeletedBefore(ctx, time.Now().Add(time.Minute))
+		assert.Nil(t, err)
+		assert.Equal(t, int64(1), purged)
+
+		err = rDB.RestoreByID(ctx, riskID)
+		assert.ErrorIs(t, err, data.ErrNotFound)
+	})
+}
+
+func TestOrderBy(t *testing.T) {
+	tests := []struct {
+		name     string
+		keys     []data.SortKey
+		expected string
+	}{
+		{
+			name:     "no sort keys falls back to the tie-breaker",
+			expected: "risk_id ASC",
+		},
+		{
+			name:     "multiple sort keys with a tie-breaker",
+			keys:     []data.SortKey{{Field: "state"}, {Field: "title", Descending: true}},
+			expected: "state ASC, title DESC, risk_id ASC",
+		},
+		{
+			name:     "sorting by id needs no tie-breaker",
+			keys:     []data.SortKey{{Field: "id", Descending: true}, {Field: "title"}},
+			expected: "risk_id DESC",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			actual, err := orderBy(tt.keys)
+			assert.Nil(t, err)
+			assert.Equal(t, tt.expected, actual)
+		})
+	}
+
+	t.Run("unknown fields are rejected", func(t *testing.T) {
+		_, err := orderBy([]data.SortKey{{Field: "title; DROP TABLE risks"}})
+		assert.ErrorIs(t, err, data.ErrValidation)
+	})
+}
+
+func TestWhereFilter(t *testing.T) {
+	after := time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)
+	before := time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name         string
+		filter       data.Filter
+		firstArg     int
+		expected     string
+		expectedArgs []any
+	}{
+		{
+			name:     "no filter",
+			firstArg: 1,
+		},
+		{
+			name:         "states and escaped title",
+			filter:       data.Filter{States: []data.State{data.StateOpen, data.StateClosed}, Title: "100%_sure"},
+			firstArg:     1,
+			expected:     " AND state = ANY($1) AND title ILIKE $2",
+			expectedArgs: []any{[]string{"open", "closed"}, `%100\%\_sure%`},
+		},
+		{
+			name:         "date ranges after the pagination arguments",
+			filter:       data.Filter{Description: "ddos", CreatedAfter: &after, UpdatedBefore: &before},
+			firstArg:     3,
+			expected:     " AND description ILIKE $3 AND created_at >= $4 AND updated_at < $5",
+			expectedArgs: []any{"%ddos%", after, before},
+		},
+		{
+			name:         "severities and a residual score range",
+			filter:       data.Filter{Severities: []data.Severity{data.SeverityHigh}, MinScore: 6, MaxScore: 20},
+			firstArg:     1,
+			expected:     " AND severity = ANY($1) AND residual_score >= $2 AND residual_score <= $3",
+			expectedArgs: []any{[]string{"high"}, 6, 20},
+		},
+		{
+			name:         "owner and the risks of a user",
+			filter:       data.Filter{Owner: "alice", Involving: "bob"},
+			firstArg:     2,
+			expected:     " AND owner_id = $2 AND (owner_id = $3 OR assignee_id = $3)",
+			expectedArgs: []any{"alice", "bob"},
+		},
+		{
+			name:         "creator and last updater",
+			filter:       data.Filter{CreatedBy: "alice", UpdatedBy: "bob"},
+			firstArg:     1,
+			expected:     " AND created_by = $1 AND updated_by = $2",
+			expectedArgs: []any{"alice", "bob"},
+		},
+		{
+			name:         "every one of the tags",
+			filter:       data.Filter{Tags: []string{"cloud", "payments"}},
+			firstArg:     1,
+			expected:     " AND tags @> $1",
+			expectedArgs: []any{[]string{"cloud", "payments"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			actual, args := whereFilter(tt.filter, tt.firstArg)
+			assert.Equal(t, tt.expected, actual)
+			assert.Equal(t, tt.expectedArgs, args)
+		})
+	}
+}
+
+func TestKeysetCondition(t *testing.T) {
+	keys := []data.SortKey{{Field: "state"}, {Field: "title", Descending: true}, {Field: "id"}}
+
+	t.Run("forward cursor", func(t *testing.T) {
+		actual, args, err := keysetCondition(keys, &data.Cursor{Values: []string{"open", "threat 1", "c7041e22-15c1-4293-9b43-c54c8dd4b909"}}, 3)
+		assert.Nil(t, err)
+		assert.Equal(t, " AND ((state > $3) OR (state = $3 AND title < $4) OR (state = $3 AND title = $4 AND risk_id > $5))", actual)
+		assert.Equal(t, []any{"open", "threat 1", "c7041e22-15c1-4293-9b43-c54c8dd4b909"}, args)
+	})
+
+	t.Run("backward cursor", func(t *testing.T) {
+		actual, _, err := keysetCondition(keys, &data.Cursor{Values: []string{"open", "threat 1", "c7041e22-15c1-4293-9b43-c54c8dd4b909"}, Backward: true}, 1)
+		assert.Nil(t, err)
+		assert.Equal(t, " AND ((state < $1) OR (state = $1 AND title > $2) OR (state = $1 AND title = $2 AND risk_id < $3))", actual)
+	})
+
+	t.Run("numeric cursor values are compared as numbers", func(t *testing.T) {
+		actual, args, err := keysetCondition([]data.SortKey{{Field: "residualScore", Descending: true}, {Field: "id"}}, &data.Cursor{Values: []string{"012", "c7041e22-15c1-4293-9b43-c54c8dd4b909"}}, 1)
+		assert.Nil(t, err)
+		assert.Equal(t, " AND ((residual_score < $1) OR (residual_score = $1 AND risk_id > $2))", actual)
+		assert.Equal(t, []any{12, "c7041e22-15c1-4293-9b43-c54c8dd4b909"}, args)
+	})
+
+	t.Run("time cursor values are compared as times", func(t *testing.T) {
+		actual, args, err := keysetCondition([]data.SortKey{{Field: "createdAt"}, {Field: "id"}}, &data.Cursor{Values: []string{"2024-06-01T10:00:00.000001Z", "c7041e22-15c1-4293-9b43-c54c8dd4b909"}}, 1)
+		assert.Nil(t, err)
+		assert.Equal(t, " AND ((created_at > $1) OR (created_at = $1 AND risk_id > $2))", actual)
+		assert.Equal(t, []any{time.Date(2024, 6, 1, 10, 0, 0, 1000, time.UTC), "c7041e22-15c1-4293-9b43-c54c8dd4b909"}, args)
+
+		_, _, err = keysetCondition([]data.SortKey{{Field: "createdAt"}, {Field: "id"}}, &data.Cursor{Values: []string{"yesterday", "c7041e22-15c1-4293-9b43-c54c8dd4b909"}}, 1)
+		assert.ErrorIs(t, err, data.ErrValidation)
+	})
+
+	t.Run("cursor values not matching the sort keys are rejected", func(t *testing.T) {
+		_, _, err := keysetCondition(keys, &data.Cursor{Values: []string{"open"}}, 1)
+		assert.ErrorIs(t, err, data.ErrValidation)
+	})
+}
+
+func TestPrefixQuery(t *testing.T) {
+	tests := map[string]string{
+		"ddos":                "ddos:*",
+		"  man in the middle": "man:* & in:* & the:* & middle:*",
+		"rate-limit & (dos)!": "rate:* & limit:* & dos:*",
+		"':*|!":               "",
+	}
+	for text, expected := range tests {
+		assert.Equal(t, expected, prefixQuery(text))
+	}
+}
+
+func intPtr(i int) *int {
+	return &i
+}
@@ -0,0 +1,5 @@
+INSERT INTO idempotency_keys(idempotency_key, request_hash, expires_at) VALUES ($1, $2, $3)
+ON CONFLICT (idempotency_key) DO UPDATE
+SET request_hash = EXCLUDED.request_hash, risk_id = NULL, response = NULL, created_at = NOW(), expires_at = EXCLUDED.expires_at
+WHERE idempotency_keys.expires_at <= NOW()
+RETURNING idempotency_key
@@ -1 +1 @@
-SELECT COUNT(*) FROM risks;
\ No newline at end of file
+SELECT COUNT(*) FROM risks WHERE deleted_at IS NULL%s;
\ No newline at end of file
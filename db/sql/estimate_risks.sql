@@ -0,0 +1 @@
+EXPLAIN (FORMAT JSON) SELECT 1 FROM risks WHERE deleted_at IS NULL%s;
\ No newline at end of file
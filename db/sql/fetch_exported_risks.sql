@@ -0,0 +1 @@
+FETCH FORWARD 500 FROM export_risks;
@@ -0,0 +1 @@
+SELECT request_hash, response FROM idempotency_keys WHERE idempotency_key = $1
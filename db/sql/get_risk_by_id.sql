@@ -1,5 +1,5 @@
 SELECT
-    *
+    risk_id, title, description, state, created_at, updated_at, version, external_ref, likelihood, impact, residual_likelihood, residual_impact, inherent_score, residual_score, severity, COALESCE(owner_id, ''), COALESCE(assignee_id, ''), created_by, updated_by, NULLIF(tags, '{}')
 FROM
     risks
-WHERE risk_id = $1
\ No newline at end of file
+WHERE risk_id = $1 AND deleted_at IS NULL
\ No newline at end of file
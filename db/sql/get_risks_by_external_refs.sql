@@ -0,0 +1,5 @@
+SELECT
+    risk_id, title, description, state, created_at, updated_at, version, external_ref, likelihood, impact, residual_likelihood, residual_impact, inherent_score, residual_score, severity, COALESCE(owner_id, ''), COALESCE(assignee_id, ''), created_by, updated_by, NULLIF(tags, '{}'), deleted_at
+FROM
+    risks
+WHERE external_ref = ANY($1)
\ No newline at end of file
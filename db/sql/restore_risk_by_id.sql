@@ -0,0 +1,2 @@
+UPDATE risks SET deleted_at = NULL, version = version + 1 WHERE risk_id = $1 AND deleted_at IS NOT NULL
+RETURNING risk_id, title, description, state, created_at, updated_at, version, external_ref, likelihood, impact, residual_likelihood, residual_impact, inherent_score, residual_score, severity, COALESCE(owner_id, ''), COALESCE(assignee_id, ''), created_by, updated_by, NULLIF(tags, '{}'), deleted_at
\ No newline at end of file
@@ -0,0 +1,11 @@
+SELECT
+    risk_id, title, description, state, created_at, updated_at, version, external_ref, likelihood, impact, residual_likelihood, residual_impact, inherent_score, residual_score, severity, COALESCE(owner_id, ''), COALESCE(assignee_id, ''), created_by, updated_by, NULLIF(tags, '{}'),
+    ts_rank(search, query) AS rank,
+    -- the headlines are made from an HTML escaped copy of the text, so that the marks are the only markup
+    ts_headline('english', replace(replace(replace(replace(replace(title, '&', '&amp;'), '<', '&lt;'), '>', '&gt;'), '"', '&#34;'), '''', '&#39;'), query, 'StartSel=<mark>, StopSel=</mark>, HighlightAll=true'),
+    ts_headline('english', replace(replace(replace(replace(replace(description, '&', '&amp;'), '<', '&lt;'), '>', '&gt;'), '"', '&#34;'), '''', '&#39;'), query, 'StartSel=<mark>, StopSel=</mark>, MaxFragments=3')
+FROM
+    risks, to_tsquery('english', $3) AS query
+WHERE deleted_at IS NULL AND search @@ query%s
+ORDER BY rank DESC, risk_id ASC
+LIMIT $1 OFFSET $2;
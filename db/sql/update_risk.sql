@@ -0,0 +1,5 @@
+UPDATE risks SET title = $2, description = $3, state = $4, external_ref = $5,
+    likelihood = $6, impact = $7, residual_likelihood = $8, residual_impact = $9, inherent_score = $10, residual_score = $11, severity = $12,
+    owner_id = NULLIF($13, ''), assignee_id = NULLIF($14, ''), tags = COALESCE($15::TEXT[], '{}'),
+    updated_at = NOW(), updated_by = $16, version = version + 1 WHERE risk_id = $1 AND deleted_at IS NULL
+RETURNING risk_id, title, description, state, created_at, updated_at, version, external_ref, likelihood, impact, residual_likelihood, residual_impact, inherent_score, residual_score, severity, COALESCE(owner_id, ''), COALESCE(assignee_id, ''), created_by, updated_by, NULLIF(tags, '{}')
\ No newline at end of file
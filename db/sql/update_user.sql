@@ -0,0 +1,2 @@
+UPDATE users SET name = $2, email = $3, active = $4, updated_at = NOW() WHERE user_id = $1
+RETURNING user_id, name, email, active, created_at, updated_at
@@ -0,0 +1,109 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	_ "embed"
+	"errors"
+	"stan-project/data"
+)
+
+//go:embed sql/get_risk_id_by_external_ref.sql
+var getRiskIDByExternalRef string
+
+// Batch applies the operations in a single transaction, one after the other. Every operation is checked before it
+// writes anything, so that a best effort batch can skip the failed operations and go on.
+func (rdb *risksDB) Batch(ctx context.Context, operations []data.BatchOperation, mode data.BatchMode, check data.BatchCheck) ([]data.BatchResult, error) {
+	var results []data.BatchResult
+	err := rdb.db.withTx(ctx, func(tx *sql.Tx) error {
+		results = make([]data.BatchResult, len(operations))
+		for i, operation := range operations {
+			results[i].Action = operation.Action
+			current, err := checkOperation(ctx, tx, operation, check)
+			if err != nil && mode == data.BatchAtomic {
+				return &data.BatchError{Index: i, Err: err}
+			}
+			if err != nil {
+				results[i].Err = err
+				continue
+			}
+
+			changed, err := applyOperation(ctx, tx, operation, current)
+			if err != nil {
+				return err
+			}
+			results[i].Risk = changed
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+// checkOperation checks an operation against the risks as the previous operations left them, it returns the risk an
+// update or delete changes
+func checkOperation(ctx context.Context, tx *sql.Tx, operation data.BatchOperation, check data.BatchCheck) (data.Risk, error) {
+	var current data.Risk
+	if operation.Action != data.BatchCreate {
+		var err error
+		current, err = lockRisk(ctx, tx, operation.ID)
+		if err == nil && current.DeletedAt != nil {
+			err = data.Errorf(data.ErrNotFound, "risk with ID: %s not found", operation.ID)
+		}
+		if err == nil {
+			err = checkVersion(current, operation.Version)
+		}
+		if err == nil {
+			err = check(current, operation)
+		}
+		if err != nil {
+			return data.Risk{}, err
+		}
+	}
+	if operation.Action == data.BatchDelete || operation.ExternalRef == "" {
+		return current, nil
+	}
+
+	// the unique index would fail the whole transaction, another risk holding the reference only fails the operation
+	var other string
+	err := tx.QueryRowContext(ctx, getRiskIDByExternalRef, operation.ExternalRef, operation.ID).Scan(&other)
+	if err == nil {
+		return data.Risk{}, data.Errorf(data.ErrConflict, "risk with ID: %s already has the external reference %q", other, operation.ExternalRef)
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return data.Risk{}, classifyError(err)
+	}
+	return current, nil
+}
+
+// applyOperation writes an operation that passed its checks, along with its history
+func applyOperation(ctx context.Context, tx *sql.Tx, operation data.BatchOperation, current data.Risk) (data.Risk, error) {
+	changedAt := now()
+	switch operation.Action {
+	case data.BatchCreate:
+		added, err := scanRisk(tx.QueryRowContext(ctx, insertRisk, riskValues(operation.Risk(), changedAt, data.AuditFrom(ctx).Actor)...))
+		if err != nil {
+			return data.Risk{}, classifyError(err)
+		}
+		return added, insertHistory(ctx, tx, changedAt, data.ActionCreated, nil, &added)
+	case data.BatchUpdate:
+		updated, err := scanRisk(tx.QueryRowContext(ctx, updateRisk, riskValues(operation.Risk(), changedAt, data.AuditFrom(ctx).Actor)...))
+		if err != nil {
+			return data.Risk{}, classifyError(err)
+		}
+		return updated, insertHistory(ctx, tx, changedAt, data.ActionUpdated, &current, &updated)
+	default:
+		var row riskRow
+		err := tx.QueryRowContext(ctx, softDeleteRiskByID, operation.ID, formatTime(changedAt)).Scan(append(row.fields(), &row.deletedAt)...)
+		if err != nil {
+			return data.Risk{}, classifyError(err)
+		}
+		deleted, err := row.toRisk()
+		if err != nil {
+			return data.Risk{}, err
+		}
+		return deleted, insertHistory(ctx, tx, changedAt, data.ActionDeleted, &current, &deleted)
+	}
+}
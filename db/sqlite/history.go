@@ -0,0 +1,92 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	_ "embed"
+	"encoding/json"
+	"github.com/google/uuid"
+	"stan-project/data"
+	"time"
+)
+
+//go:embed sql/insert_risk_history.sql
+var insertRiskHistory string
+
+// insertHistory records a change of a risk in its history, with the audit carried by the context.
+// It runs in the transaction of the change so that no change is left out of the history.
+func insertHistory(ctx context.Context, tx *sql.Tx, changedAt time.Time, action data.Action, before, after *data.Risk) error {
+	risk := after
+	if risk == nil {
+		risk = before
+	}
+	beforeJSON, err := snapshot(before)
+	if err != nil {
+		return err
+	}
+	afterJSON, err := snapshot(after)
+	if err != nil {
+		return err
+	}
+
+	audit := data.AuditFrom(ctx)
+	_, err = tx.ExecContext(ctx, insertRiskHistory, risk.ID, action, audit.Actor, audit.RequestID, audit.Reason, formatTime(changedAt), beforeJSON, afterJSON)
+	return classifyError(err)
+}
+
+// snapshot encodes a version of a risk for the history, a nil risk is stored as NULL
+func snapshot(risk *data.Risk) (sql.NullString, error) {
+	if risk == nil {
+		return sql.NullString{}, nil
+	}
+	encoded, err := json.Marshal(risk)
+	return sql.NullString{String: string(encoded), Valid: true}, err
+}
+
+//go:embed sql/get_risk_history.sql
+var getRiskHistory string
+
+// GetHistory lists the changes of a risk, oldest first. The history of a purged risk is kept.
+func (rdb *risksDB) GetHistory(ctx context.Context, ID uuid.UUID) ([]data.HistoryEntry, error) {
+	rows, err := rdb.db.client.QueryContext(ctx, getRiskHistory, ID)
+	if err != nil {
+		return nil, classifyError(err)
+	}
+	defer rows.Close()
+
+	var history []data.HistoryEntry
+
+	for rows.Next() {
+		var entry data.HistoryEntry
+		var changedAt string
+		var before, after sql.NullString
+		err = rows.Scan(&entry.ID, &entry.RiskID, &entry.Action, &entry.Actor, &entry.RequestID, &entry.Reason, &changedAt, &before, &after)
+		if err != nil {
+			return nil, classifyError(err)
+		}
+		if entry.ChangedAt, err = time.Parse(timeFormat, changedAt); err != nil {
+			return nil, err
+		}
+		if entry.Before, err = unmarshalSnapshot(before); err != nil {
+			return nil, err
+		}
+		if entry.After, err = unmarshalSnapshot(after); err != nil {
+			return nil, err
+		}
+		history = append(history, entry)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, classifyError(err)
+	}
+
+	return history, nil
+}
+
+func unmarshalSnapshot(encoded sql.NullString) (*data.Risk, error) {
+	if !encoded.Valid {
+		return nil, nil
+	}
+	var risk data.Risk
+	err := json.Unmarshal([]byte(encoded.String), &risk)
+	return &risk, err
+}
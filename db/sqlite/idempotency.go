@@ -0,0 +1,92 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"stan-project/data"
+	"time"
+)
+
+//go:embed sql/claim_idempotency_key.sql
+var claimIdempotencyKey string
+
+//go:embed sql/get_idempotency_key.sql
+var getIdempotencyKey string
+
+//go:embed sql/set_idempotency_key_response.sql
+var setIdempotencyKeyResponse string
+
+// AddIdempotent adds a risk unless the idempotency key was already used, in which case the risk added by the first
+// request is returned as it was then, with replayed set.
+// The key is claimed in the transaction adding the risk, which holds the write lock, so requests with the same key
+// take turns.
+func (rdb *risksDB) AddIdempotent(ctx context.Context, risk data.Risk, key data.IdempotencyKey) (data.Risk, bool, error) {
+	var (
+		added    data.Risk
+		replayed bool
+	)
+	err := rdb.db.withTx(ctx, func(tx *sql.Tx) error {
+		changedAt := now()
+		var claimed string
+		err := tx.QueryRowContext(ctx, claimIdempotencyKey, key.Key, key.RequestHash, formatTime(changedAt), formatTime(key.ExpiresAt)).Scan(&claimed)
+		if errors.Is(err, sql.ErrNoRows) {
+			replayed = true
+			added, err = replay(ctx, tx, key)
+			return err
+		}
+		if err != nil {
+			return classifyError(err)
+		}
+
+		added, err = scanRisk(tx.QueryRowContext(ctx, insertRisk, riskValues(risk, changedAt, data.AuditFrom(ctx).Actor)...))
+		if err != nil {
+			return classifyError(err)
+		}
+		if err = insertHistory(ctx, tx, changedAt, data.ActionCreated, nil, &added); err != nil {
+			return err
+		}
+		response, err := json.Marshal(added)
+		if err != nil {
+			return err
+		}
+		_, err = tx.ExecContext(ctx, setIdempotencyKeyResponse, key.Key, added.ID, string(response))
+		return classifyError(err)
+	})
+	if err != nil {
+		return data.Risk{}, false, err
+	}
+	return added, replayed, nil
+}
+
+// replay returns the risk added with an idempotency key that is already used
+func replay(ctx context.Context, tx *sql.Tx, key data.IdempotencyKey) (data.Risk, error) {
+	var requestHash, response string
+	if err := tx.QueryRowContext(ctx, getIdempotencyKey, key.Key).Scan(&requestHash, &response); err != nil {
+		return data.Risk{}, classifyError(err)
+	}
+	if requestHash != key.RequestHash {
+		return data.Risk{}, data.Errorf(data.ErrIdempotencyKeyReused, "idempotency key %q was used with another request", key.Key)
+	}
+
+	var risk data.Risk
+	if err := json.Unmarshal([]byte(response), &risk); err != nil {
+		return data.Risk{}, err
+	}
+	return risk, nil
+}
+
+//go:embed sql/purge_expired_idempotency_keys.sql
+var purgeExpiredIdempotencyKeys string
+
+// PurgeExpiredIdempotencyKeys deletes the idempotency keys that expired before the given time
+func (rdb *risksDB) PurgeExpiredIdempotencyKeys(ctx context.Context, before time.Time) (int64, error) {
+	result, err := rdb.db.client.ExecContext(ctx, purgeExpiredIdempotencyKeys, formatTime(before))
+	if err != nil {
+		return 0, classifyError(err)
+	}
+	purged, err := result.RowsAffected()
+	return purged, classifyError(err)
+}
@@ -0,0 +1,10 @@
+CREATE TABLE IF NOT EXISTS risks (
+    risk_id     TEXT PRIMARY KEY,
+    title       TEXT NOT NULL,
+    description TEXT NOT NULL DEFAULT '',
+    state       TEXT NOT NULL,
+    created_at  TEXT NOT NULL,
+    updated_at  TEXT NOT NULL,
+    deleted_at  TEXT
+);
+CREATE INDEX IF NOT EXISTS risks_deleted_at_idx ON risks (deleted_at);
@@ -0,0 +1,14 @@
+CREATE VIRTUAL TABLE IF NOT EXISTS risks_search USING fts5(
+    title, description, content='risks', content_rowid='rowid', tokenize='porter unicode61'
+);
+CREATE TRIGGER IF NOT EXISTS risks_search_insert AFTER INSERT ON risks BEGIN
+    INSERT INTO risks_search(rowid, title, description) VALUES (new.rowid, new.title, new.description);
+END;
+CREATE TRIGGER IF NOT EXISTS risks_search_delete AFTER DELETE ON risks BEGIN
+    INSERT INTO risks_search(risks_search, rowid, title, description) VALUES ('delete', old.rowid, old.title, old.description);
+END;
+CREATE TRIGGER IF NOT EXISTS risks_search_update AFTER UPDATE OF title, description ON risks BEGIN
+    INSERT INTO risks_search(risks_search, rowid, title, description) VALUES ('delete', old.rowid, old.title, old.description);
+    INSERT INTO risks_search(rowid, title, description) VALUES (new.rowid, new.title, new.description);
+END;
+INSERT INTO risks_search(risks_search) VALUES ('rebuild');
@@ -0,0 +1,12 @@
+-- likelihood and impact are rated before and after the mitigations of a risk, the scores and severity are computed
+-- by the service from the ratings and its configured severity bands. The defaults backfill the risks created before
+-- scoring, rated in the middle of the default 1 to 5 scale like unrated new risks.
+ALTER TABLE risks ADD COLUMN likelihood INTEGER NOT NULL DEFAULT 3;
+ALTER TABLE risks ADD COLUMN impact INTEGER NOT NULL DEFAULT 3;
+ALTER TABLE risks ADD COLUMN residual_likelihood INTEGER NOT NULL DEFAULT 3;
+ALTER TABLE risks ADD COLUMN residual_impact INTEGER NOT NULL DEFAULT 3;
+ALTER TABLE risks ADD COLUMN inherent_score INTEGER NOT NULL DEFAULT 9;
+ALTER TABLE risks ADD COLUMN residual_score INTEGER NOT NULL DEFAULT 9;
+ALTER TABLE risks ADD COLUMN severity TEXT NOT NULL DEFAULT 'medium';
+CREATE INDEX risks_residual_score_idx ON risks (residual_score, risk_id) WHERE deleted_at IS NULL;
+CREATE INDEX risks_inherent_score_idx ON risks (inherent_score, risk_id) WHERE deleted_at IS NULL;
@@ -0,0 +1,14 @@
+-- the users who own risks or are assigned to them, identified by the actor the gateway sends with their requests.
+-- Users are deactivated rather than deleted, so that the risks they own keep referencing them.
+CREATE TABLE IF NOT EXISTS users (
+    user_id    TEXT PRIMARY KEY,
+    name       TEXT NOT NULL,
+    email      TEXT NOT NULL DEFAULT '',
+    active     INTEGER NOT NULL DEFAULT 1,
+    created_at TEXT NOT NULL,
+    updated_at TEXT NOT NULL
+);
+ALTER TABLE risks ADD COLUMN owner_id TEXT REFERENCES users (user_id);
+ALTER TABLE risks ADD COLUMN assignee_id TEXT REFERENCES users (user_id);
+CREATE INDEX risks_owner_id_idx ON risks (owner_id) WHERE deleted_at IS NULL;
+CREATE INDEX risks_assignee_id_idx ON risks (assignee_id) WHERE deleted_at IS NULL;
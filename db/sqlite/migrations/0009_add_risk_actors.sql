@@ -0,0 +1,20 @@
+-- the actors who created and last updated every risk, written by the service from the actor of the request
+ALTER TABLE risks ADD COLUMN created_by TEXT NOT NULL DEFAULT '';
+ALTER TABLE risks ADD COLUMN updated_by TEXT NOT NULL DEFAULT '';
+
+-- the existing risks take their actors from their history, the risks written before the history was recorded have
+-- no known actor
+UPDATE risks
+SET created_by = COALESCE((
+        SELECT actor FROM risk_history
+        WHERE risk_history.risk_id = risks.risk_id AND action = 'created'
+        ORDER BY history_id LIMIT 1
+    ), 'unknown'),
+    updated_by = COALESCE((
+        SELECT actor FROM risk_history
+        WHERE risk_history.risk_id = risks.risk_id AND action IN ('created', 'updated')
+        ORDER BY history_id DESC LIMIT 1
+    ), 'unknown');
+
+CREATE INDEX risks_created_at_idx ON risks (created_at, risk_id) WHERE deleted_at IS NULL;
+CREATE INDEX risks_updated_at_idx ON risks (updated_at, risk_id) WHERE deleted_at IS NULL;
@@ -0,0 +1,67 @@
+-- the search index was keyed on the implicit rowid of the risks, which VACUUM may renumber on a table without an
+-- INTEGER PRIMARY KEY. The risks are copied to a table whose search_id is an explicit alias of the rowid, keeping
+-- their rowids, and the index is keyed on it.
+DROP TRIGGER risks_search_insert;
+DROP TRIGGER risks_search_delete;
+DROP TRIGGER risks_search_update;
+DROP TABLE risks_search;
+
+CREATE TABLE risks_copy (
+    search_id           INTEGER PRIMARY KEY,
+    risk_id             TEXT NOT NULL UNIQUE,
+    title               TEXT NOT NULL,
+    description         TEXT NOT NULL DEFAULT '',
+    state               TEXT NOT NULL,
+    created_at          TEXT NOT NULL,
+    updated_at          TEXT NOT NULL,
+    deleted_at          TEXT,
+    version             INTEGER NOT NULL DEFAULT 1,
+    external_ref        TEXT NOT NULL DEFAULT '',
+    likelihood          INTEGER NOT NULL DEFAULT 3,
+    impact              INTEGER NOT NULL DEFAULT 3,
+    residual_likelihood INTEGER NOT NULL DEFAULT 3,
+    residual_impact     INTEGER NOT NULL DEFAULT 3,
+    inherent_score      INTEGER NOT NULL DEFAULT 9,
+    residual_score      INTEGER NOT NULL DEFAULT 9,
+    severity            TEXT NOT NULL DEFAULT 'medium',
+    owner_id            TEXT REFERENCES users (user_id),
+    assignee_id         TEXT REFERENCES users (user_id),
+    created_by          TEXT NOT NULL DEFAULT '',
+    updated_by          TEXT NOT NULL DEFAULT ''
+);
+INSERT INTO risks_copy (
+    search_id, risk_id, title, description, state, created_at, updated_at, deleted_at, version, external_ref,
+    likelihood, impact, residual_likelihood, residual_impact, inherent_score, residual_score, severity,
+    owner_id, assignee_id, created_by, updated_by
+)
+SELECT
+    rowid, risk_id, title, description, state, created_at, updated_at, deleted_at, version, external_ref,
+    likelihood, impact, residual_likelihood, residual_impact, inherent_score, residual_score, severity,
+    owner_id, assignee_id, created_by, updated_by
+FROM risks;
+DROP TABLE risks;
+ALTER TABLE risks_copy RENAME TO risks;
+
+CREATE INDEX risks_deleted_at_idx ON risks (deleted_at);
+CREATE UNIQUE INDEX risks_external_ref_idx ON risks (external_ref) WHERE external_ref <> '';
+CREATE INDEX risks_residual_score_idx ON risks (residual_score, risk_id) WHERE deleted_at IS NULL;
+CREATE INDEX risks_inherent_score_idx ON risks (inherent_score, risk_id) WHERE deleted_at IS NULL;
+CREATE INDEX risks_owner_id_idx ON risks (owner_id) WHERE deleted_at IS NULL;
+CREATE INDEX risks_assignee_id_idx ON risks (assignee_id) WHERE deleted_at IS NULL;
+CREATE INDEX risks_created_at_idx ON risks (created_at, risk_id) WHERE deleted_at IS NULL;
+CREATE INDEX risks_updated_at_idx ON risks (updated_at, risk_id) WHERE deleted_at IS NULL;
+
+CREATE VIRTUAL TABLE risks_search USING fts5(
+    title, description, content='risks', content_rowid='search_id', tokenize='porter unicode61'
+);
+CREATE TRIGGER risks_search_insert AFTER INSERT ON risks BEGIN
+    INSERT INTO risks_search(rowid, title, description) VALUES (new.search_id, new.title, new.description);
+END;
+CREATE TRIGGER risks_search_delete AFTER DELETE ON risks BEGIN
+    INSERT INTO risks_search(risks_search, rowid, title, description) VALUES ('delete', old.search_id, old.title, old.description);
+END;
+CREATE TRIGGER risks_search_update AFTER UPDATE OF title, description ON risks BEGIN
+    INSERT INTO risks_search(risks_search, rowid, title, description) VALUES ('delete', old.search_id, old.title, old.description);
+    INSERT INTO risks_search(rowid, title, description) VALUES (new.search_id, new.title, new.description);
+END;
+INSERT INTO risks_search(risks_search) VALUES ('rebuild');
@@ -0,0 +1,2 @@
+-- the tags label a risk, e.g. with the areas or the projects it concerns, stored as a JSON array of strings
+ALTER TABLE risks ADD COLUMN tags TEXT NOT NULL DEFAULT '[]';
@@ -0,0 +1,764 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"html"
+	"slices"
+	"stan-project/data"
+	"strings"
+	"time"
+	"unicode"
+)
+
+type risksDB struct {
+	db *db
+}
+
+func NewRisksDB(db *db) *risksDB {
+	return &risksDB{db: db}
+}
+
+// scanner is a *sql.Row or *sql.Rows
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+// riskRow holds the risk columns selected by every query, the times are stored as text and the tags as a JSON array
+type riskRow struct {
+	risk      data.Risk
+	createdAt string
+	updatedAt string
+	tags      string
+	deletedAt sql.NullString
+}
+
+func (row *riskRow) fields() []any {
+	return []any{&row.risk.ID, &row.risk.Title, &row.risk.Description, &row.risk.State, &row.createdAt, &row.updatedAt, &row.risk.Version, &row.risk.ExternalRef,
+		&row.risk.Likelihood, &row.risk.Impact, &row.risk.ResidualLikelihood, &row.risk.ResidualImpact, &row.risk.InherentScore, &row.risk.ResidualScore, &row.risk.Severity,
+		&row.risk.Owner, &row.risk.Assignee, &row.risk.CreatedBy, &row.risk.UpdatedBy, &row.tags}
+}
+
+// riskValues returns the values of the columns written by insert_risk.sql and update_risk.sql, in order. The actor is
+// recorded as the creator of an inserted risk and as the last updater of the risk.
+func riskValues(risk data.Risk, changedAt time.Time, actor string) []any {
+	return []any{risk.ID, risk.Title, risk.Description, risk.State, formatTime(changedAt), risk.ExternalRef,
+		risk.Likelihood, risk.Impact, risk.ResidualLikelihood, risk.ResidualImpact, risk.InherentScore, risk.ResidualScore, risk.Severity,
+		risk.Owner, risk.Assignee, formatTags(risk.Tags), actor}
+}
+
+// formatTags returns the tags as the JSON array they are stored as
+func formatTags(tags []string) string {
+	if len(tags) == 0 {
+		return "[]"
+	}
+	formatted, _ := json.Marshal(tags)
+	return string(formatted)
+}
+
+// toRisk parses the stored times into the risk
+func (row *riskRow) toRisk() (data.Risk, error) {
+	risk := row.risk
+	var err error
+	if risk.CreatedAt, err = time.Parse(timeFormat, row.createdAt); err != nil {
+		return data.Risk{}, err
+	}
+	if risk.UpdatedAt, err = time.Parse(timeFormat, row.updatedAt); err != nil {
+		return data.Risk{}, err
+	}
+	if err = json.Unmarshal([]byte(row.tags), &risk.Tags); err != nil {
+		return data.Risk{}, err
+	}
+	if len(risk.Tags) == 0 {
+		risk.Tags = nil
+	}
+	if row.deletedAt.Valid {
+		deletedAt, err := time.Parse(timeFormat, row.deletedAt.String)
+		if err != nil {
+			return data.Risk{}, err
+		}
+		risk.DeletedAt = &deletedAt
+	}
+	return risk, nil
+}
+
+// scanRisk scans a row of the risk columns, followed by the extra columns
+func scanRisk(s scanner, extra ...any) (data.Risk, error) {
+	var row riskRow
+	if err := s.Scan(append(row.fields(), extra...)...); err != nil {
+		return data.Risk{}, err
+	}
+	return row.toRisk()
+}
+
+//go:embed sql/insert_risk.sql
+var insertRisk string
+
+func (rdb *risksDB) Add(ctx context.Context, risk data.Risk) (data.Risk, error) {
+	var added data.Risk
+	err := rdb.db.withTx(ctx, func(tx *sql.Tx) error {
+		changedAt := now()
+		var err error
+		added, err = scanRisk(tx.QueryRowContext(ctx, insertRisk, riskValues(risk, changedAt, data.AuditFrom(ctx).Actor)...))
+		if err != nil {
+			return classifyError(err)
+		}
+		return insertHistory(ctx, tx, changedAt, data.ActionCreated, nil, &added)
+	})
+	if err != nil {
+		return data.Risk{}, err
+	}
+	return added, nil
+}
+
+//go:embed sql/get_risk_for_update.sql
+var getRiskForUpdate string
+
+// lockRisk reads a risk, deleted or not, in the transaction of a change
+func lockRisk(ctx context.Context, tx *sql.Tx, ID uuid.UUID) (data.Risk, error) {
+	var row riskRow
+	err := tx.QueryRowContext(ctx, getRiskForUpdate, ID).Scan(append(row.fields(), &row.deletedAt)...)
+	if errors.Is(err, sql.ErrNoRows) {
+		return data.Risk{}, data.Errorf(data.ErrNotFound, "risk with ID: %s not found", ID)
+	}
+	if err != nil {
+		return data.Risk{}, classifyError(err)
+	}
+	return row.toRisk()
+}
+
+// checkVersion fails with ErrPreconditionFailed when the risk does not have the expected version, 0 expects any version
+func checkVersion(risk data.Risk, version int64) error {
+	if version != 0 && risk.Version != version {
+		return data.Errorf(data.ErrPreconditionFailed, "risk with ID: %s has version %d, not %d", risk.ID, risk.Version, version)
+	}
+	return nil
+}
+
+//go:embed sql/get_risk_by_id.sql
+var getRiskByID string
+
+func (rdb *risksDB) GetByID(ctx context.Context, ID uuid.UUID) (data.Risk, error) {
+	risk, err := scanRisk(rdb.db.client.QueryRowContext(ctx, getRiskByID, ID))
+	if errors.Is(err, sql.ErrNoRows) {
+		return data.Risk{}, data.Errorf(data.ErrNotFound, "risk with ID: %s not found", ID)
+	}
+	if err != nil {
+		return data.Risk{}, classifyError(err)
+	}
+	return risk, nil
+}
+
+//go:embed sql/get_risks_by_external_refs.sql
+var getRisksByExternalRefs string
+
+// GetByExternalRefs lists the risks, deleted or not, with the given external references
+func (rdb *risksDB) GetByExternalRefs(ctx context.Context, refs []string) ([]data.Risk, error) {
+	// the references are sent as a JSON array, which SQLite reads with json_each
+	encoded, err := json.Marshal(refs)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := rdb.db.client.QueryContext(ctx, getRisksByExternalRefs, string(encoded))
+	if err != nil {
+		return nil, classifyError(err)
+	}
+	defer rows.Close()
+
+	var risks []data.Risk
+
+	for rows.Next() {
+		var row riskRow
+		if err = rows.Scan(append(row.fields(), &row.deletedAt)...); err != nil {
+			return nil, classifyError(err)
+		}
+		risk, err := row.toRisk()
+		if err != nil {
+			return nil, err
+		}
+		risks = append(risks, risk)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, classifyError(err)
+	}
+
+	return risks, nil
+}
+
+//go:embed sql/update_risk.sql
+var updateRisk string
+
+// Update updates a risk, expecting it to have the version of the given risk unless that version is 0
+func (rdb *risksDB) Update(ctx context.Context, risk data.Risk) (data.Risk, error) {
+	var updated data.Risk
+	err := rdb.db.withTx(ctx, func(tx *sql.Tx) error {
+		current, err := lockRisk(ctx, tx, risk.ID)
+		if err != nil {
+			return err
+		}
+		if current.DeletedAt != nil {
+			return data.Errorf(data.ErrNotFound, "risk with ID: %s not found", risk.ID)
+		}
+		if err = checkVersion(current, risk.Version); err != nil {
+			return err
+		}
+
+		changedAt := now()
+		updated, err = scanRisk(tx.QueryRowContext(ctx, updateRisk, riskValues(risk, changedAt, data.AuditFrom(ctx).Actor)...))
+		if err != nil {
+			return classifyError(err)
+		}
+		return insertHistory(ctx, tx, changedAt, data.ActionUpdated, &current, &updated)
+	})
+	if err != nil {
+		return data.Risk{}, err
+	}
+	return updated, nil
+}
+
+//go:embed sql/get_all_risks.sql
+var getAllRisks string
+
+//go:embed sql/count_all_risks.sql
+var countAllRisks string
+
+// exportPageSize is the number of risks an export reads at a time
+const exportPageSize = 500
+
+// Export calls write with every risk matching the filter, in the sort order. The risks are read a page at a time with
+// keyset cursors rather than a single query, which would hold the only connection and block the writes for as long as
+// the export takes.
+func (rdb *risksDB) Export(ctx context.Context, options data.Options, write func(risk data.Risk) error) error {
+	options = data.Options{Limit: exportPageSize, Sort: options.Sort, Filter: options.Filter, Count: data.CountNone}
+	for {
+		page, err := rdb.GetAll(ctx, options)
+		if err != nil {
+			return err
+		}
+		for _, risk := range page.Risks {
+			if err = write(risk); err != nil {
+				return err
+			}
+		}
+		if page.NextCursor == nil {
+			return nil
+		}
+		options.After = page.NextCursor
+	}
+}
+
+func (rdb *risksDB) GetAll(ctx context.Context, options data.Options) (data.PaginatedResponse, error) {
+	keys := data.WithTieBreaker(options.Sort)
+	if options.After != nil && options.After.Sort != data.FormatSort(keys) {
+		return data.PaginatedResponse{}, data.Errorf(data.ErrValidation, "the cursor was created for the sort order %q but the risks are sorted by %q", options.After.Sort, data.FormatSort(keys))
+	}
+
+	where, args := whereFilter(options.Filter, 1)
+	count, err := rdb.count(ctx, options.Count, where, args)
+	if err != nil {
+		return data.PaginatedResponse{}, err
+	}
+
+	backward := options.After != nil && options.After.Backward
+	order, err := orderBy(keys, backward)
+	if err != nil {
+		return data.PaginatedResponse{}, err
+	}
+
+	// the limit and offset are the first two arguments of the query
+	where, args = whereFilter(options.Filter, 3)
+	offset := options.Offset
+	if options.After != nil {
+		after, afterArgs, err := keysetCondition(keys, options.After, 3+len(args))
+		if err != nil {
+			return data.PaginatedResponse{}, err
+		}
+		where += after
+		args = append(args, afterArgs...)
+		offset = 0
+	}
+
+	// one more risk than requested is fetched to know whether there is another page
+	rows, err := rdb.db.client.QueryContext(ctx, fmt.Sprintf(getAllRisks, where, order), append([]any{options.Limit + 1, offset}, args...)...)
+	if err != nil {
+		return data.PaginatedResponse{}, classifyError(err)
+	}
+	defer rows.Close()
+
+	var risks []data.Risk
+
+	for rows.Next() {
+		risk, err := scanRisk(rows)
+		if err != nil {
+			return data.PaginatedResponse{}, classifyError(err)
+		}
+		risks = append(risks, risk)
+	}
+	if err = rows.Err(); err != nil {
+		return data.PaginatedResponse{}, classifyError(err)
+	}
+
+	hasMore := len(risks) > options.Limit
+	if hasMore {
+		risks = risks[:options.Limit]
+	}
+	if backward {
+		slices.Reverse(risks)
+	}
+
+	response := data.PaginatedResponse{TotalCount: count, Risks: risks}
+	if len(risks) == 0 {
+		return response, nil
+	}
+	if (backward && hasMore) || (!backward && (options.After != nil || offset > 0)) {
+		response.PrevCursor = data.NewCursor(risks[0], keys, true)
+	}
+	if backward || hasMore {
+		response.NextCursor = data.NewCursor(risks[len(risks)-1], keys, false)
+	}
+	return response, nil
+}
+
+//go:embed sql/count_risks_by_ratings.sql
+var countRisksByRatings string
+
+// ratingColumns are the likelihood and impact columns of the ratings
+func ratingColumns(rating data.Rating) (string, string) {
+	if rating == data.RatingInherent {
+		return "likelihood", "impact"
+	}
+	return "residual_likelihood", "residual_impact"
+}
+
+// CountByRatings counts the risks matching the filter by likelihood and impact, with the comma separated IDs of the
+// risks of every cell when they are asked for
+func (rdb *risksDB) CountByRatings(ctx context.Context, options data.HeatMapOptions) ([]data.HeatMapCell, error) {
+	likelihood, impact := ratingColumns(options.Rating)
+	ids := "''"
+	if options.WithIDs {
+		ids = "group_concat(risk_id)"
+	}
+	where, args := whereFilter(options.Filter, 1)
+
+	rows, err := rdb.db.client.QueryContext(ctx, fmt.Sprintf(countRisksByRatings, likelihood, impact, ids, where), args...)
+	if err != nil {
+		return nil, classifyError(err)
+	}
+	defer rows.Close()
+
+	var cells []data.HeatMapCell
+	for rows.Next() {
+		var cell data.HeatMapCell
+		var riskIDs string
+		if err = rows.Scan(&cell.Likelihood, &cell.Impact, &cell.Count, &riskIDs); err != nil {
+			return nil, classifyError(err)
+		}
+		for _, ID := range strings.Split(riskIDs, ",") {
+			if ID != "" {
+				cell.RiskIDs = append(cell.RiskIDs, uuid.MustParse(ID))
+			}
+		}
+		cells = append(cells, cell)
+	}
+	return cells, classifyError(rows.Err())
+}
+
+//go:embed sql/search_risks.sql
+var searchRisks string
+
+// Search lists the risks whose title or description match every word of the query as a prefix, most relevant first
+func (rdb *risksDB) Search(ctx context.Context, query string, options data.Options) (data.SearchResponse, error) {
+	matchQuery := prefixQuery(query)
+	if matchQuery == "" {
+		zero := 0
+		return data.SearchResponse{TotalCount: &zero}, nil
+	}
+
+	where, args := whereFilter(options.Filter, 2)
+	count, err := rdb.count(ctx, options.Count, " AND search_id IN (SELECT rowid FROM risks_search WHERE risks_search MATCH ?1)"+where, append([]any{matchQuery}, args...))
+	if err != nil {
+		return data.SearchResponse{}, err
+	}
+
+	// the limit, offset and search query are the first three arguments of the query
+	where, args = whereFilter(options.Filter, 4)
+	offset := options.Offset
+	if options.After != nil {
+		rank, ID, err := data.SearchCursorArgs(options.After)
+		if err != nil {
+			return data.SearchResponse{}, err
+		}
+		where += fmt.Sprintf(" AND (-bm25(risks_search, 1.0, 0.4) < ?%[1]d OR (-bm25(risks_search, 1.0, 0.4) = ?%[1]d AND risks.risk_id > ?%[2]d))", 4+len(args), 5+len(args))
+		args = append(args, rank, ID)
+		offset = 0
+	}
+
+	// one more result than requested is fetched to know whether there is another page
+	rows, err := rdb.db.client.QueryContext(ctx, fmt.Sprintf(searchRisks, where), append([]any{options.Limit + 1, offset, matchQuery}, args...)...)
+	if err != nil {
+		return data.SearchResponse{}, classifyError(err)
+	}
+	defer rows.Close()
+
+	var results []data.SearchResult
+	var ranks []float64
+
+	for rows.Next() {
+		var result data.SearchResult
+		var rank float64
+		result.Risk, err = scanRisk(rows, &rank, &result.TitleHighlight, &result.DescriptionHighlight)
+		if err != nil {
+			return data.SearchResponse{}, classifyError(err)
+		}
+		result.Rank = float32(rank)
+		result.TitleHighlight, result.DescriptionHighlight = markHighlight(result.TitleHighlight), markHighlight(result.DescriptionHighlight)
+		results = append(results, result)
+		ranks = append(ranks, rank)
+	}
+	if err = rows.Err(); err != nil {
+		return data.SearchResponse{}, classifyError(err)
+	}
+
+	// the cursor keeps the rank as computed, the rank of the results is rounded
+	response := data.SearchResponse{TotalCount: count, Risks: results}
+	if len(results) > options.Limit {
+		response.Risks = results[:options.Limit]
+		response.NextCursor = data.NewSearchCursor(ranks[options.Limit-1], results[options.Limit-1].ID)
+	}
+	return response, nil
+}
+
+// highlightMarks turns the delimiters of the matches into <mark> tags
+var highlightMarks = strings.NewReplacer("\x02", "<mark>", "\x03", "</mark>")
+
+// markHighlight escapes the HTML of a highlighted text and wraps its matches in <mark> tags, so that the marks are the
+// only markup
+func markHighlight(highlighted string) string {
+	return highlightMarks.Replace(html.EscapeString(highlighted))
+}
+
+// prefixQuery converts free text into an FTS5 query matching every word as a prefix.
+// Anything but letters and digits is dropped so that the text cannot break the query syntax.
+func prefixQuery(text string) string {
+	words := strings.FieldsFunc(text, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	for i, word := range words {
+		words[i] = `"` + word + `"*`
+	}
+	return strings.Join(words, " AND ")
+}
+
+// count counts the risks matching the conditions of the WHERE clause, the count is nil when it is skipped.
+// SQLite has no planner estimates, an estimated count is exact.
+func (rdb *risksDB) count(ctx context.Context, mode data.CountMode, where string, args []any) (*int, error) {
+	if mode == data.CountNone {
+		return nil, nil
+	}
+	var count int
+	err := rdb.db.client.QueryRowContext(ctx, fmt.Sprintf(countAllRisks, where), args...).Scan(&count)
+	if err != nil {
+		return nil, classifyError(err)
+	}
+	return &count, nil
+}
+
+// keysetCondition builds the condition selecting the risks after the cursor, to be appended to a WHERE clause:
+// (k1 > v1) OR (k1 = v1 AND k2 > v2) OR ...
+func keysetCondition(keys []data.SortKey, cursor *data.Cursor, firstArg int) (string, []any, error) {
+	if len(cursor.Values) != len(keys) {
+		return "", nil, data.Errorf(data.ErrValidation, "the cursor does not match the sort order %q", data.FormatSort(keys))
+	}
+
+	args := make([]any, len(keys))
+	disjunction := make([]string, len(keys))
+	for i, key := range keys {
+		arg, err := data.CursorArg(key.Field, cursor.Values[i])
+		if err != nil {
+			return "", nil, err
+		}
+		// the times are compared in their stored text form
+		if t, ok := arg.(time.Time); ok {
+			arg = formatTime(t)
+		}
+		args[i] = arg
+		op := ">"
+		if key.Descending != cursor.Backward {
+			op = "<"
+		}
+
+		conjunction := make([]string, 0, i+1)
+		for j := 0; j < i; j++ {
+			conjunction = append(conjunction, fmt.Sprintf("%s = ?%d", sortColumns[keys[j].Field], firstArg+j))
+		}
+		conjunction = append(conjunction, fmt.Sprintf("%s %s ?%d", sortColumns[key.Field], op, firstArg+i))
+		disjunction[i] = "(" + strings.Join(conjunction, " AND ") + ")"
+	}
+	return " AND (" + strings.Join(disjunction, " OR ") + ")", args, nil
+}
+
+// whereFilter builds the conditions for the given filter, to be appended to a WHERE clause, along with their arguments.
+// The placeholders are numbered starting from firstArg and the columns are qualified, as the search joins another table.
+func whereFilter(filter data.Filter, firstArg int) (string, []any) {
+	var conditions []string
+	var args []any
+	add := func(condition string, arg any) {
+		args = append(args, arg)
+		conditions = append(conditions, fmt.Sprintf(condition, firstArg+len(args)-1))
+	}
+
+	if len(filter.States) > 0 {
+		states, _ := json.Marshal(filter.States)
+		add("risks.state IN (SELECT value FROM json_each(?%d))", string(states))
+	}
+	// LIKE ignores the case of ASCII letters, unlike the postgres ILIKE it is case sensitive for other letters
+	if filter.Title != "" {
+		add(`risks.title LIKE ?%d ESCAPE '\'`, "%"+escapeLike(filter.Title)+"%")
+	}
+	if filter.Description != "" {
+		add(`risks.description LIKE ?%d ESCAPE '\'`, "%"+escapeLike(filter.Description)+"%")
+	}
+	if filter.CreatedAfter != nil {
+		add("risks.created_at >= ?%d", formatTime(*filter.CreatedAfter))
+	}
+	if filter.CreatedBefore != nil {
+		add("risks.created_at < ?%d", formatTime(*filter.CreatedBefore))
+	}
+	if filter.UpdatedAfter != nil {
+		add("risks.updated_at >= ?%d", formatTime(*filter.UpdatedAfter))
+	}
+	if filter.UpdatedBefore != nil {
+		add("risks.updated_at < ?%d", formatTime(*filter.UpdatedBefore))
+	}
+	if len(filter.Severities) > 0 {
+		severities, _ := json.Marshal(filter.Severities)
+		add("risks.severity IN (SELECT value FROM json_each(?%d))", string(severities))
+	}
+	if filter.MinScore > 0 {
+		add("risks.residual_score >= ?%d", filter.MinScore)
+	}
+	if filter.MaxScore > 0 {
+		add("risks.residual_score <= ?%d", filter.MaxScore)
+	}
+	if filter.Owner != "" {
+		add("risks.owner_id = ?%d", filter.Owner)
+	}
+	if filter.Assignee != "" {
+		add("risks.assignee_id = ?%d", filter.Assignee)
+	}
+	if filter.Involving != "" {
+		add("(risks.owner_id = ?%[1]d OR risks.assignee_id = ?%[1]d)", filter.Involving)
+	}
+	if filter.CreatedBy != "" {
+		add("risks.created_by = ?%d", filter.CreatedBy)
+	}
+	if filter.UpdatedBy != "" {
+		add("risks.updated_by = ?%d", filter.UpdatedBy)
+	}
+	if len(filter.Tags) > 0 {
+		tags, _ := json.Marshal(filter.Tags)
+		add("NOT EXISTS (SELECT value FROM json_each(?%d) EXCEPT SELECT value FROM json_each(risks.tags))", string(tags))
+	}
+
+	if len(conditions) == 0 {
+		return "", nil
+	}
+	return " AND " + strings.Join(conditions, " AND "), args
+}
+
+// escapeLike escapes the LIKE wildcards so that the value is matched literally
+func escapeLike(value string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(value)
+}
+
+// sortColumns maps the sortable risk fields to their columns
+var sortColumns = map[string]string{
+	"id":            "risks.risk_id",
+	"title":         "risks.title",
+	"description":   "risks.description",
+	"state":         "risks.state",
+	"likelihood":    "risks.likelihood",
+	"impact":        "risks.impact",
+	"inherentScore": "risks.inherent_score",
+	"residualScore": "risks.residual_score",
+	"createdAt":     "risks.created_at",
+	"updatedAt":     "risks.updated_at",
+	"createdBy":     "risks.created_by",
+	"updatedBy":     "risks.updated_by",
+}
+
+// orderBy builds an ORDER BY clause from whitelisted columns only, the directions are flipped to read backward
+func orderBy(keys []data.SortKey, backward bool) (string, error) {
+	clauses := make([]string, 0, len(keys))
+	for _, key := range keys {
+		column, ok := sortColumns[key.Field]
+		if !ok {
+			return "", data.Errorf(data.ErrValidation, "cannot sort by %q", key.Field)
+		}
+		direction := "ASC"
+		if key.Descending != backward {
+			direction = "DESC"
+		}
+		clauses = append(clauses, column+" "+direction)
+	}
+	return strings.Join(clauses, ", "), nil
+}
+
+//go:embed sql/delete_risk_by_id.sql
+var deleteRiskByID string
+
+// DeleteByID hard deletes a risk, deleted or not, it does nothing when the risk does not exist
+func (rdb *risksDB) DeleteByID(ctx context.Context, ID uuid.UUID) error {
+	return rdb.db.withTx(ctx, func(tx *sql.Tx) error {
+		current, err := lockRisk(ctx, tx, ID)
+		if errors.Is(err, data.ErrNotFound) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		if _, err = tx.ExecContext(ctx, deleteRiskByID, ID); err != nil {
+			return classifyError(err)
+		}
+		return insertHistory(ctx, tx, now(), data.ActionPurged, &current, nil)
+	})
+}
+
+//go:embed sql/soft_delete_risk_by_id.sql
+var softDeleteRiskByID string
+
+// SoftDeleteByID moves a risk to the trash, expecting it to have the given version unless the version is 0
+func (rdb *risksDB) SoftDeleteByID(ctx context.Context, ID uuid.UUID, version int64) error {
+	return rdb.db.withTx(ctx, func(tx *sql.Tx) error {
+		current, err := lockRisk(ctx, tx, ID)
+		if err == nil && current.DeletedAt != nil {
+			err = data.Errorf(data.ErrNotFound, "risk with ID: %s not found", ID)
+		}
+		if err == nil {
+			err = checkVersion(current, version)
+		}
+		if err != nil {
+			return err
+		}
+
+		changedAt := now()
+		var row riskRow
+		err = tx.QueryRowContext(ctx, softDeleteRiskByID, ID, formatTime(changedAt)).Scan(append(row.fields(), &row.deletedAt)...)
+		if err != nil {
+			return classifyError(err)
+		}
+		deleted, err := row.toRisk()
+		if err != nil {
+			return err
+		}
+		return insertHistory(ctx, tx, changedAt, data.ActionDeleted, &current, &deleted)
+	})
+}
+
+//go:embed sql/get_deleted_risks.sql
+var getDeletedRisks string
+
+//go:embed sql/count_deleted_risks.sql
+var countDeletedRisks string
+
+func (rdb *risksDB) GetDeleted(ctx context.Context, options data.Options) (data.PaginatedResponse, error) {
+	var count int
+	err := rdb.db.client.QueryRowContext(ctx, countDeletedRisks).Scan(&count)
+	if err != nil {
+		return data.PaginatedResponse{}, classifyError(err)
+	}
+
+	rows, err := rdb.db.client.QueryContext(ctx, getDeletedRisks, options.Limit, options.Offset)
+	if err != nil {
+		return data.PaginatedResponse{}, classifyError(err)
+	}
+	defer rows.Close()
+
+	var risks []data.Risk
+
+	for rows.Next() {
+		var row riskRow
+		if err = rows.Scan(append(row.fields(), &row.deletedAt)...); err != nil {
+			return data.PaginatedResponse{}, classifyError(err)
+		}
+		risk, err := row.toRisk()
+		if err != nil {
+			return data.PaginatedResponse{}, err
+		}
+		risks = append(risks, risk)
+	}
+	if err = rows.Err(); err != nil {
+		return data.PaginatedResponse{}, classifyError(err)
+	}
+
+	return data.PaginatedResponse{TotalCount: &count, Risks: risks}, nil
+}
+
+//go:embed sql/restore_risk_by_id.sql
+var restoreRiskByID string
+
+func (rdb *risksDB) RestoreByID(ctx context.Context, ID uuid.UUID) error {
+	return rdb.db.withTx(ctx, func(tx *sql.Tx) error {
+		current, err := lockRisk(ctx, tx, ID)
+		if err == nil && current.DeletedAt == nil || errors.Is(err, data.ErrNotFound) {
+			return data.Errorf(data.ErrNotFound, "no deleted risk with ID: %s", ID)
+		}
+		if err != nil {
+			return err
+		}
+
+		restored, err := scanRisk(tx.QueryRowContext(ctx, restoreRiskByID, ID), new(sql.NullString))
+		if err != nil {
+			return classifyError(err)
+		}
+		return insertHistory(ctx, tx, now(), data.ActionRestored, &current, &restored)
+	})
+}
+
+//go:embed sql/purge_deleted_risks.sql
+var purgeDeletedRisks string
+
+// PurgeDeletedBefore hard deletes every risk that was soft deleted before the given time
+func (rdb *risksDB) PurgeDeletedBefore(ctx context.Context, before time.Time) (int64, error) {
+	var purged int64
+	err := rdb.db.withTx(ctx, func(tx *sql.Tx) error {
+		rows, err := tx.QueryContext(ctx, purgeDeletedRisks, formatTime(before))
+		if err != nil {
+			return classifyError(err)
+		}
+		var risks []data.Risk
+		for rows.Next() {
+			var row riskRow
+			if err = rows.Scan(append(row.fields(), &row.deletedAt)...); err != nil {
+				rows.Close()
+				return classifyError(err)
+			}
+			risk, err := row.toRisk()
+			if err != nil {
+				rows.Close()
+				return err
+			}
+			risks = append(risks, risk)
+		}
+		rows.Close()
+		if err = rows.Err(); err != nil {
+			return classifyError(err)
+		}
+
+		changedAt := now()
+		for i := range risks {
+			if err = insertHistory(ctx, tx, changedAt, data.ActionPurged, &risks[i], nil); err != nil {
+				return err
+			}
+		}
+		purged = int64(len(risks))
+		return nil
+	})
+	return purged, err
+}
@@ -0,0 +1,29 @@
+package sqlite
+
+import (
+	"context"
+	"path/filepath"
+	"stan-project/cmd/config"
+	"stan-project/db/dbtest"
+	"testing"
+)
+
+// newTestDB opens a migrated database in a new file, it is closed when the test ends
+func newTestDB(t *testing.T) *db {
+	t.Helper()
+	ctx := context.Background()
+	config.Global.SQLite.Path = filepath.Join(t.TempDir(), "risks.db")
+	sDB, err := InitDB(ctx)
+	if err != nil {
+		t.Fatalf("error initializing DB for test: %s", err)
+	}
+	t.Cleanup(func() { sDB.Close(ctx) })
+	if err = sDB.RunMigrations(ctx); err != nil {
+		t.Fatalf("error migrating DB for test: %s", err)
+	}
+	return sDB
+}
+
+func TestRisksDB_Conformance(t *testing.T) {
+	dbtest.Run(t, NewRisksDB(newTestDB(t)))
+}
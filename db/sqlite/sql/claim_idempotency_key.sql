@@ -0,0 +1,5 @@
+INSERT INTO idempotency_keys(idempotency_key, request_hash, created_at, expires_at) VALUES (?1, ?2, ?3, ?4)
+ON CONFLICT (idempotency_key) DO UPDATE
+SET request_hash = excluded.request_hash, risk_id = NULL, response = NULL, created_at = excluded.created_at, expires_at = excluded.expires_at
+WHERE idempotency_keys.expires_at <= excluded.created_at
+RETURNING idempotency_key
@@ -0,0 +1 @@
+SELECT COUNT(*) FROM risks WHERE deleted_at IS NULL%s;
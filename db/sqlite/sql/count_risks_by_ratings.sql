@@ -0,0 +1,6 @@
+SELECT
+    %[1]s, %[2]s, COUNT(*), %[3]s
+FROM
+    risks
+WHERE deleted_at IS NULL%[4]s
+GROUP BY 1, 2;
@@ -0,0 +1 @@
+DELETE FROM risks WHERE risk_id = ?1
\ No newline at end of file
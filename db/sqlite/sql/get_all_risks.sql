@@ -0,0 +1,7 @@
+SELECT
+    risk_id, title, description, state, created_at, updated_at, version, external_ref, likelihood, impact, residual_likelihood, residual_impact, inherent_score, residual_score, severity, COALESCE(owner_id, ''), COALESCE(assignee_id, ''), created_by, updated_by, tags
+FROM
+    risks
+WHERE deleted_at IS NULL%s
+ORDER BY %s
+LIMIT ?1 OFFSET ?2;
@@ -0,0 +1,6 @@
+SELECT
+    history_id, risk_id, action, actor, request_id, reason, changed_at, before, after
+FROM
+    risk_history
+WHERE risk_id = ?1
+ORDER BY history_id ASC;
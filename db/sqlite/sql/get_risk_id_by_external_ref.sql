@@ -0,0 +1 @@
+SELECT risk_id FROM risks WHERE external_ref = ?1 AND risk_id <> ?2 LIMIT 1
\ No newline at end of file
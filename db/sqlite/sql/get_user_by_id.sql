@@ -0,0 +1,5 @@
+SELECT
+    user_id, name, email, active, created_at, updated_at
+FROM
+    users
+WHERE user_id = ?1
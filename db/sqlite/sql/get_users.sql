@@ -0,0 +1,6 @@
+SELECT
+    user_id, name, email, active, created_at, updated_at
+FROM
+    users
+WHERE TRUE%s
+ORDER BY user_id;
@@ -0,0 +1,3 @@
+INSERT INTO risks(risk_id, title, description, state, created_at, updated_at, external_ref, likelihood, impact, residual_likelihood, residual_impact, inherent_score, residual_score, severity, owner_id, assignee_id, tags, created_by, updated_by)
+VALUES (?1, ?2, ?3, ?4, ?5, ?5, ?6, ?7, ?8, ?9, ?10, ?11, ?12, ?13, NULLIF(?14, ''), NULLIF(?15, ''), ?16, ?17, ?17)
+RETURNING risk_id, title, description, state, created_at, updated_at, version, external_ref, likelihood, impact, residual_likelihood, residual_impact, inherent_score, residual_score, severity, COALESCE(owner_id, ''), COALESCE(assignee_id, ''), created_by, updated_by, tags
\ No newline at end of file
@@ -0,0 +1 @@
+INSERT INTO risk_history(risk_id, action, actor, request_id, reason, changed_at, before, after) VALUES (?1, ?2, ?3, ?4, ?5, ?6, ?7, ?8)
\ No newline at end of file
@@ -0,0 +1,3 @@
+INSERT INTO users(user_id, name, email, active, created_at, updated_at)
+VALUES (?1, ?2, ?3, ?4, ?5, ?5)
+RETURNING user_id, name, email, active, created_at, updated_at
@@ -0,0 +1,2 @@
+DELETE FROM risks WHERE deleted_at IS NOT NULL AND deleted_at < ?1
+RETURNING risk_id, title, description, state, created_at, updated_at, version, external_ref, likelihood, impact, residual_likelihood, residual_impact, inherent_score, residual_score, severity, COALESCE(owner_id, ''), COALESCE(assignee_id, ''), created_by, updated_by, tags, deleted_at
\ No newline at end of file
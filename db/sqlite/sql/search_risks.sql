@@ -0,0 +1,11 @@
+SELECT
+    risks.risk_id, risks.title, risks.description, risks.state, risks.created_at, risks.updated_at, risks.version, risks.external_ref, risks.likelihood, risks.impact, risks.residual_likelihood, risks.residual_impact, risks.inherent_score, risks.residual_score, risks.severity, COALESCE(risks.owner_id, ''), COALESCE(risks.assignee_id, ''), risks.created_by, risks.updated_by, risks.tags,
+    -bm25(risks_search, 1.0, 0.4) AS search_rank,
+    -- the matches are delimited with control characters, the text is HTML escaped before they become marks
+    highlight(risks_search, 0, char(2), char(3)),
+    highlight(risks_search, 1, char(2), char(3))
+FROM
+    risks_search JOIN risks ON risks.search_id = risks_search.rowid
+WHERE risks_search MATCH ?3 AND risks.deleted_at IS NULL%s
+ORDER BY search_rank DESC, risks.risk_id ASC
+LIMIT ?1 OFFSET ?2;
@@ -0,0 +1 @@
+UPDATE idempotency_keys SET risk_id = ?2, response = ?3 WHERE idempotency_key = ?1
@@ -0,0 +1,5 @@
+UPDATE risks SET title = ?2, description = ?3, state = ?4, updated_at = ?5, external_ref = ?6,
+    likelihood = ?7, impact = ?8, residual_likelihood = ?9, residual_impact = ?10, inherent_score = ?11, residual_score = ?12, severity = ?13,
+    owner_id = NULLIF(?14, ''), assignee_id = NULLIF(?15, ''), tags = ?16,
+    updated_by = ?17, version = version + 1 WHERE risk_id = ?1 AND deleted_at IS NULL
+RETURNING risk_id, title, description, state, created_at, updated_at, version, external_ref, likelihood, impact, residual_likelihood, residual_impact, inherent_score, residual_score, severity, COALESCE(owner_id, ''), COALESCE(assignee_id, ''), created_by, updated_by, tags
\ No newline at end of file
@@ -0,0 +1,146 @@
+// Package sqlite stores the risks in a SQLite database file, for deployments that cannot run postgres
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+	"net/url"
+	"path"
+	"stan-project/cmd/config"
+	"stan-project/data"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// timeFormat stores the times in UTC with a fixed width, so that they sort like the times they represent
+const timeFormat = "2006-01-02T15:04:05.000000Z07:00"
+
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+type db struct {
+	client *sql.DB
+}
+
+// InitDB opens the database file configured in config.Global, creating it when it does not exist
+func InitDB(ctx context.Context) (*db, error) {
+	dsn := url.URL{
+		Scheme: "file",
+		Opaque: config.Global.SQLite.Path,
+		RawQuery: url.Values{
+			"_pragma": {"busy_timeout(5000)", "journal_mode(WAL)", "foreign_keys(1)"},
+			"_txlock": {"immediate"},
+		}.Encode(),
+	}
+	client, err := sql.Open("sqlite", dsn.String())
+	if err != nil {
+		return nil, err
+	}
+	// SQLite has a single writer, a single connection serializes the writes instead of failing them as busy
+	client.SetMaxOpenConns(1)
+	if err = client.PingContext(ctx); err != nil {
+		client.Close()
+		return nil, classifyError(err)
+	}
+	return &db{client: client}, nil
+}
+
+// Close closes the database file
+func (db *db) Close(ctx context.Context) error {
+	return db.client.Close()
+}
+
+// RunMigrations applies the migrations newer than the user_version of the database in a single transaction.
+// Migrations are named <version>_<name>.sql and are never changed once released.
+func (db *db) RunMigrations(ctx context.Context) error {
+	paths, err := fs.Glob(migrationFiles, "migrations/*.sql")
+	if err != nil {
+		return err
+	}
+	versions := map[int]string{}
+	for _, p := range paths {
+		versionText, _, _ := strings.Cut(path.Base(p), "_")
+		version, err := strconv.Atoi(versionText)
+		if err != nil {
+			return fmt.Errorf("invalid migration file name %s, expected <version>_<name>.sql", path.Base(p))
+		}
+		versions[version] = p
+	}
+
+	return db.withTx(ctx, func(tx *sql.Tx) error {
+		var current int
+		if err := tx.QueryRowContext(ctx, "PRAGMA user_version").Scan(&current); err != nil {
+			return classifyError(err)
+		}
+		for version := current + 1; versions[version] != ""; version++ {
+			script, err := fs.ReadFile(migrationFiles, versions[version])
+			if err != nil {
+				return err
+			}
+			slog.Info("applying migration", "name", path.Base(versions[version]))
+			if _, err = tx.ExecContext(ctx, string(script)); err != nil {
+				return fmt.Errorf("error applying migration %s: %w", path.Base(versions[version]), err)
+			}
+			// the pragma cannot take a parameter, the version is an integer
+			if _, err = tx.ExecContext(ctx, fmt.Sprintf("PRAGMA user_version = %d", version)); err != nil {
+				return classifyError(err)
+			}
+		}
+		return nil
+	})
+}
+
+// withTx runs f in a transaction, which is committed when f succeeds and rolled back otherwise
+func (db *db) withTx(ctx context.Context, f func(tx *sql.Tx) error) error {
+	tx, err := db.client.BeginTx(ctx, nil)
+	if err != nil {
+		return classifyError(err)
+	}
+	defer tx.Rollback()
+
+	if err = f(tx); err != nil {
+		return err
+	}
+	return classifyError(tx.Commit())
+}
+
+// classifyError wraps SQLite errors with the matching data error kind so that callers do not need to know about SQLite
+func classifyError(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	var sqliteErr *sqlite.Error
+	if errors.As(err, &sqliteErr) {
+		switch sqliteErr.Code() {
+		case sqlite3.SQLITE_CONSTRAINT_PRIMARYKEY, sqlite3.SQLITE_CONSTRAINT_UNIQUE:
+			return data.Errorf(data.ErrConflict, "%w", err)
+		// a risk referencing a user who does not exist
+		case sqlite3.SQLITE_CONSTRAINT_FOREIGNKEY:
+			return data.Errorf(data.ErrValidation, "%w", err)
+		}
+		// the primary result code is the low byte of the extended code
+		switch sqliteErr.Code() & 0xff {
+		case sqlite3.SQLITE_BUSY, sqlite3.SQLITE_LOCKED, sqlite3.SQLITE_CANTOPEN, sqlite3.SQLITE_FULL, sqlite3.SQLITE_IOERR:
+			return data.Errorf(data.ErrUnavailable, "database unavailable: %w", err)
+		}
+	}
+	return err
+}
+
+func formatTime(t time.Time) string {
+	return t.UTC().Format(timeFormat)
+}
+
+// now returns the current time with the microsecond precision of the stored times
+func now() time.Time {
+	return time.Now().UTC().Truncate(time.Microsecond)
+}
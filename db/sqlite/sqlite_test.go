@@ -0,0 +1,79 @@
+package sqlite
+
+import (
+	"context"
+	"errors"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"io/fs"
+	"stan-project/data"
+	"testing"
+	"time"
+)
+
+func TestDB_RunMigrations(t *testing.T) {
+	t.Run("successfully apply the migrations once", func(t *testing.T) {
+		ctx := context.Background()
+		sDB := newTestDB(t)
+
+		migrations, err := fs.Glob(migrationFiles, "migrations/*.sql")
+		assert.Nil(t, err)
+		var version int
+		err = sDB.client.QueryRowContext(ctx, "PRAGMA user_version").Scan(&version)
+		assert.Nil(t, err)
+		assert.Equal(t, len(migrations), version)
+
+		assert.Nil(t, sDB.RunMigrations(ctx))
+	})
+}
+
+func TestClassifyError(t *testing.T) {
+	t.Run("successfully classify a primary key violation as a conflict", func(t *testing.T) {
+		ctx := context.Background()
+		sDB := newTestDB(t)
+
+		insert := "INSERT INTO risks(risk_id, title, state, created_at, updated_at) VALUES ('a', 'threat', 'open', '', '')"
+		_, err := sDB.client.ExecContext(ctx, insert)
+		assert.Nil(t, err)
+		_, err = sDB.client.ExecContext(ctx, insert)
+		assert.ErrorIs(t, classifyError(err), data.ErrConflict)
+	})
+
+	t.Run("successfully keep other errors as they are", func(t *testing.T) {
+		err := errors.New("boom")
+		assert.Equal(t, err, classifyError(err))
+		assert.Nil(t, classifyError(nil))
+	})
+}
+
+func TestDB_Vacuum(t *testing.T) {
+	t.Run("successfully search the risks after a vacuum renumbered the rows", func(t *testing.T) {
+		ctx := context.Background()
+		sDB := newTestDB(t)
+		rdb := NewRisksDB(sDB)
+
+		var risks []data.Risk
+		for _, title := range []string{"flood", "fire", "drought"} {
+			risk, err := rdb.Add(ctx, data.Risk{ID: uuid.New(), Title: title, State: data.StateOpen})
+			assert.Nil(t, err)
+			risks = append(risks, risk)
+		}
+		assert.Nil(t, rdb.SoftDeleteByID(ctx, risks[0].ID, 0))
+		_, err := rdb.PurgeDeletedBefore(ctx, time.Now().Add(time.Hour))
+		assert.Nil(t, err)
+		_, err = sDB.client.ExecContext(ctx, "VACUUM")
+		assert.Nil(t, err)
+
+		// the search index is keyed on search_id, which VACUUM keeps as it is the rowid itself
+		var renumbered int
+		err = sDB.client.QueryRowContext(ctx, "SELECT count(*) FROM risks WHERE search_id IS NOT rowid").Scan(&renumbered)
+		assert.Nil(t, err)
+		assert.Equal(t, 0, renumbered)
+
+		found, err := rdb.Search(ctx, "drought", data.Options{Limit: 10, Count: data.CountExact})
+		assert.Nil(t, err)
+		assert.Len(t, found.Risks, 1)
+		assert.Equal(t, risks[2].ID, found.Risks[0].ID)
+		assert.Equal(t, 1, *found.TotalCount)
+	})
+}
@@ -0,0 +1,105 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"stan-project/data"
+	"strings"
+	"time"
+)
+
+// scanUser scans a row of the user columns, the times are stored as text
+func scanUser(s scanner) (data.User, error) {
+	var user data.User
+	var createdAt, updatedAt string
+	if err := s.Scan(&user.ID, &user.Name, &user.Email, &user.Active, &createdAt, &updatedAt); err != nil {
+		return data.User{}, err
+	}
+	var err error
+	if user.CreatedAt, err = time.Parse(timeFormat, createdAt); err != nil {
+		return data.User{}, err
+	}
+	if user.UpdatedAt, err = time.Parse(timeFormat, updatedAt); err != nil {
+		return data.User{}, err
+	}
+	return user, nil
+}
+
+//go:embed sql/insert_user.sql
+var insertUser string
+
+// AddUser adds a user, it fails with data.ErrConflict when a user with the same ID exists
+func (rdb *risksDB) AddUser(ctx context.Context, user data.User) (data.User, error) {
+	added, err := scanUser(rdb.db.client.QueryRowContext(ctx, insertUser, user.ID, user.Name, user.Email, user.Active, formatTime(now())))
+	if err != nil {
+		return data.User{}, classifyError(err)
+	}
+	return added, nil
+}
+
+//go:embed sql/get_user_by_id.sql
+var getUserByID string
+
+func (rdb *risksDB) GetUser(ctx context.Context, ID string) (data.User, error) {
+	user, err := scanUser(rdb.db.client.QueryRowContext(ctx, getUserByID, ID))
+	if errors.Is(err, sql.ErrNoRows) {
+		return data.User{}, data.Errorf(data.ErrNotFound, "user with ID: %s not found", ID)
+	}
+	if err != nil {
+		return data.User{}, classifyError(err)
+	}
+	return user, nil
+}
+
+//go:embed sql/get_users.sql
+var getUsers string
+
+// GetUsers lists the users matching the filter, ordered by ID
+func (rdb *risksDB) GetUsers(ctx context.Context, filter data.UserFilter) ([]data.User, error) {
+	var conditions []string
+	var args []any
+	if filter.IDs != nil {
+		IDs, _ := json.Marshal(filter.IDs)
+		args = append(args, string(IDs))
+		conditions = append(conditions, fmt.Sprintf(" AND user_id IN (SELECT value FROM json_each(?%d))", len(args)))
+	}
+	if filter.Active != nil {
+		args = append(args, *filter.Active)
+		conditions = append(conditions, fmt.Sprintf(" AND active = ?%d", len(args)))
+	}
+
+	rows, err := rdb.db.client.QueryContext(ctx, fmt.Sprintf(getUsers, strings.Join(conditions, "")), args...)
+	if err != nil {
+		return nil, classifyError(err)
+	}
+	defer rows.Close()
+
+	users := []data.User{}
+	for rows.Next() {
+		user, err := scanUser(rows)
+		if err != nil {
+			return nil, classifyError(err)
+		}
+		users = append(users, user)
+	}
+	return users, classifyError(rows.Err())
+}
+
+//go:embed sql/update_user.sql
+var updateUser string
+
+// UpdateUser updates the name, email and activity of a user
+func (rdb *risksDB) UpdateUser(ctx context.Context, user data.User) (data.User, error) {
+	updated, err := scanUser(rdb.db.client.QueryRowContext(ctx, updateUser, user.ID, user.Name, user.Email, user.Active, formatTime(now())))
+	if errors.Is(err, sql.ErrNoRows) {
+		return data.User{}, data.Errorf(data.ErrNotFound, "user with ID: %s not found", user.ID)
+	}
+	if err != nil {
+		return data.User{}, classifyError(err)
+	}
+	return updated, nil
+}
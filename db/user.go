@@ -0,0 +1,93 @@
+package db
+
+import (
+	"context"
+	_ "embed"
+	"errors"
+	"fmt"
+	"github.com/jackc/pgx/v4"
+	"stan-project/data"
+	"strings"
+)
+
+// userFields returns the scan targets for the user columns selected by every query, in order
+func userFields(user *data.User) []any {
+	return []any{&user.ID, &user.Name, &user.Email, &user.Active, &user.CreatedAt, &user.UpdatedAt}
+}
+
+//go:embed sql/insert_user.sql
+var insertUser string
+
+// AddUser adds a user, it fails with data.ErrConflict when a user with the same ID exists
+func (rdb *risksDB) AddUser(ctx context.Context, user data.User) (data.User, error) {
+	var added data.User
+	err := rdb.db.client.QueryRow(ctx, insertUser, user.ID, user.Name, user.Email, user.Active).Scan(userFields(&added)...)
+	if err != nil {
+		return data.User{}, classifyError(err)
+	}
+	return added, nil
+}
+
+//go:embed sql/get_user_by_id.sql
+var getUserByID string
+
+func (rdb *risksDB) GetUser(ctx context.Context, ID string) (data.User, error) {
+	var user data.User
+	err := rdb.db.client.QueryRow(ctx, getUserByID, ID).Scan(userFields(&user)...)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return data.User{}, data.Errorf(data.ErrNotFound, "user with ID: %s not found", ID)
+	}
+	if err != nil {
+		return data.User{}, classifyError(err)
+	}
+	return user, nil
+}
+
+//go:embed sql/get_users.sql
+var getUsers string
+
+// GetUsers lists the users matching the filter, ordered by ID
+func (rdb *risksDB) GetUsers(ctx context.Context, filter data.UserFilter) ([]data.User, error) {
+	var conditions []string
+	var args []any
+	if filter.IDs != nil {
+		args = append(args, filter.IDs)
+		conditions = append(conditions, fmt.Sprintf(" AND user_id = ANY($%d)", len(args)))
+	}
+	if filter.Active != nil {
+		args = append(args, *filter.Active)
+		conditions = append(conditions, fmt.Sprintf(" AND active = $%d", len(args)))
+	}
+
+	rows, err := rdb.db.client.Query(ctx, fmt.Sprintf(getUsers, strings.Join(conditions, "")), args...)
+	if err != nil {
+		return nil, classifyError(err)
+	}
+	defer rows.Close()
+
+	users := []data.User{}
+	for rows.Next() {
+		var user data.User
+		if err = rows.Scan(userFields(&user)...); err != nil {
+			return nil, classifyError(err)
+		}
+		users = append(users, user)
+	}
+	return users, classifyError(rows.Err())
+}
+
+//go:embed sql/update_user.sql
+var updateUser string
+
+// UpdateUser updates the name, email and activity of a user
+func (rdb *risksDB) UpdateUser(ctx context.Context, user data.User) (data.User, error) {
+	var updated data.User
+	err := rdb.db.client.QueryRow(ctx, updateUser, user.ID, user.Name, user.Email, user.Active).Scan(userFields(&updated)...)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return data.User{}, data.Errorf(data.ErrNotFound, "user with ID: %s not found", user.ID)
+	}
+	if err != nil {
+		return data.User{}, classifyError(err)
+	}
+	return updated, nil
+}
@@ -0,0 +1,77 @@
+package handler
+
+import (
+	"log/slog"
+	"net/http"
+	"stan-project/data"
+)
+
+type (
+	// batchResponse lists the outcome of every operation of a batch, in the order of the operations
+	batchResponse struct {
+		Mode      data.BatchMode `json:"mode"`
+		Succeeded int            `json:"succeeded"`
+		Failed    int            `json:"failed"`
+		Results   []batchResult  `json:"results"`
+	}
+
+	// batchResult is the outcome of an operation, with the status the matching single request would have responded
+	// with. Deletes have no risk, like the 204 of a single delete.
+	batchResult struct {
+		Index  int              `json:"index"`
+		Op     data.BatchAction `json:"op"`
+		Status int              `json:"status"`
+		Risk   *data.Risk       `json:"risk,omitempty"`
+		Error  *problem         `json:"error,omitempty"`
+	}
+)
+
+// batchStatuses are the statuses of the successful operations of a batch
+var batchStatuses = map[data.BatchAction]int{
+	data.BatchCreate: http.StatusCreated,
+	data.BatchUpdate: http.StatusOK,
+	data.BatchDelete: http.StatusNoContent,
+}
+
+func (rh *riskHandler) Batch(w http.ResponseWriter, r *http.Request) {
+	requestID := r.Context().Value("requestID").(string)
+	slog.Debug("received a batch request", "requestID", requestID, "method", r.Method, "url", r.URL)
+	ctx := r.Context()
+
+	var request data.BatchRequest
+	err := decodeJSON(w, r, &request, "batch request")
+	if err != nil {
+		slog.Warn("error unmarshallling batch request", "err", err)
+		respondWithError(w, r, err, "")
+		return
+	}
+	if request.Mode == "" {
+		request.Mode = data.BatchAtomic
+	}
+
+	results, err := rh.riskLogic.Batch(ctx, request)
+	if err != nil {
+		slog.Error("error applying batch", "err", err)
+		respondWithError(w, r, err, "error processing the batch request")
+		return
+	}
+
+	response := batchResponse{Mode: request.Mode, Results: make([]batchResult, len(results))}
+	for i, result := range results {
+		response.Results[i] = batchResult{Index: i, Op: result.Action}
+		if result.Err != nil {
+			p := errorProblem(r, result.Err, "error processing the operation")
+			response.Results[i].Status, response.Results[i].Error = p.Status, &p
+			response.Failed++
+			continue
+		}
+		response.Results[i].Status = batchStatuses[result.Action]
+		if result.Action != data.BatchDelete {
+			response.Results[i].Risk = &result.Risk
+		}
+		response.Succeeded++
+	}
+
+	slog.Info("successfully applied batch", "succeeded", response.Succeeded, "failed", response.Failed)
+	respondWithJSON(w, http.StatusOK, response)
+}
@@ -0,0 +1,67 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"stan-project/data"
+	"strings"
+	"testing"
+)
+
+func TestRiskHandler_Batch(t *testing.T) {
+	newRequest := func(body string) *http.Request {
+		req := httptest.NewRequest(http.MethodPost, "/v1/risks:batch", strings.NewReader(body))
+		return req.WithContext(context.WithValue(req.Context(), "requestID", uuid.New().String()))
+	}
+
+	t.Run("successfully apply a batch with a result per operation", func(t *testing.T) {
+		risk := data.Risk{ID: uuid.MustParse("c7041e22-15c1-4293-9b43-c54c8dd4b909"), Title: "threat 1", State: "open", Version: 1}
+		h := NewRiskHandler(&mockRiskLogic{batchResults: []data.BatchResult{
+			{Action: data.BatchCreate, Risk: risk},
+			{Action: data.BatchDelete, Risk: risk},
+			{Action: data.BatchUpdate, Err: data.Errorf(data.ErrPreconditionFailed, "risk has changed")},
+		}})
+		w := httptest.NewRecorder()
+
+		h.Batch(w, newRequest(`{"mode": "bestEffort", "operations": [{"op": "create", "title": "threat 1"}]}`))
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		var response batchResponse
+		assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &response))
+		assert.Equal(t, data.BatchBestEffort, response.Mode)
+		assert.Equal(t, 2, response.Succeeded)
+		assert.Equal(t, 1, response.Failed)
+		if !assert.Len(t, response.Results, 3) {
+			return
+		}
+		assert.Equal(t, batchResult{Index: 0, Op: data.BatchCreate, Status: http.StatusCreated, Risk: &risk}, response.Results[0])
+		assert.Equal(t, batchResult{Index: 1, Op: data.BatchDelete, Status: http.StatusNoContent}, response.Results[1])
+		assert.Equal(t, http.StatusPreconditionFailed, response.Results[2].Status)
+		assert.Equal(t, "/problems/precondition-failed", response.Results[2].Error.Type)
+		assert.Equal(t, "risk has changed", response.Results[2].Error.Detail)
+	})
+
+	t.Run("failed to apply an atomic batch, an operation failed", func(t *testing.T) {
+		h := NewRiskHandler(&mockRiskLogic{err: &data.BatchError{Index: 2, Err: data.Errorf(data.ErrNotFound, "risk not found")}})
+		w := httptest.NewRecorder()
+
+		h.Batch(w, newRequest(`{"operations": [{"op": "delete", "id": "c7041e22-15c1-4293-9b43-c54c8dd4b909", "version": 1}]}`))
+
+		assert.Equal(t, http.StatusNotFound, w.Code)
+		assert.Contains(t, w.Body.String(), "operations[2]: risk not found")
+	})
+
+	t.Run("failed to apply a batch, unknown field", func(t *testing.T) {
+		h := NewRiskHandler(&mockRiskLogic{})
+		w := httptest.NewRecorder()
+
+		h.Batch(w, newRequest(`{"operations": [{"op": "create", "createdAt": "2024-06-01T10:00:00Z"}]}`))
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Contains(t, w.Body.String(), "createdAt")
+	})
+}
@@ -0,0 +1,82 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"stan-project/data"
+	"strconv"
+	"strings"
+)
+
+const (
+	etagHeader        = "ETag"
+	ifMatchHeader     = "If-Match"
+	ifNoneMatchHeader = "If-None-Match"
+)
+
+// errPreconditionRequired is returned when a write is not made conditional with If-Match
+var errPreconditionRequired = errors.New("precondition required")
+
+// etag returns the strong entity tag of a risk, it is the version of the risk which changes with every write
+func etag(risk data.Risk) string {
+	return `"` + strconv.FormatInt(risk.Version, 10) + `"`
+}
+
+// parseETags splits an If-Match or If-None-Match header into its entity tags, wildcard is set when the header is "*"
+func parseETags(header string) (tags []string, wildcard bool) {
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "*" {
+			return nil, true
+		}
+		if tag != "" {
+			tags = append(tags, tag)
+		}
+	}
+	return tags, false
+}
+
+// getPrecondition reads the If-Match header every write of a risk must send, so that it cannot overwrite a change
+// the client has not seen. If-Match uses the strong comparison, weak entity tags never match.
+func getPrecondition(r *http.Request) (data.Precondition, error) {
+	header := strings.TrimSpace(r.Header.Get(ifMatchHeader))
+	if header == "" {
+		return data.Precondition{}, data.Errorf(errPreconditionRequired, "the %s header is required, send the ETag of the risk you changed", ifMatchHeader)
+	}
+
+	tags, wildcard := parseETags(header)
+	precondition := data.Precondition{Any: wildcard}
+	for _, tag := range tags {
+		version, err := strconv.ParseInt(strings.TrimSuffix(strings.TrimPrefix(tag, `"`), `"`), 10, 64)
+		if err != nil || !strings.HasPrefix(tag, `"`) || !strings.HasSuffix(tag, `"`) {
+			continue
+		}
+		precondition.Versions = append(precondition.Versions, version)
+	}
+	return precondition, nil
+}
+
+// notModified tells whether the If-None-Match header of a read matches the risk, using the weak comparison
+func notModified(r *http.Request, risk data.Risk) bool {
+	header := r.Header.Get(ifNoneMatchHeader)
+	if header == "" {
+		return false
+	}
+	tags, wildcard := parseETags(header)
+	if wildcard {
+		return true
+	}
+	current := etag(risk)
+	for _, tag := range tags {
+		if strings.TrimPrefix(tag, "W/") == current {
+			return true
+		}
+	}
+	return false
+}
+
+// respondWithRisk responds with a risk along with its entity tag
+func respondWithRisk(w http.ResponseWriter, code int, risk data.Risk) {
+	w.Header().Set(etagHeader, etag(risk))
+	respondWithJSON(w, code, risk)
+}
@@ -0,0 +1,64 @@
+package handler
+
+import (
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"stan-project/data"
+	"testing"
+)
+
+func TestGetPrecondition(t *testing.T) {
+	tests := []struct {
+		name     string
+		header   string
+		expected data.Precondition
+	}{
+		{name: "successfully read an entity tag", header: `"3"`, expected: data.Precondition{Versions: []int64{3}}},
+		{name: "successfully read a list of entity tags", header: `"3", "4"`, expected: data.Precondition{Versions: []int64{3, 4}}},
+		{name: "successfully read any version", header: "*", expected: data.Precondition{Any: true}},
+		{name: "successfully ignore weak and invalid entity tags", header: `W/"3", "abc", 4`, expected: data.Precondition{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPut, "/v1/risks/c7041e22-15c1-4293-9b43-c54c8dd4b909", nil)
+			req.Header.Set(ifMatchHeader, tt.header)
+
+			precondition, err := getPrecondition(req)
+			assert.Nil(t, err)
+			assert.Equal(t, tt.expected, precondition)
+		})
+	}
+
+	t.Run("failed to read the precondition, If-Match missing", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPut, "/v1/risks/c7041e22-15c1-4293-9b43-c54c8dd4b909", nil)
+
+		_, err := getPrecondition(req)
+		assert.ErrorIs(t, err, errPreconditionRequired)
+	})
+}
+
+func TestNotModified(t *testing.T) {
+	risk := data.Risk{Version: 3}
+	tests := map[string]bool{
+		"":            false,
+		`"3"`:         true,
+		`W/"3"`:       true,
+		`"2", "3"`:    true,
+		"*":           true,
+		`"2"`:         false,
+		`"3 "`:        false,
+		`W/"2", "4"`:  false,
+		`"4", W/"30"`: false,
+	}
+
+	for header, expected := range tests {
+		t.Run("If-None-Match "+header, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/v1/risks/c7041e22-15c1-4293-9b43-c54c8dd4b909", nil)
+			req.Header.Set(ifNoneMatchHeader, header)
+
+			assert.Equal(t, expected, notModified(req, risk))
+		})
+	}
+}
@@ -0,0 +1,85 @@
+package handler
+
+import (
+	"log/slog"
+	"mime"
+	"net/http"
+	"stan-project/cmd/config"
+	"stan-project/data"
+	"time"
+)
+
+const exportFormat = "format"
+
+// exportResponse is the body of an export. It counts the bytes written, so that errors met before the first byte are
+// still responded with a problem, and pushes the write deadline back on every write, so that the write timeout is the
+// longest a slow export may stall rather than the longest it may take.
+type exportResponse struct {
+	w       http.ResponseWriter
+	written int64
+}
+
+func (e *exportResponse) Write(p []byte) (int, error) {
+	// recorders used in tests do not support deadlines, the error is harmless
+	_ = http.NewResponseController(e.w).SetWriteDeadline(time.Now().Add(config.Global.HTTP.WriteTimeout))
+	n, err := e.w.Write(p)
+	e.written += int64(n)
+	return n, err
+}
+
+// Export streams every risk matching the filters of the list endpoint, in its sort order, as a CSV, JSON Lines or
+// XLSX file download.
+func (rh *riskHandler) Export(w http.ResponseWriter, r *http.Request) {
+	requestID := r.Context().Value("requestID").(string)
+	slog.Debug("received a request to export risks", "requestID", requestID, "method", r.Method, "url", r.URL)
+	ctx := r.Context()
+
+	format, err := data.ParseExportFormat(getQueryParam(exportFormat, r))
+	if err != nil {
+		slog.Warn("invalid export format", "err", err)
+		respondWithError(w, r, err, "")
+		return
+	}
+
+	keys, err := data.ParseSort(getSortParam(r))
+	if err != nil {
+		slog.Warn("invalid sort options", "err", err)
+		respondWithError(w, r, err, "")
+		return
+	}
+
+	filter, err := getFilter(r)
+	if err != nil {
+		slog.Warn("invalid filter options", "err", err)
+		respondWithError(w, r, err, "")
+		return
+	}
+
+	filename := "risks-" + time.Now().UTC().Format("20060102T150405Z") + "." + string(format)
+	w.Header().Set("Content-Type", format.ContentType())
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": filename}))
+
+	body := &exportResponse{w: w}
+	writer := data.NewRiskWriter(format, body)
+	exported := 0
+	err = rh.riskLogic.Export(ctx, data.Options{Sort: keys, Filter: filter}, func(risk data.Risk) error {
+		exported++
+		return writer.Write(risk)
+	})
+	if err == nil {
+		err = writer.Close()
+	}
+	if err != nil && body.written == 0 {
+		slog.Error("error exporting risks", "err", err)
+		w.Header().Del("Content-Disposition")
+		respondWithError(w, r, err, "error exporting risks")
+		return
+	}
+	if err != nil {
+		// the status is already sent, aborting the response tells the client that the file is incomplete
+		slog.Error("error exporting risks, aborting the response", "exported", exported, "err", err)
+		panic(http.ErrAbortHandler)
+	}
+
+	slog.Info("successfully exported risks", "exported", exported, "format", format)
+}
@@ -0,0 +1,144 @@
+package handler
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"stan-project/data"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRiskHandler_Export(t *testing.T) {
+	newRequest := func(target string) *http.Request {
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		return req.WithContext(context.WithValue(req.Context(), "requestID", uuid.New().String()))
+	}
+	createdAt := time.Date(2024, 6, 1, 10, 0, 0, 0, time.UTC)
+	risks := []data.Risk{
+		{ID: uuid.MustParse("c7041e22-15c1-4293-9b43-c54c8dd4b909"), Title: "threat 1", Description: "DDOS, \"large\"", State: "open", Likelihood: 4, Impact: 5, ResidualLikelihood: 2, ResidualImpact: 5, InherentScore: 20, ResidualScore: 10, Severity: "high", Owner: "alice", Tags: []string{"cloud", "payments"}, Version: 1, CreatedAt: createdAt, UpdatedAt: createdAt, CreatedBy: "alice", UpdatedBy: "bob"},
+		{ID: uuid.MustParse("3adf28e9-c4f8-418a-b08b-2c070cd9653b"), Title: "=threat <2>", State: "closed", Version: 3, ExternalRef: "EXT-2", CreatedAt: createdAt, UpdatedAt: createdAt},
+	}
+	logic := &mockRiskLogic{paginatedRisk: data.PaginatedResponse{Risks: risks}}
+
+	t.Run("successfully export risks as CSV", func(t *testing.T) {
+		w := httptest.NewRecorder()
+
+		NewRiskHandler(logic).Export(w, newRequest("/v1/risks/export?state=open,closed&sort=-title"))
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "text/csv; charset=utf-8", w.Header().Get("Content-Type"))
+		assert.Regexp(t, `^attachment; filename=risks-\d{8}T\d{6}Z\.csv$`, w.Header().Get("Content-Disposition"))
+		records, err := csv.NewReader(w.Body).ReadAll()
+		assert.Nil(t, err)
+		assert.Equal(t, [][]string{
+			{"id", "title", "description", "state", "externalRef", "likelihood", "impact", "residualLikelihood", "residualImpact", "inherentScore", "residualScore", "severity", "owner", "assignee", "tags", "version", "createdAt", "updatedAt", "createdBy", "updatedBy"},
+			{"c7041e22-15c1-4293-9b43-c54c8dd4b909", "threat 1", "DDOS, \"large\"", "open", "", "4", "5", "2", "5", "20", "10", "high", "alice", "", "cloud,payments", "1", "2024-06-01T10:00:00Z", "2024-06-01T10:00:00Z", "alice", "bob"},
+			{"3adf28e9-c4f8-418a-b08b-2c070cd9653b", "'=threat <2>", "", "closed", "EXT-2", "0", "0", "0", "0", "0", "0", "", "", "", "", "3", "2024-06-01T10:00:00Z", "2024-06-01T10:00:00Z", "", ""},
+		}, records)
+	})
+
+	t.Run("successfully export risks as CSV, formulas are quoted", func(t *testing.T) {
+		var formulas []data.Risk
+		for _, text := range []string{"=1+1", "+1", "-1", "@SUM(A1)", "\tcmd", "\rcmd", "a=1"} {
+			formulas = append(formulas, data.Risk{Title: text, Description: text})
+		}
+		w := httptest.NewRecorder()
+
+		NewRiskHandler(&mockRiskLogic{paginatedRisk: data.PaginatedResponse{Risks: formulas}}).Export(w, newRequest("/v1/risks/export"))
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		records, err := csv.NewReader(w.Body).ReadAll()
+		assert.Nil(t, err)
+		var titles, descriptions []string
+		for _, record := range records[1:] {
+			titles, descriptions = append(titles, record[1]), append(descriptions, record[2])
+		}
+		expected := []string{"'=1+1", "'+1", "'-1", "'@SUM(A1)", "'\tcmd", "'\rcmd", "a=1"}
+		assert.Equal(t, expected, titles)
+		assert.Equal(t, expected, descriptions)
+	})
+
+	t.Run("successfully export no risks as a CSV header", func(t *testing.T) {
+		w := httptest.NewRecorder()
+
+		NewRiskHandler(&mockRiskLogic{}).Export(w, newRequest("/v1/risks/export"))
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "id,title,description,state,externalRef,likelihood,impact,residualLikelihood,residualImpact,inherentScore,residualScore,severity,owner,assignee,tags,version,createdAt,updatedAt,createdBy,updatedBy\n", w.Body.String())
+	})
+
+	t.Run("successfully export risks as JSON Lines", func(t *testing.T) {
+		w := httptest.NewRecorder()
+
+		NewRiskHandler(logic).Export(w, newRequest("/v1/risks/export?format=jsonl"))
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "application/jsonl", w.Header().Get("Content-Type"))
+		lines := strings.Split(strings.TrimSuffix(w.Body.String(), "\n"), "\n")
+		if !assert.Len(t, lines, 2) {
+			return
+		}
+		for i, line := range lines {
+			var risk data.Risk
+			assert.Nil(t, json.Unmarshal([]byte(line), &risk))
+			assert.Equal(t, risks[i], risk)
+		}
+	})
+
+	t.Run("successfully export risks as XLSX", func(t *testing.T) {
+		w := httptest.NewRecorder()
+
+		NewRiskHandler(logic).Export(w, newRequest("/v1/risks/export?format=xlsx"))
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Regexp(t, `\.xlsx$`, w.Header().Get("Content-Disposition"))
+		archive, err := zip.NewReader(bytes.NewReader(w.Body.Bytes()), int64(w.Body.Len()))
+		if !assert.Nil(t, err) {
+			return
+		}
+		var names []string
+		var sheet string
+		for _, file := range archive.File {
+			names = append(names, file.Name)
+			if file.Name == "xl/worksheets/sheet1.xml" {
+				r, err := file.Open()
+				assert.Nil(t, err)
+				content, err := io.ReadAll(r)
+				assert.Nil(t, err)
+				sheet = string(content)
+			}
+		}
+		assert.Equal(t, []string{"[Content_Types].xml", "_rels/.rels", "xl/workbook.xml", "xl/_rels/workbook.xml.rels", "xl/worksheets/sheet1.xml"}, names)
+		assert.Equal(t, 3, strings.Count(sheet, "<row "))
+		assert.Contains(t, sheet, `<t xml:space="preserve">=threat &lt;2&gt;</t>`)
+		assert.True(t, strings.HasSuffix(sheet, "</sheetData></worksheet>"))
+	})
+
+	t.Run("failed to export risks, invalid format", func(t *testing.T) {
+		w := httptest.NewRecorder()
+
+		NewRiskHandler(logic).Export(w, newRequest("/v1/risks/export?format=pdf"))
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Contains(t, w.Body.String(), "format")
+	})
+
+	t.Run("failed to export risks, error before the first risk", func(t *testing.T) {
+		w := httptest.NewRecorder()
+
+		NewRiskHandler(&mockRiskLogic{err: data.Errorf(data.ErrUnavailable, "db down")}).Export(w, newRequest("/v1/risks/export"))
+
+		assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+		assert.Equal(t, problemContentType, w.Header().Get("Content-Type"))
+		assert.Empty(t, w.Header().Get("Content-Disposition"))
+	})
+}
@@ -4,14 +4,23 @@ import (
 	"encoding/json"
 	"github.com/gorilla/mux"
 	"net/http"
+	"stan-project/data"
 )
 
-type Handler struct {
-	rh *riskHandler
-}
+type (
+	Handler struct {
+		rh      *riskHandler
+		uh      *userHandler
+		dbStats dbStats
+	}
+
+	dbStats interface {
+		Stats() data.PoolStats
+	}
+)
 
-func NewHandler(rh *riskHandler) *Handler {
-	return &Handler{rh: rh}
+func NewHandler(rh *riskHandler, uh *userHandler, dbStats dbStats) *Handler {
+	return &Handler{rh: rh, uh: uh, dbStats: dbStats}
 }
 
 func NewRouter(h *Handler) *mux.Router {
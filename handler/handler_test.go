@@ -1,15 +1,22 @@
 package handler
 
 import (
+	"encoding/json"
+	"github.com/gorilla/mux"
 	"github.com/stretchr/testify/assert"
 	"net/http"
 	"net/http/httptest"
+	"stan-project/cmd/config"
+	"stan-project/data"
+	"stan-project/db/memory"
+	"stan-project/logic"
+	"strings"
 	"testing"
 )
 
 func TestHandler_CheckHealth(t *testing.T) {
 	t.Run("Successfully return as healthy", func(t *testing.T) {
-		h := NewHandler(&riskHandler{})
+		h := NewHandler(&riskHandler{}, &userHandler{}, nil)
 
 		req, err := http.NewRequest(http.MethodGet, "/risks/health", nil)
 		if err != nil {
@@ -24,10 +31,253 @@ func TestHandler_CheckHealth(t *testing.T) {
 	})
 }
 
+func TestHandler_DBStats(t *testing.T) {
+	t.Run("successfully report the database pool stats", func(t *testing.T) {
+		expected := data.PoolStats{TotalConns: 3, AcquiredConns: 1, IdleConns: 2, MaxConns: 10, AcquireCount: 42, AcquireDuration: "1.5ms"}
+		h := NewHandler(&riskHandler{}, &userHandler{}, mockDBStats{stats: expected})
+
+		req := httptest.NewRequest(http.MethodGet, "/risks/health/db", nil)
+
+		w := httptest.NewRecorder()
+
+		h.DBStats(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		var resp data.PoolStats
+		err := json.Unmarshal(w.Body.Bytes(), &resp)
+		if err != nil {
+			t.Fatalf("error decoding response: %s", err)
+		}
+
+		assert.Equal(t, expected, resp)
+	})
+
+	t.Run("failed to report the pool stats without a database", func(t *testing.T) {
+		h := NewHandler(&riskHandler{}, &userHandler{}, nil)
+
+		req := httptest.NewRequest(http.MethodGet, "/risks/health/db", nil)
+
+		w := httptest.NewRecorder()
+
+		h.DBStats(w, req)
+
+		assert.Equal(t, http.StatusNotFound, w.Code)
+	})
+}
+
 func TestNewRouter(t *testing.T) {
 	t.Run("successfully initialise http router", func(t *testing.T) {
-		h := NewHandler(&riskHandler{})
+		h := NewHandler(&riskHandler{}, &userHandler{}, nil)
 		router := NewRouter(h)
 		assert.NotNil(t, router)
 	})
+
+	t.Run("trash routes are not matched as a risk ID", func(t *testing.T) {
+		router := NewRouter(NewHandler(&riskHandler{}, &userHandler{}, nil))
+
+		tests := map[string]string{
+			http.MethodGet:    "Get Deleted Risks",
+			http.MethodDelete: "Purge Deleted Risks",
+		}
+		for method, name := range tests {
+			req := httptest.NewRequest(method, "/v1/risks/trash", nil)
+			var match mux.RouteMatch
+			assert.True(t, router.Match(req, &match))
+			assert.Equal(t, name, match.Route.GetName())
+		}
+	})
+
+	t.Run("search route is not matched as a risk ID", func(t *testing.T) {
+		router := NewRouter(NewHandler(&riskHandler{}, &userHandler{}, nil))
+
+		req := httptest.NewRequest(http.MethodGet, "/v1/risks/search?q=ddos", nil)
+		var match mux.RouteMatch
+		assert.True(t, router.Match(req, &match))
+		assert.Equal(t, "Search Risks", match.Route.GetName())
+	})
+}
+
+func TestHandler_RequestIDMiddleware(t *testing.T) {
+	gatewaySecret := config.Global.HTTP.GatewaySecret
+	t.Cleanup(func() { config.Global.HTTP.GatewaySecret = gatewaySecret })
+
+	tests := []struct {
+		name          string
+		configured    string
+		actor, secret string
+		expected      string
+	}{
+		{name: "without actor", configured: "s3cret", expected: "anonymous"},
+		{name: "actor sent by the gateway", configured: "s3cret", actor: " alice ", secret: "s3cret", expected: "alice"},
+		{name: "unauthenticated actor", configured: "s3cret", actor: "alice", expected: "anonymous"},
+		{name: "actor with a wrong gateway secret", configured: "s3cret", actor: "alice", secret: "guess", expected: "anonymous"},
+		{name: "actor without a configured gateway secret", actor: "alice", expected: "anonymous"},
+	}
+	for _, test := range tests {
+		t.Run("successfully add the audit of the request, "+test.name, func(t *testing.T) {
+			config.Global.HTTP.GatewaySecret = test.configured
+			h := NewHandler(&riskHandler{}, &userHandler{}, nil)
+			var audit data.Audit
+			next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				audit = data.AuditFrom(r.Context())
+			})
+
+			req := httptest.NewRequest(http.MethodGet, "/v1/risks", nil)
+			req.Header.Set("X-Actor", test.actor)
+			req.Header.Set("X-Gateway-Secret", test.secret)
+			w := httptest.NewRecorder()
+
+			h.RequestIDMiddleware(next).ServeHTTP(w, req)
+
+			assert.Equal(t, test.expected, audit.Actor)
+			assert.Equal(t, w.Header().Get("X-Request-ID"), audit.RequestID)
+		})
+	}
+}
+
+func TestRouter_MemoryStorage(t *testing.T) {
+	gatewaySecret := config.Global.HTTP.GatewaySecret
+	t.Cleanup(func() { config.Global.HTTP.GatewaySecret = gatewaySecret })
+	config.Global.HTTP.GatewaySecret = "s3cret"
+
+	t.Run("successfully manage risks end to end with the in-memory storage", func(t *testing.T) {
+		storage := memory.NewRisksDB()
+		router := NewRouter(NewHandler(NewRiskHandler(logic.NewRiskLogic(storage)), NewUserHandler(logic.NewUserLogic(storage)), nil))
+		serve := func(method, target, body string, header ...string) *httptest.ResponseRecorder {
+			req := httptest.NewRequest(method, target, strings.NewReader(body))
+			if body != "" {
+				req.Header.Set("Content-Type", "application/json")
+			}
+			for i := 0; i+1 < len(header); i += 2 {
+				req.Header.Set(header[i], header[i+1])
+			}
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+			return w
+		}
+
+		for _, title := range []string{"threat b", "threat a", "threat c"} {
+			w := serve(http.MethodPost, "/v1/risks", `{"title": "`+title+`", "state": "open"}`)
+			assert.Equal(t, http.StatusCreated, w.Code)
+		}
+
+		w := serve(http.MethodGet, "/v1/risks?limit=2&sort=-title", "")
+		assert.Equal(t, http.StatusOK, w.Code)
+		var page data.PaginatedResponse
+		if err := json.Unmarshal(w.Body.Bytes(), &page); err != nil {
+			t.Fatalf("error decoding response: %s", err)
+		}
+		assert.Equal(t, 3, *page.TotalCount)
+		assert.Equal(t, []string{"threat c", "threat b"}, []string{page.Risks[0].Title, page.Risks[1].Title})
+
+		w = serve(http.MethodGet, "/v1/risks?limit=2&sort=-title&after="+page.NextCursor.String(), "")
+		assert.Equal(t, http.StatusOK, w.Code)
+		var next data.PaginatedResponse
+		if err := json.Unmarshal(w.Body.Bytes(), &next); err != nil {
+			t.Fatalf("error decoding response: %s", err)
+		}
+		assert.Len(t, next.Risks, 1)
+		assert.Equal(t, "threat a", next.Risks[0].Title)
+
+		riskURL := "/v1/risks/" + next.Risks[0].ID.String()
+		w = serve(http.MethodGet, riskURL, "")
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, `"1"`, w.Header().Get("ETag"))
+		assert.Equal(t, http.StatusNotModified, serve(http.MethodGet, riskURL, "", "If-None-Match", `"1"`).Code)
+
+		assert.Equal(t, http.StatusPreconditionRequired, serve(http.MethodPatch, riskURL, `{"state": "closed"}`, "Content-Type", mergePatchContentType).Code)
+		w = serve(http.MethodPatch, riskURL, `{"state": "closed"}`, "Content-Type", mergePatchContentType, "If-Match", `"1"`)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, `"2"`, w.Header().Get("ETag"))
+		assert.Equal(t, http.StatusPreconditionFailed, serve(http.MethodDelete, riskURL, "", "If-Match", `"1"`).Code)
+		assert.Equal(t, http.StatusNoContent, serve(http.MethodDelete, riskURL, "", "If-Match", `"2"`).Code)
+		assert.Equal(t, http.StatusNotFound, serve(http.MethodGet, riskURL, "").Code)
+		assert.Equal(t, http.StatusNotFound, serve(http.MethodGet, "/risks/health/db", "").Code)
+
+		w = serve(http.MethodGet, riskURL+"/history", "")
+		assert.Equal(t, http.StatusOK, w.Code)
+		var history []data.HistoryEntry
+		if err := json.Unmarshal(w.Body.Bytes(), &history); err != nil {
+			t.Fatalf("error decoding response: %s", err)
+		}
+		assert.Equal(t, []data.Action{data.ActionCreated, data.ActionUpdated, data.ActionDeleted}, []data.Action{history[0].Action, history[1].Action, history[2].Action})
+		assert.Equal(t, "anonymous", history[0].Actor)
+		assert.NotEmpty(t, history[0].RequestID)
+
+		w = serve(http.MethodPost, "/v1/risks:batch", `{"mode": "bestEffort", "operations": [
+			{"op": "create", "title": "threat d", "state": "open"},
+			{"op": "delete", "id": "`+page.Risks[0].ID.String()+`", "version": 1},
+			{"op": "delete", "id": "`+next.Risks[0].ID.String()+`", "version": 3}
+		]}`)
+		assert.Equal(t, http.StatusOK, w.Code)
+		var batch batchResponse
+		if err := json.Unmarshal(w.Body.Bytes(), &batch); err != nil {
+			t.Fatalf("error decoding response: %s", err)
+		}
+		assert.Equal(t, []int{http.StatusCreated, http.StatusNoContent, http.StatusNotFound}, []int{batch.Results[0].Status, batch.Results[1].Status, batch.Results[2].Status})
+
+		w = serve(http.MethodPost, "/v1/risks/import", "title,state,externalRef\nthreat e,open,EXT-1\n", "Content-Type", "text/csv")
+		assert.Equal(t, http.StatusOK, w.Code)
+		var report data.ImportReport
+		if err := json.Unmarshal(w.Body.Bytes(), &report); err != nil {
+			t.Fatalf("error decoding response: %s", err)
+		}
+		assert.Equal(t, 1, report.Created)
+
+		w = serve(http.MethodGet, "/v1/risks/export?format=jsonl&sort=-title&state=open", "")
+		assert.Equal(t, http.StatusOK, w.Code)
+		var first data.Risk
+		if err := json.NewDecoder(w.Body).Decode(&first); err != nil {
+			t.Fatalf("error decoding the export: %s", err)
+		}
+		assert.Equal(t, "threat e", first.Title)
+
+		w = serve(http.MethodGet, "/v1/reports/heatmap?state=open", "")
+		assert.Equal(t, http.StatusOK, w.Code)
+		var heatMap data.HeatMap
+		if err := json.Unmarshal(w.Body.Bytes(), &heatMap); err != nil {
+			t.Fatalf("error decoding response: %s", err)
+		}
+		assert.Equal(t, 25, len(heatMap.Cells))
+		assert.Equal(t, heatMap.Total, heatMap.Cells[2*5+2].Count, "unrated risks are in the middle of the scale")
+
+		assert.Equal(t, http.StatusCreated, serve(http.MethodPost, "/v1/users", `{"id": "alice", "name": "Alice"}`).Code)
+		assert.Equal(t, http.StatusConflict, serve(http.MethodPost, "/v1/users", `{"id": "alice", "name": "Alice"}`).Code)
+		w = serve(http.MethodPost, "/v1/risks/"+first.ID.String()+"/assignment", `{"assignee": "bob"}`, "If-Match", `"1"`)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		w = serve(http.MethodPost, "/v1/risks/"+first.ID.String()+"/assignment", `{"owner": "alice", "reason": "new team"}`, "If-Match", `"1"`, "X-Actor", "carol", "X-Gateway-Secret", "s3cret")
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, `"2"`, w.Header().Get("ETag"))
+		var assigned data.Risk
+		if err := json.Unmarshal(w.Body.Bytes(), &assigned); err != nil {
+			t.Fatalf("error decoding response: %s", err)
+		}
+		assert.Equal(t, []string{"anonymous", "carol"}, []string{assigned.CreatedBy, assigned.UpdatedBy})
+		w = serve(http.MethodGet, "/v1/risks?updatedBy=carol&sort=-updatedAt", "")
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Contains(t, w.Body.String(), `"updatedBy":"carol"`)
+
+		assert.Equal(t, http.StatusBadRequest, serve(http.MethodGet, "/v1/risks?mine=true", "").Code)
+		assert.Equal(t, http.StatusBadRequest, serve(http.MethodGet, "/v1/risks?mine=true", "", "X-Actor", "alice").Code)
+		w = serve(http.MethodGet, "/v1/risks?mine=true", "", "X-Actor", "alice", "X-Gateway-Secret", "s3cret")
+		assert.Equal(t, http.StatusOK, w.Code)
+		var mine data.PaginatedResponse
+		if err := json.Unmarshal(w.Body.Bytes(), &mine); err != nil {
+			t.Fatalf("error decoding response: %s", err)
+		}
+		if assert.Len(t, mine.Risks, 1) {
+			assert.Equal(t, "alice", mine.Risks[0].Owner)
+		}
+		assert.Equal(t, http.StatusOK, serve(http.MethodPut, "/v1/users/alice", `{"name": "Alice", "active": false}`).Code)
+		assert.Equal(t, http.StatusBadRequest, serve(http.MethodPost, "/v1/risks", `{"title": "threat f", "state": "open", "owner": "alice"}`).Code)
+	})
+}
+
+type mockDBStats struct {
+	stats data.PoolStats
+}
+
+func (m mockDBStats) Stats() data.PoolStats {
+	return m.stats
 }
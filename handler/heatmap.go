@@ -0,0 +1,78 @@
+package handler
+
+import (
+	"bytes"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"stan-project/data"
+	"strconv"
+)
+
+const (
+	heatMapFormat = "format"
+	heatMapRating = "rating"
+	withIDs       = "ids"
+
+	svgFormat      = "svg"
+	svgContentType = "image/svg+xml"
+)
+
+// HeatMap counts the risks matching the filters of the list endpoint by likelihood and impact, as JSON or as an SVG
+// image that can be embedded as is
+func (rh *riskHandler) HeatMap(w http.ResponseWriter, r *http.Request) {
+	requestID := r.Context().Value("requestID").(string)
+	slog.Debug("received a request for the heat map", "requestID", requestID, "method", r.Method, "url", r.URL)
+	ctx := r.Context()
+
+	var fields []data.FieldError
+	format := getQueryParam(heatMapFormat, r)
+	if format != "" && format != "json" && format != svgFormat {
+		fields = append(fields, data.FieldError{Field: heatMapFormat, Message: fmt.Sprintf("must be one of json or svg but received %q", format)})
+	}
+	rating, err := data.ParseRating(getQueryParam(heatMapRating, r))
+	if err != nil {
+		fields = append(fields, err.(*data.ValidationError).Fields...)
+	}
+	listIDs := false
+	if value := getQueryParam(withIDs, r); value != "" {
+		listIDs, err = strconv.ParseBool(value)
+		if err != nil {
+			fields = append(fields, data.FieldError{Field: withIDs, Message: fmt.Sprintf("must be true or false but received %q", value)})
+		}
+	}
+	if len(fields) > 0 {
+		slog.Warn("invalid heat map options", "fields", fields)
+		respondWithError(w, r, &data.ValidationError{Fields: fields}, "")
+		return
+	}
+
+	filter, err := getFilter(r)
+	if err != nil {
+		slog.Warn("invalid filter options", "err", err)
+		respondWithError(w, r, err, "")
+		return
+	}
+
+	heatMap, err := rh.riskLogic.HeatMap(ctx, data.HeatMapOptions{Filter: filter, Rating: rating, WithIDs: listIDs})
+	if err != nil {
+		slog.Error("error counting risks for the heat map", "err", err)
+		respondWithError(w, r, err, "error counting risks for the heat map")
+		return
+	}
+	slog.Debug("successfully counted risks for the heat map", "total", heatMap.Total)
+
+	if format != svgFormat {
+		respondWithJSON(w, http.StatusOK, heatMap)
+		return
+	}
+	var svg bytes.Buffer
+	if err = heatMap.WriteSVG(&svg); err != nil {
+		slog.Error("error rendering the heat map", "err", err)
+		respondWithError(w, r, err, "error rendering the heat map")
+		return
+	}
+	w.Header().Set("Content-Type", svgContentType)
+	w.WriteHeader(http.StatusOK)
+	w.Write(svg.Bytes())
+}
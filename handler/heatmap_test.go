@@ -0,0 +1,109 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"stan-project/data"
+	"strings"
+	"testing"
+)
+
+func TestRiskHandler_HeatMap(t *testing.T) {
+	newRequest := func(target string) *http.Request {
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		return req.WithContext(context.WithValue(req.Context(), "requestID", uuid.New().String()))
+	}
+	riskID := uuid.MustParse("c7041e22-15c1-4293-9b43-c54c8dd4b909")
+	scoring := data.Scoring{Scale: 3, MediumScore: 3, HighScore: 6, CriticalScore: 9}
+	heatMap := data.NewHeatMap(data.RatingResidual, scoring, []data.HeatMapCell{
+		{Likelihood: 3, Impact: 2, Count: 1, RiskIDs: []uuid.UUID{riskID}},
+		{Likelihood: 1, Impact: 1, Count: 4},
+	})
+	logic := &mockRiskLogic{heatMap: heatMap}
+
+	t.Run("successfully get the heat map as JSON", func(t *testing.T) {
+		w := httptest.NewRecorder()
+
+		NewRiskHandler(logic).HeatMap(w, newRequest("/v1/reports/heatmap?state=open&ids=true"))
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+		var actual data.HeatMap
+		assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &actual))
+		assert.Equal(t, heatMap, actual)
+		assert.Equal(t, 5, actual.Total)
+		assert.Equal(t, data.HeatMapCell{Likelihood: 3, Impact: 2, Score: 6, Severity: data.SeverityHigh, Count: 1, RiskIDs: []uuid.UUID{riskID}}, actual.Cells[7])
+	})
+
+	t.Run("successfully get the heat map as SVG", func(t *testing.T) {
+		w := httptest.NewRecorder()
+
+		NewRiskHandler(logic).HeatMap(w, newRequest("/v1/reports/heatmap?format=svg&rating=inherent"))
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "image/svg+xml", w.Header().Get("Content-Type"))
+		decoder := xml.NewDecoder(strings.NewReader(w.Body.String()))
+		for {
+			_, err := decoder.Token()
+			if err == io.EOF {
+				break
+			}
+			if !assert.Nil(t, err, "the SVG is well formed") {
+				return
+			}
+		}
+		assert.Equal(t, 9, strings.Count(w.Body.String(), "<rect "))
+		assert.Contains(t, w.Body.String(), "<title>Likelihood 3, impact 2, high: 1 risk</title>")
+		assert.Contains(t, w.Body.String(), "<title>Likelihood 1, impact 1, low: 4 risks</title>")
+	})
+
+	t.Run("failed to get the heat map, invalid options", func(t *testing.T) {
+		w := httptest.NewRecorder()
+
+		NewRiskHandler(logic).HeatMap(w, newRequest("/v1/reports/heatmap?format=png&rating=current&ids=maybe"))
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		var resp problem
+		assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		assert.Equal(t, []data.FieldError{
+			{Field: "format", Message: `must be one of json or svg but received "png"`},
+			{Field: "rating", Message: `must be one of inherent or residual but received "current"`},
+			{Field: "ids", Message: `must be true or false but received "maybe"`},
+		}, resp.Errors)
+	})
+
+	t.Run("successfully get the heat map of the risks with a tag", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		var options data.HeatMapOptions
+		tagged := &mockRiskLogic{heatMap: heatMap, heatMapOptions: &options}
+
+		NewRiskHandler(tagged).HeatMap(w, newRequest("/v1/reports/heatmap?state=open&tag=payments"))
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, data.Filter{States: []data.State{data.StateOpen}, Tags: []string{"payments"}}, options.Filter)
+	})
+
+	t.Run("failed to get the heat map, invalid filter", func(t *testing.T) {
+		w := httptest.NewRecorder()
+
+		NewRiskHandler(logic).HeatMap(w, newRequest("/v1/reports/heatmap?state=archived"))
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Contains(t, w.Body.String(), "archived")
+	})
+
+	t.Run("failed to get the heat map, database unavailable", func(t *testing.T) {
+		w := httptest.NewRecorder()
+
+		NewRiskHandler(&mockRiskLogic{err: data.Errorf(data.ErrUnavailable, "db down")}).HeatMap(w, newRequest("/v1/reports/heatmap?format=svg"))
+
+		assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+		assert.Equal(t, problemContentType, w.Header().Get("Content-Type"))
+	})
+}
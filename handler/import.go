@@ -0,0 +1,69 @@
+package handler
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime"
+	"net/http"
+	"stan-project/cmd/config"
+	"stan-project/data"
+	"strconv"
+)
+
+const (
+	csvContentType = "text/csv"
+	dryRun         = "dryRun"
+)
+
+// Import creates or updates risks from the rows of a CSV file and responds with what it did with every row. Rows
+// are rejected one by one, the file is only rejected when it cannot be read.
+func (rh *riskHandler) Import(w http.ResponseWriter, r *http.Request) {
+	requestID := r.Context().Value("requestID").(string)
+	slog.Debug("received an import request", "requestID", requestID, "method", r.Method, "url", r.URL)
+	ctx := r.Context()
+
+	contentType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil || contentType != csvContentType {
+		slog.Warn("unsupported import content type", "contentType", r.Header.Get("Content-Type"))
+		respondWithProblem(w, newProblem(r, unsupportedMediaProblemType, fmt.Sprintf("unsupported content type %q, expected %s", r.Header.Get("Content-Type"), csvContentType)))
+		return
+	}
+
+	isDryRun := false
+	if value := r.URL.Query().Get(dryRun); value != "" {
+		isDryRun, err = strconv.ParseBool(value)
+		if err != nil {
+			slog.Warn("error reading the dry run param", "err", err)
+			respondWithError(w, r, &data.ValidationError{Fields: []data.FieldError{
+				{Field: dryRun, Message: fmt.Sprintf("must be true or false but received %q", value)},
+			}}, "")
+			return
+		}
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, config.Global.HTTP.MaxRequestBodyBytes))
+	if err != nil {
+		slog.Warn("error reading import request", "err", err)
+		respondWithError(w, r, decodeError(err, "import request"), "")
+		return
+	}
+
+	rows, err := data.ReadRisksCSV(bytes.NewReader(body))
+	if err != nil {
+		slog.Warn("error reading the imported CSV file", "err", err)
+		respondWithError(w, r, err, "")
+		return
+	}
+
+	report, err := rh.riskLogic.Import(ctx, rows, isDryRun)
+	if err != nil {
+		slog.Error("error importing risks", "err", err)
+		respondWithError(w, r, err, "error importing the risks")
+		return
+	}
+
+	slog.Info("successfully imported rows", "rows", len(rows), "dryRun", isDryRun)
+	respondWithJSON(w, http.StatusOK, report)
+}
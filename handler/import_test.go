@@ -0,0 +1,77 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"stan-project/data"
+	"strings"
+	"testing"
+)
+
+func TestRiskHandler_Import(t *testing.T) {
+	newRequest := func(target, contentType, body string) *http.Request {
+		req := httptest.NewRequest(http.MethodPost, target, strings.NewReader(body))
+		req.Header.Set("Content-Type", contentType)
+		return req.WithContext(context.WithValue(req.Context(), "requestID", uuid.New().String()))
+	}
+
+	t.Run("successfully import risks with a report per row", func(t *testing.T) {
+		ID := uuid.MustParse("c7041e22-15c1-4293-9b43-c54c8dd4b909")
+		expected := data.ImportReport{DryRun: true, Created: 1, Rejected: 1, Rows: []data.ImportRowReport{
+			{Line: 2, ExternalRef: "EXT-1", Status: data.ImportCreated, RiskID: &ID},
+			{Line: 3, Status: data.ImportRejected, Reason: "the row has invalid fields", Errors: []data.FieldError{{Field: "title", Message: "is required"}}},
+		}}
+		h := NewRiskHandler(&mockRiskLogic{importReport: expected})
+		w := httptest.NewRecorder()
+
+		h.Import(w, newRequest("/v1/risks/import?dryRun=true", "text/csv; charset=utf-8", "title,externalRef\nthreat 1,EXT-1\n,\n"))
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		var report data.ImportReport
+		assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &report))
+		assert.Equal(t, expected, report)
+	})
+
+	t.Run("failed to import risks, unsupported content type", func(t *testing.T) {
+		h := NewRiskHandler(&mockRiskLogic{})
+		w := httptest.NewRecorder()
+
+		h.Import(w, newRequest("/v1/risks/import", "application/json", `{"title": "threat 1"}`))
+
+		assert.Equal(t, http.StatusUnsupportedMediaType, w.Code)
+		assert.Contains(t, w.Body.String(), "/problems/unsupported-media-type")
+	})
+
+	t.Run("failed to import risks, invalid dry run", func(t *testing.T) {
+		h := NewRiskHandler(&mockRiskLogic{})
+		w := httptest.NewRecorder()
+
+		h.Import(w, newRequest("/v1/risks/import?dryRun=maybe", "text/csv", "title\nthreat 1\n"))
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Contains(t, w.Body.String(), "dryRun")
+	})
+
+	t.Run("failed to import risks, unknown column", func(t *testing.T) {
+		h := NewRiskHandler(&mockRiskLogic{})
+		w := httptest.NewRecorder()
+
+		h.Import(w, newRequest("/v1/risks/import", "text/csv", "title,priority\nthreat 1,high\n"))
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Contains(t, w.Body.String(), "is not a known column")
+	})
+
+	t.Run("failed to import risks, error importing", func(t *testing.T) {
+		h := NewRiskHandler(&mockRiskLogic{err: data.Errorf(data.ErrUnavailable, "db down")})
+		w := httptest.NewRecorder()
+
+		h.Import(w, newRequest("/v1/risks/import", "text/csv", "title\nthreat 1\n"))
+
+		assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	})
+}
@@ -0,0 +1,93 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"stan-project/data"
+)
+
+const problemContentType = "application/problem+json"
+
+type (
+	// problem is an RFC 7807 problem details response
+	problem struct {
+		Type      string            `json:"type"`
+		Title     string            `json:"title"`
+		Status    int               `json:"status"`
+		Detail    string            `json:"detail,omitempty"`
+		Instance  string            `json:"instance,omitempty"`
+		RequestID string            `json:"requestId,omitempty"`
+		Errors    []data.FieldError `json:"errors,omitempty"`
+	}
+
+	problemType struct {
+		kind   error
+		status int
+		uri    string
+		title  string
+	}
+)
+
+var (
+	problemTypes = []problemType{
+		{kind: data.ErrValidation, status: http.StatusBadRequest, uri: "/problems/validation-error", title: "Your request is not valid"},
+		{kind: data.ErrNotFound, status: http.StatusNotFound, uri: "/problems/not-found", title: "The resource was not found"},
+		{kind: data.ErrConflict, status: http.StatusConflict, uri: "/problems/conflict", title: "The request conflicts with the current state of the resource"},
+		{kind: data.ErrPreconditionFailed, status: http.StatusPreconditionFailed, uri: "/problems/precondition-failed", title: "The resource has changed since you last read it"},
+		{kind: data.ErrIdempotencyKeyReused, status: http.StatusUnprocessableEntity, uri: "/problems/idempotency-key-reused", title: "The idempotency key was used with another request"},
+		{kind: errPreconditionRequired, status: http.StatusPreconditionRequired, uri: "/problems/precondition-required", title: "The request must be conditional"},
+		{kind: data.ErrUnavailable, status: http.StatusServiceUnavailable, uri: "/problems/unavailable", title: "The service is temporarily unavailable"},
+	}
+	internalProblemType         = problemType{status: http.StatusInternalServerError, uri: "/problems/internal-error", title: "Internal server error"}
+	unsupportedMediaProblemType = problemType{status: http.StatusUnsupportedMediaType, uri: "/problems/unsupported-media-type", title: "The content type of the request is not supported"}
+)
+
+// respondWithError responds with the problem matching the kind of the error. The messages of unclassified and
+// unavailable errors are not returned to the client, the given internal message is used instead.
+func respondWithError(w http.ResponseWriter, r *http.Request, err error, internalMessage string) {
+	respondWithProblem(w, errorProblem(r, err, internalMessage))
+}
+
+// errorProblem returns the problem matching the kind of the error, see respondWithError
+func errorProblem(r *http.Request, err error, internalMessage string) problem {
+	pt := internalProblemType
+	for _, t := range problemTypes {
+		if errors.Is(err, t.kind) {
+			pt = t
+			break
+		}
+	}
+
+	detail := err.Error()
+	if pt.status >= http.StatusInternalServerError {
+		detail = internalMessage
+	}
+
+	p := newProblem(r, pt, detail)
+
+	var validationErr *data.ValidationError
+	if errors.As(err, &validationErr) {
+		p.Errors = validationErr.Fields
+	}
+	return p
+}
+
+func newProblem(r *http.Request, pt problemType, detail string) problem {
+	requestID, _ := r.Context().Value("requestID").(string)
+	return problem{
+		Type:      pt.uri,
+		Title:     pt.title,
+		Status:    pt.status,
+		Detail:    detail,
+		Instance:  r.URL.Path,
+		RequestID: requestID,
+	}
+}
+
+func respondWithProblem(w http.ResponseWriter, p problem) {
+	response, _ := json.Marshal(p)
+	w.Header().Set("Content-Type", problemContentType)
+	w.WriteHeader(p.Status)
+	w.Write(response)
+}
@@ -0,0 +1,104 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"stan-project/data"
+	"testing"
+)
+
+func TestRespondWithError(t *testing.T) {
+	tests := []struct {
+		name     string
+		err      error
+		expected problem
+	}{
+		{
+			name: "validation error lists the invalid fields",
+			err:  &data.ValidationError{Fields: []data.FieldError{{Field: "state", Message: "must be one of open, investigating, accepted or closed"}}},
+			expected: problem{
+				Type:      "/problems/validation-error",
+				Title:     "Your request is not valid",
+				Status:    http.StatusBadRequest,
+				Detail:    "state: must be one of open, investigating, accepted or closed",
+				Instance:  "/v1/risks",
+				RequestID: "c9b1a1e2-2f7e-4b7f-9c1e-5d1f3c0a8e11",
+				Errors:    []data.FieldError{{Field: "state", Message: "must be one of open, investigating, accepted or closed"}},
+			},
+		},
+		{
+			name: "wrapped not found error",
+			err:  fmt.Errorf("fetching risk: %w", data.Errorf(data.ErrNotFound, "risk with ID: 1 not found")),
+			expected: problem{
+				Type:      "/problems/not-found",
+				Title:     "The resource was not found",
+				Status:    http.StatusNotFound,
+				Detail:    "fetching risk: risk with ID: 1 not found",
+				Instance:  "/v1/risks",
+				RequestID: "c9b1a1e2-2f7e-4b7f-9c1e-5d1f3c0a8e11",
+			},
+		},
+		{
+			name: "conflict error",
+			err:  fmt.Errorf("%w: a risk cannot move from open to accepted", data.ErrInvalidTransition),
+			expected: problem{
+				Type:      "/problems/conflict",
+				Title:     "The request conflicts with the current state of the resource",
+				Status:    http.StatusConflict,
+				Detail:    "invalid state transition: a risk cannot move from open to accepted",
+				Instance:  "/v1/risks",
+				RequestID: "c9b1a1e2-2f7e-4b7f-9c1e-5d1f3c0a8e11",
+			},
+		},
+		{
+			name: "unavailable error does not leak the cause",
+			err:  data.Errorf(data.ErrUnavailable, "database unavailable: dial tcp 10.0.0.1:5432"),
+			expected: problem{
+				Type:      "/problems/unavailable",
+				Title:     "The service is temporarily unavailable",
+				Status:    http.StatusServiceUnavailable,
+				Detail:    "error fetching risks",
+				Instance:  "/v1/risks",
+				RequestID: "c9b1a1e2-2f7e-4b7f-9c1e-5d1f3c0a8e11",
+			},
+		},
+		{
+			name: "unclassified error does not leak the cause",
+			err:  errors.New("pq: column does not exist"),
+			expected: problem{
+				Type:      "/problems/internal-error",
+				Title:     "Internal server error",
+				Status:    http.StatusInternalServerError,
+				Detail:    "error fetching risks",
+				Instance:  "/v1/risks",
+				RequestID: "c9b1a1e2-2f7e-4b7f-9c1e-5d1f3c0a8e11",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/v1/risks", nil)
+			req = req.WithContext(context.WithValue(req.Context(), "requestID", "c9b1a1e2-2f7e-4b7f-9c1e-5d1f3c0a8e11"))
+
+			w := httptest.NewRecorder()
+
+			respondWithError(w, req, tt.err, "error fetching risks")
+
+			assert.Equal(t, tt.expected.Status, w.Code)
+			assert.Equal(t, problemContentType, w.Header().Get("Content-Type"))
+
+			var resp problem
+			err := json.Unmarshal(w.Body.Bytes(), &resp)
+			if err != nil {
+				t.Fatalf("error decoding response: %s", err)
+			}
+			assert.Equal(t, tt.expected, resp)
+		})
+	}
+}
@@ -1,32 +1,83 @@
 package handler
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	jsonpatch "github.com/evanphx/json-patch/v5"
 	"github.com/google/uuid"
 	"github.com/gorilla/mux"
-	"log"
+	"io"
+	"log/slog"
 	"net/http"
+	"slices"
+	"stan-project/cmd/config"
 	"stan-project/data"
 	"strconv"
+	"strings"
+	"time"
 )
 
 const (
 	offset    = "offset"
 	limit     = "limit"
+	sort      = "sort"
 	sortBy    = "sortBy"
 	sortOrder = "sortOrder"
-	title     = "title"
-	asc       = "asc"
 	desc      = "desc"
+	after     = "after"
+	count     = "count"
+	q         = "q"
+
+	state         = "state"
+	title         = "title"
+	description   = "description"
+	createdAfter  = "createdAfter"
+	createdBefore = "createdBefore"
+	createdBy     = "createdBy"
+	updatedAfter  = "updatedAfter"
+	updatedBefore = "updatedBefore"
+	updatedBy     = "updatedBy"
+	severity      = "severity"
+	minScore      = "minScore"
+	maxScore      = "maxScore"
+	owner         = "owner"
+	assignee      = "assignee"
+	tag           = "tag"
+	// mine lists the risks the caller owns or is assigned to
+	mine = "mine"
+
+	mergePatchContentType = "application/merge-patch+json"
+	jsonPatchContentType  = "application/json-patch+json"
+
+	// idempotencyKeyHeader makes the creation of a risk safe to retry, the replayed header tells a retry was replayed
+	idempotencyKeyHeader     = "Idempotency-Key"
+	idempotentReplayedHeader = "Idempotent-Replayed"
+	idempotencyKeyMaxLength  = 255
 )
 
 type (
 	riskLogic interface {
 		Add(ctx context.Context, risk data.Risk) (data.Risk, error)
+		AddIdempotent(ctx context.Context, key string, risk data.Risk) (data.Risk, bool, error)
 		GetByID(ctx context.Context, ID uuid.UUID) (data.Risk, error)
 		GetAll(ctx context.Context, options data.Options) (data.PaginatedResponse, error)
+		Export(ctx context.Context, options data.Options, write func(risk data.Risk) error) error
+		HeatMap(ctx context.Context, options data.HeatMapOptions) (data.HeatMap, error)
+		Search(ctx context.Context, query string, options data.Options) (data.SearchResponse, error)
+		Update(ctx context.Context, risk data.Risk, precondition data.Precondition) (data.Risk, error)
+		Transition(ctx context.Context, ID uuid.UUID, transition data.TransitionRequest, precondition data.Precondition) (data.Risk, error)
+		Assign(ctx context.Context, ID uuid.UUID, assignment data.AssignmentRequest, precondition data.Precondition) (data.Risk, error)
+		GetTransitions(ctx context.Context, ID uuid.UUID) ([]data.Transition, error)
+		Delete(ctx context.Context, ID uuid.UUID, precondition data.Precondition) error
+		GetDeleted(ctx context.Context, options data.Options) (data.PaginatedResponse, error)
+		Restore(ctx context.Context, ID uuid.UUID) (data.Risk, error)
+		PurgeDeleted(ctx context.Context) (int64, error)
+		History(ctx context.Context, ID uuid.UUID) ([]data.HistoryEntry, error)
+		Batch(ctx context.Context, request data.BatchRequest) ([]data.BatchResult, error)
+		Import(ctx context.Context, rows []data.ImportRow, dryRun bool) (data.ImportReport, error)
 	}
 
 	riskHandler struct {
@@ -41,104 +92,768 @@ func NewRiskHandler(riskLogic riskLogic) *riskHandler {
 func (rh *riskHandler) Add(w http.ResponseWriter, r *http.Request) {
 
 	requestID := r.Context().Value("requestID").(string)
-	log.Printf("received a request to create a new risk with requestID: %s, req: %v", requestID, r)
+	slog.Debug("received a request to create a new risk", "requestID", requestID, "method", r.Method, "url", r.URL)
 
 	ctx := r.Context()
-	risk, err := decodeReq(r)
+	key, err := getIdempotencyKey(r)
+	if err != nil {
+		slog.Warn("invalid idempotency key", "err", err)
+		respondWithError(w, r, err, "")
+		return
+	}
+
+	risk, err := decodeReq(w, r)
 	if err != nil {
-		log.Printf("error unmarshallling risk request: %s", err)
-		respondWithJSON(w, http.StatusBadRequest, map[string]string{"error": "error decoding risk request"})
+		slog.Warn("error unmarshallling risk request", "err", err)
+		respondWithError(w, r, err, "")
 		return
 	}
 
-	risk, err = rh.riskLogic.Add(ctx, risk)
+	replayed := false
+	if key == "" {
+		risk, err = rh.riskLogic.Add(ctx, risk)
+	} else {
+		risk, replayed, err = rh.riskLogic.AddIdempotent(ctx, key, risk)
+	}
 	if err != nil {
-		log.Printf("error adding risk: %s", err)
-		respondWithJSON(w, http.StatusInternalServerError, map[string]string{"error": "error processing the risk add request"})
+		slog.Error("error adding risk", "err", err)
+		respondWithError(w, r, err, "error processing the risk add request")
 		return
 	}
 
-	log.Printf("successfully added a new risk with ID: %s", risk.ID)
-	respondWithJSON(w, http.StatusCreated, risk)
+	if replayed {
+		slog.Info("replayed the risk added with idempotency key", "id", risk.ID, "key", key)
+		w.Header().Set(idempotentReplayedHeader, "true")
+	}
+
+	slog.Info("successfully added a new risk", "id", risk.ID)
+	respondWithRisk(w, http.StatusCreated, risk)
 }
 
 func (rh *riskHandler) GetByID(w http.ResponseWriter, r *http.Request) {
 	requestID := r.Context().Value("requestID").(string)
-	log.Printf("received a request to fetch a risk with requestID: %s, req: %v", requestID, r)
+	slog.Debug("received a request to fetch a risk", "requestID", requestID, "method", r.Method, "url", r.URL)
 	ctx := r.Context()
 
-	ID := mux.Vars(r)["id"]
-
-	log.Printf("received riskID: %s", ID)
-
-	riskID, err := uuid.Parse(ID)
+	riskID, err := getRiskID(r)
 	if err != nil {
-		log.Printf("invalid riskID: %s", ID)
-		respondWithJSON(w, http.StatusBadRequest, map[string]string{"error": fmt.Errorf("invalid riskID, expected a UUID but received: %s", ID).Error()})
+		slog.Warn("error reading riskID", "err", err)
+		respondWithError(w, r, err, "")
 		return
 	}
 
+	slog.Debug("received riskID", "id", riskID)
+
 	risk, err := rh.riskLogic.GetByID(ctx, riskID)
 	if err != nil {
-		log.Printf("error fetching risk with ID: %s", err)
-		respondWithJSON(w, http.StatusInternalServerError, map[string]string{"error": fmt.Errorf("error fetching risk with ID: %s", riskID).Error()})
+		slog.Error("error fetching risk", "id", riskID, "err", err)
+		respondWithError(w, r, err, fmt.Sprintf("error fetching risk with ID: %s", riskID))
+		return
+	}
+
+	if notModified(r, risk) {
+		slog.Debug("risk is not modified", "id", riskID)
+		w.Header().Set(etagHeader, etag(risk))
+		w.WriteHeader(http.StatusNotModified)
+		return
 	}
 
-	log.Printf("successfully fetched risk with ID: %s, risk: %v", riskID, risk)
-	respondWithJSON(w, http.StatusOK, risk)
+	slog.Debug("successfully fetched risk", "id", riskID, "risk", risk)
+	respondWithRisk(w, http.StatusOK, risk)
 }
 
 func (rh *riskHandler) GetAll(w http.ResponseWriter, r *http.Request) {
 	requestID := r.Context().Value("requestID").(string)
-	log.Printf("received a request to fetch all risks with requestID: %s, req: %v", requestID, r)
+	slog.Debug("received a request to fetch all risks", "requestID", requestID, "method", r.Method, "url", r.URL)
+	ctx := r.Context()
+
+	options := getPaginationOptions(r)
+
+	keys, err := data.ParseSort(getSortParam(r))
+	if err != nil {
+		slog.Warn("invalid sort options", "err", err)
+		respondWithError(w, r, err, "")
+		return
+	}
+	options.Sort = keys
+
+	filter, err := getFilter(r)
+	if err != nil {
+		slog.Warn("invalid filter options", "err", err)
+		respondWithError(w, r, err, "")
+		return
+	}
+	options.Filter = filter
+
+	options.Count, err = data.ParseCountMode(getQueryParam(count, r))
+	if err != nil {
+		slog.Warn("invalid count option", "err", err)
+		respondWithError(w, r, err, "")
+		return
+	}
+
+	if afterVal := getQueryParam(after, r); afterVal != "" {
+		options.After, err = data.ParseCursor(afterVal)
+		if err != nil {
+			slog.Warn("invalid cursor", "err", err)
+			respondWithError(w, r, err, "")
+			return
+		}
+	}
+
+	slog.Debug("fetching risks", "options", options)
+
+	risks, err := rh.riskLogic.GetAll(ctx, options)
+	if err != nil {
+		slog.Error("error fetching all risks", "err", err)
+		respondWithError(w, r, err, "error fetching risks")
+		return
+	}
+
+	slog.Debug("successfully fetched all risks", "risks", risks)
+	respondWithJSON(w, http.StatusOK, risks)
+}
+
+func (rh *riskHandler) Search(w http.ResponseWriter, r *http.Request) {
+	requestID := r.Context().Value("requestID").(string)
+	slog.Debug("received a request to search risks", "requestID", requestID, "method", r.Method, "url", r.URL)
+	ctx := r.Context()
+
+	options := getPaginationOptions(r)
+
+	filter, err := getFilter(r)
+	if err != nil {
+		slog.Warn("invalid filter options", "err", err)
+		respondWithError(w, r, err, "")
+		return
+	}
+	options.Filter = filter
+
+	options.Count, err = data.ParseCountMode(getQueryParam(count, r))
+	if err != nil {
+		slog.Warn("invalid count option", "err", err)
+		respondWithError(w, r, err, "")
+		return
+	}
+
+	if afterVal := getQueryParam(after, r); afterVal != "" {
+		options.After, err = data.ParseCursor(afterVal)
+		if err != nil {
+			slog.Warn("invalid cursor", "err", err)
+			respondWithError(w, r, err, "")
+			return
+		}
+	}
+
+	query := getQueryParam(q, r)
+	results, err := rh.riskLogic.Search(ctx, query, options)
+	if err != nil {
+		slog.Error("error searching risks", "query", query, "err", err)
+		respondWithError(w, r, err, "error searching risks")
+		return
+	}
+
+	slog.Debug("successfully searched risks", "query", query, "found", len(results.Risks))
+	respondWithJSON(w, http.StatusOK, results)
+}
+
+func (rh *riskHandler) Delete(w http.ResponseWriter, r *http.Request) {
+	requestID := r.Context().Value("requestID").(string)
+	slog.Debug("received a request to delete a risk", "requestID", requestID, "method", r.Method, "url", r.URL)
+	ctx := r.Context()
+
+	riskID, err := getRiskID(r)
+	if err != nil {
+		slog.Warn("error reading riskID", "err", err)
+		respondWithError(w, r, err, "")
+		return
+	}
+
+	precondition, err := getPrecondition(r)
+	if err != nil {
+		slog.Warn("error reading the precondition", "err", err)
+		respondWithError(w, r, err, "")
+		return
+	}
+
+	err = rh.riskLogic.Delete(ctx, riskID, precondition)
+	if err != nil {
+		slog.Error("error deleting risk", "id", riskID, "err", err)
+		respondWithError(w, r, err, fmt.Sprintf("error deleting risk with ID: %s", riskID))
+		return
+	}
+
+	slog.Info("successfully moved risk to the trash", "id", riskID)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (rh *riskHandler) GetDeleted(w http.ResponseWriter, r *http.Request) {
+	requestID := r.Context().Value("requestID").(string)
+	slog.Debug("received a request to fetch deleted risks", "requestID", requestID, "method", r.Method, "url", r.URL)
+	ctx := r.Context()
+
+	risks, err := rh.riskLogic.GetDeleted(ctx, getPaginationOptions(r))
+	if err != nil {
+		slog.Error("error fetching deleted risks", "err", err)
+		respondWithError(w, r, err, "error fetching deleted risks")
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, risks)
+}
+
+func (rh *riskHandler) Restore(w http.ResponseWriter, r *http.Request) {
+	requestID := r.Context().Value("requestID").(string)
+	slog.Debug("received a request to restore a risk", "requestID", requestID, "method", r.Method, "url", r.URL)
+	ctx := r.Context()
+
+	riskID, err := getRiskID(r)
+	if err != nil {
+		slog.Warn("error reading riskID", "err", err)
+		respondWithError(w, r, err, "")
+		return
+	}
+
+	risk, err := rh.riskLogic.Restore(ctx, riskID)
+	if err != nil {
+		slog.Error("error restoring risk", "id", riskID, "err", err)
+		respondWithError(w, r, err, fmt.Sprintf("error restoring risk with ID: %s", riskID))
+		return
+	}
+
+	slog.Info("successfully restored risk", "id", riskID)
+	respondWithRisk(w, http.StatusOK, risk)
+}
+
+func (rh *riskHandler) PurgeDeleted(w http.ResponseWriter, r *http.Request) {
+	requestID := r.Context().Value("requestID").(string)
+	slog.Debug("received a request to purge deleted risks", "requestID", requestID, "method", r.Method, "url", r.URL)
+	ctx := r.Context()
+
+	purged, err := rh.riskLogic.PurgeDeleted(ctx)
+	if err != nil {
+		slog.Error("error purging deleted risks", "err", err)
+		respondWithError(w, r, err, "error purging deleted risks")
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, map[string]int64{"purged": purged})
+}
+
+func (rh *riskHandler) Update(w http.ResponseWriter, r *http.Request) {
+	requestID := r.Context().Value("requestID").(string)
+	slog.Debug("received a request to update a risk", "requestID", requestID, "method", r.Method, "url", r.URL)
+
+	riskID, err := getRiskID(r)
+	if err != nil {
+		slog.Warn("error reading riskID", "err", err)
+		respondWithError(w, r, err, "")
+		return
+	}
+
+	precondition, err := getPrecondition(r)
+	if err != nil {
+		slog.Warn("error reading the precondition", "err", err)
+		respondWithError(w, r, err, "")
+		return
+	}
+
+	risk, err := decodeReq(w, r)
+	if err != nil {
+		slog.Warn("error unmarshallling risk request", "err", err)
+		respondWithError(w, r, err, "")
+		return
+	}
+	risk.ID = riskID
+
+	rh.update(w, r, risk, precondition)
+}
+
+func (rh *riskHandler) Patch(w http.ResponseWriter, r *http.Request) {
+	requestID := r.Context().Value("requestID").(string)
+	slog.Debug("received a request to patch a risk", "requestID", requestID, "method", r.Method, "url", r.URL)
+	ctx := r.Context()
+
+	riskID, err := getRiskID(r)
+	if err != nil {
+		slog.Warn("error reading riskID", "err", err)
+		respondWithError(w, r, err, "")
+		return
+	}
+
+	precondition, err := getPrecondition(r)
+	if err != nil {
+		slog.Warn("error reading the precondition", "err", err)
+		respondWithError(w, r, err, "")
+		return
+	}
+
+	contentType := r.Header.Get("Content-Type")
+	if contentType != mergePatchContentType && contentType != jsonPatchContentType {
+		slog.Warn("unsupported patch content type", "contentType", contentType)
+		respondWithProblem(w, newProblem(r, unsupportedMediaProblemType, fmt.Sprintf("unsupported content type %q, expected %s or %s", contentType, mergePatchContentType, jsonPatchContentType)))
+		return
+	}
+
+	patch, err := io.ReadAll(http.MaxBytesReader(w, r.Body, config.Global.HTTP.MaxRequestBodyBytes))
+	if err != nil {
+		slog.Warn("error reading patch request", "err", err)
+		respondWithError(w, r, decodeError(err, "patch request"), "")
+		return
+	}
+
+	current, err := rh.riskLogic.GetByID(ctx, riskID)
+	if err != nil {
+		slog.Error("error fetching risk", "id", riskID, "err", err)
+		respondWithError(w, r, err, fmt.Sprintf("error fetching risk with ID: %s", riskID))
+		return
+	}
+
+	risk, err := applyPatch(current, contentType, patch)
+	if err == nil {
+		err = checkReadOnlyFields(current, risk)
+	}
+	if err != nil {
+		slog.Error("error applying patch to risk", "id", riskID, "err", err)
+		respondWithError(w, r, err, "")
+		return
+	}
+
+	// the patched risk keeps the version it was patched from, so that it is not written over a newer version
+	rh.update(w, r, risk, precondition)
+}
+
+func (rh *riskHandler) update(w http.ResponseWriter, r *http.Request, risk data.Risk, precondition data.Precondition) {
+	updated, err := rh.riskLogic.Update(r.Context(), risk, precondition)
+	if errors.Is(err, data.ErrReasonRequired) {
+		err = fmt.Errorf("%w, use the transitions endpoint to provide one", err)
+	}
+	if err != nil {
+		slog.Error("error updating risk", "err", err)
+		respondWithError(w, r, err, "error processing the risk update request")
+		return
+	}
+
+	slog.Info("successfully updated risk", "id", updated.ID)
+	respondWithRisk(w, http.StatusOK, updated)
+}
+
+func (rh *riskHandler) Transition(w http.ResponseWriter, r *http.Request) {
+	requestID := r.Context().Value("requestID").(string)
+	slog.Debug("received a request to transition a risk", "requestID", requestID, "method", r.Method, "url", r.URL)
+	ctx := r.Context()
+
+	riskID, err := getRiskID(r)
+	if err != nil {
+		slog.Warn("error reading riskID", "err", err)
+		respondWithError(w, r, err, "")
+		return
+	}
+
+	precondition, err := getPrecondition(r)
+	if err != nil {
+		slog.Warn("error reading the precondition", "err", err)
+		respondWithError(w, r, err, "")
+		return
+	}
+
+	var transition data.TransitionRequest
+	err = decodeJSON(w, r, &transition, "transition request")
+	if err != nil {
+		slog.Warn("error unmarshallling transition request", "err", err)
+		respondWithError(w, r, err, "")
+		return
+	}
+
+	risk, err := rh.riskLogic.Transition(ctx, riskID, transition, precondition)
+	if err != nil {
+		slog.Error("error transitioning risk", "err", err)
+		respondWithError(w, r, err, "error processing the risk transition request")
+		return
+	}
+
+	slog.Info("successfully moved risk", "id", riskID, "state", risk.State)
+	respondWithRisk(w, http.StatusOK, risk)
+}
+
+// Assign changes the owner or the assignee of a risk, the fields left out of the request are not changed
+func (rh *riskHandler) Assign(w http.ResponseWriter, r *http.Request) {
+	requestID := r.Context().Value("requestID").(string)
+	slog.Debug("received a request to assign a risk", "requestID", requestID, "method", r.Method, "url", r.URL)
 	ctx := r.Context()
 
-	var options data.Options
-	options.SortBy = title
-	options.SortOrder = asc
+	riskID, err := getRiskID(r)
+	if err != nil {
+		slog.Warn("error reading riskID", "err", err)
+		respondWithError(w, r, err, "")
+		return
+	}
+
+	precondition, err := getPrecondition(r)
+	if err != nil {
+		slog.Warn("error reading the precondition", "err", err)
+		respondWithError(w, r, err, "")
+		return
+	}
+
+	var assignment data.AssignmentRequest
+	err = decodeJSON(w, r, &assignment, "assignment request")
+	if err != nil {
+		slog.Warn("error unmarshallling assignment request", "err", err)
+		respondWithError(w, r, err, "")
+		return
+	}
+
+	risk, err := rh.riskLogic.Assign(ctx, riskID, assignment, precondition)
+	if err != nil {
+		slog.Error("error assigning risk", "err", err)
+		respondWithError(w, r, err, "error processing the risk assignment request")
+		return
+	}
+
+	slog.Info("successfully assigned risk", "id", riskID, "owner", risk.Owner, "assignee", risk.Assignee)
+	respondWithRisk(w, http.StatusOK, risk)
+}
+
+func (rh *riskHandler) GetTransitions(w http.ResponseWriter, r *http.Request) {
+	requestID := r.Context().Value("requestID").(string)
+	slog.Debug("received a request to fetch the transitions of a risk", "requestID", requestID, "method", r.Method, "url", r.URL)
+	ctx := r.Context()
+
+	riskID, err := getRiskID(r)
+	if err != nil {
+		slog.Warn("error reading riskID", "err", err)
+		respondWithError(w, r, err, "")
+		return
+	}
+
+	transitions, err := rh.riskLogic.GetTransitions(ctx, riskID)
+	if err != nil {
+		slog.Error("error fetching transitions for risk", "id", riskID, "err", err)
+		respondWithError(w, r, err, fmt.Sprintf("error fetching transitions for risk with ID: %s", riskID))
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, transitions)
+}
+
+func (rh *riskHandler) History(w http.ResponseWriter, r *http.Request) {
+	requestID := r.Context().Value("requestID").(string)
+	slog.Debug("received a request to fetch the history of a risk", "requestID", requestID, "method", r.Method, "url", r.URL)
+	ctx := r.Context()
 
+	riskID, err := getRiskID(r)
+	if err != nil {
+		slog.Warn("error reading riskID", "err", err)
+		respondWithError(w, r, err, "")
+		return
+	}
+
+	history, err := rh.riskLogic.History(ctx, riskID)
+	if err != nil {
+		slog.Error("error fetching the history of risk", "id", riskID, "err", err)
+		respondWithError(w, r, err, fmt.Sprintf("error fetching the history of risk with ID: %s", riskID))
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, history)
+}
+
+// applyPatch applies a JSON Merge Patch (RFC 7396) or a JSON Patch (RFC 6902) document to the given risk
+func applyPatch(risk data.Risk, contentType string, patch []byte) (data.Risk, error) {
+	original, err := json.Marshal(risk)
+	if err != nil {
+		return data.Risk{}, err
+	}
+
+	var patched []byte
+	switch contentType {
+	case mergePatchContentType:
+		patched, err = jsonpatch.MergePatch(original, patch)
+	case jsonPatchContentType:
+		var p jsonpatch.Patch
+		p, err = jsonpatch.DecodePatch(patch)
+		if err == nil {
+			patched, err = p.Apply(original)
+		}
+	default:
+		err = fmt.Errorf("unsupported patch content type: %s", contentType)
+	}
+	if err != nil {
+		return data.Risk{}, data.Errorf(data.ErrValidation, "error applying patch: %w", err)
+	}
+
+	var result data.Risk
+	decoder := json.NewDecoder(bytes.NewReader(patched))
+	decoder.DisallowUnknownFields()
+	err = decoder.Decode(&result)
+	if err != nil {
+		return data.Risk{}, decodeError(err, "patched risk")
+	}
+	return result, nil
+}
+
+// getIdempotencyKey reads the optional Idempotency-Key header, it is empty when the header is not sent
+func getIdempotencyKey(r *http.Request) (string, error) {
+	key := strings.TrimSpace(r.Header.Get(idempotencyKeyHeader))
+	if len(key) > idempotencyKeyMaxLength {
+		return "", &data.ValidationError{Fields: []data.FieldError{
+			{Field: idempotencyKeyHeader, Message: fmt.Sprintf("must be at most %d bytes but has %d", idempotencyKeyMaxLength, len(key))},
+		}}
+	}
+	return key, nil
+}
+
+func getRiskID(r *http.Request) (uuid.UUID, error) {
+	ID := mux.Vars(r)["id"]
+	riskID, err := uuid.Parse(ID)
+	if err != nil {
+		return uuid.Nil, data.Errorf(data.ErrValidation, "invalid riskID, expected a UUID but received: %s", ID)
+	}
+	return riskID, nil
+}
+
+// getPaginationOptions reads the offset and limit query params, falling back to the defaults when they are invalid
+func getPaginationOptions(r *http.Request) data.Options {
 	offsetOpt := getQueryParam(offset, r)
 	offsetVal, err := strconv.Atoi(offsetOpt)
 	if err != nil {
-		log.Printf("invalid offset in request options so setting it to 0, err: %s", err)
+		slog.Warn("invalid offset in request options so setting it to 0", "err", err)
 		offsetVal = 0
 	}
 	limitOpt := getQueryParam(limit, r)
 	limitVal, err := strconv.Atoi(limitOpt)
 	if err != nil {
-		log.Printf("invalid limit option, setting to default value 5, err: %s", err)
+		slog.Warn("invalid limit option, setting to default value 10", "err", err)
 		limitVal = 10
 	}
+	return data.Options{Offset: offsetVal, Limit: limitVal}
+}
+
+// getSortParam reads the sort query param, falling back to the sortBy and sortOrder params still used by older clients
+func getSortParam(r *http.Request) string {
+	if sortVal := getQueryParam(sort, r); sortVal != "" {
+		return sortVal
+	}
 	sortByVal := getQueryParam(sortBy, r)
-	sortOrderVal := getQueryParam(sortOrder, r)
+	if sortByVal != "" && getQueryParam(sortOrder, r) == desc {
+		return "-" + sortByVal
+	}
+	return sortByVal
+}
+
+// getFilter reads the filter query params. States and tags can be given as a comma separated list, the param can also
+// be repeated, and the risks must have every tag.
+// Dates are either RFC 3339 timestamps or plain dates, which are read as midnight UTC. The risks of the caller are the
+// ones they own or are assigned to, the caller is the actor of the request.
+func getFilter(r *http.Request) (data.Filter, error) {
+	query := r.URL.Query()
+	filter := data.Filter{
+		Title:       strings.TrimSpace(query.Get(title)),
+		Description: strings.TrimSpace(query.Get(description)),
+		Owner:       strings.TrimSpace(query.Get(owner)),
+		Assignee:    strings.TrimSpace(query.Get(assignee)),
+		CreatedBy:   strings.TrimSpace(query.Get(createdBy)),
+		UpdatedBy:   strings.TrimSpace(query.Get(updatedBy)),
+	}
 
-	options.Offset = offsetVal
-	options.Limit = limitVal
-	if sortByVal != "" {
-		options.SortBy = sortByVal
+	var fields []data.FieldError
+	if value := query.Get(mine); value != "" {
+		onlyMine, err := strconv.ParseBool(value)
+		actor := data.AuditFrom(r.Context()).Actor
+		switch {
+		case err != nil:
+			fields = append(fields, data.FieldError{Field: mine, Message: fmt.Sprintf("must be true or false but received %q", value)})
+		case onlyMine && (actor == "" || actor == anonymousActor):
+			fields = append(fields, data.FieldError{Field: mine, Message: fmt.Sprintf("requires an authenticated caller, send the %s header", actorHeader)})
+		case onlyMine:
+			filter.Involving = actor
+		}
 	}
-	if sortOrderVal == desc {
-		options.SortOrder = desc
+	for _, value := range query[state] {
+		for _, s := range strings.Split(value, ",") {
+			s = strings.TrimSpace(s)
+			if s == "" {
+				continue
+			}
+			if !data.State(s).IsValid() {
+				fields = append(fields, data.FieldError{
+					Field:   state,
+					Message: fmt.Sprintf("must be one of %s, %s, %s or %s but received %q", data.StateOpen, data.StateInvestigating, data.StateAccepted, data.StateClosed, s),
+				})
+				continue
+			}
+			filter.States = append(filter.States, data.State(s))
+		}
 	}
 
-	log.Printf("fetching risks with options: %v", options)
+	for _, value := range query[tag] {
+		for _, t := range strings.Split(value, ",") {
+			if t = strings.TrimSpace(t); t != "" && !slices.Contains(filter.Tags, t) {
+				filter.Tags = append(filter.Tags, t)
+			}
+		}
+	}
 
-	risks, err := rh.riskLogic.GetAll(ctx, options)
+	dates := []struct {
+		param  string
+		target **time.Time
+	}{
+		{createdAfter, &filter.CreatedAfter},
+		{createdBefore, &filter.CreatedBefore},
+		{updatedAfter, &filter.UpdatedAfter},
+		{updatedBefore, &filter.UpdatedBefore},
+	}
+	for _, d := range dates {
+		value := query.Get(d.param)
+		if value == "" {
+			continue
+		}
+		t, err := parseTime(value)
+		if err != nil {
+			fields = append(fields, data.FieldError{
+				Field:   d.param,
+				Message: fmt.Sprintf("must be an RFC 3339 timestamp or a date like 2006-01-02 but received %q", value),
+			})
+			continue
+		}
+		*d.target = &t
+	}
+
+	for _, value := range query[severity] {
+		for _, s := range strings.Split(value, ",") {
+			s = strings.TrimSpace(s)
+			if s == "" {
+				continue
+			}
+			if !data.Severity(s).IsValid() {
+				fields = append(fields, data.FieldError{
+					Field:   severity,
+					Message: fmt.Sprintf("must be one of %s, %s, %s or %s but received %q", data.SeverityLow, data.SeverityMedium, data.SeverityHigh, data.SeverityCritical, s),
+				})
+				continue
+			}
+			filter.Severities = append(filter.Severities, data.Severity(s))
+		}
+	}
+
+	scores := []struct {
+		param  string
+		target *int
+	}{
+		{minScore, &filter.MinScore},
+		{maxScore, &filter.MaxScore},
+	}
+	for _, s := range scores {
+		value := query.Get(s.param)
+		if value == "" {
+			continue
+		}
+		score, err := strconv.Atoi(value)
+		if err != nil || score < 1 {
+			fields = append(fields, data.FieldError{
+				Field:   s.param,
+				Message: fmt.Sprintf("must be a positive whole number but received %q", value),
+			})
+			continue
+		}
+		*s.target = score
+	}
+
+	if len(fields) > 0 {
+		return data.Filter{}, &data.ValidationError{Fields: fields}
+	}
+	return filter, nil
+}
+
+func parseTime(value string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	return time.Parse(time.DateOnly, value)
+}
+
+// decodeJSON strictly decodes the request body into v, rejecting unknown fields and bodies larger than the configured limit
+func decodeJSON(w http.ResponseWriter, r *http.Request, v any, request string) error {
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, config.Global.HTTP.MaxRequestBodyBytes))
+	decoder.DisallowUnknownFields()
+	err := decoder.Decode(v)
 	if err != nil {
-		log.Printf("error fetchiing all risks, %s", err)
-		respondWithJSON(w, http.StatusInternalServerError, map[string]string{"error": "error fetching risks"})
-		return
+		return decodeError(err, request)
+	}
+	if decoder.More() {
+		return data.Errorf(data.ErrValidation, "%s must contain a single JSON value", request)
 	}
+	return nil
+}
 
-	log.Printf("successfully fetched all risks: %v", risks)
-	respondWithJSON(w, http.StatusOK, risks)
+// decodeError converts a JSON decoding error into a validation error, naming the offending field when possible
+func decodeError(err error, request string) error {
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(err, &typeErr) && typeErr.Field != "" {
+		return &data.ValidationError{Fields: []data.FieldError{
+			{Field: typeErr.Field, Message: fmt.Sprintf("must be a %s but received a %s", typeErr.Type.Kind(), typeErr.Value)},
+		}}
+	}
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) {
+		return data.Errorf(data.ErrValidation, "%s must not be larger than %d bytes", request, maxBytesErr.Limit)
+	}
+	// the json package has no typed error for unknown fields
+	if field, ok := strings.CutPrefix(err.Error(), "json: unknown field "); ok {
+		if unquoted, unquoteErr := strconv.Unquote(field); unquoteErr == nil {
+			field = unquoted
+		}
+		return &data.ValidationError{Fields: []data.FieldError{{Field: field, Message: "is not a known field"}}}
+	}
+	return data.Errorf(data.ErrValidation, "error decoding %s: %s", request, err)
+}
+
+// checkReadOnlyFields rejects requests that try to set or change the fields managed by the service
+func checkReadOnlyFields(current, requested data.Risk) error {
+	var fields []data.FieldError
+	if requested.ID != current.ID {
+		fields = append(fields, data.FieldError{Field: "id", Message: "is read-only"})
+	}
+	if !requested.CreatedAt.Equal(current.CreatedAt) {
+		fields = append(fields, data.FieldError{Field: "createdAt", Message: "is read-only"})
+	}
+	if !requested.UpdatedAt.Equal(current.UpdatedAt) {
+		fields = append(fields, data.FieldError{Field: "updatedAt", Message: "is read-only"})
+	}
+	if requested.CreatedBy != current.CreatedBy {
+		fields = append(fields, data.FieldError{Field: "createdBy", Message: "is read-only"})
+	}
+	if requested.UpdatedBy != current.UpdatedBy {
+		fields = append(fields, data.FieldError{Field: "updatedBy", Message: "is read-only"})
+	}
+	if requested.DeletedAt != nil {
+		fields = append(fields, data.FieldError{Field: "deletedAt", Message: "is read-only"})
+	}
+	if requested.Version != current.Version {
+		fields = append(fields, data.FieldError{Field: "version", Message: "is read-only"})
+	}
+	// the scores and severity are computed from the ratings
+	if requested.InherentScore != current.InherentScore {
+		fields = append(fields, data.FieldError{Field: "inherentScore", Message: "is read-only"})
+	}
+	if requested.ResidualScore != current.ResidualScore {
+		fields = append(fields, data.FieldError{Field: "residualScore", Message: "is read-only"})
+	}
+	if requested.Severity != current.Severity {
+		fields = append(fields, data.FieldError{Field: "severity", Message: "is read-only"})
+	}
+	if len(fields) > 0 {
+		return &data.ValidationError{Fields: fields}
+	}
+	return nil
 }
 
-func decodeReq(req *http.Request) (data.Risk, error) {
+func decodeReq(w http.ResponseWriter, r *http.Request) (data.Risk, error) {
 	var risk data.Risk
-	err := json.NewDecoder(req.Body).Decode(&risk)
+	err := decodeJSON(w, r, &risk, "risk request")
 	if err != nil {
-		return risk, err
+		return data.Risk{}, err
 	}
-	return risk, err
+	return risk, checkReadOnlyFields(data.Risk{}, risk)
 }
@@ -12,7 +12,9 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"stan-project/data"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestNewRiskHandler(t *testing.T) {
@@ -68,6 +70,47 @@ func TestRiskHandler_Add(t *testing.T) {
 		assert.Equal(t, expected, resp)
 	})
 
+	t.Run("successfully replay a risk added with the same idempotency key", func(t *testing.T) {
+		h := NewRiskHandler(&mockRiskLogic{risk: data.Risk{ID: uuid.MustParse("c7041e22-15c1-4293-9b43-c54c8dd4b909"), Version: 1}, replayed: true})
+
+		req := httptest.NewRequest(http.MethodPost, "/v1/risks", bytes.NewBuffer(getTestData()))
+		req.Header.Set(idempotencyKeyHeader, "key-1")
+		req = req.WithContext(context.WithValue(req.Context(), "requestID", uuid.New().String()))
+		w := httptest.NewRecorder()
+
+		h.Add(w, req)
+
+		assert.Equal(t, http.StatusCreated, w.Code)
+		assert.Equal(t, "true", w.Header().Get(idempotentReplayedHeader))
+		assert.Equal(t, `"1"`, w.Header().Get(etagHeader))
+	})
+
+	t.Run("failed to add a new risk, idempotency key reused with another risk", func(t *testing.T) {
+		h := NewRiskHandler(&mockRiskLogic{err: data.Errorf(data.ErrIdempotencyKeyReused, "key reused")})
+
+		req := httptest.NewRequest(http.MethodPost, "/v1/risks", bytes.NewBuffer(getTestData()))
+		req.Header.Set(idempotencyKeyHeader, "key-1")
+		req = req.WithContext(context.WithValue(req.Context(), "requestID", uuid.New().String()))
+		w := httptest.NewRecorder()
+
+		h.Add(w, req)
+
+		assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+	})
+
+	t.Run("failed to add a new risk, idempotency key too long", func(t *testing.T) {
+		h := NewRiskHandler(&mockRiskLogic{})
+
+		req := httptest.NewRequest(http.MethodPost, "/v1/risks", bytes.NewBuffer(getTestData()))
+		req.Header.Set(idempotencyKeyHeader, strings.Repeat("k", 256))
+		req = req.WithContext(context.WithValue(req.Context(), "requestID", uuid.New().String()))
+		w := httptest.NewRecorder()
+
+		h.Add(w, req)
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+
 	t.Run("failed to add a new risk, error from logic", func(t *testing.T) {
 		h := NewRiskHandler(&mockRiskLogic{
 			err: errors.New("some error"),
@@ -92,6 +135,129 @@ func TestRiskHandler_Add(t *testing.T) {
 		assert.Equal(t, http.StatusInternalServerError, w.Code)
 	})
 
+	t.Run("failed to add a new risk, invalid state", func(t *testing.T) {
+		h := NewRiskHandler(&mockRiskLogic{
+			err: &data.ValidationError{Fields: []data.FieldError{{Field: "state", Message: "must be one of open, investigating, accepted or closed"}}},
+		})
+
+		req, err := http.NewRequest(http.MethodPost, "/v1/risks", bytes.NewBuffer(getTestData()))
+		if err != nil {
+			t.Fatalf("error creating request: %s", err)
+		}
+
+		requestID := uuid.New().String()
+		req = req.WithContext(context.WithValue(req.Context(), "requestID", requestID))
+
+		w := httptest.NewRecorder()
+
+		h.Add(w, req)
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Equal(t, "application/problem+json", w.Header().Get("Content-Type"))
+
+		var resp problem
+		err = json.Unmarshal(w.Body.Bytes(), &resp)
+		if err != nil {
+			t.Fatalf("error decoding response: %s", err)
+		}
+
+		assert.Equal(t, requestID, resp.RequestID)
+		assert.Equal(t, []data.FieldError{{Field: "state", Message: "must be one of open, investigating, accepted or closed"}}, resp.Errors)
+	})
+
+	t.Run("failed to add a new risk, field of the wrong type", func(t *testing.T) {
+		h := NewRiskHandler(&mockRiskLogic{})
+
+		req, err := http.NewRequest(http.MethodPost, "/v1/risks", bytes.NewBuffer([]byte(`{"title": 42}`)))
+		if err != nil {
+			t.Fatalf("error creating request: %s", err)
+		}
+
+		req = req.WithContext(context.WithValue(req.Context(), "requestID", uuid.New().String()))
+
+		w := httptest.NewRecorder()
+
+		h.Add(w, req)
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+
+		var resp problem
+		err = json.Unmarshal(w.Body.Bytes(), &resp)
+		if err != nil {
+			t.Fatalf("error decoding response: %s", err)
+		}
+
+		assert.Equal(t, []data.FieldError{{Field: "title", Message: "must be a string but received a number"}}, resp.Errors)
+	})
+
+	strictTests := []struct {
+		name     string
+		body     string
+		expected []data.FieldError
+	}{
+		{
+			name:     "failed to add a new risk, unknown field",
+			body:     `{"title": "threat 1", "state": "open", "priority": "high"}`,
+			expected: []data.FieldError{{Field: "priority", Message: "is not a known field"}},
+		},
+		{
+			name:     "failed to add a new risk, client supplied severity",
+			body:     `{"title": "threat 1", "state": "open", "likelihood": 4, "severity": "high", "residualScore": 16}`,
+			expected: []data.FieldError{{Field: "residualScore", Message: "is read-only"}, {Field: "severity", Message: "is read-only"}},
+		},
+		{
+			name:     "failed to add a new risk, client supplied ID",
+			body:     `{"id": "c7041e22-15c1-4293-9b43-c54c8dd4b909", "title": "threat 1", "state": "open"}`,
+			expected: []data.FieldError{{Field: "id", Message: "is read-only"}},
+		},
+		{
+			name:     "failed to add a new risk, client supplied deletedAt",
+			body:     `{"title": "threat 1", "state": "open", "deletedAt": "2024-06-01T10:00:00Z"}`,
+			expected: []data.FieldError{{Field: "deletedAt", Message: "is read-only"}},
+		},
+		{
+			name:     "failed to add a new risk, client supplied createdAt",
+			body:     `{"title": "threat 1", "state": "open", "createdAt": "2024-06-01T10:00:00Z"}`,
+			expected: []data.FieldError{{Field: "createdAt", Message: "is read-only"}},
+		},
+		{
+			name:     "failed to add a new risk, client supplied actors",
+			body:     `{"title": "threat 1", "state": "open", "createdBy": "alice", "updatedBy": "alice"}`,
+			expected: []data.FieldError{{Field: "createdBy", Message: "is read-only"}, {Field: "updatedBy", Message: "is read-only"}},
+		},
+		{
+			name: "failed to add a new risk, body too large",
+			body: fmt.Sprintf(`{"title": "threat 1", "state": "open", "description": "%s"}`, strings.Repeat("a", 1<<20)),
+		},
+	}
+
+	for _, tt := range strictTests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := NewRiskHandler(&mockRiskLogic{})
+
+			req, err := http.NewRequest(http.MethodPost, "/v1/risks", bytes.NewBufferString(tt.body))
+			if err != nil {
+				t.Fatalf("error creating request: %s", err)
+			}
+
+			req = req.WithContext(context.WithValue(req.Context(), "requestID", uuid.New().String()))
+
+			w := httptest.NewRecorder()
+
+			h.Add(w, req)
+
+			assert.Equal(t, http.StatusBadRequest, w.Code)
+
+			var resp problem
+			err = json.Unmarshal(w.Body.Bytes(), &resp)
+			if err != nil {
+				t.Fatalf("error decoding response: %s", err)
+			}
+
+			assert.Equal(t, tt.expected, resp.Errors)
+		})
+	}
+
 	t.Run("failed to add a new risk, invalid request", func(t *testing.T) {
 		h := NewRiskHandler(&mockRiskLogic{})
 
@@ -163,6 +329,36 @@ func TestRiskHandler_GetByID(t *testing.T) {
 		assert.Equal(t, expected, resp)
 	})
 
+	t.Run("successfully fetch risk by ID with its ETag, not modified", func(t *testing.T) {
+		h := NewRiskHandler(&mockRiskLogic{risk: data.Risk{ID: uuid.MustParse("c7041e22-15c1-4293-9b43-c54c8dd4b909"), State: "open", Version: 2}})
+
+		req := httptest.NewRequest(http.MethodGet, "/v1/risks/c7041e22-15c1-4293-9b43-c54c8dd4b909", nil)
+		req = mux.SetURLVars(req, map[string]string{"id": "c7041e22-15c1-4293-9b43-c54c8dd4b909"})
+		req = req.WithContext(context.WithValue(req.Context(), "requestID", uuid.New().String()))
+		w := httptest.NewRecorder()
+
+		h.GetByID(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, `"2"`, w.Header().Get(etagHeader))
+
+		req.Header.Set(ifNoneMatchHeader, `"2"`)
+		w = httptest.NewRecorder()
+
+		h.GetByID(w, req)
+
+		assert.Equal(t, http.StatusNotModified, w.Code)
+		assert.Equal(t, `"2"`, w.Header().Get(etagHeader))
+		assert.Empty(t, w.Body.Bytes())
+
+		req.Header.Set(ifNoneMatchHeader, `"1"`)
+		w = httptest.NewRecorder()
+
+		h.GetByID(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+	})
+
 	t.Run("failed to fetch risk by ID, error from logic", func(t *testing.T) {
 		h := NewRiskHandler(&mockRiskLogic{
 			err: errors.New("some error from logic"),
@@ -189,6 +385,55 @@ func TestRiskHandler_GetByID(t *testing.T) {
 		assert.Equal(t, http.StatusInternalServerError, w.Code)
 	})
 
+	t.Run("failed to fetch risk by ID, risk not found", func(t *testing.T) {
+		h := NewRiskHandler(&mockRiskLogic{
+			err: data.Errorf(data.ErrNotFound, "risk with ID: c7041e22-15c1-4293-9b43-c54c8dd4b909 not found"),
+		})
+
+		req, err := http.NewRequest(http.MethodGet, "/v1/risks/c7041e22-15c1-4293-9b43-c54c8dd4b909", nil)
+		if err != nil {
+			t.Fatalf("error creating request: %s", err)
+		}
+
+		req = mux.SetURLVars(req, map[string]string{"id": "c7041e22-15c1-4293-9b43-c54c8dd4b909"})
+		req = req.WithContext(context.WithValue(req.Context(), "requestID", uuid.New().String()))
+
+		w := httptest.NewRecorder()
+
+		h.GetByID(w, req)
+
+		assert.Equal(t, http.StatusNotFound, w.Code)
+
+		var resp problem
+		err = json.Unmarshal(w.Body.Bytes(), &resp)
+		if err != nil {
+			t.Fatalf("error decoding response: %s", err)
+		}
+
+		assert.Equal(t, "/problems/not-found", resp.Type)
+		assert.Equal(t, "risk with ID: c7041e22-15c1-4293-9b43-c54c8dd4b909 not found", resp.Detail)
+	})
+
+	t.Run("failed to fetch risk by ID, database unavailable", func(t *testing.T) {
+		h := NewRiskHandler(&mockRiskLogic{
+			err: data.Errorf(data.ErrUnavailable, "database unavailable"),
+		})
+
+		req, err := http.NewRequest(http.MethodGet, "/v1/risks/c7041e22-15c1-4293-9b43-c54c8dd4b909", nil)
+		if err != nil {
+			t.Fatalf("error creating request: %s", err)
+		}
+
+		req = mux.SetURLVars(req, map[string]string{"id": "c7041e22-15c1-4293-9b43-c54c8dd4b909"})
+		req = req.WithContext(context.WithValue(req.Context(), "requestID", uuid.New().String()))
+
+		w := httptest.NewRecorder()
+
+		h.GetByID(w, req)
+
+		assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	})
+
 	t.Run("failed to fetch risk by ID, invalid ID", func(t *testing.T) {
 		h := NewRiskHandler(&mockRiskLogic{
 			err: errors.New("some error from logic"),
@@ -220,7 +465,7 @@ func TestRiskHandler_GetAll(t *testing.T) {
 	t.Run("successfully get all risks", func(t *testing.T) {
 		h := NewRiskHandler(&mockRiskLogic{
 			paginatedRisk: data.PaginatedResponse{
-				TotalCount: 1,
+				TotalCount: intPtr(1),
 				Risks: []data.Risk{
 					{
 						ID:          uuid.MustParse("c7041e22-15c1-4293-9b43-c54c8dd4b909"),
@@ -229,11 +474,12 @@ func TestRiskHandler_GetAll(t *testing.T) {
 						State:       "open",
 					},
 				},
+				NextCursor: &data.Cursor{Sort: "title,id", Values: []string{"threat 1", "c7041e22-15c1-4293-9b43-c54c8dd4b909"}},
 			},
 		})
 
 		expected := data.PaginatedResponse{
-			TotalCount: 1,
+			TotalCount: intPtr(1),
 			Risks: []data.Risk{
 				{
 					ID:          uuid.MustParse("c7041e22-15c1-4293-9b43-c54c8dd4b909"),
@@ -242,6 +488,7 @@ func TestRiskHandler_GetAll(t *testing.T) {
 					State:       "open",
 				},
 			},
+			NextCursor: &data.Cursor{Sort: "title,id", Values: []string{"threat 1", "c7041e22-15c1-4293-9b43-c54c8dd4b909"}},
 		}
 
 		req, err := http.NewRequest(http.MethodGet, "/v1/risks", nil)
@@ -298,30 +545,1043 @@ func TestRiskHandler_GetAll(t *testing.T) {
 	})
 }
 
-func getTestData() []byte {
-	return []byte(`
-					{
-						"title": "threat 1",
-						"description": "DDOS threat",
-						"state": "open"
-					}
-				`)
-}
+func TestRiskHandler_GetAll_Sort(t *testing.T) {
+	t.Run("failed to get all risks, unknown sort field", func(t *testing.T) {
+		h := NewRiskHandler(&mockRiskLogic{})
 
-type mockRiskLogic struct {
-	risk          data.Risk
-	err           error
-	paginatedRisk data.PaginatedResponse
+		req, err := http.NewRequest(http.MethodGet, "/v1/risks?sort=state,-owner", nil)
+		if err != nil {
+			t.Fatalf("error creating request: %s", err)
+		}
+
+		req = req.WithContext(context.WithValue(req.Context(), "requestID", uuid.New().String()))
+
+		w := httptest.NewRecorder()
+
+		h.GetAll(w, req)
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+
+		var resp problem
+		err = json.Unmarshal(w.Body.Bytes(), &resp)
+		if err != nil {
+			t.Fatalf("error decoding response: %s", err)
+		}
+
+		assert.Equal(t, []data.FieldError{{Field: "sort", Message: `cannot sort by "owner", allowed fields are: id, title, description, state, likelihood, impact, inherentScore, residualScore, createdAt, updatedAt, createdBy, updatedBy`}}, resp.Errors)
+	})
+
+	tests := []struct {
+		name     string
+		query    string
+		expected string
+	}{
+		{name: "sort param", query: "sort=state,-title", expected: "state,-title"},
+		{name: "sort param takes precedence", query: "sort=state&sortBy=title", expected: "state"},
+		{name: "legacy ascending sort", query: "sortBy=state", expected: "state"},
+		{name: "legacy descending sort", query: "sortBy=state&sortOrder=desc", expected: "-state"},
+		{name: "no sort", query: "", expected: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/v1/risks?"+tt.query, nil)
+			assert.Equal(t, tt.expected, getSortParam(req))
+		})
+	}
 }
 
-func (m mockRiskLogic) Add(ctx context.Context, risk data.Risk) (data.Risk, error) {
-	return m.risk, m.err
+func TestRiskHandler_GetAll_Filter(t *testing.T) {
+	t.Run("failed to get all risks, invalid filters", func(t *testing.T) {
+		h := NewRiskHandler(&mockRiskLogic{})
+
+		req, err := http.NewRequest(http.MethodGet, "/v1/risks?state=open,archived&createdAfter=yesterday", nil)
+		if err != nil {
+			t.Fatalf("error creating request: %s", err)
+		}
+
+		req = req.WithContext(context.WithValue(req.Context(), "requestID", uuid.New().String()))
+
+		w := httptest.NewRecorder()
+
+		h.GetAll(w, req)
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+
+		var resp problem
+		err = json.Unmarshal(w.Body.Bytes(), &resp)
+		if err != nil {
+			t.Fatalf("error decoding response: %s", err)
+		}
+
+		assert.Equal(t, []data.FieldError{
+			{Field: "state", Message: `must be one of open, investigating, accepted or closed but received "archived"`},
+			{Field: "createdAfter", Message: `must be an RFC 3339 timestamp or a date like 2006-01-02 but received "yesterday"`},
+		}, resp.Errors)
+	})
+
+	invalidOptions := []struct {
+		name     string
+		query    string
+		expected []data.FieldError
+	}{
+		{
+			name:     "failed to get all risks, invalid cursor",
+			query:    "after=not-a-cursor",
+			expected: []data.FieldError{{Field: "after", Message: "is not a valid cursor"}},
+		},
+		{
+			name:     "failed to get all risks, invalid count",
+			query:    "count=approximate",
+			expected: []data.FieldError{{Field: "count", Message: `must be one of exact, estimate or none but received "approximate"`}},
+		},
+		{
+			name:  "failed to get all risks, invalid severity and scores",
+			query: "severity=high,severe&minScore=0&maxScore=ten",
+			expected: []data.FieldError{
+				{Field: "severity", Message: `must be one of low, medium, high or critical but received "severe"`},
+				{Field: "minScore", Message: `must be a positive whole number but received "0"`},
+				{Field: "maxScore", Message: `must be a positive whole number but received "ten"`},
+			},
+		},
+		{
+			name:     "failed to get all risks, invalid mine",
+			query:    "mine=maybe",
+			expected: []data.FieldError{{Field: "mine", Message: `must be true or false but received "maybe"`}},
+		},
+		{
+			name:     "failed to get all risks, mine without an authenticated caller",
+			query:    "mine=true",
+			expected: []data.FieldError{{Field: "mine", Message: "requires an authenticated caller, send the X-Actor header"}},
+		},
+	}
+
+	for _, tt := range invalidOptions {
+		t.Run(tt.name, func(t *testing.T) {
+			h := NewRiskHandler(&mockRiskLogic{})
+
+			req := httptest.NewRequest(http.MethodGet, "/v1/risks?"+tt.query, nil)
+			req = req.WithContext(context.WithValue(req.Context(), "requestID", uuid.New().String()))
+
+			w := httptest.NewRecorder()
+
+			h.GetAll(w, req)
+
+			assert.Equal(t, http.StatusBadRequest, w.Code)
+
+			var resp problem
+			err := json.Unmarshal(w.Body.Bytes(), &resp)
+			if err != nil {
+				t.Fatalf("error decoding response: %s", err)
+			}
+
+			assert.Equal(t, tt.expected, resp.Errors)
+		})
+	}
+
+	createdAfterVal := time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)
+	updatedBeforeVal := time.Date(2024, 3, 4, 10, 30, 0, 0, time.FixedZone("", 2*60*60))
+
+	tests := []struct {
+		name     string
+		query    string
+		expected data.Filter
+	}{
+		{name: "no filters", query: "", expected: data.Filter{}},
+		{
+			name:     "comma separated and repeated states",
+			query:    "state=open,%20closed&state=accepted",
+			expected: data.Filter{States: []data.State{data.StateOpen, data.StateClosed, data.StateAccepted}},
+		},
+		{
+			name:     "title and description",
+			query:    "title=ddos&description=rate%20limit",
+			expected: data.Filter{Title: "ddos", Description: "rate limit"},
+		},
+		{
+			name:     "date ranges",
+			query:    "createdAfter=2024-01-02&updatedBefore=2024-03-04T10:30:00%2B02:00",
+			expected: data.Filter{CreatedAfter: &createdAfterVal, UpdatedBefore: &updatedBeforeVal},
+		},
+		{
+			name:     "severities and a score range",
+			query:    "severity=high,critical&minScore=6&maxScore=20",
+			expected: data.Filter{Severities: []data.Severity{data.SeverityHigh, data.SeverityCritical}, MinScore: 6, MaxScore: 20},
+		},
+		{
+			name:     "owner and assignee",
+			query:    "owner=alice&assignee=%20bob",
+			expected: data.Filter{Owner: "alice", Assignee: "bob"},
+		},
+		{
+			name:     "creator and last updater",
+			query:    "createdBy=alice&updatedBy=%20bob",
+			expected: data.Filter{CreatedBy: "alice", UpdatedBy: "bob"},
+		},
+		{
+			name:     "comma separated and repeated tags",
+			query:    "tag=cloud,%20payments&tag=cloud",
+			expected: data.Filter{Tags: []string{"cloud", "payments"}},
+		},
+		{
+			name:     "risks of the caller",
+			query:    "mine=true",
+			expected: data.Filter{Involving: "alice"},
+		},
+		{
+			name:     "risks of anyone",
+			query:    "mine=false",
+			expected: data.Filter{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/v1/risks?"+tt.query, nil)
+			req = req.WithContext(data.WithAudit(req.Context(), data.Audit{Actor: "alice"}))
+			actual, err := getFilter(req)
+			assert.Nil(t, err)
+			assert.Equal(t, tt.expected, actual)
+		})
+	}
 }
 
-func (m mockRiskLogic) GetByID(ctx context.Context, ID uuid.UUID) (data.Risk, error) {
-	return m.risk, m.err
+func TestRiskHandler_Search(t *testing.T) {
+	t.Run("successfully search risks", func(t *testing.T) {
+		expected := data.SearchResponse{
+			TotalCount: intPtr(1),
+			Risks: []data.SearchResult{
+				{
+					Risk: data.Risk{
+						ID:          uuid.MustParse("c7041e22-15c1-4293-9b43-c54c8dd4b909"),
+						Title:       "threat 1",
+						Description: "DDOS threat",
+						State:       "open",
+					},
+					Rank:                 0.6,
+					TitleHighlight:       "threat 1",
+					DescriptionHighlight: "<mark>DDOS</mark> threat",
+				},
+			},
+			NextCursor: data.NewSearchCursor(0.6, uuid.MustParse("c7041e22-15c1-4293-9b43-c54c8dd4b909")),
+		}
+		h := NewRiskHandler(&mockRiskLogic{searchResults: expected})
+
+		req := httptest.NewRequest(http.MethodGet, "/v1/risks/search?q=ddos&state=open", nil)
+		req = req.WithContext(context.WithValue(req.Context(), "requestID", uuid.New().String()))
+
+		w := httptest.NewRecorder()
+
+		h.Search(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		var resp data.SearchResponse
+		err := json.Unmarshal(w.Body.Bytes(), &resp)
+		if err != nil {
+			t.Fatalf("error decoding response: %s", err)
+		}
+
+		assert.Equal(t, expected, resp)
+	})
+
+	t.Run("failed to search risks, invalid cursor", func(t *testing.T) {
+		h := NewRiskHandler(&mockRiskLogic{})
+
+		req := httptest.NewRequest(http.MethodGet, "/v1/risks/search?q=ddos&after=not-a-cursor", nil)
+		req = req.WithContext(context.WithValue(req.Context(), "requestID", uuid.New().String()))
+
+		w := httptest.NewRecorder()
+
+		h.Search(w, req)
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+
+	t.Run("failed to search risks, error from logic", func(t *testing.T) {
+		h := NewRiskHandler(&mockRiskLogic{
+			err: &data.ValidationError{Fields: []data.FieldError{{Field: "q", Message: "is required"}}},
+		})
+
+		req := httptest.NewRequest(http.MethodGet, "/v1/risks/search", nil)
+		req = req.WithContext(context.WithValue(req.Context(), "requestID", uuid.New().String()))
+
+		w := httptest.NewRecorder()
+
+		h.Search(w, req)
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
 }
 
-func (m mockRiskLogic) GetAll(ctx context.Context, options data.Options) (data.PaginatedResponse, error) {
-	return m.paginatedRisk, m.err
+func TestRiskHandler_Update(t *testing.T) {
+	t.Run("successfully update a risk", func(t *testing.T) {
+		h := NewRiskHandler(&mockRiskLogic{})
+
+		expected := data.Risk{
+			ID:          uuid.MustParse("c7041e22-15c1-4293-9b43-c54c8dd4b909"),
+			Title:       "threat 1",
+			Description: "DDOS threat",
+			State:       "open",
+		}
+
+		req, err := http.NewRequest(http.MethodPut, "/v1/risks/c7041e22-15c1-4293-9b43-c54c8dd4b909", bytes.NewBuffer(getTestData()))
+		if err != nil {
+			t.Fatalf("error creating request: %s", err)
+		}
+
+		req = mux.SetURLVars(req, map[string]string{"id": "c7041e22-15c1-4293-9b43-c54c8dd4b909"})
+		req.Header.Set(ifMatchHeader, `"1"`)
+		req = req.WithContext(context.WithValue(req.Context(), "requestID", uuid.New().String()))
+
+		w := httptest.NewRecorder()
+
+		h.Update(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		var resp data.Risk
+		err = json.Unmarshal(w.Body.Bytes(), &resp)
+		if err != nil {
+			t.Fatalf("error decoding response: %s", err)
+		}
+
+		assert.Equal(t, expected, resp)
+	})
+
+	t.Run("failed to update a risk, risk not found", func(t *testing.T) {
+		h := NewRiskHandler(&mockRiskLogic{err: data.ErrNotFound})
+
+		req, err := http.NewRequest(http.MethodPut, "/v1/risks/c7041e22-15c1-4293-9b43-c54c8dd4b909", bytes.NewBuffer(getTestData()))
+		if err != nil {
+			t.Fatalf("error creating request: %s", err)
+		}
+
+		req = mux.SetURLVars(req, map[string]string{"id": "c7041e22-15c1-4293-9b43-c54c8dd4b909"})
+		req.Header.Set(ifMatchHeader, `"1"`)
+		req = req.WithContext(context.WithValue(req.Context(), "requestID", uuid.New().String()))
+
+		w := httptest.NewRecorder()
+
+		h.Update(w, req)
+
+		assert.Equal(t, http.StatusNotFound, w.Code)
+	})
+
+	t.Run("failed to update a risk, error from logic", func(t *testing.T) {
+		h := NewRiskHandler(&mockRiskLogic{err: errors.New("some error")})
+
+		req, err := http.NewRequest(http.MethodPut, "/v1/risks/c7041e22-15c1-4293-9b43-c54c8dd4b909", bytes.NewBuffer(getTestData()))
+		if err != nil {
+			t.Fatalf("error creating request: %s", err)
+		}
+
+		req = mux.SetURLVars(req, map[string]string{"id": "c7041e22-15c1-4293-9b43-c54c8dd4b909"})
+		req.Header.Set(ifMatchHeader, `"1"`)
+		req = req.WithContext(context.WithValue(req.Context(), "requestID", uuid.New().String()))
+
+		w := httptest.NewRecorder()
+
+		h.Update(w, req)
+
+		assert.Equal(t, http.StatusInternalServerError, w.Code)
+	})
+
+	t.Run("failed to update a risk, If-Match missing", func(t *testing.T) {
+		h := NewRiskHandler(&mockRiskLogic{})
+
+		req := httptest.NewRequest(http.MethodPut, "/v1/risks/c7041e22-15c1-4293-9b43-c54c8dd4b909", bytes.NewBuffer(getTestData()))
+		req = mux.SetURLVars(req, map[string]string{"id": "c7041e22-15c1-4293-9b43-c54c8dd4b909"})
+		req = req.WithContext(context.WithValue(req.Context(), "requestID", uuid.New().String()))
+		w := httptest.NewRecorder()
+
+		h.Update(w, req)
+
+		assert.Equal(t, http.StatusPreconditionRequired, w.Code)
+	})
+
+	t.Run("failed to update a risk, the risk has changed", func(t *testing.T) {
+		h := NewRiskHandler(&mockRiskLogic{err: data.Errorf(data.ErrPreconditionFailed, "risk has changed")})
+
+		req := httptest.NewRequest(http.MethodPut, "/v1/risks/c7041e22-15c1-4293-9b43-c54c8dd4b909", bytes.NewBuffer(getTestData()))
+		req.Header.Set(ifMatchHeader, `"1"`)
+		req = mux.SetURLVars(req, map[string]string{"id": "c7041e22-15c1-4293-9b43-c54c8dd4b909"})
+		req = req.WithContext(context.WithValue(req.Context(), "requestID", uuid.New().String()))
+		w := httptest.NewRecorder()
+
+		h.Update(w, req)
+
+		assert.Equal(t, http.StatusPreconditionFailed, w.Code)
+	})
+
+	t.Run("failed to update a risk, invalid ID", func(t *testing.T) {
+		h := NewRiskHandler(&mockRiskLogic{})
+
+		req, err := http.NewRequest(http.MethodPut, "/v1/risks/c7041e22-15c", bytes.NewBuffer(getTestData()))
+		if err != nil {
+			t.Fatalf("error creating request: %s", err)
+		}
+
+		req = mux.SetURLVars(req, map[string]string{"id": "c7041e22-15c"})
+		req.Header.Set(ifMatchHeader, `"1"`)
+		req = req.WithContext(context.WithValue(req.Context(), "requestID", uuid.New().String()))
+
+		w := httptest.NewRecorder()
+
+		h.Update(w, req)
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+}
+
+func TestRiskHandler_Patch(t *testing.T) {
+	current := data.Risk{
+		ID:          uuid.MustParse("c7041e22-15c1-4293-9b43-c54c8dd4b909"),
+		Title:       "threat 1",
+		Description: "DDOS threat",
+		State:       "open",
+	}
+
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+		err         error
+		code        int
+		expected    data.Risk
+	}{
+		{
+			name:        "successfully merge patch a risk",
+			contentType: mergePatchContentType,
+			body:        `{"state": "investigating"}`,
+			code:        http.StatusOK,
+			expected: data.Risk{
+				ID:          current.ID,
+				Title:       "threat 1",
+				Description: "DDOS threat",
+				State:       "investigating",
+			},
+		},
+		{
+			name:        "successfully json patch a risk",
+			contentType: jsonPatchContentType,
+			body:        `[{"op": "replace", "path": "/title", "value": "threat 2"}, {"op": "replace", "path": "/state", "value": "closed"}]`,
+			code:        http.StatusOK,
+			expected: data.Risk{
+				ID:          current.ID,
+				Title:       "threat 2",
+				Description: "DDOS threat",
+				State:       "closed",
+			},
+		},
+		{
+			name:        "failed to patch a risk, ID is read-only",
+			contentType: mergePatchContentType,
+			body:        `{"id": "00000000-0000-0000-0000-000000000000"}`,
+			code:        http.StatusBadRequest,
+		},
+		{
+			name:        "failed to patch a risk, updatedBy is read-only",
+			contentType: jsonPatchContentType,
+			body:        `[{"op": "replace", "path": "/updatedBy", "value": "mallory"}]`,
+			code:        http.StatusBadRequest,
+		},
+		{
+			name:        "failed to patch a risk, unknown field",
+			contentType: jsonPatchContentType,
+			body:        `[{"op": "add", "path": "/priority", "value": "high"}]`,
+			code:        http.StatusBadRequest,
+		},
+		{
+			name:        "failed to patch a risk, unsupported content type",
+			contentType: "application/json",
+			body:        `{"state": "closed"}`,
+			code:        http.StatusUnsupportedMediaType,
+		},
+		{
+			name:        "failed to patch a risk, invalid json patch",
+			contentType: jsonPatchContentType,
+			body:        `[{"op": "remove", "path": "/unknown"}]`,
+			code:        http.StatusBadRequest,
+		},
+		{
+			name:        "failed to patch a risk, risk not found",
+			contentType: mergePatchContentType,
+			body:        `{"state": "closed"}`,
+			err:         data.ErrNotFound,
+			code:        http.StatusNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := NewRiskHandler(&mockRiskLogic{risk: current, err: tt.err})
+
+			req, err := http.NewRequest(http.MethodPatch, "/v1/risks/c7041e22-15c1-4293-9b43-c54c8dd4b909", bytes.NewBufferString(tt.body))
+			if err != nil {
+				t.Fatalf("error creating request: %s", err)
+			}
+			req.Header.Set("Content-Type", tt.contentType)
+
+			req = mux.SetURLVars(req, map[string]string{"id": "c7041e22-15c1-4293-9b43-c54c8dd4b909"})
+			req.Header.Set(ifMatchHeader, `"1"`)
+			req = req.WithContext(context.WithValue(req.Context(), "requestID", uuid.New().String()))
+
+			w := httptest.NewRecorder()
+
+			h.Patch(w, req)
+
+			assert.Equal(t, tt.code, w.Code)
+
+			if tt.code == http.StatusOK {
+				var resp data.Risk
+				err = json.Unmarshal(w.Body.Bytes(), &resp)
+				if err != nil {
+					t.Fatalf("error decoding response: %s", err)
+				}
+				assert.Equal(t, tt.expected, resp)
+			}
+		})
+	}
+}
+
+func TestRiskHandler_Transition(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		err  error
+		code int
+	}{
+		{
+			name: "successfully transition a risk",
+			body: `{"to": "investigating"}`,
+			code: http.StatusOK,
+		},
+		{
+			name: "failed to transition a risk, transition not allowed",
+			body: `{"to": "accepted"}`,
+			err:  fmt.Errorf("%w: a risk cannot move from open to accepted", data.ErrInvalidTransition),
+			code: http.StatusConflict,
+		},
+		{
+			name: "failed to transition a risk, reason missing",
+			body: `{"to": "open"}`,
+			err:  fmt.Errorf("%w: moving a risk from closed to open", data.ErrReasonRequired),
+			code: http.StatusBadRequest,
+		},
+		{
+			name: "failed to transition a risk, risk not found",
+			body: `{"to": "closed"}`,
+			err:  data.ErrNotFound,
+			code: http.StatusNotFound,
+		},
+		{
+			name: "failed to transition a risk, invalid request",
+			body: `{`,
+			code: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := NewRiskHandler(&mockRiskLogic{
+				risk: data.Risk{ID: uuid.MustParse("c7041e22-15c1-4293-9b43-c54c8dd4b909"), State: "investigating"},
+				err:  tt.err,
+			})
+
+			req, err := http.NewRequest(http.MethodPost, "/v1/risks/c7041e22-15c1-4293-9b43-c54c8dd4b909/transitions", bytes.NewBufferString(tt.body))
+			if err != nil {
+				t.Fatalf("error creating request: %s", err)
+			}
+
+			req = mux.SetURLVars(req, map[string]string{"id": "c7041e22-15c1-4293-9b43-c54c8dd4b909"})
+			req.Header.Set(ifMatchHeader, `"1"`)
+			req = req.WithContext(context.WithValue(req.Context(), "requestID", uuid.New().String()))
+
+			w := httptest.NewRecorder()
+
+			h.Transition(w, req)
+
+			assert.Equal(t, tt.code, w.Code)
+		})
+	}
+}
+
+func TestRiskHandler_Assign(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		err  error
+		code int
+	}{
+		{
+			name: "successfully assign a risk",
+			body: `{"owner": "alice", "assignee": "bob", "reason": "on call"}`,
+			code: http.StatusOK,
+		},
+		{
+			name: "failed to assign a risk, inactive user",
+			body: `{"assignee": "carol"}`,
+			err:  &data.ValidationError{Fields: []data.FieldError{{Field: "assignee", Message: `must be an active user but "carol" is inactive`}}},
+			code: http.StatusBadRequest,
+		},
+		{
+			name: "failed to assign a risk, the risk has changed",
+			body: `{"owner": ""}`,
+			err:  data.ErrPreconditionFailed,
+			code: http.StatusPreconditionFailed,
+		},
+		{
+			name: "failed to assign a risk, risk not found",
+			body: `{"owner": "alice"}`,
+			err:  data.ErrNotFound,
+			code: http.StatusNotFound,
+		},
+		{
+			name: "failed to assign a risk, unknown field",
+			body: `{"reviewer": "alice"}`,
+			code: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := NewRiskHandler(&mockRiskLogic{
+				risk: data.Risk{ID: uuid.MustParse("c7041e22-15c1-4293-9b43-c54c8dd4b909"), State: "open", Owner: "alice", Assignee: "bob", Version: 2},
+				err:  tt.err,
+			})
+
+			req := httptest.NewRequest(http.MethodPost, "/v1/risks/c7041e22-15c1-4293-9b43-c54c8dd4b909/assignment", bytes.NewBufferString(tt.body))
+			req = mux.SetURLVars(req, map[string]string{"id": "c7041e22-15c1-4293-9b43-c54c8dd4b909"})
+			req.Header.Set(ifMatchHeader, `"1"`)
+			req = req.WithContext(context.WithValue(req.Context(), "requestID", uuid.New().String()))
+
+			w := httptest.NewRecorder()
+
+			h.Assign(w, req)
+
+			assert.Equal(t, tt.code, w.Code)
+			if tt.code == http.StatusOK {
+				assert.Equal(t, `"2"`, w.Header().Get("ETag"))
+			}
+		})
+	}
+}
+
+func TestRiskHandler_GetTransitions(t *testing.T) {
+	t.Run("successfully get the transitions of a risk", func(t *testing.T) {
+		h := NewRiskHandler(&mockRiskLogic{
+			transitions: []data.Transition{{To: "investigating"}, {To: "closed"}},
+		})
+
+		req, err := http.NewRequest(http.MethodGet, "/v1/risks/c7041e22-15c1-4293-9b43-c54c8dd4b909/transitions", nil)
+		if err != nil {
+			t.Fatalf("error creating request: %s", err)
+		}
+
+		req = mux.SetURLVars(req, map[string]string{"id": "c7041e22-15c1-4293-9b43-c54c8dd4b909"})
+		req = req.WithContext(context.WithValue(req.Context(), "requestID", uuid.New().String()))
+
+		w := httptest.NewRecorder()
+
+		h.GetTransitions(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		var resp []data.Transition
+		err = json.Unmarshal(w.Body.Bytes(), &resp)
+		if err != nil {
+			t.Fatalf("error decoding response: %s", err)
+		}
+
+		assert.Equal(t, []data.Transition{{To: "investigating"}, {To: "closed"}}, resp)
+	})
+
+	t.Run("failed to get the transitions of a risk, risk not found", func(t *testing.T) {
+		h := NewRiskHandler(&mockRiskLogic{err: data.ErrNotFound})
+
+		req, err := http.NewRequest(http.MethodGet, "/v1/risks/c7041e22-15c1-4293-9b43-c54c8dd4b909/transitions", nil)
+		if err != nil {
+			t.Fatalf("error creating request: %s", err)
+		}
+
+		req = mux.SetURLVars(req, map[string]string{"id": "c7041e22-15c1-4293-9b43-c54c8dd4b909"})
+		req = req.WithContext(context.WithValue(req.Context(), "requestID", uuid.New().String()))
+
+		w := httptest.NewRecorder()
+
+		h.GetTransitions(w, req)
+
+		assert.Equal(t, http.StatusNotFound, w.Code)
+	})
+}
+
+func TestRiskHandler_History(t *testing.T) {
+	riskID := uuid.MustParse("c7041e22-15c1-4293-9b43-c54c8dd4b909")
+
+	t.Run("successfully get the history of a risk", func(t *testing.T) {
+		title := "threat 1"
+		history := []data.HistoryEntry{{
+			ID:        1,
+			RiskID:    riskID,
+			Action:    data.ActionCreated,
+			Actor:     "alice",
+			ChangedAt: time.Date(2024, 6, 1, 10, 0, 0, 0, time.UTC),
+			Changes:   []data.FieldChange{{Field: "title", To: &title}},
+		}}
+		h := NewRiskHandler(&mockRiskLogic{history: history})
+
+		req, err := http.NewRequest(http.MethodGet, "/v1/risks/c7041e22-15c1-4293-9b43-c54c8dd4b909/history", nil)
+		if err != nil {
+			t.Fatalf("error creating request: %s", err)
+		}
+
+		req = mux.SetURLVars(req, map[string]string{"id": riskID.String()})
+		req = req.WithContext(context.WithValue(req.Context(), "requestID", uuid.New().String()))
+
+		w := httptest.NewRecorder()
+
+		h.History(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Contains(t, w.Body.String(), `"changes":[{"field":"title","from":null,"to":"threat 1"}]`)
+
+		var resp []data.HistoryEntry
+		err = json.Unmarshal(w.Body.Bytes(), &resp)
+		if err != nil {
+			t.Fatalf("error decoding response: %s", err)
+		}
+
+		assert.Equal(t, history, resp)
+	})
+
+	t.Run("failed to get the history of a risk, risk not found", func(t *testing.T) {
+		h := NewRiskHandler(&mockRiskLogic{err: data.ErrNotFound})
+
+		req, err := http.NewRequest(http.MethodGet, "/v1/risks/c7041e22-15c1-4293-9b43-c54c8dd4b909/history", nil)
+		if err != nil {
+			t.Fatalf("error creating request: %s", err)
+		}
+
+		req = mux.SetURLVars(req, map[string]string{"id": riskID.String()})
+		req = req.WithContext(context.WithValue(req.Context(), "requestID", uuid.New().String()))
+
+		w := httptest.NewRecorder()
+
+		h.History(w, req)
+
+		assert.Equal(t, http.StatusNotFound, w.Code)
+	})
+}
+
+func TestRiskHandler_Delete(t *testing.T) {
+	tests := []struct {
+		name string
+		id   string
+		err  error
+		code int
+	}{
+		{
+			name: "successfully delete a risk",
+			id:   "c7041e22-15c1-4293-9b43-c54c8dd4b909",
+			code: http.StatusNoContent,
+		},
+		{
+			name: "failed to delete a risk, risk not found",
+			id:   "c7041e22-15c1-4293-9b43-c54c8dd4b909",
+			err:  data.ErrNotFound,
+			code: http.StatusNotFound,
+		},
+		{
+			name: "failed to delete a risk, the risk has changed",
+			id:   "c7041e22-15c1-4293-9b43-c54c8dd4b909",
+			err:  data.ErrPreconditionFailed,
+			code: http.StatusPreconditionFailed,
+		},
+		{
+			name: "failed to delete a risk, error from logic",
+			id:   "c7041e22-15c1-4293-9b43-c54c8dd4b909",
+			err:  errors.New("some error"),
+			code: http.StatusInternalServerError,
+		},
+		{
+			name: "failed to delete a risk, invalid ID",
+			id:   "c7041e22-15c",
+			code: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := NewRiskHandler(&mockRiskLogic{err: tt.err})
+
+			req, err := http.NewRequest(http.MethodDelete, fmt.Sprintf("/v1/risks/%s", tt.id), nil)
+			if err != nil {
+				t.Fatalf("error creating request: %s", err)
+			}
+
+			req = mux.SetURLVars(req, map[string]string{"id": tt.id})
+			req.Header.Set(ifMatchHeader, `"1"`)
+			req = req.WithContext(context.WithValue(req.Context(), "requestID", uuid.New().String()))
+
+			w := httptest.NewRecorder()
+
+			h.Delete(w, req)
+
+			assert.Equal(t, tt.code, w.Code)
+		})
+	}
+
+	t.Run("failed to delete a risk, If-Match missing", func(t *testing.T) {
+		h := NewRiskHandler(&mockRiskLogic{})
+
+		req := httptest.NewRequest(http.MethodDelete, "/v1/risks/c7041e22-15c1-4293-9b43-c54c8dd4b909", nil)
+		req = mux.SetURLVars(req, map[string]string{"id": "c7041e22-15c1-4293-9b43-c54c8dd4b909"})
+		req = req.WithContext(context.WithValue(req.Context(), "requestID", uuid.New().String()))
+		w := httptest.NewRecorder()
+
+		h.Delete(w, req)
+
+		assert.Equal(t, http.StatusPreconditionRequired, w.Code)
+	})
+}
+
+func TestRiskHandler_GetDeleted(t *testing.T) {
+	t.Run("successfully get deleted risks", func(t *testing.T) {
+		deletedAt := time.Date(2024, 6, 1, 10, 0, 0, 0, time.UTC)
+		expected := data.PaginatedResponse{
+			TotalCount: intPtr(1),
+			Risks: []data.Risk{
+				{
+					ID:          uuid.MustParse("c7041e22-15c1-4293-9b43-c54c8dd4b909"),
+					Title:       "threat 1",
+					Description: "DDOS threat",
+					State:       "open",
+					DeletedAt:   &deletedAt,
+				},
+			},
+		}
+		h := NewRiskHandler(&mockRiskLogic{paginatedRisk: expected})
+
+		req, err := http.NewRequest(http.MethodGet, "/v1/risks/trash", nil)
+		if err != nil {
+			t.Fatalf("error creating request: %s", err)
+		}
+		req = req.WithContext(context.WithValue(req.Context(), "requestID", uuid.New().String()))
+
+		w := httptest.NewRecorder()
+
+		h.GetDeleted(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		var resp data.PaginatedResponse
+		err = json.Unmarshal(w.Body.Bytes(), &resp)
+		if err != nil {
+			t.Fatalf("error decoding response: %s", err)
+		}
+
+		assert.Equal(t, expected, resp)
+	})
+
+	t.Run("failed to get deleted risks, error from logic", func(t *testing.T) {
+		h := NewRiskHandler(&mockRiskLogic{err: errors.New("some error")})
+
+		req, err := http.NewRequest(http.MethodGet, "/v1/risks/trash", nil)
+		if err != nil {
+			t.Fatalf("error creating request: %s", err)
+		}
+		req = req.WithContext(context.WithValue(req.Context(), "requestID", uuid.New().String()))
+
+		w := httptest.NewRecorder()
+
+		h.GetDeleted(w, req)
+
+		assert.Equal(t, http.StatusInternalServerError, w.Code)
+	})
+}
+
+func TestRiskHandler_Restore(t *testing.T) {
+	t.Run("successfully restore a risk", func(t *testing.T) {
+		expected := data.Risk{
+			ID:          uuid.MustParse("c7041e22-15c1-4293-9b43-c54c8dd4b909"),
+			Title:       "threat 1",
+			Description: "DDOS threat",
+			State:       "open",
+		}
+		h := NewRiskHandler(&mockRiskLogic{risk: expected})
+
+		req, err := http.NewRequest(http.MethodPost, "/v1/risks/c7041e22-15c1-4293-9b43-c54c8dd4b909/restore", nil)
+		if err != nil {
+			t.Fatalf("error creating request: %s", err)
+		}
+		req = mux.SetURLVars(req, map[string]string{"id": "c7041e22-15c1-4293-9b43-c54c8dd4b909"})
+		req = req.WithContext(context.WithValue(req.Context(), "requestID", uuid.New().String()))
+
+		w := httptest.NewRecorder()
+
+		h.Restore(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		var resp data.Risk
+		err = json.Unmarshal(w.Body.Bytes(), &resp)
+		if err != nil {
+			t.Fatalf("error decoding response: %s", err)
+		}
+
+		assert.Equal(t, expected, resp)
+	})
+
+	t.Run("failed to restore a risk, risk not in the trash", func(t *testing.T) {
+		h := NewRiskHandler(&mockRiskLogic{err: data.ErrNotFound})
+
+		req, err := http.NewRequest(http.MethodPost, "/v1/risks/c7041e22-15c1-4293-9b43-c54c8dd4b909/restore", nil)
+		if err != nil {
+			t.Fatalf("error creating request: %s", err)
+		}
+		req = mux.SetURLVars(req, map[string]string{"id": "c7041e22-15c1-4293-9b43-c54c8dd4b909"})
+		req = req.WithContext(context.WithValue(req.Context(), "requestID", uuid.New().String()))
+
+		w := httptest.NewRecorder()
+
+		h.Restore(w, req)
+
+		assert.Equal(t, http.StatusNotFound, w.Code)
+	})
+}
+
+func TestRiskHandler_PurgeDeleted(t *testing.T) {
+	t.Run("successfully purge deleted risks", func(t *testing.T) {
+		h := NewRiskHandler(&mockRiskLogic{purged: 2})
+
+		req, err := http.NewRequest(http.MethodDelete, "/v1/risks/trash", nil)
+		if err != nil {
+			t.Fatalf("error creating request: %s", err)
+		}
+		req = req.WithContext(context.WithValue(req.Context(), "requestID", uuid.New().String()))
+
+		w := httptest.NewRecorder()
+
+		h.PurgeDeleted(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.JSONEq(t, `{"purged": 2}`, w.Body.String())
+	})
+}
+
+func getTestData() []byte {
+	return []byte(`
+					{
+						"title": "threat 1",
+						"description": "DDOS threat",
+						"state": "open"
+					}
+				`)
+}
+
+type mockRiskLogic struct {
+	risk          data.Risk
+	err           error
+	paginatedRisk data.PaginatedResponse
+	searchResults data.SearchResponse
+	transitions   []data.Transition
+	purged        int64
+	history       []data.HistoryEntry
+	replayed      bool
+	batchResults  []data.BatchResult
+	importReport  data.ImportReport
+	heatMap       data.HeatMap
+	// heatMapOptions records the options of the heat map when it is set
+	heatMapOptions *data.HeatMapOptions
+}
+
+func (m mockRiskLogic) Add(ctx context.Context, risk data.Risk) (data.Risk, error) {
+	return m.risk, m.err
+}
+
+func (m mockRiskLogic) AddIdempotent(ctx context.Context, key string, risk data.Risk) (data.Risk, bool, error) {
+	return m.risk, m.replayed, m.err
+}
+
+func (m mockRiskLogic) Search(ctx context.Context, query string, options data.Options) (data.SearchResponse, error) {
+	return m.searchResults, m.err
+}
+
+func (m mockRiskLogic) GetByID(ctx context.Context, ID uuid.UUID) (data.Risk, error) {
+	return m.risk, m.err
+}
+
+func (m mockRiskLogic) GetAll(ctx context.Context, options data.Options) (data.PaginatedResponse, error) {
+	return m.paginatedRisk, m.err
+}
+
+func (m mockRiskLogic) Update(ctx context.Context, risk data.Risk, precondition data.Precondition) (data.Risk, error) {
+	if m.err != nil {
+		return data.Risk{}, m.err
+	}
+	return risk, nil
+}
+
+func (m mockRiskLogic) Transition(ctx context.Context, ID uuid.UUID, transition data.TransitionRequest, precondition data.Precondition) (data.Risk, error) {
+	return m.risk, m.err
+}
+
+func (m mockRiskLogic) Assign(ctx context.Context, ID uuid.UUID, assignment data.AssignmentRequest, precondition data.Precondition) (data.Risk, error) {
+	return m.risk, m.err
+}
+
+func (m mockRiskLogic) GetTransitions(ctx context.Context, ID uuid.UUID) ([]data.Transition, error) {
+	return m.transitions, m.err
+}
+
+func (m mockRiskLogic) History(ctx context.Context, ID uuid.UUID) ([]data.HistoryEntry, error) {
+	return m.history, m.err
+}
+
+func (m mockRiskLogic) Delete(ctx context.Context, ID uuid.UUID, precondition data.Precondition) error {
+	return m.err
+}
+
+func (m mockRiskLogic) GetDeleted(ctx context.Context, options data.Options) (data.PaginatedResponse, error) {
+	return m.paginatedRisk, m.err
+}
+
+func (m mockRiskLogic) Restore(ctx context.Context, ID uuid.UUID) (data.Risk, error) {
+	return m.risk, m.err
+}
+
+func (m mockRiskLogic) PurgeDeleted(ctx context.Context) (int64, error) {
+	return m.purged, m.err
+}
+
+func intPtr(i int) *int {
+	return &i
+}
+
+func (m mockRiskLogic) Export(ctx context.Context, options data.Options, write func(risk data.Risk) error) error {
+	if m.err != nil {
+		return m.err
+	}
+	for _, risk := range m.paginatedRisk.Risks {
+		if err := write(risk); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m mockRiskLogic) HeatMap(ctx context.Context, options data.HeatMapOptions) (data.HeatMap, error) {
+	if m.heatMapOptions != nil {
+		*m.heatMapOptions = options
+	}
+	return m.heatMap, m.err
+}
+
+func (m mockRiskLogic) Batch(ctx context.Context, request data.BatchRequest) ([]data.BatchResult, error) {
+	return m.batchResults, m.err
+}
+
+func (m mockRiskLogic) Import(ctx context.Context, rows []data.ImportRow, dryRun bool) (data.ImportReport, error) {
+	return m.importReport, m.err
 }
@@ -2,8 +2,20 @@ package handler
 
 import (
 	"context"
+	"crypto/subtle"
 	"github.com/google/uuid"
+	"log/slog"
 	"net/http"
+	"stan-project/cmd/config"
+	"stan-project/data"
+	"strings"
+)
+
+const (
+	// actorHeader identifies who makes a request, it is only trusted along with the gatewaySecretHeader
+	actorHeader         = "X-Actor"
+	gatewaySecretHeader = "X-Gateway-Secret"
+	anonymousActor      = "anonymous"
 )
 
 type Route struct {
@@ -22,6 +34,12 @@ func (h *Handler) GetRoutes() []Route {
 			Pattern:     "/risks/health",
 			HandlerFunc: h.CheckHealth,
 		},
+		{
+			Name:        "Database Pool Stats",
+			Method:      http.MethodGet,
+			Pattern:     "/risks/health/db",
+			HandlerFunc: h.DBStats,
+		},
 
 		//Risk endpoints
 		{
@@ -30,6 +48,42 @@ func (h *Handler) GetRoutes() []Route {
 			Pattern:     "/v1/risks",
 			HandlerFunc: h.rh.Add,
 		},
+		{
+			Name:        "Create, Update or Delete Risks in a Batch",
+			Method:      http.MethodPost,
+			Pattern:     "/v1/risks:batch",
+			HandlerFunc: h.rh.Batch,
+		},
+		{
+			Name:        "Import Risks from CSV",
+			Method:      http.MethodPost,
+			Pattern:     "/v1/risks/import",
+			HandlerFunc: h.rh.Import,
+		},
+		{
+			Name:        "Get Deleted Risks",
+			Method:      http.MethodGet,
+			Pattern:     "/v1/risks/trash",
+			HandlerFunc: h.rh.GetDeleted,
+		},
+		{
+			Name:        "Purge Deleted Risks",
+			Method:      http.MethodDelete,
+			Pattern:     "/v1/risks/trash",
+			HandlerFunc: h.rh.PurgeDeleted,
+		},
+		{
+			Name:        "Export Risks",
+			Method:      http.MethodGet,
+			Pattern:     "/v1/risks/export",
+			HandlerFunc: h.rh.Export,
+		},
+		{
+			Name:        "Search Risks",
+			Method:      http.MethodGet,
+			Pattern:     "/v1/risks/search",
+			HandlerFunc: h.rh.Search,
+		},
 		{
 			Name:        "Get a Risk By ID",
 			Method:      http.MethodGet,
@@ -42,6 +96,88 @@ func (h *Handler) GetRoutes() []Route {
 			Pattern:     "/v1/risks",
 			HandlerFunc: h.rh.GetAll,
 		},
+		{
+			Name:        "Update a Risk",
+			Method:      http.MethodPut,
+			Pattern:     "/v1/risks/{id}",
+			HandlerFunc: h.rh.Update,
+		},
+		{
+			Name:        "Patch a Risk",
+			Method:      http.MethodPatch,
+			Pattern:     "/v1/risks/{id}",
+			HandlerFunc: h.rh.Patch,
+		},
+		{
+			Name:        "Transition a Risk",
+			Method:      http.MethodPost,
+			Pattern:     "/v1/risks/{id}/transitions",
+			HandlerFunc: h.rh.Transition,
+		},
+		{
+			Name:        "Assign a Risk",
+			Method:      http.MethodPost,
+			Pattern:     "/v1/risks/{id}/assignment",
+			HandlerFunc: h.rh.Assign,
+		},
+		{
+			Name:        "Get the Transitions of a Risk",
+			Method:      http.MethodGet,
+			Pattern:     "/v1/risks/{id}/transitions",
+			HandlerFunc: h.rh.GetTransitions,
+		},
+		{
+			Name:        "Get the History of a Risk",
+			Method:      http.MethodGet,
+			Pattern:     "/v1/risks/{id}/history",
+			HandlerFunc: h.rh.History,
+		},
+		{
+			Name:        "Delete a Risk",
+			Method:      http.MethodDelete,
+			Pattern:     "/v1/risks/{id}",
+			HandlerFunc: h.rh.Delete,
+		},
+		{
+			Name:        "Restore a Deleted Risk",
+			Method:      http.MethodPost,
+			Pattern:     "/v1/risks/{id}/restore",
+			HandlerFunc: h.rh.Restore,
+		},
+
+		//User endpoints
+		{
+			Name:        "Create a User",
+			Method:      http.MethodPost,
+			Pattern:     "/v1/users",
+			HandlerFunc: h.uh.Add,
+		},
+		{
+			Name:        "Get All Users",
+			Method:      http.MethodGet,
+			Pattern:     "/v1/users",
+			HandlerFunc: h.uh.GetAll,
+		},
+		{
+			Name:        "Get a User By ID",
+			Method:      http.MethodGet,
+			Pattern:     "/v1/users/{id}",
+			HandlerFunc: h.uh.GetByID,
+		},
+		{
+			Name:        "Update a User",
+			Method:      http.MethodPut,
+			Pattern:     "/v1/users/{id}",
+			HandlerFunc: h.uh.Update,
+		},
+
+		//Report endpoints
+		{
+			Name:        "Risk Heat Map",
+			Method:      http.MethodGet,
+			Pattern:     "/v1/reports/heatmap",
+			HandlerFunc: h.rh.HeatMap,
+		},
 	}
 }
 
@@ -52,7 +188,17 @@ func (h *Handler) CheckHealth(w http.ResponseWriter, r *http.Request) {
 	return
 }
 
-// RequestIDMiddleware generate and add a requestID to each request
+// DBStats reports the usage of the database connection pool for monitoring
+func (h *Handler) DBStats(w http.ResponseWriter, r *http.Request) {
+	if h.dbStats == nil {
+		respondWithError(w, r, data.Errorf(data.ErrNotFound, "the storage has no database connection pool"), "")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, h.dbStats.Stats())
+}
+
+// RequestIDMiddleware generate and add a requestID to each request, along with the audit recorded in the history of
+// the risks the request changes
 func (h *Handler) RequestIDMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		// Generate a unique requestID using Google's UUID library
@@ -61,6 +207,9 @@ func (h *Handler) RequestIDMiddleware(next http.Handler) http.Handler {
 		// Add the requestID to the request context
 		ctx := context.WithValue(r.Context(), "requestID", requestID)
 
+		actor := requestActor(r)
+		ctx = data.WithAudit(ctx, data.Audit{Actor: actor, RequestID: requestID})
+
 		// Add the requestID as a header in the response
 		w.Header().Set("X-Request-ID", requestID)
 
@@ -68,3 +217,19 @@ func (h *Handler) RequestIDMiddleware(next http.Handler) http.Handler {
 		next.ServeHTTP(w, r.WithContext(ctx))
 	})
 }
+
+// requestActor returns the actor set by the gateway in front of the service once the caller is authenticated. The
+// X-Actor header is dropped unless the request carries the gateway secret, so that a caller reaching the service
+// directly cannot claim to be someone else.
+func requestActor(r *http.Request) string {
+	actor := strings.TrimSpace(r.Header.Get(actorHeader))
+	if actor == "" {
+		return anonymousActor
+	}
+	secret := config.Global.HTTP.GatewaySecret
+	if secret == "" || subtle.ConstantTimeCompare([]byte(r.Header.Get(gatewaySecretHeader)), []byte(secret)) != 1 {
+		slog.Warn("ignoring the actor of a request not sent by the gateway", "actor", actor, "url", r.URL)
+		return anonymousActor
+	}
+	return actor
+}
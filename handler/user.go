@@ -0,0 +1,141 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"github.com/gorilla/mux"
+	"log/slog"
+	"net/http"
+	"stan-project/data"
+	"strconv"
+)
+
+const active = "active"
+
+type (
+	userLogic interface {
+		Add(ctx context.Context, user data.User) (data.User, error)
+		GetByID(ctx context.Context, ID string) (data.User, error)
+		GetAll(ctx context.Context, filter data.UserFilter) ([]data.User, error)
+		Update(ctx context.Context, user data.User) (data.User, error)
+	}
+
+	userHandler struct {
+		userLogic userLogic
+	}
+
+	// userRequest holds the fields of a user that can be written, a user is active unless told otherwise
+	userRequest struct {
+		ID     string `json:"id"`
+		Name   string `json:"name"`
+		Email  string `json:"email"`
+		Active *bool  `json:"active"`
+	}
+)
+
+func NewUserHandler(userLogic userLogic) *userHandler {
+	return &userHandler{userLogic: userLogic}
+}
+
+func (uh *userHandler) Add(w http.ResponseWriter, r *http.Request) {
+	requestID := r.Context().Value("requestID").(string)
+	slog.Debug("received a request to create a new user", "requestID", requestID, "method", r.Method, "url", r.URL)
+	ctx := r.Context()
+
+	var req userRequest
+	err := decodeJSON(w, r, &req, "user request")
+	if err != nil {
+		slog.Warn("error unmarshallling user request", "err", err)
+		respondWithError(w, r, err, "")
+		return
+	}
+
+	user, err := uh.userLogic.Add(ctx, req.user())
+	if err != nil {
+		slog.Error("error adding user", "err", err)
+		respondWithError(w, r, err, "error processing the user add request")
+		return
+	}
+
+	slog.Info("successfully added a new user", "id", user.ID)
+	respondWithJSON(w, http.StatusCreated, user)
+}
+
+func (uh *userHandler) GetByID(w http.ResponseWriter, r *http.Request) {
+	requestID := r.Context().Value("requestID").(string)
+	slog.Debug("received a request to fetch a user", "requestID", requestID, "method", r.Method, "url", r.URL)
+	ctx := r.Context()
+
+	userID := mux.Vars(r)["id"]
+	user, err := uh.userLogic.GetByID(ctx, userID)
+	if err != nil {
+		slog.Error("error fetching user", "id", userID, "err", err)
+		respondWithError(w, r, err, fmt.Sprintf("error fetching user with ID: %s", userID))
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, user)
+}
+
+// GetAll lists the users ordered by ID, the active param lists only the active or the inactive ones
+func (uh *userHandler) GetAll(w http.ResponseWriter, r *http.Request) {
+	requestID := r.Context().Value("requestID").(string)
+	slog.Debug("received a request to fetch all users", "requestID", requestID, "method", r.Method, "url", r.URL)
+	ctx := r.Context()
+
+	var filter data.UserFilter
+	if value := getQueryParam(active, r); value != "" {
+		isActive, err := strconv.ParseBool(value)
+		if err != nil {
+			slog.Warn("invalid active filter", "err", err)
+			respondWithError(w, r, &data.ValidationError{Fields: []data.FieldError{
+				{Field: active, Message: fmt.Sprintf("must be true or false but received %q", value)},
+			}}, "")
+			return
+		}
+		filter.Active = &isActive
+	}
+
+	users, err := uh.userLogic.GetAll(ctx, filter)
+	if err != nil {
+		slog.Error("error fetching users", "err", err)
+		respondWithError(w, r, err, "error fetching users")
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, users)
+}
+
+// Update replaces the name, email and activity of a user. Inactive users keep their risks but cannot be given new ones.
+func (uh *userHandler) Update(w http.ResponseWriter, r *http.Request) {
+	requestID := r.Context().Value("requestID").(string)
+	slog.Debug("received a request to update a user", "requestID", requestID, "method", r.Method, "url", r.URL)
+	ctx := r.Context()
+
+	userID := mux.Vars(r)["id"]
+	var req userRequest
+	err := decodeJSON(w, r, &req, "user request")
+	if err == nil && req.ID != "" && req.ID != userID {
+		err = &data.ValidationError{Fields: []data.FieldError{{Field: "id", Message: "is read-only"}}}
+	}
+	if err != nil {
+		slog.Warn("error unmarshallling user request", "err", err)
+		respondWithError(w, r, err, "")
+		return
+	}
+	req.ID = userID
+
+	user, err := uh.userLogic.Update(ctx, req.user())
+	if err != nil {
+		slog.Error("error updating user", "err", err)
+		respondWithError(w, r, err, "error processing the user update request")
+		return
+	}
+
+	slog.Info("successfully updated user", "id", user.ID)
+	respondWithJSON(w, http.StatusOK, user)
+}
+
+func (req userRequest) user() data.User {
+	return data.User{ID: req.ID, Name: req.Name, Email: req.Email, Active: req.Active == nil || *req.Active}
+}
@@ -0,0 +1,131 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"stan-project/data"
+	"testing"
+	"time"
+)
+
+func TestUserHandler(t *testing.T) {
+	newRequest := func(method, target, body string, userID string) *http.Request {
+		req := httptest.NewRequest(method, target, bytes.NewBufferString(body))
+		if userID != "" {
+			req = mux.SetURLVars(req, map[string]string{"id": userID})
+		}
+		return req.WithContext(context.WithValue(req.Context(), "requestID", uuid.New().String()))
+	}
+	createdAt := time.Date(2024, 6, 1, 10, 0, 0, 0, time.UTC)
+	alice := data.User{ID: "alice", Name: "Alice", Email: "alice@example.com", Active: true, CreatedAt: createdAt, UpdatedAt: createdAt}
+
+	t.Run("successfully add an active user by default", func(t *testing.T) {
+		logic := &mockUserLogic{}
+		w := httptest.NewRecorder()
+
+		NewUserHandler(logic).Add(w, newRequest(http.MethodPost, "/v1/users", `{"id": "alice", "name": "Alice", "email": "alice@example.com"}`, ""))
+
+		assert.Equal(t, http.StatusCreated, w.Code)
+		assert.Equal(t, data.User{ID: "alice", Name: "Alice", Email: "alice@example.com", Active: true}, logic.written)
+	})
+	t.Run("failed to add a user, the user exists", func(t *testing.T) {
+		w := httptest.NewRecorder()
+
+		NewUserHandler(&mockUserLogic{err: data.ErrConflict}).Add(w, newRequest(http.MethodPost, "/v1/users", `{"id": "alice", "name": "Alice"}`, ""))
+
+		assert.Equal(t, http.StatusConflict, w.Code)
+	})
+	t.Run("failed to add a user, unknown field", func(t *testing.T) {
+		w := httptest.NewRecorder()
+
+		NewUserHandler(&mockUserLogic{}).Add(w, newRequest(http.MethodPost, "/v1/users", `{"id": "alice", "role": "admin"}`, ""))
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+	t.Run("successfully get a user", func(t *testing.T) {
+		w := httptest.NewRecorder()
+
+		NewUserHandler(&mockUserLogic{user: alice}).GetByID(w, newRequest(http.MethodGet, "/v1/users/alice", "", "alice"))
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		var actual data.User
+		assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &actual))
+		assert.Equal(t, alice, actual)
+	})
+	t.Run("failed to get a user, user not found", func(t *testing.T) {
+		w := httptest.NewRecorder()
+
+		NewUserHandler(&mockUserLogic{err: data.ErrNotFound}).GetByID(w, newRequest(http.MethodGet, "/v1/users/bob", "", "bob"))
+
+		assert.Equal(t, http.StatusNotFound, w.Code)
+	})
+	t.Run("successfully list the inactive users", func(t *testing.T) {
+		logic := &mockUserLogic{user: alice}
+		w := httptest.NewRecorder()
+
+		NewUserHandler(logic).GetAll(w, newRequest(http.MethodGet, "/v1/users?active=false", "", ""))
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		if assert.NotNil(t, logic.filter.Active) {
+			assert.False(t, *logic.filter.Active)
+		}
+	})
+	t.Run("failed to list users, invalid active filter", func(t *testing.T) {
+		w := httptest.NewRecorder()
+
+		NewUserHandler(&mockUserLogic{}).GetAll(w, newRequest(http.MethodGet, "/v1/users?active=sometimes", "", ""))
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		var resp problem
+		assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		assert.Equal(t, []data.FieldError{{Field: "active", Message: `must be true or false but received "sometimes"`}}, resp.Errors)
+	})
+	t.Run("successfully deactivate a user", func(t *testing.T) {
+		logic := &mockUserLogic{}
+		w := httptest.NewRecorder()
+
+		NewUserHandler(logic).Update(w, newRequest(http.MethodPut, "/v1/users/alice", `{"name": "Alice", "active": false}`, "alice"))
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, data.User{ID: "alice", Name: "Alice"}, logic.written)
+	})
+	t.Run("failed to update a user, the ID is read-only", func(t *testing.T) {
+		w := httptest.NewRecorder()
+
+		NewUserHandler(&mockUserLogic{}).Update(w, newRequest(http.MethodPut, "/v1/users/alice", `{"id": "bob", "name": "Alice"}`, "alice"))
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+}
+
+type mockUserLogic struct {
+	user    data.User
+	err     error
+	written data.User
+	filter  data.UserFilter
+}
+
+func (m *mockUserLogic) Add(ctx context.Context, user data.User) (data.User, error) {
+	m.written = user
+	return user, m.err
+}
+
+func (m *mockUserLogic) GetByID(ctx context.Context, ID string) (data.User, error) {
+	return m.user, m.err
+}
+
+func (m *mockUserLogic) GetAll(ctx context.Context, filter data.UserFilter) ([]data.User, error) {
+	m.filter = filter
+	return []data.User{m.user}, m.err
+}
+
+func (m *mockUserLogic) Update(ctx context.Context, user data.User) (data.User, error) {
+	m.written = user
+	return user, m.err
+}
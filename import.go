@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"stan-project/cmd/config"
+	"stan-project/data"
+	"stan-project/logic"
+	"text/tabwriter"
+)
+
+const importUsage = `usage: import [-dry-run] <file.csv>
+
+The header of the file names the risk field of every column: title, description, state, externalRef, likelihood,
+impact, residualLikelihood, residualImpact, owner, assignee and tags, separated by commas. The title column is
+required, and the other columns of a CSV export are ignored. Rows with the external reference of an existing risk update the columns of the file on
+that risk, the other rows create new risks.`
+
+// runImport runs the import subcommand, importing the risks of a CSV file into the configured storage
+func runImport(ctx context.Context, args []string, out io.Writer) error {
+	flags := flag.NewFlagSet("import", flag.ContinueOnError)
+	flags.SetOutput(out)
+	dryRun := flags.Bool("dry-run", false, "report what the import would do without writing anything")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 1 {
+		return fmt.Errorf("invalid arguments for import\n%s", importUsage)
+	}
+
+	if config.Global.Storage == config.StorageMemory {
+		return fmt.Errorf("the import command needs a persistent storage but the storage is %s", config.Global.Storage)
+	}
+
+	file, err := os.Open(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	rows, err := data.ReadRisksCSV(file)
+	if err != nil {
+		return err
+	}
+
+	riskDB, _, closeStorage, err := openStorage(ctx)
+	if err != nil {
+		return err
+	}
+	defer closeStorage(ctx)
+
+	ctx = data.WithAudit(ctx, data.Audit{Actor: logic.SystemActor})
+	report, err := logic.NewRiskLogic(riskDB).Import(ctx, rows, *dryRun)
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "LINE\tEXTERNAL REF\tSTATUS\tRISK ID\tREASON")
+	for _, row := range report.Rows {
+		riskID, reason := "-", row.Reason
+		if row.RiskID != nil {
+			riskID = row.RiskID.String()
+		}
+		for _, field := range row.Errors {
+			reason += fmt.Sprintf(", %s %s", field.Field, field.Message)
+		}
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\n", row.Line, valueOrDash(row.ExternalRef), row.Status, riskID, valueOrDash(reason))
+	}
+	if err = w.Flush(); err != nil {
+		return err
+	}
+
+	summary := fmt.Sprintf("created %d, updated %d, unchanged %d, rejected %d", report.Created, report.Updated, report.Unchanged, report.Rejected)
+	if report.DryRun {
+		summary = "dry run, nothing was written: " + summary
+	}
+	_, err = fmt.Fprintln(out, summary)
+	return err
+}
+
+func valueOrDash(value string) string {
+	if value == "" {
+		return "-"
+	}
+	return value
+}
@@ -0,0 +1,131 @@
+package logic
+
+import (
+	"context"
+	"fmt"
+	"github.com/google/uuid"
+	"log/slog"
+	"stan-project/data"
+	"strings"
+)
+
+// Assign changes the owner or the assignee of a risk that meets the precondition, the reason is recorded in the
+// history of the risk
+func (r *riskLogic) Assign(ctx context.Context, ID uuid.UUID, assignment data.AssignmentRequest, precondition data.Precondition) (data.Risk, error) {
+	if assignment.Owner == nil && assignment.Assignee == nil {
+		return data.Risk{}, &data.ValidationError{Fields: []data.FieldError{{Field: "owner", Message: "is required unless an assignee is given"}}}
+	}
+
+	risk, err := r.riskDB.GetByID(ctx, ID)
+	if err != nil {
+		slog.Error("error fetching risk", "id", ID, "err", err)
+		return data.Risk{}, err
+	}
+
+	current := risk
+	if assignment.Owner != nil {
+		risk.Owner = strings.TrimSpace(*assignment.Owner)
+	}
+	if assignment.Assignee != nil {
+		risk.Assignee = strings.TrimSpace(*assignment.Assignee)
+	}
+	risk.Version, err = checkPrecondition(current, precondition)
+	if err == nil {
+		err = r.checkAssignment(ctx, current, risk)
+	}
+	if err != nil {
+		slog.Warn("rejected assignment of risk", "id", ID, "err", err)
+		return data.Risk{}, err
+	}
+
+	// the reason is recorded in the history of the risk
+	audit := data.AuditFrom(ctx)
+	audit.Reason = assignment.Reason
+	updated, err := r.riskDB.Update(data.WithAudit(ctx, audit), risk)
+	if err != nil {
+		slog.Error("error updating risk", "id", ID, "err", err)
+		return data.Risk{}, err
+	}
+
+	slog.Info("assigned risk", "id", ID, "owner", updated.Owner, "assignee", updated.Assignee, "reason", assignment.Reason)
+	return updated, nil
+}
+
+// checkAssignment fails with a data.ValidationError when the owner or the assignee of the risk changed from the current
+// risk to someone who is not an active user. A user deactivated after the assignment keeps the risk until it changes.
+func (r *riskLogic) checkAssignment(ctx context.Context, current, risk data.Risk) error {
+	users, err := r.assignedUsers(ctx, []data.Risk{risk})
+	if err != nil {
+		return err
+	}
+	if fields := assignmentErrors(current, risk, users); len(fields) > 0 {
+		return &data.ValidationError{Fields: fields}
+	}
+	return nil
+}
+
+// assignedUsers fetches the owners and the assignees of the risks, by ID. The storage is not queried when the risks are
+// unassigned.
+func (r *riskLogic) assignedUsers(ctx context.Context, risks []data.Risk) (map[string]data.User, error) {
+	var IDs []string
+	for _, risk := range risks {
+		for _, ID := range []string{risk.Owner, risk.Assignee} {
+			if ID != "" {
+				IDs = append(IDs, ID)
+			}
+		}
+	}
+	users := map[string]data.User{}
+	if len(IDs) == 0 {
+		return users, nil
+	}
+
+	found, err := r.riskDB.GetUsers(ctx, data.UserFilter{IDs: IDs})
+	if err != nil {
+		slog.Error("error fetching the users assigned to risks", "risks", len(risks), "err", err)
+		return nil, err
+	}
+	for _, user := range found {
+		users[user.ID] = user
+	}
+	return users, nil
+}
+
+// assignmentErrors lists the owner and the assignee that changed from the current risk to a user who is missing from
+// users or is inactive
+func assignmentErrors(current, risk data.Risk, users map[string]data.User) []data.FieldError {
+	var fields []data.FieldError
+	for _, assigned := range []struct{ field, from, to string }{
+		{"owner", current.Owner, risk.Owner},
+		{"assignee", current.Assignee, risk.Assignee},
+	} {
+		if assigned.to == "" || assigned.to == assigned.from {
+			continue
+		}
+		user, ok := users[assigned.to]
+		switch {
+		case !ok:
+			fields = append(fields, data.FieldError{Field: assigned.field, Message: fmt.Sprintf("must be an existing user but received %q", assigned.to)})
+		case !user.Active:
+			fields = append(fields, data.FieldError{Field: assigned.field, Message: fmt.Sprintf("must be an active user but %q is inactive", assigned.to)})
+		}
+	}
+	return fields
+}
+
+// batchCheck extends checkBatchOperation with the owners and the assignees of the updates, which are checked against
+// the risk as it is when the update is applied
+func batchCheck(users map[string]data.User) data.BatchCheck {
+	return func(current data.Risk, operation data.BatchOperation) error {
+		if err := checkBatchOperation(current, operation); err != nil {
+			return err
+		}
+		if operation.Action != data.BatchUpdate {
+			return nil
+		}
+		if fields := assignmentErrors(current, operation.Risk(), users); len(fields) > 0 {
+			return &data.ValidationError{Fields: fields}
+		}
+		return nil
+	}
+}
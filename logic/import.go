@@ -0,0 +1,157 @@
+package logic
+
+import (
+	"context"
+	"errors"
+	"github.com/google/uuid"
+	"log/slog"
+	"stan-project/data"
+)
+
+// Import creates or updates a risk for every row of an imported file. A row with the external reference of an
+// existing risk updates that risk with the columns of the file, the other rows create new risks. The rows are
+// validated like single writes, including their owners and assignees, and the valid ones are written in a single best
+// effort batch, a dry run reports what the import would do without writing anything.
+func (r *riskLogic) Import(ctx context.Context, rows []data.ImportRow, dryRun bool) (data.ImportReport, error) {
+	var (
+		refs     []string
+		assigned []data.Risk
+	)
+	for _, row := range rows {
+		if ref := row.Values["externalRef"]; row.Err == nil && ref != "" {
+			refs = append(refs, ref)
+		}
+		if row.Err == nil {
+			assigned = append(assigned, row.Apply(data.Risk{}))
+		}
+	}
+	existing := map[string]data.Risk{}
+	if len(refs) > 0 {
+		risks, err := r.riskDB.GetByExternalRefs(ctx, refs)
+		if err != nil {
+			slog.Error("error fetching the risks to import by external reference", "err", err)
+			return data.ImportReport{}, err
+		}
+		for _, risk := range risks {
+			existing[risk.ExternalRef] = risk
+		}
+	}
+
+	users, err := r.assignedUsers(ctx, assigned)
+	if err != nil {
+		return data.ImportReport{}, err
+	}
+
+	reports := make([]data.ImportRowReport, len(rows))
+	var (
+		operations []data.BatchOperation
+		indexes    []int
+	)
+	importedBy := map[string]int{}
+	for i, row := range rows {
+		ref := row.Values["externalRef"]
+		reports[i] = data.ImportRowReport{Line: row.Line, ExternalRef: ref}
+
+		operation, err := importOperation(row, existing, users)
+		if err == nil && ref != "" {
+			if line, ok := importedBy[ref]; ok {
+				err = data.Errorf(data.ErrValidation, "the external reference %q is already imported by line %d", ref, line)
+			} else {
+				importedBy[ref] = row.Line
+			}
+		}
+		if err != nil {
+			reports[i] = rejected(reports[i], err)
+			continue
+		}
+		if operation == nil {
+			ID := existing[ref].ID
+			reports[i].Status, reports[i].RiskID = data.ImportUnchanged, &ID
+			continue
+		}
+
+		reports[i].Status = data.ImportCreated
+		if operation.Action == data.BatchUpdate {
+			reports[i].Status = data.ImportUpdated
+			reports[i].RiskID = &operation.ID
+		}
+		operations = append(operations, *operation)
+		indexes = append(indexes, i)
+	}
+
+	if !dryRun && len(operations) > 0 {
+		results, err := r.riskDB.Batch(ctx, operations, data.BatchBestEffort, batchCheck(users))
+		if err != nil {
+			slog.Error("error importing risks", "risks", len(operations), "err", err)
+			return data.ImportReport{}, err
+		}
+		for i, result := range results {
+			report := &reports[indexes[i]]
+			if result.Err != nil {
+				*report = rejected(*report, result.Err)
+				continue
+			}
+			report.RiskID = &result.Risk.ID
+		}
+	}
+
+	report := data.ImportReport{DryRun: dryRun, Rows: []data.ImportRowReport{}}
+	for _, row := range reports {
+		report.Add(row)
+	}
+	slog.Info("imported rows", "rows", len(rows), "dryRun", dryRun,
+		"created", report.Created, "updated", report.Updated, "unchanged", report.Unchanged, "rejected", report.Rejected)
+	return report, nil
+}
+
+// importOperation returns the write a row needs, nil when the row does not change its risk. It fails when the row
+// is invalid, or when it cannot be applied to the existing risk with its external reference.
+func importOperation(row data.ImportRow, existing map[string]data.Risk, users map[string]data.User) (*data.BatchOperation, error) {
+	if row.Err != nil {
+		return nil, row.Err
+	}
+
+	current, ok := existing[row.Values["externalRef"]]
+	if !ok {
+		risk := row.Apply(data.Risk{}).Score(riskScoring())
+		if err := risk.ValidateNew(riskLimits()); err != nil {
+			return nil, err
+		}
+		if fields := assignmentErrors(data.Risk{}, risk, users); len(fields) > 0 {
+			return nil, &data.ValidationError{Fields: fields}
+		}
+		risk.ID = uuid.New()
+		operation := data.NewBatchOperation(data.BatchCreate, risk)
+		return &operation, nil
+	}
+
+	if current.DeletedAt != nil {
+		return nil, data.Errorf(data.ErrConflict, "the risk with the external reference %q is in the trash, restore it to import it", current.ExternalRef)
+	}
+	risk := row.Apply(current).Score(riskScoring())
+	if err := risk.Validate(riskLimits()); err != nil {
+		return nil, err
+	}
+	// the fields a row sets are the ones of the history, the scores follow the ratings
+	if len(data.Diff(&current, &risk)) == 0 {
+		return nil, nil
+	}
+	operation := data.NewBatchOperation(data.BatchUpdate, risk)
+	if err := batchCheck(users)(current, operation); err != nil {
+		return nil, err
+	}
+	return &operation, nil
+}
+
+// rejected reports a row as rejected, with the invalid fields of a validation error
+func rejected(report data.ImportRowReport, err error) data.ImportRowReport {
+	report.Status = data.ImportRejected
+	report.RiskID = nil
+	report.Reason = err.Error()
+	var validationErr *data.ValidationError
+	if errors.As(err, &validationErr) {
+		report.Reason = "the row has invalid fields"
+		report.Errors = validationErr.Fields
+	}
+	return report
+}
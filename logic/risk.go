@@ -2,42 +2,299 @@ package logic
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/google/uuid"
-	"log"
+	"log/slog"
+	"stan-project/cmd/config"
 	"stan-project/data"
+	"strings"
+	"time"
 )
 
+// SystemActor is recorded in the history of the changes made by the service itself
+const SystemActor = "system"
+
 type (
-	riskDB interface {
-		Add(ctx context.Context, risk data.Risk) error
+	// RiskDB stores the risks, see the postgres and in-memory implementations.
+	// Update and SoftDeleteByID fail with data.ErrPreconditionFailed when the risk does not have the expected version,
+	// the version of the given risk for Update, any version is expected when it is 0.
+	RiskDB interface {
+		Add(ctx context.Context, risk data.Risk) (data.Risk, error)
+		AddIdempotent(ctx context.Context, risk data.Risk, key data.IdempotencyKey) (data.Risk, bool, error)
 		GetByID(ctx context.Context, ID uuid.UUID) (data.Risk, error)
+		// GetByExternalRefs lists the risks with the given external references, including the deleted ones
+		GetByExternalRefs(ctx context.Context, refs []string) ([]data.Risk, error)
 		GetAll(ctx context.Context, options data.Options) (data.PaginatedResponse, error)
+		// Export calls write with every risk matching the filter of the options, in their sort order, without
+		// holding them all in memory. The other options are ignored.
+		Export(ctx context.Context, options data.Options, write func(risk data.Risk) error) error
+		// CountByRatings counts the risks matching the filter of the options by likelihood and impact, the cells
+		// without risks are left out
+		CountByRatings(ctx context.Context, options data.HeatMapOptions) ([]data.HeatMapCell, error)
+		Search(ctx context.Context, query string, options data.Options) (data.SearchResponse, error)
+		Update(ctx context.Context, risk data.Risk) (data.Risk, error)
+		SoftDeleteByID(ctx context.Context, ID uuid.UUID, version int64) error
+		GetDeleted(ctx context.Context, options data.Options) (data.PaginatedResponse, error)
+		RestoreByID(ctx context.Context, ID uuid.UUID) error
+		PurgeDeletedBefore(ctx context.Context, before time.Time) (int64, error)
+		GetHistory(ctx context.Context, ID uuid.UUID) ([]data.HistoryEntry, error)
+		PurgeExpiredIdempotencyKeys(ctx context.Context, before time.Time) (int64, error)
+		// Batch applies the operations in a single transaction, in order. An atomic batch stops at the first failed
+		// operation and fails with a data.BatchError, nothing is written. A best effort batch skips the failed
+		// operations, their result holds the error.
+		Batch(ctx context.Context, operations []data.BatchOperation, mode data.BatchMode, check data.BatchCheck) ([]data.BatchResult, error)
+		// the owners and the assignees of the risks are users, the storage rejects unknown ones
+		UserDB
 	}
 	riskLogic struct {
-		riskDB riskDB
+		riskDB RiskDB
 	}
 )
 
-func NewRiskLogic(riskDB riskDB) *riskLogic {
+func NewRiskLogic(riskDB RiskDB) *riskLogic {
 	return &riskLogic{riskDB: riskDB}
 }
 
+func riskLimits() data.Limits {
+	return data.Limits{
+		TitleMaxLength:       config.Global.Risks.TitleMaxLength,
+		DescriptionMaxLength: config.Global.Risks.DescriptionMaxLength,
+		ScoreScale:           config.Global.Risks.ScoreScale,
+	}
+}
+
+func riskScoring() data.Scoring {
+	return data.Scoring{
+		Scale:         config.Global.Risks.ScoreScale,
+		MediumScore:   config.Global.Risks.SeverityScores.Medium,
+		HighScore:     config.Global.Risks.SeverityScores.High,
+		CriticalScore: config.Global.Risks.SeverityScores.Critical,
+	}
+}
+
 func (r *riskLogic) Add(ctx context.Context, risk data.Risk) (data.Risk, error) {
-	if !risk.State.IsValid() {
-		log.Printf("given risk: %v is invalid", risk)
-		return data.Risk{}, fmt.Errorf("risk state is invalid: %v", risk)
+	risk = risk.Score(riskScoring())
+	if err := risk.ValidateNew(riskLimits()); err != nil {
+		slog.Warn("given risk is invalid", "err", err)
+		return data.Risk{}, err
+	}
+	if err := r.checkAssignment(ctx, data.Risk{}, risk); err != nil {
+		slog.Warn("given risk is invalid", "err", err)
+		return data.Risk{}, err
 	}
 
 	risk.ID = uuid.New()
 
-	err := r.riskDB.Add(ctx, risk)
+	added, err := r.riskDB.Add(ctx, risk)
 	if err != nil {
-		log.Printf("error adding new risk: %s", err)
+		slog.Error("error adding new risk", "err", err)
 		return data.Risk{}, err
 	}
 
-	return risk, nil
+	return added, nil
+}
+
+// AddIdempotent adds a risk like Add, except that a retry with the same idempotency key and risk returns the risk
+// added by the first request, with replayed set, instead of adding another one
+func (r *riskLogic) AddIdempotent(ctx context.Context, key string, risk data.Risk) (data.Risk, bool, error) {
+	risk = risk.Score(riskScoring())
+	if err := risk.ValidateNew(riskLimits()); err != nil {
+		slog.Warn("given risk is invalid", "err", err)
+		return data.Risk{}, false, err
+	}
+	if err := r.checkAssignment(ctx, data.Risk{}, risk); err != nil {
+		slog.Warn("given risk is invalid", "err", err)
+		return data.Risk{}, false, err
+	}
+
+	requestHash, err := hashRequest(risk)
+	if err != nil {
+		return data.Risk{}, false, err
+	}
+	idempotencyKey := data.IdempotencyKey{
+		Key:         key,
+		RequestHash: requestHash,
+		ExpiresAt:   time.Now().Add(config.Global.Risks.IdempotencyKeyTTL),
+	}
+
+	risk.ID = uuid.New()
+
+	added, replayed, err := r.riskDB.AddIdempotent(ctx, risk, idempotencyKey)
+	if err != nil {
+		slog.Error("error adding new risk with idempotency key", "key", key, "err", err)
+		return data.Risk{}, false, err
+	}
+	if replayed {
+		slog.Info("replayed risk for idempotency key", "id", added.ID, "key", key)
+	}
+	return added, replayed, nil
+}
+
+// Batch creates, updates and deletes risks in a single transaction. The operations are validated like their single
+// counterparts, an atomic batch with an invalid operation fails before anything is written while a best effort batch
+// applies the valid operations only.
+func (r *riskLogic) Batch(ctx context.Context, request data.BatchRequest) ([]data.BatchResult, error) {
+	if request.Mode == "" {
+		request.Mode = data.BatchAtomic
+	}
+	if err := validateBatch(request); err != nil {
+		slog.Warn("given batch is invalid", "err", err)
+		return nil, err
+	}
+
+	var written []data.Risk
+	for _, operation := range request.Operations {
+		if operation.Action == data.BatchCreate || operation.Action == data.BatchUpdate {
+			written = append(written, operation.Risk())
+		}
+	}
+	users, err := r.assignedUsers(ctx, written)
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]data.BatchResult, len(request.Operations))
+	var (
+		valid   []data.BatchOperation
+		indexes []int
+		fields  []data.FieldError
+	)
+	for i, operation := range request.Operations {
+		results[i].Action = operation.Action
+		if operation.Action == data.BatchCreate || operation.Action == data.BatchUpdate {
+			operation = data.NewBatchOperation(operation.Action, operation.Risk().Score(riskScoring()))
+		}
+		err := validateOperation(operation)
+		if err == nil && operation.Action == data.BatchCreate {
+			if assigned := assignmentErrors(data.Risk{}, operation.Risk(), users); len(assigned) > 0 {
+				err = &data.ValidationError{Fields: assigned}
+			}
+		}
+		if err != nil {
+			results[i].Err = err
+			var validationErr *data.ValidationError
+			if errors.As(err, &validationErr) {
+				for _, field := range validationErr.Fields {
+					fields = append(fields, data.FieldError{Field: fmt.Sprintf("operations[%d].%s", i, field.Field), Message: field.Message})
+				}
+			}
+			continue
+		}
+		if operation.Action == data.BatchCreate {
+			operation.ID = uuid.New()
+		}
+		valid = append(valid, operation)
+		indexes = append(indexes, i)
+	}
+	if request.Mode == data.BatchAtomic && len(fields) > 0 {
+		slog.Warn("given batch is invalid", "invalidFields", len(fields))
+		return nil, &data.ValidationError{Fields: fields}
+	}
+	if len(valid) == 0 {
+		return results, nil
+	}
+
+	applied, err := r.riskDB.Batch(ctx, valid, request.Mode, batchCheck(users))
+	if err != nil {
+		var batchErr *data.BatchError
+		if errors.As(err, &batchErr) {
+			batchErr.Index = indexes[batchErr.Index]
+		}
+		slog.Error("error applying a batch", "operations", len(request.Operations), "err", err)
+		return nil, err
+	}
+	for i, result := range applied {
+		results[indexes[i]] = result
+	}
+	return results, nil
+}
+
+// validateBatch checks the mode and the number of operations of a batch
+func validateBatch(request data.BatchRequest) error {
+	var fields []data.FieldError
+	if request.Mode != data.BatchAtomic && request.Mode != data.BatchBestEffort {
+		fields = append(fields, data.FieldError{
+			Field:   "mode",
+			Message: fmt.Sprintf("must be %s or %s but received %q", data.BatchAtomic, data.BatchBestEffort, request.Mode),
+		})
+	}
+	maxOperations := config.Global.Risks.BatchMaxOperations
+	if n := len(request.Operations); n == 0 || n > maxOperations {
+		fields = append(fields, data.FieldError{
+			Field:   "operations",
+			Message: fmt.Sprintf("must have between 1 and %d operations but has %d", maxOperations, n),
+		})
+	}
+	if len(fields) > 0 {
+		return &data.ValidationError{Fields: fields}
+	}
+	return nil
+}
+
+// validateOperation checks an operation of a batch with the rules of the matching single write
+func validateOperation(operation data.BatchOperation) error {
+	var fields []data.FieldError
+	switch operation.Action {
+	case data.BatchCreate:
+		if operation.ID != uuid.Nil {
+			fields = append(fields, data.FieldError{Field: "id", Message: "is read-only"})
+		}
+		if operation.Version != 0 {
+			fields = append(fields, data.FieldError{Field: "version", Message: "is read-only"})
+		}
+	case data.BatchUpdate, data.BatchDelete:
+		if operation.ID == uuid.Nil {
+			fields = append(fields, data.FieldError{Field: "id", Message: "is required"})
+		}
+		if operation.Version <= 0 {
+			fields = append(fields, data.FieldError{Field: "version", Message: "is required, send the version of the risk you changed"})
+		}
+	default:
+		fields = append(fields, data.FieldError{
+			Field:   "op",
+			Message: fmt.Sprintf("must be one of %s, %s or %s but received %q", data.BatchCreate, data.BatchUpdate, data.BatchDelete, operation.Action),
+		})
+	}
+
+	if operation.Action == data.BatchCreate || operation.Action == data.BatchUpdate {
+		var validationErr *data.ValidationError
+		validate := operation.Risk().Validate
+		if operation.Action == data.BatchCreate {
+			validate = operation.Risk().ValidateNew
+		}
+		if err := validate(riskLimits()); errors.As(err, &validationErr) {
+			fields = append(fields, validationErr.Fields...)
+		} else if err != nil {
+			return err
+		}
+	}
+
+	if len(fields) > 0 {
+		return &data.ValidationError{Fields: fields}
+	}
+	return nil
+}
+
+// checkBatchOperation checks the state change of an update against the risk as it is when the update is applied
+func checkBatchOperation(current data.Risk, operation data.BatchOperation) error {
+	if operation.Action != data.BatchUpdate || current.State == operation.State {
+		return nil
+	}
+	return current.State.ValidateTransition(operation.State, "")
+}
+
+// hashRequest hashes the risk requested to be added, so that a key reused with another risk is detected
+func hashRequest(risk data.Risk) (string, error) {
+	encoded, err := json.Marshal(risk)
+	if err != nil {
+		return "", err
+	}
+	hash := sha256.Sum256(encoded)
+	return hex.EncodeToString(hash[:]), nil
 }
 
 func (r *riskLogic) GetByID(ctx context.Context, ID uuid.UUID) (data.Risk, error) {
@@ -51,5 +308,289 @@ func (r *riskLogic) GetAll(ctx context.Context, options data.Options) (data.Pagi
 	if options.Limit <= 0 {
 		options.Limit = 10
 	}
+	if len(options.Sort) == 0 {
+		options.Sort = []data.SortKey{{Field: "title"}}
+	}
+	if options.Count == "" {
+		options.Count = data.CountExact
+	}
 	return r.riskDB.GetAll(ctx, options)
 }
+
+// Export calls write with every risk matching the filter, sorted like GetAll. It stops at the first error of write.
+func (r *riskLogic) Export(ctx context.Context, options data.Options, write func(risk data.Risk) error) error {
+	if len(options.Sort) == 0 {
+		options.Sort = []data.SortKey{{Field: "title"}}
+	}
+	return r.riskDB.Export(ctx, options, write)
+}
+
+// HeatMap counts the risks matching the filter in every cell of the likelihood by impact matrix of the configured scale
+func (r *riskLogic) HeatMap(ctx context.Context, options data.HeatMapOptions) (data.HeatMap, error) {
+	if options.Rating == "" {
+		options.Rating = data.RatingResidual
+	}
+	counted, err := r.riskDB.CountByRatings(ctx, options)
+	if err != nil {
+		return data.HeatMap{}, err
+	}
+	return data.NewHeatMap(options.Rating, riskScoring(), counted), nil
+}
+
+func (r *riskLogic) Search(ctx context.Context, query string, options data.Options) (data.SearchResponse, error) {
+	if strings.TrimSpace(query) == "" {
+		return data.SearchResponse{}, &data.ValidationError{Fields: []data.FieldError{{Field: "q", Message: "is required"}}}
+	}
+	if options.Offset < 0 {
+		options.Offset = 0
+	}
+	if options.Limit <= 0 {
+		options.Limit = 10
+	}
+	if options.Count == "" {
+		options.Count = data.CountExact
+	}
+	return r.riskDB.Search(ctx, query, options)
+}
+
+// Update updates a risk that meets the precondition. A risk with a version is the result of changes made to that
+// version, e.g. by a patch, so the risk must still have that version.
+func (r *riskLogic) Update(ctx context.Context, risk data.Risk, precondition data.Precondition) (data.Risk, error) {
+	risk = risk.Score(riskScoring())
+	if err := risk.Validate(riskLimits()); err != nil {
+		slog.Warn("given risk is invalid", "err", err)
+		return data.Risk{}, err
+	}
+
+	current, err := r.riskDB.GetByID(ctx, risk.ID)
+	if err != nil {
+		slog.Error("error fetching risk", "id", risk.ID, "err", err)
+		return data.Risk{}, err
+	}
+
+	version, err := checkPrecondition(current, precondition)
+	if err == nil && risk.Version != 0 {
+		version, err = checkPrecondition(current, data.Precondition{Versions: []int64{risk.Version}})
+	}
+	if err != nil {
+		slog.Warn("rejected update of risk", "id", risk.ID, "err", err)
+		return data.Risk{}, err
+	}
+	risk.Version = version
+
+	if current.State != risk.State {
+		err = current.State.ValidateTransition(risk.State, "")
+	}
+	if err == nil {
+		err = r.checkAssignment(ctx, current, risk)
+	}
+	if err != nil {
+		slog.Warn("rejected update of risk", "id", risk.ID, "err", err)
+		return data.Risk{}, err
+	}
+
+	updated, err := r.riskDB.Update(ctx, risk)
+	if err != nil {
+		slog.Error("error updating risk", "id", risk.ID, "err", err)
+		return data.Risk{}, err
+	}
+
+	return updated, nil
+}
+
+func (r *riskLogic) Transition(ctx context.Context, ID uuid.UUID, transition data.TransitionRequest, precondition data.Precondition) (data.Risk, error) {
+	risk, err := r.riskDB.GetByID(ctx, ID)
+	if err != nil {
+		slog.Error("error fetching risk", "id", ID, "err", err)
+		return data.Risk{}, err
+	}
+
+	risk.Version, err = checkPrecondition(risk, precondition)
+	if err == nil {
+		err = risk.State.ValidateTransition(transition.To, transition.Reason)
+	}
+	if err != nil {
+		slog.Warn("rejected transition of risk", "id", ID, "err", err)
+		return data.Risk{}, err
+	}
+
+	from := risk.State
+	risk.State = transition.To
+
+	// the reason is recorded in the history of the risk
+	audit := data.AuditFrom(ctx)
+	audit.Reason = transition.Reason
+	updated, err := r.riskDB.Update(data.WithAudit(ctx, audit), risk)
+	if err != nil {
+		slog.Error("error updating risk", "id", ID, "err", err)
+		return data.Risk{}, err
+	}
+
+	slog.Info("moved risk", "id", ID, "from", from, "to", transition.To, "reason", transition.Reason)
+	return updated, nil
+}
+
+// checkPrecondition fails with data.ErrPreconditionFailed unless the current version of the risk meets the precondition.
+// It returns the version the storage must still find when it writes the risk, so that a concurrent write is not
+// overwritten, or 0 when any version is allowed.
+func checkPrecondition(current data.Risk, precondition data.Precondition) (int64, error) {
+	if !precondition.Matches(current.Version) {
+		return 0, data.Errorf(data.ErrPreconditionFailed, "risk with ID: %s has changed, its current version is %d", current.ID, current.Version)
+	}
+	if precondition.Any {
+		return 0, nil
+	}
+	return current.Version, nil
+}
+
+func (r *riskLogic) GetTransitions(ctx context.Context, ID uuid.UUID) ([]data.Transition, error) {
+	risk, err := r.riskDB.GetByID(ctx, ID)
+	if err != nil {
+		slog.Error("error fetching risk", "id", ID, "err", err)
+		return nil, err
+	}
+	return risk.State.Transitions(), nil
+}
+
+// History returns the changes of a risk, oldest first, with the fields each change made differ
+func (r *riskLogic) History(ctx context.Context, ID uuid.UUID) ([]data.HistoryEntry, error) {
+	history, err := r.riskDB.GetHistory(ctx, ID)
+	if err != nil {
+		slog.Error("error fetching the history of risk", "id", ID, "err", err)
+		return nil, err
+	}
+
+	// risks created before the history was recorded have none
+	if len(history) == 0 {
+		if _, err = r.riskDB.GetByID(ctx, ID); err != nil {
+			return nil, err
+		}
+		return []data.HistoryEntry{}, nil
+	}
+
+	for i := range history {
+		history[i].Changes = data.Diff(history[i].Before, history[i].After)
+	}
+	return history, nil
+}
+
+func (r *riskLogic) Delete(ctx context.Context, ID uuid.UUID, precondition data.Precondition) error {
+	current, err := r.riskDB.GetByID(ctx, ID)
+	if err != nil {
+		slog.Error("error fetching risk", "id", ID, "err", err)
+		return err
+	}
+
+	version, err := checkPrecondition(current, precondition)
+	if err != nil {
+		slog.Warn("rejected delete of risk", "id", ID, "err", err)
+		return err
+	}
+
+	err = r.riskDB.SoftDeleteByID(ctx, ID, version)
+	if err != nil {
+		slog.Error("error deleting risk", "id", ID, "err", err)
+		return err
+	}
+	return nil
+}
+
+func (r *riskLogic) GetDeleted(ctx context.Context, options data.Options) (data.PaginatedResponse, error) {
+	if options.Offset < 0 {
+		options.Offset = 0
+	}
+	if options.Limit <= 0 {
+		options.Limit = 10
+	}
+	return r.riskDB.GetDeleted(ctx, options)
+}
+
+func (r *riskLogic) Restore(ctx context.Context, ID uuid.UUID) (data.Risk, error) {
+	err := r.riskDB.RestoreByID(ctx, ID)
+	if err != nil {
+		slog.Error("error restoring risk", "id", ID, "err", err)
+		return data.Risk{}, err
+	}
+	restored, err := r.riskDB.GetByID(ctx, ID)
+	if err != nil {
+		return data.Risk{}, err
+	}
+	// the scoring may have changed while the risk was in the trash, where the rescore command does not reach
+	if rescored := restored.Rescore(riskScoring()); !restored.Scored(rescored) {
+		return r.riskDB.Update(ctx, rescored)
+	}
+	return restored, nil
+}
+
+// PurgeDeleted hard deletes the risks that have been in the trash for longer than the configured retention period
+func (r *riskLogic) PurgeDeleted(ctx context.Context) (int64, error) {
+	// the periodic purge is not made by anyone in particular
+	if audit := data.AuditFrom(ctx); audit.Actor == "" {
+		audit.Actor = SystemActor
+		ctx = data.WithAudit(ctx, audit)
+	}
+
+	before := time.Now().Add(-config.Global.Risks.TrashRetention)
+	purged, err := r.riskDB.PurgeDeletedBefore(ctx, before)
+	if err != nil {
+		slog.Error("error purging deleted risks", "before", before, "err", err)
+		return 0, err
+	}
+	slog.Info("purged deleted risks", "purged", purged, "before", before)
+	return purged, nil
+}
+
+// rescorePageSize is the number of risks Rescore reads, and rescores, at a time
+const rescorePageSize = 500
+
+// Rescore scores the stored risks again with the configured scoring, when it changed since they were written, and
+// returns how many were rescored. The risks are read and rescored a page at a time, so that they are never all held in
+// memory. The risks that were written while it is running are already scored and skipped.
+func (r *riskLogic) Rescore(ctx context.Context) (int64, error) {
+	if audit := data.AuditFrom(ctx); audit.Actor == "" {
+		audit.Actor = SystemActor
+		ctx = data.WithAudit(ctx, audit)
+	}
+
+	scoring := riskScoring()
+	options := data.Options{Limit: rescorePageSize, Sort: []data.SortKey{{Field: "id"}}, Count: data.CountNone}
+	var rescored int64
+	for {
+		page, err := r.riskDB.GetAll(ctx, options)
+		if err != nil {
+			slog.Error("error listing the risks to rescore", "err", err)
+			return rescored, err
+		}
+		for _, risk := range page.Risks {
+			updated := risk.Rescore(scoring)
+			if risk.Scored(updated) {
+				continue
+			}
+			if _, err = r.riskDB.Update(ctx, updated); err != nil {
+				if errors.Is(err, data.ErrPreconditionFailed) || errors.Is(err, data.ErrNotFound) {
+					continue
+				}
+				slog.Error("error rescoring risk", "id", risk.ID, "err", err)
+				return rescored, err
+			}
+			rescored++
+		}
+		if page.NextCursor == nil {
+			break
+		}
+		options.After = page.NextCursor
+	}
+	slog.Info("rescored risks", "rescored", rescored)
+	return rescored, nil
+}
+
+// PurgeExpiredIdempotencyKeys deletes the idempotency keys whose time to live has passed
+func (r *riskLogic) PurgeExpiredIdempotencyKeys(ctx context.Context) (int64, error) {
+	purged, err := r.riskDB.PurgeExpiredIdempotencyKeys(ctx, time.Now())
+	if err != nil {
+		slog.Error("error purging expired idempotency keys", "err", err)
+		return 0, err
+	}
+	slog.Info("purged expired idempotency keys", "purged", purged)
+	return purged, nil
+}
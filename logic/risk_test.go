@@ -1,13 +1,18 @@
 package logic
 
 import (
+	"bytes"
 	"context"
 	"errors"
 	"fmt"
 	"github.com/google/uuid"
 	"github.com/stretchr/testify/assert"
+	"stan-project/cmd/config"
 	"stan-project/data"
+	"stan-project/db/memory"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestNewRiskLogic(t *testing.T) {
@@ -29,6 +34,8 @@ func TestRiskLogic_Add(t *testing.T) {
 		actual, err := rl.Add(context.Background(), risk)
 		assert.Nil(t, err)
 		risk.ID = actual.ID
+		risk.Likelihood, risk.Impact, risk.ResidualLikelihood, risk.ResidualImpact = 3, 3, 3, 3
+		risk.InherentScore, risk.ResidualScore, risk.Severity = 9, 9, data.SeverityMedium
 		assert.Equal(t, risk, actual)
 	})
 	t.Run("failed to add a new risk, invalid state", func(t *testing.T) {
@@ -40,19 +47,460 @@ func TestRiskLogic_Add(t *testing.T) {
 		}
 		_, err := rl.Add(context.Background(), risk)
 		assert.NotNil(t, err)
-		assert.Equal(t, fmt.Errorf("risk state is invalid: %v", risk), err)
+		assert.ErrorIs(t, err, data.ErrValidation)
+		assert.Equal(t, &data.ValidationError{Fields: []data.FieldError{
+			{Field: "state", Message: `must be one of open, investigating, accepted or closed but received "converted"`},
+		}}, err)
+	})
+	t.Run("failed to add a new risk, unknown owner and inactive assignee", func(t *testing.T) {
+		rl := NewRiskLogic(mockRiskDB{users: []data.User{{ID: "bob", Name: "Bob"}}})
+		risk := data.Risk{Title: "threat 1", State: "open", Owner: "alice", Assignee: "bob"}
+		_, err := rl.Add(context.Background(), risk)
+		assert.Equal(t, &data.ValidationError{Fields: []data.FieldError{
+			{Field: "owner", Message: `must be an existing user but received "alice"`},
+			{Field: "assignee", Message: `must be an active user but "bob" is inactive`},
+		}}, err)
+	})
+	t.Run("failed to add a new risk, invalid fields", func(t *testing.T) {
+		rl := NewRiskLogic(mockRiskDB{})
+		risk := data.Risk{
+			Title:       " ",
+			Description: strings.Repeat("a", 4097),
+			State:       "open",
+		}
+		_, err := rl.Add(context.Background(), risk)
+		assert.Equal(t, &data.ValidationError{Fields: []data.FieldError{
+			{Field: "title", Message: "is required"},
+			{Field: "description", Message: "must be at most 4096 characters but has 4097"},
+		}}, err)
+	})
+	t.Run("failed to add a new risk, title too long", func(t *testing.T) {
+		rl := NewRiskLogic(mockRiskDB{})
+		risk := data.Risk{
+			Title: strings.Repeat("é", 256),
+			State: "open",
+		}
+		_, err := rl.Add(context.Background(), risk)
+		assert.Equal(t, &data.ValidationError{Fields: []data.FieldError{
+			{Field: "title", Message: "must be at most 255 characters but has 256"},
+		}}, err)
+	})
+	t.Run("failed to add a new risk, invalid tags", func(t *testing.T) {
+		rl := NewRiskLogic(mockRiskDB{})
+		risk := data.Risk{
+			Title: "threat 1",
+			State: "open",
+			Tags:  []string{"cloud", " ", " vendor", "a,b", strings.Repeat("t", 51), "cloud"},
+		}
+		_, err := rl.Add(context.Background(), risk)
+		assert.Equal(t, &data.ValidationError{Fields: []data.FieldError{
+			{Field: "tags[1]", Message: "is required"},
+			{Field: "tags[2]", Message: `must not start or end with spaces but received " vendor"`},
+			{Field: "tags[3]", Message: `must not contain commas but received "a,b"`},
+			{Field: "tags[4]", Message: "must be at most 50 characters but has 51"},
+			{Field: "tags[5]", Message: `must not repeat the tag "cloud"`},
+		}}, err)
+
+		risk.Tags = make([]string, data.MaxTags+1)
+		for i := range risk.Tags {
+			risk.Tags[i] = fmt.Sprintf("tag %d", i)
+		}
+		_, err = rl.Add(context.Background(), risk)
+		assert.Equal(t, &data.ValidationError{Fields: []data.FieldError{
+			{Field: "tags", Message: "must have at most 20 tags but has 21"},
+		}}, err)
+	})
+	t.Run("successfully add a new risk, scored by its ratings", func(t *testing.T) {
+		rl := NewRiskLogic(mockRiskDB{})
+		risk := data.Risk{
+			Title:              "threat 1",
+			State:              "open",
+			Likelihood:         4,
+			Impact:             5,
+			ResidualLikelihood: 2,
+		}
+		actual, err := rl.Add(context.Background(), risk)
+		assert.Nil(t, err)
+		assert.Equal(t, 5, actual.ResidualImpact)
+		assert.Equal(t, 20, actual.InherentScore)
+		assert.Equal(t, 10, actual.ResidualScore)
+		assert.Equal(t, data.SeverityHigh, actual.Severity)
+	})
+	t.Run("failed to add a new risk, invalid ratings", func(t *testing.T) {
+		rl := NewRiskLogic(mockRiskDB{})
+		risk := data.Risk{
+			Title:          "threat 1",
+			State:          "open",
+			Likelihood:     6,
+			Impact:         2,
+			ResidualImpact: 3,
+		}
+		_, err := rl.Add(context.Background(), risk)
+		assert.Equal(t, &data.ValidationError{Fields: []data.FieldError{
+			{Field: "likelihood", Message: "must be between 1 and 5 but is 6"},
+			{Field: "residualLikelihood", Message: "must be between 1 and 5 but is 6"},
+			{Field: "residualImpact", Message: "must not be higher than the impact 2 but is 3"},
+		}}, err)
 	})
 	t.Run("failed to add a new risk, some error from db", func(t *testing.T) {
 		rl := NewRiskLogic(mockRiskDB{err: errors.New("some error from DB")})
 		risk := data.Risk{
 			Title:       "threat 1",
 			Description: "DDOS threat",
-			State:       "closed",
+			State:       "open",
 		}
 		_, err := rl.Add(context.Background(), risk)
 		assert.NotNil(t, err)
 		assert.Equal(t, errors.New("some error from DB"), err)
 	})
+	t.Run("failed to add a new risk, not in an initial state", func(t *testing.T) {
+		rl := NewRiskLogic(mockRiskDB{})
+		for _, state := range []data.State{data.StateInvestigating, data.StateAccepted, data.StateClosed} {
+			_, err := rl.Add(context.Background(), data.Risk{Title: "threat 1", State: state})
+			assert.Equal(t, &data.ValidationError{Fields: []data.FieldError{
+				{Field: "state", Message: fmt.Sprintf("must be open when a risk is created but received %q, the other states are reached through transitions", state)},
+			}}, err)
+			_, _, err = rl.AddIdempotent(context.Background(), "key-1", data.Risk{Title: "threat 1", State: state})
+			assert.ErrorIs(t, err, data.ErrValidation)
+		}
+	})
+}
+
+func TestRiskLogic_AddIdempotent(t *testing.T) {
+	t.Run("successfully add a risk once per idempotency key", func(t *testing.T) {
+		ctx := context.Background()
+		rl := NewRiskLogic(memory.NewRisksDB())
+		risk := data.Risk{Title: "threat 1", Description: "DDOS threat", State: "open"}
+
+		added, replayed, err := rl.AddIdempotent(ctx, "key-1", risk)
+		assert.Nil(t, err)
+		assert.False(t, replayed)
+
+		retried, replayed, err := rl.AddIdempotent(ctx, "key-1", risk)
+		assert.Nil(t, err)
+		assert.True(t, replayed)
+		assert.Equal(t, added, retried)
+
+		other, replayed, err := rl.AddIdempotent(ctx, "key-2", risk)
+		assert.Nil(t, err)
+		assert.False(t, replayed)
+		assert.NotEqual(t, added.ID, other.ID)
+
+		risk.Title = "threat 2"
+		_, _, err = rl.AddIdempotent(ctx, "key-1", risk)
+		assert.ErrorIs(t, err, data.ErrIdempotencyKeyReused)
+	})
+	t.Run("failed to add a new risk with an idempotency key, invalid fields", func(t *testing.T) {
+		rl := NewRiskLogic(mockRiskDB{})
+		_, _, err := rl.AddIdempotent(context.Background(), "key-1", data.Risk{Title: " ", State: "open"})
+		assert.ErrorIs(t, err, data.ErrValidation)
+	})
+}
+
+func TestRiskLogic_PurgeExpiredIdempotencyKeys(t *testing.T) {
+	t.Run("successfully purge expired idempotency keys", func(t *testing.T) {
+		rl := NewRiskLogic(mockRiskDB{purged: 2})
+		actual, err := rl.PurgeExpiredIdempotencyKeys(context.Background())
+		assert.Nil(t, err)
+		assert.Equal(t, int64(2), actual)
+	})
+}
+
+func TestRiskLogic_Batch(t *testing.T) {
+	ctx := context.Background()
+	addRisk := func(t *testing.T, rl *riskLogic) data.Risk {
+		risk, err := rl.Add(ctx, data.Risk{Title: "threat 1", Description: "DDOS threat", State: "open"})
+		assert.Nil(t, err)
+		return risk
+	}
+
+	t.Run("successfully apply an atomic batch", func(t *testing.T) {
+		rl := NewRiskLogic(memory.NewRisksDB())
+		risk := addRisk(t, rl)
+
+		results, err := rl.Batch(ctx, data.BatchRequest{Operations: []data.BatchOperation{
+			{Action: data.BatchCreate, Title: "threat 2", State: "open"},
+			{Action: data.BatchUpdate, ID: risk.ID, Version: 1, Title: "threat 1", State: "investigating"},
+			{Action: data.BatchDelete, ID: risk.ID, Version: 2},
+		}})
+		assert.Nil(t, err)
+		assert.Len(t, results, 3)
+		assert.NotEqual(t, uuid.Nil, results[0].Risk.ID)
+		assert.Equal(t, data.State("investigating"), results[1].Risk.State)
+		assert.Equal(t, int64(3), results[2].Risk.Version)
+		assert.NotNil(t, results[2].Risk.DeletedAt)
+	})
+	t.Run("successfully replace every field of a risk with an update", func(t *testing.T) {
+		rl := NewRiskLogic(memory.NewRisksDB())
+		risk, err := rl.Add(ctx, data.Risk{Title: "threat 1", State: "open", ExternalRef: "EXT-1", Likelihood: 5, Impact: 4})
+		assert.Nil(t, err)
+
+		results, err := rl.Batch(ctx, data.BatchRequest{Operations: []data.BatchOperation{
+			{Action: data.BatchUpdate, ID: risk.ID, Version: 1, Title: "threat 1", State: "open"},
+		}})
+		assert.Nil(t, err)
+		updated := results[0].Risk
+		assert.Equal(t, "", updated.ExternalRef)
+		assert.Equal(t, []int{3, 3, 9}, []int{updated.Likelihood, updated.Impact, updated.InherentScore})
+	})
+	t.Run("failed to apply an atomic batch, an operation failed", func(t *testing.T) {
+		rl := NewRiskLogic(memory.NewRisksDB())
+		risk := addRisk(t, rl)
+
+		_, err := rl.Batch(ctx, data.BatchRequest{Mode: data.BatchAtomic, Operations: []data.BatchOperation{
+			{Action: data.BatchCreate, Title: "threat 2", State: "open"},
+			{Action: data.BatchUpdate, ID: risk.ID, Version: 1, Title: "threat 1", State: "accepted"},
+		}})
+		assert.ErrorIs(t, err, data.ErrInvalidTransition)
+		var batchErr *data.BatchError
+		assert.ErrorAs(t, err, &batchErr)
+		assert.Equal(t, 1, batchErr.Index)
+
+		all, err := rl.GetAll(ctx, data.Options{})
+		assert.Nil(t, err)
+		assert.Equal(t, 1, *all.TotalCount)
+	})
+	t.Run("failed to apply an atomic batch, invalid operations", func(t *testing.T) {
+		rl := NewRiskLogic(mockRiskDB{})
+
+		_, err := rl.Batch(ctx, data.BatchRequest{Operations: []data.BatchOperation{
+			{Action: data.BatchCreate, Title: "threat 1", State: "open"},
+			{Action: data.BatchUpdate, Title: " ", State: "open"},
+			{Action: "rename"},
+			{Action: data.BatchCreate, Title: "threat 4", State: "accepted"},
+		}})
+		var validationErr *data.ValidationError
+		assert.ErrorAs(t, err, &validationErr)
+		assert.Equal(t, []data.FieldError{
+			{Field: "operations[1].id", Message: "is required"},
+			{Field: "operations[1].version", Message: "is required, send the version of the risk you changed"},
+			{Field: "operations[1].title", Message: "is required"},
+			{Field: "operations[2].op", Message: `must be one of create, update or delete but received "rename"`},
+			{Field: "operations[3].state", Message: `must be open when a risk is created but received "accepted", the other states are reached through transitions`},
+		}, validationErr.Fields)
+	})
+	t.Run("successfully apply a best effort batch with failed operations", func(t *testing.T) {
+		rl := NewRiskLogic(memory.NewRisksDB())
+		risk := addRisk(t, rl)
+
+		results, err := rl.Batch(ctx, data.BatchRequest{Mode: data.BatchBestEffort, Operations: []data.BatchOperation{
+			{Action: data.BatchCreate, Title: " ", State: "open"},
+			{Action: data.BatchDelete, ID: risk.ID, Version: 5},
+			{Action: data.BatchUpdate, ID: risk.ID, Version: 1, Title: "threat 1", State: "closed"},
+			{Action: data.BatchDelete, ID: uuid.New(), Version: 1},
+		}})
+		assert.Nil(t, err)
+		assert.ErrorIs(t, results[0].Err, data.ErrValidation)
+		assert.ErrorIs(t, results[1].Err, data.ErrPreconditionFailed)
+		assert.Nil(t, results[2].Err)
+		assert.Equal(t, int64(2), results[2].Risk.Version)
+		assert.ErrorIs(t, results[3].Err, data.ErrNotFound)
+	})
+	t.Run("failed to apply an atomic batch, unknown owner", func(t *testing.T) {
+		rl := NewRiskLogic(memory.NewRisksDB())
+		risk := addRisk(t, rl)
+
+		_, err := rl.Batch(ctx, data.BatchRequest{Operations: []data.BatchOperation{
+			{Action: data.BatchCreate, Title: "threat 2", State: "open", Owner: "alice"},
+		}})
+		assert.Equal(t, &data.ValidationError{Fields: []data.FieldError{
+			{Field: "operations[0].owner", Message: `must be an existing user but received "alice"`},
+		}}, err)
+
+		_, err = rl.Batch(ctx, data.BatchRequest{Operations: []data.BatchOperation{
+			{Action: data.BatchUpdate, ID: risk.ID, Version: 1, Title: "threat 1", State: "open", Assignee: "alice"},
+		}})
+		var batchErr *data.BatchError
+		assert.ErrorAs(t, err, &batchErr)
+		assert.ErrorIs(t, err, data.ErrValidation)
+	})
+	t.Run("failed to apply a batch, invalid mode and no operations", func(t *testing.T) {
+		rl := NewRiskLogic(mockRiskDB{})
+
+		_, err := rl.Batch(ctx, data.BatchRequest{Mode: "sometimes"})
+		var validationErr *data.ValidationError
+		assert.ErrorAs(t, err, &validationErr)
+		assert.Len(t, validationErr.Fields, 2)
+	})
+}
+
+func TestRiskLogic_Import(t *testing.T) {
+	ctx := context.Background()
+	readCSV := func(t *testing.T, file string) []data.ImportRow {
+		rows, err := data.ReadRisksCSV(strings.NewReader(file))
+		assert.Nil(t, err)
+		return rows
+	}
+	newLogic := func(t *testing.T) *riskLogic {
+		rl := NewRiskLogic(memory.NewRisksDB())
+		_, err := rl.Add(ctx, data.Risk{Title: "threat 1", Description: "DDOS threat", State: "open", ExternalRef: "EXT-1", Likelihood: 2, Impact: 4})
+		assert.Nil(t, err)
+		closed, err := rl.Add(ctx, data.Risk{Title: "threat 2", State: "open", ExternalRef: "EXT-2"})
+		assert.Nil(t, err)
+		closed, err = rl.Transition(ctx, closed.ID, data.TransitionRequest{To: "closed"}, data.Precondition{Any: true})
+		assert.Nil(t, err)
+		deleted, err := rl.Add(ctx, data.Risk{Title: "threat 3", State: "open", ExternalRef: "EXT-3"})
+		assert.Nil(t, err)
+		assert.Nil(t, rl.Delete(ctx, deleted.ID, data.Precondition{Versions: []int64{deleted.Version}}))
+		assert.Equal(t, data.StateClosed, closed.State)
+		return rl
+	}
+	file := "External Ref,Title,state\n" +
+		"EXT-1,threat 1,investigating\n" +
+		"EXT-2,threat 2,closed\n" +
+		"EXT-3,threat 3,open\n" +
+		"EXT-4,threat 4,open\n" +
+		",threat 5,open\n" +
+		"EXT-4,threat 4 again,open\n" +
+		"EXT-6, ,open\n" +
+		"EXT-2,threat 2,open\n" +
+		"EXT-7\n"
+
+	t.Run("successfully import risks with a report per row", func(t *testing.T) {
+		rl := newLogic(t)
+
+		report, err := rl.Import(ctx, readCSV(t, file), false)
+		assert.Nil(t, err)
+		assert.False(t, report.DryRun)
+		assert.Equal(t, 2, report.Created)
+		assert.Equal(t, 1, report.Updated)
+		assert.Equal(t, 1, report.Unchanged)
+		assert.Equal(t, 5, report.Rejected)
+		if !assert.Len(t, report.Rows, 9) {
+			return
+		}
+		statuses := make([]data.ImportStatus, len(report.Rows))
+		for i, row := range report.Rows {
+			statuses[i] = row.Status
+			assert.Equal(t, i+2, row.Line)
+			assert.Equal(t, row.Status != data.ImportRejected, row.RiskID != nil)
+		}
+		assert.Equal(t, []data.ImportStatus{"updated", "unchanged", "rejected", "created", "created", "rejected", "rejected", "rejected", "rejected"}, statuses)
+		assert.Contains(t, report.Rows[2].Reason, "is in the trash")
+		assert.Contains(t, report.Rows[5].Reason, "already imported by line 5")
+		assert.Equal(t, []data.FieldError{{Field: "title", Message: "is required"}}, report.Rows[6].Errors)
+		assert.Contains(t, report.Rows[7].Reason, "a reason is required")
+		assert.Contains(t, report.Rows[8].Reason, "the row has 1 fields but the header has 3")
+
+		updated, err := rl.GetByID(ctx, *report.Rows[0].RiskID)
+		assert.Nil(t, err)
+		assert.Equal(t, data.StateInvestigating, updated.State)
+		assert.Equal(t, "DDOS threat", updated.Description, "the columns missing from the file are left as they are")
+		assert.Equal(t, []int{2, 4, 8}, []int{updated.Likelihood, updated.Impact, updated.InherentScore})
+		created, err := rl.GetByID(ctx, *report.Rows[3].RiskID)
+		assert.Nil(t, err)
+		assert.Equal(t, "EXT-4", created.ExternalRef)
+
+		report, err = rl.Import(ctx, readCSV(t, file), false)
+		assert.Nil(t, err)
+		assert.Equal(t, 1, report.Created, "a row without an external reference always creates a risk")
+		assert.Equal(t, 0, report.Updated)
+		assert.Equal(t, 3, report.Unchanged)
+	})
+	t.Run("successfully report an import without writing anything in a dry run", func(t *testing.T) {
+		rl := newLogic(t)
+
+		report, err := rl.Import(ctx, readCSV(t, file), true)
+		assert.Nil(t, err)
+		assert.True(t, report.DryRun)
+		assert.Equal(t, 2, report.Created)
+		assert.Equal(t, 1, report.Updated)
+		assert.Nil(t, report.Rows[3].RiskID, "a risk created by a dry run has no ID")
+
+		all, err := rl.GetAll(ctx, data.Options{})
+		assert.Nil(t, err)
+		assert.Equal(t, 2, *all.TotalCount)
+		versions := map[string]int64{}
+		for _, risk := range all.Risks {
+			versions[risk.ExternalRef] = risk.Version
+		}
+		assert.Equal(t, map[string]int64{"EXT-1": 1, "EXT-2": 2}, versions)
+	})
+	t.Run("failed to import a new risk, not in an initial state", func(t *testing.T) {
+		rl := newLogic(t)
+
+		report, err := rl.Import(ctx, readCSV(t, "externalRef,title,state\nEXT-8,threat 8,closed\nEXT-9,threat 9,open\n"), false)
+		assert.Nil(t, err)
+		assert.Equal(t, 1, report.Created)
+		assert.Equal(t, 1, report.Rejected)
+		assert.Equal(t, []data.FieldError{
+			{Field: "state", Message: `must be open when a risk is created but received "closed", the other states are reached through transitions`},
+		}, report.Rows[0].Errors)
+	})
+	t.Run("successfully import an export as it was exported", func(t *testing.T) {
+		exported := NewRiskLogic(memory.NewRisksDB())
+		for i, title := range []string{"-1 day slippage", "=SUM(A1)", "+44 supplier", "@ops handover"} {
+			_, err := exported.Add(ctx, data.Risk{Title: title, Description: "'-quoted", State: "open", ExternalRef: fmt.Sprintf("EXT-%d", i), Likelihood: 2})
+			assert.Nil(t, err)
+		}
+		var file bytes.Buffer
+		writer := data.NewRiskWriter(data.ExportCSV, &file)
+		assert.Nil(t, exported.Export(ctx, data.Options{}, writer.Write))
+		assert.Nil(t, writer.Close())
+		assert.Contains(t, file.String(), "'-1 day slippage", "the export quotes the values spreadsheets run as formulas")
+
+		report, err := exported.Import(ctx, readCSV(t, file.String()), false)
+		assert.Nil(t, err)
+		assert.Equal(t, 4, report.Unchanged, "an exported file changes nothing")
+
+		rl := NewRiskLogic(memory.NewRisksDB())
+		report, err = rl.Import(ctx, readCSV(t, file.String()), false)
+		assert.Nil(t, err)
+		assert.Equal(t, 4, report.Created)
+		all, err := rl.GetAll(ctx, data.Options{Sort: []data.SortKey{{Field: "title"}}})
+		assert.Nil(t, err)
+		assert.Equal(t, []string{"+44 supplier", "-1 day slippage", "=SUM(A1)", "@ops handover"}, []string{all.Risks[0].Title, all.Risks[1].Title, all.Risks[2].Title, all.Risks[3].Title})
+		assert.Equal(t, "'-quoted", all.Risks[0].Description, "a value the export did not quote is kept as it is")
+		assert.Equal(t, 2, all.Risks[0].Likelihood)
+	})
+	t.Run("successfully import owners and assignees, active users only", func(t *testing.T) {
+		rl := newLogic(t)
+		for _, user := range []data.User{{ID: "alice", Name: "Alice", Active: true}, {ID: "carol", Name: "Carol"}} {
+			_, err := rl.riskDB.AddUser(ctx, user)
+			assert.Nil(t, err)
+		}
+
+		report, err := rl.Import(ctx, readCSV(t, "externalRef,title,state,owner,assignee\n"+
+			"EXT-1,threat 1,open,alice,\n"+
+			"EXT-8,threat 8,open,alice,alice\n"+
+			"EXT-9,threat 9,open,dave,carol\n"), false)
+		assert.Nil(t, err)
+		assert.Equal(t, []data.ImportStatus{"updated", "created", "rejected"}, []data.ImportStatus{report.Rows[0].Status, report.Rows[1].Status, report.Rows[2].Status})
+		assert.Equal(t, []data.FieldError{
+			{Field: "owner", Message: `must be an existing user but received "dave"`},
+			{Field: "assignee", Message: `must be an active user but "carol" is inactive`},
+		}, report.Rows[2].Errors)
+		created, err := rl.GetByID(ctx, *report.Rows[1].RiskID)
+		assert.Nil(t, err)
+		assert.Equal(t, []string{"alice", "alice"}, []string{created.Owner, created.Assignee})
+
+		report, err = rl.Import(ctx, readCSV(t, "externalRef,title\nEXT-1,threat 1\n"), false)
+		assert.Nil(t, err)
+		assert.Equal(t, 1, report.Unchanged, "the owner left out of the file is not changed")
+		updated, err := rl.GetByID(ctx, *report.Rows[0].RiskID)
+		assert.Nil(t, err)
+		assert.Equal(t, "alice", updated.Owner)
+	})
+	t.Run("successfully import tags separated by commas", func(t *testing.T) {
+		rl := newLogic(t)
+
+		report, err := rl.Import(ctx, readCSV(t, "externalRef,title,tags\nEXT-1,threat 1,\"cloud, payments\"\n"), false)
+		assert.Nil(t, err)
+		assert.Equal(t, 1, report.Updated)
+		updated, err := rl.GetByID(ctx, *report.Rows[0].RiskID)
+		assert.Nil(t, err)
+		assert.Equal(t, []string{"cloud", "payments"}, updated.Tags)
+
+		report, err = rl.Import(ctx, readCSV(t, "externalRef,title,tags\nEXT-1,threat 1,\"cloud,payments\"\n"), false)
+		assert.Nil(t, err)
+		assert.Equal(t, 1, report.Unchanged)
+	})
+	t.Run("failed to import risks, error fetching the existing risks", func(t *testing.T) {
+		rl := NewRiskLogic(mockRiskDB{err: data.Errorf(data.ErrUnavailable, "db down")})
+
+		_, err := rl.Import(ctx, readCSV(t, file), false)
+		assert.ErrorIs(t, err, data.ErrUnavailable)
+	})
 }
 
 func TestRiskLogic_GetByID(t *testing.T) {
@@ -80,7 +528,7 @@ func TestRiskLogic_GetByID(t *testing.T) {
 func TestRiskLogic_GetAll(t *testing.T) {
 	t.Run("successfully get all risks", func(t *testing.T) {
 		rl := NewRiskLogic(mockRiskDB{paginatedRisk: data.PaginatedResponse{
-			TotalCount: 1,
+			TotalCount: intPtr(1),
 			Risks: []data.Risk{
 				{
 					ID:          uuid.MustParse("c7041e22-15c1-4293-9b43-c54c8dd4b909"),
@@ -92,7 +540,7 @@ func TestRiskLogic_GetAll(t *testing.T) {
 		}})
 
 		expected := data.PaginatedResponse{
-			TotalCount: 1,
+			TotalCount: intPtr(1),
 			Risks: []data.Risk{
 				{
 					ID:          uuid.MustParse("c7041e22-15c1-4293-9b43-c54c8dd4b909"),
@@ -103,14 +551,26 @@ func TestRiskLogic_GetAll(t *testing.T) {
 			},
 		}
 
-		actual, err := rl.GetAll(context.Background(), data.Options{Offset: 0, Limit: 5, SortBy: "title", SortOrder: "desc"})
+		actual, err := rl.GetAll(context.Background(), data.Options{Offset: 0, Limit: 5, Sort: []data.SortKey{{Field: "title", Descending: true}}})
 		assert.Nil(t, err)
 		assert.Equal(t, expected, actual)
 	})
 
 	t.Run("successfully get all risks, offset and limit is less than 0 fallback to defaults", func(t *testing.T) {
 		rl := NewRiskLogic(mockRiskDB{paginatedRisk: data.PaginatedResponse{
-			TotalCount: 1,
+			TotalCount: intPtr(1),
+			Risks: []data.Risk{
+				{
+					ID:          uuid.MustParse("c7041e22-15c1-4293-9b43-c54c8dd4b909"),
+					Title:       "threat 1",
+					Description: "DDOS threat",
+					State:       "open",
+				},
+			},
+		}})
+
+		expected := data.PaginatedResponse{
+			TotalCount: intPtr(1),
 			Risks: []data.Risk{
 				{
 					ID:          uuid.MustParse("c7041e22-15c1-4293-9b43-c54c8dd4b909"),
@@ -119,34 +579,573 @@ func TestRiskLogic_GetAll(t *testing.T) {
 					State:       "open",
 				},
 			},
+		}
+
+		actual, err := rl.GetAll(context.Background(), data.Options{Offset: -1, Limit: -2, Sort: []data.SortKey{{Field: "title", Descending: true}}})
+		assert.Nil(t, err)
+		assert.Equal(t, expected, actual)
+	})
+}
+
+func TestRiskLogic_Export(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("successfully export risks sorted by title by default", func(t *testing.T) {
+		rl := NewRiskLogic(memory.NewRisksDB())
+		for _, title := range []string{"threat 2", "threat 3", "threat 1"} {
+			_, err := rl.Add(ctx, data.Risk{Title: title, State: "open"})
+			assert.Nil(t, err)
+		}
+
+		var exported []string
+		err := rl.Export(ctx, data.Options{}, func(risk data.Risk) error {
+			exported = append(exported, risk.Title)
+			return nil
+		})
+		assert.Nil(t, err)
+		assert.Equal(t, []string{"threat 1", "threat 2", "threat 3"}, exported)
+	})
+	t.Run("failed to export risks", func(t *testing.T) {
+		rl := NewRiskLogic(mockRiskDB{err: data.Errorf(data.ErrUnavailable, "db down")})
+
+		err := rl.Export(ctx, data.Options{}, func(risk data.Risk) error { return nil })
+		assert.ErrorIs(t, err, data.ErrUnavailable)
+	})
+}
+
+func TestRiskLogic_HeatMap(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("successfully count the risks of every cell", func(t *testing.T) {
+		rl := NewRiskLogic(memory.NewRisksDB())
+		var mitigated data.Risk
+		for _, risk := range []data.Risk{
+			{Title: "threat 1", State: "open", Likelihood: 4, Impact: 5, ResidualLikelihood: 2},
+			{Title: "threat 2", State: "open", Likelihood: 4, Impact: 5},
+			{Title: "threat 3", State: "closed", Likelihood: 1, Impact: 1},
+		} {
+			// risks are created open, the others are moved through the workflow
+			state := risk.State
+			risk.State = data.StateOpen
+			added, err := rl.Add(ctx, risk)
+			assert.Nil(t, err)
+			if state != data.StateOpen {
+				added, err = rl.Transition(ctx, added.ID, data.TransitionRequest{To: state}, data.Precondition{Any: true})
+				assert.Nil(t, err)
+			}
+			if risk.Title == "threat 1" {
+				mitigated = added
+			}
+		}
+
+		heatMap, err := rl.HeatMap(ctx, data.HeatMapOptions{Filter: data.Filter{States: []data.State{"open"}}, WithIDs: true})
+		assert.Nil(t, err)
+		assert.Equal(t, data.RatingResidual, heatMap.Rating)
+		assert.Equal(t, 5, heatMap.Scale)
+		assert.Equal(t, 2, heatMap.Total)
+		assert.Len(t, heatMap.Cells, 25)
+		assert.Equal(t, data.HeatMapCell{Likelihood: 2, Impact: 5, Score: 10, Severity: data.SeverityHigh, Count: 1, RiskIDs: []uuid.UUID{mitigated.ID}}, heatMap.Cells[1*5+4])
+		assert.Equal(t, data.HeatMapCell{Likelihood: 4, Impact: 5, Score: 20, Severity: data.SeverityCritical, Count: 1, RiskIDs: []uuid.UUID{heatMap.Cells[3*5+4].RiskIDs[0]}}, heatMap.Cells[3*5+4])
+		assert.Equal(t, data.HeatMapCell{Likelihood: 1, Impact: 1, Score: 1, Severity: data.SeverityLow}, heatMap.Cells[0])
+
+		heatMap, err = rl.HeatMap(ctx, data.HeatMapOptions{Rating: data.RatingInherent})
+		assert.Nil(t, err)
+		assert.Equal(t, 3, heatMap.Total)
+		assert.Equal(t, 2, heatMap.Cells[3*5+4].Count)
+		assert.Nil(t, heatMap.Cells[3*5+4].RiskIDs)
+	})
+	t.Run("failed to count the risks", func(t *testing.T) {
+		rl := NewRiskLogic(mockRiskDB{err: data.Errorf(data.ErrUnavailable, "db down")})
+
+		_, err := rl.HeatMap(ctx, data.HeatMapOptions{})
+		assert.ErrorIs(t, err, data.ErrUnavailable)
+	})
+}
+
+func TestRiskLogic_Search(t *testing.T) {
+	t.Run("successfully search risks", func(t *testing.T) {
+		rl := NewRiskLogic(mockRiskDB{})
+
+		_, err := rl.Search(context.Background(), "ddos", data.Options{})
+		assert.Nil(t, err)
+	})
+
+	t.Run("failed to search risks, empty query", func(t *testing.T) {
+		rl := NewRiskLogic(mockRiskDB{})
+
+		_, err := rl.Search(context.Background(), "  ", data.Options{})
+		assert.ErrorIs(t, err, data.ErrValidation)
+	})
+}
+
+func TestRiskLogic_Update(t *testing.T) {
+	t.Run("successfully update a risk", func(t *testing.T) {
+		rl := NewRiskLogic(mockRiskDB{risk: data.Risk{State: "open"}})
+		risk := data.Risk{
+			ID:          uuid.MustParse("c7041e22-15c1-4293-9b43-c54c8dd4b909"),
+			Title:       "threat 1",
+			Description: "DDOS threat",
+			State:       "investigating",
+		}
+		actual, err := rl.Update(context.Background(), risk, data.Precondition{Any: true})
+		assert.Nil(t, err)
+		risk.Likelihood, risk.Impact, risk.ResidualLikelihood, risk.ResidualImpact = 3, 3, 3, 3
+		risk.InherentScore, risk.ResidualScore, risk.Severity = 9, 9, data.SeverityMedium
+		assert.Equal(t, risk, actual)
+	})
+	t.Run("failed to update a risk, invalid state", func(t *testing.T) {
+		rl := NewRiskLogic(mockRiskDB{})
+		risk := data.Risk{
+			ID:          uuid.MustParse("c7041e22-15c1-4293-9b43-c54c8dd4b909"),
+			Title:       "threat 1",
+			Description: "DDOS threat",
+			State:       "converted",
+		}
+		_, err := rl.Update(context.Background(), risk, data.Precondition{Any: true})
+		assert.NotNil(t, err)
+		assert.ErrorIs(t, err, data.ErrValidation)
+		assert.Equal(t, &data.ValidationError{Fields: []data.FieldError{
+			{Field: "state", Message: `must be one of open, investigating, accepted or closed but received "converted"`},
+		}}, err)
+	})
+	t.Run("failed to update a risk, risk not found", func(t *testing.T) {
+		rl := NewRiskLogic(mockRiskDB{err: data.ErrNotFound})
+		risk := data.Risk{
+			ID:          uuid.MustParse("c7041e22-15c1-4293-9b43-c54c8dd4b909"),
+			Title:       "threat 1",
+			Description: "DDOS threat",
+			State:       "open",
+		}
+		_, err := rl.Update(context.Background(), risk, data.Precondition{Any: true})
+		assert.ErrorIs(t, err, data.ErrNotFound)
+	})
+	t.Run("failed to update a risk, state transition not allowed", func(t *testing.T) {
+		rl := NewRiskLogic(mockRiskDB{risk: data.Risk{State: "closed"}})
+		risk := data.Risk{
+			ID:          uuid.MustParse("c7041e22-15c1-4293-9b43-c54c8dd4b909"),
+			Title:       "threat 1",
+			Description: "DDOS threat",
+			State:       "investigating",
+		}
+		_, err := rl.Update(context.Background(), risk, data.Precondition{Any: true})
+		assert.ErrorIs(t, err, data.ErrInvalidTransition)
+	})
+	t.Run("failed to update a risk, reopening requires a reason", func(t *testing.T) {
+		rl := NewRiskLogic(mockRiskDB{risk: data.Risk{State: "closed"}})
+		risk := data.Risk{
+			ID:          uuid.MustParse("c7041e22-15c1-4293-9b43-c54c8dd4b909"),
+			Title:       "threat 1",
+			Description: "DDOS threat",
+			State:       "open",
+		}
+		_, err := rl.Update(context.Background(), risk, data.Precondition{Any: true})
+		assert.ErrorIs(t, err, data.ErrReasonRequired)
+	})
+	t.Run("successfully update the version of a risk matching the precondition", func(t *testing.T) {
+		rl := NewRiskLogic(mockRiskDB{risk: data.Risk{State: "open", Version: 3}})
+		risk := data.Risk{ID: uuid.MustParse("c7041e22-15c1-4293-9b43-c54c8dd4b909"), Title: "threat 1", State: "open"}
+		actual, err := rl.Update(context.Background(), risk, data.Precondition{Versions: []int64{2, 3}})
+		assert.Nil(t, err)
+		assert.Equal(t, int64(3), actual.Version)
+	})
+	t.Run("failed to update a risk, the risk has another version", func(t *testing.T) {
+		rl := NewRiskLogic(mockRiskDB{risk: data.Risk{State: "open", Version: 3}})
+		risk := data.Risk{ID: uuid.MustParse("c7041e22-15c1-4293-9b43-c54c8dd4b909"), Title: "threat 1", State: "open"}
+		_, err := rl.Update(context.Background(), risk, data.Precondition{Versions: []int64{2}})
+		assert.ErrorIs(t, err, data.ErrPreconditionFailed)
+	})
+	t.Run("failed to update a risk, the risk was patched from another version", func(t *testing.T) {
+		rl := NewRiskLogic(mockRiskDB{risk: data.Risk{State: "open", Version: 3}})
+		risk := data.Risk{ID: uuid.MustParse("c7041e22-15c1-4293-9b43-c54c8dd4b909"), Title: "threat 1", State: "open", Version: 2}
+		_, err := rl.Update(context.Background(), risk, data.Precondition{Any: true})
+		assert.ErrorIs(t, err, data.ErrPreconditionFailed)
+	})
+}
+
+func TestRiskLogic_Transition(t *testing.T) {
+	riskID := uuid.MustParse("c7041e22-15c1-4293-9b43-c54c8dd4b909")
+
+	tests := []struct {
+		name       string
+		from       data.State
+		transition data.TransitionRequest
+		err        error
+	}{
+		{
+			name:       "successfully start investigating an open risk",
+			from:       "open",
+			transition: data.TransitionRequest{To: "investigating"},
+		},
+		{
+			name:       "successfully accept a risk under investigation",
+			from:       "investigating",
+			transition: data.TransitionRequest{To: "accepted"},
+		},
+		{
+			name:       "successfully reopen a closed risk with a reason",
+			from:       "closed",
+			transition: data.TransitionRequest{To: "open", Reason: "incident recurred"},
+		},
+		{
+			name:       "failed to reopen a closed risk without a reason",
+			from:       "closed",
+			transition: data.TransitionRequest{To: "open", Reason: "  "},
+			err:        data.ErrReasonRequired,
+		},
+		{
+			name:       "failed to accept an open risk without investigating it",
+			from:       "open",
+			transition: data.TransitionRequest{To: "accepted"},
+			err:        data.ErrInvalidTransition,
+		},
+		{
+			name:       "failed to move a risk to an unknown state",
+			from:       "open",
+			transition: data.TransitionRequest{To: "converted"},
+			err:        data.ErrInvalidTransition,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rl := NewRiskLogic(mockRiskDB{risk: data.Risk{ID: riskID, Title: "threat 1", State: tt.from}})
+			actual, err := rl.Transition(context.Background(), riskID, tt.transition, data.Precondition{Any: true})
+			if tt.err != nil {
+				assert.ErrorIs(t, err, tt.err)
+				return
+			}
+			assert.Nil(t, err)
+			assert.Equal(t, data.Risk{ID: riskID, Title: "threat 1", State: tt.transition.To}, actual)
+		})
+	}
+
+	t.Run("failed to transition a risk, the risk has another version", func(t *testing.T) {
+		rl := NewRiskLogic(mockRiskDB{risk: data.Risk{ID: riskID, Title: "threat 1", State: "open", Version: 2}})
+		_, err := rl.Transition(context.Background(), riskID, data.TransitionRequest{To: "closed"}, data.Precondition{Versions: []int64{1}})
+		assert.ErrorIs(t, err, data.ErrPreconditionFailed)
+	})
+	t.Run("failed to transition a risk, risk not found", func(t *testing.T) {
+		rl := NewRiskLogic(mockRiskDB{err: data.ErrNotFound})
+		_, err := rl.Transition(context.Background(), riskID, data.TransitionRequest{To: "closed"}, data.Precondition{Any: true})
+		assert.ErrorIs(t, err, data.ErrNotFound)
+	})
+}
+
+func TestRiskLogic_Assign(t *testing.T) {
+	ctx := context.Background()
+	newLogic := func(t *testing.T) (*riskLogic, data.Risk) {
+		riskDB := memory.NewRisksDB()
+		for _, user := range []data.User{{ID: "alice", Name: "Alice", Active: true}, {ID: "bob", Name: "Bob", Active: true}, {ID: "carol", Name: "Carol"}} {
+			_, err := riskDB.AddUser(ctx, user)
+			assert.Nil(t, err)
+		}
+		rl := NewRiskLogic(riskDB)
+		risk, err := rl.Add(ctx, data.Risk{Title: "threat 1", State: "open", Owner: "alice"})
+		assert.Nil(t, err)
+		return rl, risk
+	}
+
+	t.Run("successfully assign a risk and record the reason", func(t *testing.T) {
+		rl, risk := newLogic(t)
+
+		actual, err := rl.Assign(ctx, risk.ID, data.AssignmentRequest{Assignee: strPtr("bob"), Reason: "on call"}, data.Precondition{Versions: []int64{1}})
+		assert.Nil(t, err)
+		assert.Equal(t, "alice", actual.Owner, "the owner left out is not changed")
+		assert.Equal(t, "bob", actual.Assignee)
+		assert.Equal(t, int64(2), actual.Version)
+
+		history, err := rl.History(ctx, risk.ID)
+		assert.Nil(t, err)
+		assert.Equal(t, "on call", history[1].Reason)
+		assert.Equal(t, []data.FieldChange{{Field: "assignee", To: strPtr("bob")}}, history[1].Changes)
+	})
+	t.Run("successfully unassign a risk owned by an inactive user", func(t *testing.T) {
+		rl, risk := newLogic(t)
+		risk.Owner = "carol"
+		_, err := rl.riskDB.Update(ctx, risk)
+		assert.Nil(t, err)
+
+		_, err = rl.Assign(ctx, risk.ID, data.AssignmentRequest{Owner: strPtr(""), Assignee: strPtr("carol")}, data.Precondition{Any: true})
+		assert.Equal(t, &data.ValidationError{Fields: []data.FieldError{
+			{Field: "assignee", Message: `must be an active user but "carol" is inactive`},
+		}}, err)
+
+		actual, err := rl.Assign(ctx, risk.ID, data.AssignmentRequest{Owner: strPtr(""), Assignee: strPtr("bob")}, data.Precondition{Any: true})
+		assert.Nil(t, err)
+		assert.Equal(t, "", actual.Owner)
+		assert.Equal(t, "bob", actual.Assignee)
+	})
+	t.Run("failed to assign a risk, nothing to assign", func(t *testing.T) {
+		rl, risk := newLogic(t)
+
+		_, err := rl.Assign(ctx, risk.ID, data.AssignmentRequest{Reason: "no one"}, data.Precondition{Any: true})
+		assert.ErrorIs(t, err, data.ErrValidation)
+	})
+	t.Run("failed to assign a risk, the risk has another version", func(t *testing.T) {
+		rl, risk := newLogic(t)
+
+		_, err := rl.Assign(ctx, risk.ID, data.AssignmentRequest{Owner: strPtr("bob")}, data.Precondition{Versions: []int64{2}})
+		assert.ErrorIs(t, err, data.ErrPreconditionFailed)
+	})
+	t.Run("failed to assign a risk, risk not found", func(t *testing.T) {
+		rl, _ := newLogic(t)
+
+		_, err := rl.Assign(ctx, uuid.New(), data.AssignmentRequest{Owner: strPtr("bob")}, data.Precondition{Any: true})
+		assert.ErrorIs(t, err, data.ErrNotFound)
+	})
+}
+
+func TestRiskLogic_GetTransitions(t *testing.T) {
+	t.Run("successfully get the transitions of a risk", func(t *testing.T) {
+		rl := NewRiskLogic(mockRiskDB{risk: data.Risk{State: "accepted"}})
+		actual, err := rl.GetTransitions(context.Background(), uuid.MustParse("c7041e22-15c1-4293-9b43-c54c8dd4b909"))
+		assert.Nil(t, err)
+		assert.Equal(t, []data.Transition{{To: "closed"}, {To: "open", RequiresReason: true}}, actual)
+	})
+	t.Run("failed to get the transitions of a risk, risk not found", func(t *testing.T) {
+		rl := NewRiskLogic(mockRiskDB{err: data.ErrNotFound})
+		_, err := rl.GetTransitions(context.Background(), uuid.MustParse("c7041e22-15c1-4293-9b43-c54c8dd4b909"))
+		assert.ErrorIs(t, err, data.ErrNotFound)
+	})
+}
+
+func TestRiskLogic_History(t *testing.T) {
+	riskID := uuid.MustParse("c7041e22-15c1-4293-9b43-c54c8dd4b909")
+
+	t.Run("successfully return the history with the changed fields", func(t *testing.T) {
+		created := data.Risk{ID: riskID, Title: "threat 1", State: "open"}
+		updated := data.Risk{ID: riskID, Title: "threat 2", State: "open"}
+		rl := NewRiskLogic(mockRiskDB{history: []data.HistoryEntry{
+			{ID: 1, RiskID: riskID, Action: data.ActionCreated, After: &created},
+			{ID: 2, RiskID: riskID, Action: data.ActionUpdated, Before: &created, After: &updated},
 		}})
 
+		history, err := rl.History(context.Background(), riskID)
+		assert.Nil(t, err)
+		assert.Len(t, history, 2)
+		assert.Equal(t, []string{"title", "description", "state"}, []string{history[0].Changes[0].Field, history[0].Changes[1].Field, history[0].Changes[2].Field})
+		assert.Nil(t, history[0].Changes[0].From)
+		assert.Equal(t, []data.FieldChange{{Field: "title", From: strPtr("threat 1"), To: strPtr("threat 2")}}, history[1].Changes)
+	})
+
+	t.Run("successfully return an empty history for a risk created before the history was recorded", func(t *testing.T) {
+		rl := NewRiskLogic(mockRiskDB{risk: data.Risk{ID: riskID}})
+		history, err := rl.History(context.Background(), riskID)
+		assert.Nil(t, err)
+		assert.Empty(t, history)
+		assert.NotNil(t, history)
+	})
+
+	t.Run("failed to return the history, risk not found", func(t *testing.T) {
+		rl := NewRiskLogic(mockRiskDB{err: data.ErrNotFound})
+		_, err := rl.History(context.Background(), riskID)
+		assert.ErrorIs(t, err, data.ErrNotFound)
+	})
+
+	t.Run("successfully record the actor and the reason of a transition", func(t *testing.T) {
+		rl := NewRiskLogic(memory.NewRisksDB())
+		ctx := data.WithAudit(context.Background(), data.Audit{Actor: "alice", RequestID: "request-1"})
+
+		added, err := rl.Add(ctx, data.Risk{Title: "threat 1", State: "open"})
+		assert.Nil(t, err)
+		_, err = rl.Transition(ctx, added.ID, data.TransitionRequest{To: "closed"}, data.Precondition{Any: true})
+		assert.Nil(t, err)
+		_, err = rl.Transition(ctx, added.ID, data.TransitionRequest{To: "open", Reason: "incident recurred"}, data.Precondition{Any: true})
+		assert.Nil(t, err)
+
+		history, err := rl.History(ctx, added.ID)
+		assert.Nil(t, err)
+		assert.Len(t, history, 3)
+		assert.Equal(t, data.ActionUpdated, history[2].Action)
+		assert.Equal(t, "alice", history[2].Actor)
+		assert.Equal(t, "request-1", history[2].RequestID)
+		assert.Equal(t, "incident recurred", history[2].Reason)
+		assert.Empty(t, history[0].Reason)
+	})
+}
+
+func TestRiskLogic_Delete(t *testing.T) {
+	t.Run("successfully delete a risk", func(t *testing.T) {
+		rl := NewRiskLogic(mockRiskDB{})
+		err := rl.Delete(context.Background(), uuid.MustParse("c7041e22-15c1-4293-9b43-c54c8dd4b909"), data.Precondition{Any: true})
+		assert.Nil(t, err)
+	})
+	t.Run("failed to delete a risk, risk not found", func(t *testing.T) {
+		rl := NewRiskLogic(mockRiskDB{err: data.ErrNotFound})
+		err := rl.Delete(context.Background(), uuid.MustParse("c7041e22-15c1-4293-9b43-c54c8dd4b909"), data.Precondition{Any: true})
+		assert.ErrorIs(t, err, data.ErrNotFound)
+	})
+	t.Run("failed to delete a risk, the risk has another version", func(t *testing.T) {
+		rl := NewRiskLogic(mockRiskDB{risk: data.Risk{Version: 2}})
+		err := rl.Delete(context.Background(), uuid.MustParse("c7041e22-15c1-4293-9b43-c54c8dd4b909"), data.Precondition{Versions: []int64{1}})
+		assert.ErrorIs(t, err, data.ErrPreconditionFailed)
+	})
+}
+
+func TestRiskLogic_GetDeleted(t *testing.T) {
+	t.Run("successfully get deleted risks", func(t *testing.T) {
+		deletedAt := time.Date(2024, 6, 1, 10, 0, 0, 0, time.UTC)
 		expected := data.PaginatedResponse{
-			TotalCount: 1,
+			TotalCount: intPtr(1),
 			Risks: []data.Risk{
 				{
 					ID:          uuid.MustParse("c7041e22-15c1-4293-9b43-c54c8dd4b909"),
 					Title:       "threat 1",
 					Description: "DDOS threat",
 					State:       "open",
+					DeletedAt:   &deletedAt,
 				},
 			},
 		}
+		rl := NewRiskLogic(mockRiskDB{paginatedRisk: expected})
+		actual, err := rl.GetDeleted(context.Background(), data.Options{Offset: -1, Limit: 0})
+		assert.Nil(t, err)
+		assert.Equal(t, expected, actual)
+	})
+}
 
-		actual, err := rl.GetAll(context.Background(), data.Options{Offset: -1, Limit: -2, SortBy: "title", SortOrder: "desc"})
+func TestRiskLogic_Restore(t *testing.T) {
+	t.Run("successfully restore a risk", func(t *testing.T) {
+		expected := data.Risk{
+			ID:          uuid.MustParse("c7041e22-15c1-4293-9b43-c54c8dd4b909"),
+			Title:       "threat 1",
+			Description: "DDOS threat",
+			State:       "open",
+		}.Score(riskScoring())
+		rl := NewRiskLogic(mockRiskDB{risk: expected})
+		actual, err := rl.Restore(context.Background(), expected.ID)
 		assert.Nil(t, err)
 		assert.Equal(t, expected, actual)
 	})
+	t.Run("successfully rescore a risk restored after the scoring changed", func(t *testing.T) {
+		ctx := context.Background()
+		riskDB := memory.NewRisksDB()
+		rl := NewRiskLogic(riskDB)
+		added, err := rl.Add(ctx, data.Risk{Title: "threat 1", State: "open", Likelihood: 5, Impact: 4})
+		assert.Nil(t, err)
+		assert.Nil(t, riskDB.SoftDeleteByID(ctx, added.ID, 0))
+		withScoring(t, 3, 2, 4, 9)
+
+		actual, err := rl.Restore(ctx, added.ID)
+		assert.Nil(t, err)
+		assert.Equal(t, []int{3, 3, 9, 9}, []int{actual.Likelihood, actual.Impact, actual.InherentScore, actual.ResidualScore})
+		assert.Equal(t, data.SeverityCritical, actual.Severity)
+	})
+	t.Run("failed to restore a risk, risk not in the trash", func(t *testing.T) {
+		rl := NewRiskLogic(mockRiskDB{err: data.ErrNotFound})
+		_, err := rl.Restore(context.Background(), uuid.MustParse("c7041e22-15c1-4293-9b43-c54c8dd4b909"))
+		assert.ErrorIs(t, err, data.ErrNotFound)
+	})
+}
+
+func TestRiskLogic_PurgeDeleted(t *testing.T) {
+	t.Run("successfully purge deleted risks", func(t *testing.T) {
+		rl := NewRiskLogic(mockRiskDB{purged: 3})
+		actual, err := rl.PurgeDeleted(context.Background())
+		assert.Nil(t, err)
+		assert.Equal(t, int64(3), actual)
+	})
+	t.Run("failed to purge deleted risks, some error from db", func(t *testing.T) {
+		rl := NewRiskLogic(mockRiskDB{err: errors.New("some error from DB")})
+		_, err := rl.PurgeDeleted(context.Background())
+		assert.Equal(t, errors.New("some error from DB"), err)
+	})
+}
+
+func TestRiskLogic_Rescore(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("successfully rescore the risks stored under other scoring settings", func(t *testing.T) {
+		riskDB := memory.NewRisksDB()
+		rl := NewRiskLogic(riskDB)
+		// rated like the risks stored before scoring, and like a risk rated under the current settings
+		backfilled, err := riskDB.Add(ctx, data.Risk{ID: uuid.New(), Title: "threat 1", State: "open", Likelihood: 3, Impact: 3, ResidualLikelihood: 3, ResidualImpact: 3, InherentScore: 9, ResidualScore: 9, Severity: data.SeverityMedium})
+		assert.Nil(t, err)
+		rated, err := riskDB.Add(ctx, data.Risk{ID: uuid.New(), Title: "threat 2", State: "open", Likelihood: 2, Impact: 1, ResidualLikelihood: 1, ResidualImpact: 1, InherentScore: 2, ResidualScore: 1, Severity: data.SeverityLow})
+		assert.Nil(t, err)
+		withScoring(t, 2, 2, 3, 4)
+
+		rescored, err := rl.Rescore(ctx)
+		assert.Nil(t, err)
+		assert.Equal(t, int64(1), rescored)
+
+		actual, err := rl.GetByID(ctx, backfilled.ID)
+		assert.Nil(t, err)
+		assert.Equal(t, []int{2, 2, 2, 2, 4, 4}, []int{actual.Likelihood, actual.Impact, actual.ResidualLikelihood, actual.ResidualImpact, actual.InherentScore, actual.ResidualScore})
+		assert.Equal(t, data.SeverityCritical, actual.Severity)
+		assert.Equal(t, SystemActor, actual.UpdatedBy)
+		assert.Nil(t, actual.Validate(riskLimits()))
+
+		actual, err = rl.GetByID(ctx, rated.ID)
+		assert.Nil(t, err)
+		assert.Equal(t, rated, actual)
+	})
+	t.Run("successfully rescore the severity after a change of the bands", func(t *testing.T) {
+		rl := NewRiskLogic(memory.NewRisksDB())
+		added, err := rl.Add(ctx, data.Risk{Title: "threat 1", State: "open", Likelihood: 2, Impact: 3})
+		assert.Nil(t, err)
+		assert.Equal(t, data.SeverityMedium, added.Severity)
+		withScoring(t, 5, 2, 6, 12)
+
+		rescored, err := rl.Rescore(ctx)
+		assert.Nil(t, err)
+		assert.Equal(t, int64(1), rescored)
+		actual, err := rl.GetByID(ctx, added.ID)
+		assert.Nil(t, err)
+		assert.Equal(t, data.SeverityHigh, actual.Severity)
+
+		rescored, err = rl.Rescore(ctx)
+		assert.Nil(t, err)
+		assert.Equal(t, int64(0), rescored)
+	})
+	t.Run("successfully rescore the risks of every page", func(t *testing.T) {
+		rl := NewRiskLogic(memory.NewRisksDB())
+		for i := 0; i <= rescorePageSize; i++ {
+			_, err := rl.Add(ctx, data.Risk{Title: fmt.Sprintf("threat %d", i), State: "open", Likelihood: 2, Impact: 3})
+			assert.Nil(t, err)
+		}
+		withScoring(t, 5, 2, 6, 12)
+
+		rescored, err := rl.Rescore(ctx)
+		assert.Nil(t, err)
+		assert.Equal(t, int64(rescorePageSize+1), rescored)
+	})
+	t.Run("failed to rescore the risks, some error from db", func(t *testing.T) {
+		rl := NewRiskLogic(mockRiskDB{err: errors.New("some error from DB")})
+		_, err := rl.Rescore(ctx)
+		assert.Equal(t, errors.New("some error from DB"), err)
+	})
+}
+
+// withScoring configures the scale and severity bands for the rest of the test
+func withScoring(t *testing.T, scale, medium, high, critical int) {
+	risks := config.Global.Risks
+	t.Cleanup(func() { config.Global.Risks = risks })
+	config.Global.Risks.ScoreScale = scale
+	config.Global.Risks.SeverityScores.Medium, config.Global.Risks.SeverityScores.High, config.Global.Risks.SeverityScores.Critical = medium, high, critical
 }
 
 type mockRiskDB struct {
 	risk          data.Risk
 	err           error
 	paginatedRisk data.PaginatedResponse
+	purged        int64
+	history       []data.HistoryEntry
+	users         []data.User
 }
 
-func (m mockRiskDB) Add(ctx context.Context, risk data.Risk) error {
-	return m.err
+func (m mockRiskDB) Add(ctx context.Context, risk data.Risk) (data.Risk, error) {
+	if m.err != nil {
+		return data.Risk{}, m.err
+	}
+	return risk, nil
+}
+
+func (m mockRiskDB) AddIdempotent(ctx context.Context, risk data.Risk, key data.IdempotencyKey) (data.Risk, bool, error) {
+	if m.err != nil {
+		return data.Risk{}, false, m.err
+	}
+	return risk, false, nil
 }
 
 func (m mockRiskDB) GetByID(ctx context.Context, ID uuid.UUID) (data.Risk, error) {
@@ -156,3 +1155,92 @@ func (m mockRiskDB) GetByID(ctx context.Context, ID uuid.UUID) (data.Risk, error
 func (m mockRiskDB) GetAll(ctx context.Context, options data.Options) (data.PaginatedResponse, error) {
 	return m.paginatedRisk, m.err
 }
+
+func (m mockRiskDB) Search(ctx context.Context, query string, options data.Options) (data.SearchResponse, error) {
+	return data.SearchResponse{}, m.err
+}
+
+func (m mockRiskDB) Update(ctx context.Context, risk data.Risk) (data.Risk, error) {
+	if m.err != nil {
+		return data.Risk{}, m.err
+	}
+	return risk, nil
+}
+
+func (m mockRiskDB) SoftDeleteByID(ctx context.Context, ID uuid.UUID, version int64) error {
+	return m.err
+}
+
+func (m mockRiskDB) GetDeleted(ctx context.Context, options data.Options) (data.PaginatedResponse, error) {
+	return m.paginatedRisk, m.err
+}
+
+func (m mockRiskDB) RestoreByID(ctx context.Context, ID uuid.UUID) error {
+	return m.err
+}
+
+func (m mockRiskDB) PurgeDeletedBefore(ctx context.Context, before time.Time) (int64, error) {
+	return m.purged, m.err
+}
+
+func (m mockRiskDB) PurgeExpiredIdempotencyKeys(ctx context.Context, before time.Time) (int64, error) {
+	return m.purged, m.err
+}
+
+func (m mockRiskDB) Export(ctx context.Context, options data.Options, write func(risk data.Risk) error) error {
+	if m.err != nil {
+		return m.err
+	}
+	return write(m.risk)
+}
+
+func (m mockRiskDB) CountByRatings(ctx context.Context, options data.HeatMapOptions) ([]data.HeatMapCell, error) {
+	return nil, m.err
+}
+
+func (m mockRiskDB) GetByExternalRefs(ctx context.Context, refs []string) ([]data.Risk, error) {
+	return nil, m.err
+}
+
+func (m mockRiskDB) Batch(ctx context.Context, operations []data.BatchOperation, mode data.BatchMode, check data.BatchCheck) ([]data.BatchResult, error) {
+	return nil, m.err
+}
+
+func (m mockRiskDB) GetHistory(ctx context.Context, ID uuid.UUID) ([]data.HistoryEntry, error) {
+	return m.history, m.err
+}
+
+func (m mockRiskDB) AddUser(ctx context.Context, user data.User) (data.User, error) {
+	if m.err != nil {
+		return data.User{}, m.err
+	}
+	return user, nil
+}
+
+func (m mockRiskDB) GetUser(ctx context.Context, ID string) (data.User, error) {
+	for _, user := range m.users {
+		if user.ID == ID {
+			return user, m.err
+		}
+	}
+	return data.User{}, data.Errorf(data.ErrNotFound, "user with ID: %s not found", ID)
+}
+
+func (m mockRiskDB) GetUsers(ctx context.Context, filter data.UserFilter) ([]data.User, error) {
+	return m.users, m.err
+}
+
+func (m mockRiskDB) UpdateUser(ctx context.Context, user data.User) (data.User, error) {
+	if m.err != nil {
+		return data.User{}, m.err
+	}
+	return user, nil
+}
+
+func intPtr(i int) *int {
+	return &i
+}
+
+func strPtr(s string) *string {
+	return &s
+}
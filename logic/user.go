@@ -0,0 +1,63 @@
+package logic
+
+import (
+	"context"
+	"log/slog"
+	"stan-project/data"
+)
+
+type (
+	// UserDB stores the users who own risks or are assigned to them, see the postgres and in-memory implementations.
+	// AddUser fails with data.ErrConflict when a user with the same ID exists.
+	UserDB interface {
+		AddUser(ctx context.Context, user data.User) (data.User, error)
+		GetUser(ctx context.Context, ID string) (data.User, error)
+		// GetUsers lists the users matching the filter, ordered by ID
+		GetUsers(ctx context.Context, filter data.UserFilter) ([]data.User, error)
+		UpdateUser(ctx context.Context, user data.User) (data.User, error)
+	}
+	userLogic struct {
+		userDB UserDB
+	}
+)
+
+func NewUserLogic(userDB UserDB) *userLogic {
+	return &userLogic{userDB: userDB}
+}
+
+func (u *userLogic) Add(ctx context.Context, user data.User) (data.User, error) {
+	if err := user.Validate(); err != nil {
+		slog.Warn("given user is invalid", "err", err)
+		return data.User{}, err
+	}
+
+	added, err := u.userDB.AddUser(ctx, user)
+	if err != nil {
+		slog.Error("error adding user", "id", user.ID, "err", err)
+		return data.User{}, err
+	}
+	return added, nil
+}
+
+func (u *userLogic) GetByID(ctx context.Context, ID string) (data.User, error) {
+	return u.userDB.GetUser(ctx, ID)
+}
+
+func (u *userLogic) GetAll(ctx context.Context, filter data.UserFilter) ([]data.User, error) {
+	return u.userDB.GetUsers(ctx, filter)
+}
+
+// Update changes the name, email and activity of a user. Deactivating a user does not unassign their risks.
+func (u *userLogic) Update(ctx context.Context, user data.User) (data.User, error) {
+	if err := user.Validate(); err != nil {
+		slog.Warn("given user is invalid", "err", err)
+		return data.User{}, err
+	}
+
+	updated, err := u.userDB.UpdateUser(ctx, user)
+	if err != nil {
+		slog.Error("error updating user", "id", user.ID, "err", err)
+		return data.User{}, err
+	}
+	return updated, nil
+}
@@ -0,0 +1,62 @@
+package logic
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"stan-project/data"
+	"stan-project/db/memory"
+	"testing"
+)
+
+func TestUserLogic(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("successfully add, update and list users", func(t *testing.T) {
+		ul := NewUserLogic(memory.NewRisksDB())
+
+		added, err := ul.Add(ctx, data.User{ID: "alice", Name: "Alice", Email: "alice@example.com", Active: true})
+		assert.Nil(t, err)
+		assert.False(t, added.CreatedAt.IsZero())
+		_, err = ul.Add(ctx, data.User{ID: "bob", Name: "Bob", Active: true})
+		assert.Nil(t, err)
+
+		added.Active = false
+		updated, err := ul.Update(ctx, added)
+		assert.Nil(t, err)
+		assert.False(t, updated.Active)
+
+		active := true
+		users, err := ul.GetAll(ctx, data.UserFilter{Active: &active})
+		assert.Nil(t, err)
+		if assert.Len(t, users, 1) {
+			assert.Equal(t, "bob", users[0].ID)
+		}
+		user, err := ul.GetByID(ctx, "alice")
+		assert.Nil(t, err)
+		assert.Equal(t, updated, user)
+	})
+	t.Run("failed to add a user, invalid fields", func(t *testing.T) {
+		ul := NewUserLogic(memory.NewRisksDB())
+
+		_, err := ul.Add(ctx, data.User{ID: " alice", Email: "alice"})
+		assert.Equal(t, &data.ValidationError{Fields: []data.FieldError{
+			{Field: "id", Message: "must not start or end with spaces"},
+			{Field: "name", Message: "is required"},
+			{Field: "email", Message: `must be an email address but received "alice"`},
+		}}, err)
+	})
+	t.Run("failed to add a user, the user exists", func(t *testing.T) {
+		ul := NewUserLogic(memory.NewRisksDB())
+
+		_, err := ul.Add(ctx, data.User{ID: "alice", Name: "Alice"})
+		assert.Nil(t, err)
+		_, err = ul.Add(ctx, data.User{ID: "alice", Name: "Alice again"})
+		assert.ErrorIs(t, err, data.ErrConflict)
+	})
+	t.Run("failed to update a user, user not found", func(t *testing.T) {
+		ul := NewUserLogic(memory.NewRisksDB())
+
+		_, err := ul.Update(ctx, data.User{ID: "alice", Name: "Alice"})
+		assert.ErrorIs(t, err, data.ErrNotFound)
+	})
+}
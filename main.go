@@ -3,11 +3,16 @@ package main
 import (
 	"context"
 	"fmt"
-	"log"
+	"io"
+	"log/slog"
 	"net/http"
 	"os"
 	"os/signal"
+	"stan-project/cmd/config"
+	"stan-project/data"
 	"stan-project/db"
+	"stan-project/db/memory"
+	"stan-project/db/sqlite"
 	"stan-project/handler"
 	"stan-project/logic"
 	"syscall"
@@ -18,31 +23,51 @@ func main() {
 
 	ctx := context.Background()
 
-	log.Printf("Initializing DB...")
-
-	postgresDB, err := db.InitDB(ctx)
+	cfg, args, err := config.Load(os.Args[1:])
 	if err != nil {
-		panic(fmt.Sprintf("error initializing postgres DB: %s", err))
+		slog.Error("invalid configuration", "err", err)
+		os.Exit(1)
 	}
+	config.Global = cfg
+
+	level, _ := cfg.SlogLevel()
+	slog.SetDefault(slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: level})))
 
-	log.Printf("Running migrations...")
+	if len(args) > 0 {
+		if err = runCommand(ctx, args, os.Stdout); err != nil {
+			slog.Error("command failed", "command", args[0], "err", err)
+			os.Exit(1)
+		}
+		return
+	}
 
-	err = postgresDB.RunMigrations(ctx)
+	riskDB, dbStats, closeStorage, err := openStorage(ctx)
 	if err != nil {
-		panic(fmt.Sprintf("error running migrations"))
+		panic(err.Error())
 	}
 
-	riskDB := db.NewRisksDB(postgresDB)
 	riskLogic := logic.NewRiskLogic(riskDB)
 	riskHandler := handler.NewRiskHandler(riskLogic)
+	userHandler := handler.NewUserHandler(logic.NewUserLogic(riskDB))
 
-	log.Printf("Starting HTTP server...")
+	purgeCtx, stopPurge := context.WithCancel(ctx)
+	defer stopPurge()
+	go purgePeriodically(purgeCtx, "deleted risks", riskLogic.PurgeDeleted, time.Hour)
+	go purgePeriodically(purgeCtx, "expired idempotency keys", riskLogic.PurgeExpiredIdempotencyKeys, time.Hour)
 
-	h := handler.NewHandler(riskHandler)
+	if cfg.HTTP.GatewaySecret == "" {
+		slog.Warn("no gateway secret is configured, the X-Actor header is ignored and every request is anonymous")
+	}
+	slog.Info("Starting HTTP server")
+
+	h := handler.NewHandler(riskHandler, userHandler, dbStats)
 	router := handler.NewRouter(h)
 	httpServer := &http.Server{
-		Addr:    ":8080",
-		Handler: router,
+		Addr:         cfg.HTTP.ListenAddress,
+		Handler:      router,
+		ReadTimeout:  cfg.HTTP.ReadTimeout,
+		WriteTimeout: cfg.HTTP.WriteTimeout,
+		IdleTimeout:  cfg.HTTP.IdleTimeout,
 	}
 
 	terminationChannel := make(chan os.Signal, 1)
@@ -56,28 +81,108 @@ func main() {
 
 	sig := <-terminationChannel
 
-	log.Printf("Termination signal '%s' received, initiating graceful shutdown...", sig.String())
+	slog.Info("Termination signal received, initiating graceful shutdown", "signal", sig.String())
 
-	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(25)*time.Second)
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.HTTP.ShutdownTimeout)
 	defer cancel()
 
-	shutdownGracefully(ctx, httpServer, postgresDB.Close)
+	stopPurge()
+	shutdownGracefully(ctx, httpServer, closeStorage)
+}
+
+// runCommand runs the subcommand given on the command line instead of the HTTP server
+func runCommand(ctx context.Context, args []string, out io.Writer) error {
+	switch args[0] {
+	case "migrate":
+		return runMigrate(ctx, args[1:], out)
+	case "import":
+		return runImport(ctx, args[1:], out)
+	case "rescore":
+		return runRescore(ctx, args[1:], out)
+	case "config":
+		if len(args) != 2 || args[1] != "print" {
+			return fmt.Errorf("usage: config print")
+		}
+		printed, err := config.Global.Redacted()
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprint(out, printed)
+		return err
+	}
+	return fmt.Errorf("unknown command %q, expected migrate, import, rescore or config", args[0])
+}
+
+// openStorage opens the configured storage and migrates its schema. dbStats is nil for the storages without a pool.
+func openStorage(ctx context.Context) (riskDB logic.RiskDB, dbStats interface{ Stats() data.PoolStats }, closeStorage func(ctx context.Context) error, err error) {
+	closeStorage = func(ctx context.Context) error { return nil }
+	switch config.Global.Storage {
+	case config.StorageMemory:
+		slog.Info("Using the in-memory storage, the risks are lost when the service stops")
+		return memory.NewRisksDB(), nil, closeStorage, nil
+	case config.StorageSQLite:
+		slog.Info("Opening SQLite database", "path", config.Global.SQLite.Path)
+
+		sqliteDB, err := sqlite.InitDB(ctx)
+		if err != nil {
+			return nil, nil, nil, fmt.Errorf("error opening sqlite DB: %w", err)
+		}
+		if err = sqliteDB.RunMigrations(ctx); err != nil {
+			sqliteDB.Close(ctx)
+			return nil, nil, nil, fmt.Errorf("error running migrations: %w", err)
+		}
+
+		return sqlite.NewRisksDB(sqliteDB), nil, sqliteDB.Close, nil
+	default:
+		slog.Info("Initializing DB")
+
+		postgresDB, err := db.InitDB(ctx)
+		if err != nil {
+			return nil, nil, nil, fmt.Errorf("error initializing postgres DB: %w", err)
+		}
+
+		slog.Info("Running migrations")
+
+		if err = postgresDB.RunMigrations(ctx); err != nil {
+			postgresDB.Close(ctx)
+			return nil, nil, nil, fmt.Errorf("error running migrations: %w", err)
+		}
+
+		return db.NewRisksDB(postgresDB), postgresDB, postgresDB.Close, nil
+	}
+}
+
+// purgePeriodically periodically deletes what has expired, e.g. the risks whose trash retention period has expired
+func purgePeriodically(ctx context.Context, what string, purge func(ctx context.Context) (int64, error), interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := purge(ctx); err != nil {
+				slog.Error("failed to purge", "what", what, "err", err)
+			}
+		}
+	}
 }
 
-func shutdownGracefully(ctx context.Context, httpServer *http.Server, postgresClose func(ctx context.Context) error) {
+func shutdownGracefully(ctx context.Context, httpServer *http.Server, closeStorage func(ctx context.Context) error) {
 	//shutdown HTTP server
 	if err := httpServer.Shutdown(ctx); err != nil {
-		log.Printf("failed to gracefully shutdown HTTP server: %s", err)
+		slog.Error("failed to gracefully shutdown HTTP server", "err", err)
 	} else {
-		log.Printf("successfully and gracefully shutdown HTTP server.")
+		slog.Info("successfully and gracefully shutdown HTTP server")
 	}
 
-	err := postgresClose(ctx)
+	err := closeStorage(ctx)
 	if err != nil {
-		log.Printf("failed to gracefully close postgres connection")
+		slog.Error("failed to gracefully close the storage")
 	} else {
-		log.Printf("successfully and gracefully closed postgres connection")
+		slog.Info("successfully and gracefully closed the storage")
 	}
 
-	log.Printf("Exiting Risks service.....")
+	slog.Info("Exiting Risks service")
 }
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"stan-project/cmd/config"
+	"stan-project/db"
+	"text/tabwriter"
+	"time"
+)
+
+const migrateUsage = `usage: migrate <command>
+
+commands:
+  up                apply every pending migration
+  down [-steps n]   revert the last n applied migrations (default 1)
+  status            list the migrations and whether they are applied`
+
+// runMigrate runs the migrate subcommand against the configured database
+func runMigrate(ctx context.Context, args []string, out io.Writer) error {
+	if len(args) == 0 {
+		return fmt.Errorf("missing migrate command\n%s", migrateUsage)
+	}
+
+	command, args := args[0], args[1:]
+	if command != "up" && command != "down" && command != "status" {
+		return fmt.Errorf("unknown migrate command %q\n%s", command, migrateUsage)
+	}
+
+	flags := flag.NewFlagSet("migrate "+command, flag.ContinueOnError)
+	flags.SetOutput(out)
+	steps := 1
+	if command == "down" {
+		flags.IntVar(&steps, "steps", 1, "number of migrations to revert")
+	}
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() > 0 || steps < 1 {
+		return fmt.Errorf("invalid arguments for migrate %s\n%s", command, migrateUsage)
+	}
+
+	if config.Global.Storage != config.StoragePostgres {
+		return fmt.Errorf("the migrate command manages the %s storage but the storage is %s, the sqlite storage is migrated when the service starts", config.StoragePostgres, config.Global.Storage)
+	}
+
+	postgresDB, err := db.InitDB(ctx)
+	if err != nil {
+		return fmt.Errorf("error initializing postgres DB: %w", err)
+	}
+	defer postgresDB.Close(ctx)
+
+	switch command {
+	case "up":
+		applied, err := postgresDB.MigrateUp(ctx)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "applied %d migrations\n", applied)
+	case "down":
+		reverted, err := postgresDB.MigrateDown(ctx, steps)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "reverted %d migrations\n", reverted)
+	case "status":
+		statuses, err := postgresDB.MigrationStatus(ctx)
+		if err != nil {
+			return err
+		}
+		w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "VERSION\tNAME\tSTATE\tAPPLIED AT")
+		for _, s := range statuses {
+			appliedAt := "-"
+			if s.AppliedAt != nil {
+				appliedAt = s.AppliedAt.Format(time.RFC3339)
+			}
+			fmt.Fprintf(w, "%04d\t%s\t%s\t%s\n", s.Version, s.Name, s.State, appliedAt)
+		}
+		return w.Flush()
+	}
+	return nil
+}
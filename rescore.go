@@ -0,0 +1,40 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"stan-project/cmd/config"
+	"stan-project/data"
+	"stan-project/logic"
+)
+
+const rescoreUsage = `usage: rescore
+
+Scores the stored risks again with the configured score scale and severity bands. Run it once after changing them, the
+risks written since are scored with the new settings but the stored ones keep their scores until they are rescored.`
+
+// runRescore runs the rescore subcommand, scoring the risks of the configured storage again with the configured scoring
+func runRescore(ctx context.Context, args []string, out io.Writer) error {
+	if len(args) != 0 {
+		return fmt.Errorf("invalid arguments for rescore\n%s", rescoreUsage)
+	}
+
+	if config.Global.Storage == config.StorageMemory {
+		return fmt.Errorf("the rescore command needs a persistent storage but the storage is %s", config.Global.Storage)
+	}
+
+	riskDB, _, closeStorage, err := openStorage(ctx)
+	if err != nil {
+		return err
+	}
+	defer closeStorage(ctx)
+
+	ctx = data.WithAudit(ctx, data.Audit{Actor: logic.SystemActor})
+	rescored, err := logic.NewRiskLogic(riskDB).Rescore(ctx)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(out, "rescored %d risks\n", rescored)
+	return err
+}